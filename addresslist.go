@@ -0,0 +1,315 @@
+package kiwi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Offset is a pointer chain offset, saved in hex (e.g. "0x18").
+type Offset int64
+
+// MarshalText implements encoding.TextMarshaler.
+func (o Offset) MarshalText() ([]byte, error) {
+	if o < 0 {
+		return []byte(fmt.Sprintf("-0x%X", -int64(o))), nil
+	}
+	return []byte(fmt.Sprintf("0x%X", int64(o))), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (o *Offset) UnmarshalText(text []byte) error {
+	v, err := strconv.ParseInt(strings.TrimSpace(string(text)), 0, 64)
+	if err != nil {
+		return fmt.Errorf("invalid offset %q", text)
+	}
+	*o = Offset(v)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, accepting both strings and plain numbers.
+func (o *Offset) UnmarshalJSON(data []byte) error {
+	return o.UnmarshalText([]byte(strings.Trim(string(data), `"`)))
+}
+
+// AddressEntry is a labelled address in an AddressList.
+//
+// The address is given as an address expression (see ParseExpr), such as "game.exe+0x1A2B30",
+// so that entries keep working when modules are loaded at a different address.
+// If Offsets are given, the address is treated as the start of a pointer chain:
+// for each offset, the pointer at the current address is read and the offset added to it.
+type AddressEntry struct {
+	Description string    `json:"description" yaml:"description"`
+	Group       string    `json:"group,omitempty" yaml:"group,omitempty"`
+	Address     string    `json:"address" yaml:"address"`
+	Offsets     []Offset  `json:"offsets,omitempty" yaml:"offsets,omitempty"`
+	Type        ValueType `json:"type" yaml:"type"`
+
+	// Size is the number of bytes for TypeBytes entries.
+	Size int `json:"size,omitempty" yaml:"size,omitempty"`
+
+	// Freeze is the value to freeze the entry to, in the form accepted by ParseValue.
+	// Empty if the entry shouldn't be frozen.
+	Freeze string `json:"freeze,omitempty" yaml:"freeze,omitempty"`
+}
+
+// Resolve returns the address of the entry in the process.
+func (e *AddressEntry) Resolve(p *Process, vars Vars) (uintptr, error) {
+	addr, err := p.EvalWith(e.Address, vars)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, off := range e.Offsets {
+		ptr, err := p.ReadPointer(addr)
+		if err != nil {
+			return 0, fmt.Errorf("ReadPointer 0x%X: %w", addr, err)
+		}
+		addr = ptr + uintptr(off)
+	}
+	return addr, nil
+}
+
+// Read resolves the entry and reads its value.
+func (e *AddressEntry) Read(p *Process, vars Vars) (interface{}, error) {
+	addr, err := e.Resolve(p, vars)
+	if err != nil {
+		return nil, err
+	}
+	if e.Type == TypeBytes {
+		return p.ReadBytes(addr, e.Size)
+	}
+	return p.ReadValue(addr, e.Type)
+}
+
+// Write resolves the entry and writes v to it.
+// v must be of the Go type matching the entry's type.
+func (e *AddressEntry) Write(p *Process, vars Vars, v interface{}) error {
+	if t, err := TypeOf(v); err != nil || t != e.Type {
+		return fmt.Errorf("can't write %T to %v entry %q", v, e.Type, e.Description)
+	}
+
+	addr, err := e.Resolve(p, vars)
+	if err != nil {
+		return err
+	}
+	return p.WriteValue(addr, v)
+}
+
+// FreezeValue returns the parsed freeze value of the entry, or nil if it has none.
+func (e *AddressEntry) FreezeValue() (interface{}, error) {
+	if e.Freeze == "" {
+		return nil, nil
+	}
+	return ParseValue(e.Type, e.Freeze)
+}
+
+// SymbolEntry is a named address which entries of an AddressList can refer to in their address expressions.
+//
+// The address is either given as an address expression, or found by scanning for a byte pattern
+// (see ParsePattern), optionally within a module. Symbols can refer to symbols defined before them.
+type SymbolEntry struct {
+	Name    string `json:"name" yaml:"name"`
+	Address string `json:"address,omitempty" yaml:"address,omitempty"`
+	Pattern string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	Module  string `json:"module,omitempty" yaml:"module,omitempty"`
+}
+
+// Resolve returns the address of the symbol in the process.
+// For pattern symbols, this is the address of the first match.
+func (s *SymbolEntry) Resolve(p *Process, vars Vars) (uintptr, error) {
+	if s.Pattern == "" {
+		return p.EvalWith(s.Address, vars)
+	}
+
+	pat, err := ParsePattern(s.Pattern)
+	if err != nil {
+		return 0, err
+	}
+	matches, err := p.FindPattern(pat, &ScanOptions{Module: s.Module, Limit: 1})
+	if err != nil {
+		return 0, err
+	}
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("couldn't find pattern %s", pat)
+	}
+	return matches[0], nil
+}
+
+// AddressList is a saveable list of labelled addresses.
+type AddressList struct {
+	Symbols []*SymbolEntry  `json:"symbols,omitempty" yaml:"symbols,omitempty"`
+	Entries []*AddressEntry `json:"entries" yaml:"entries"`
+}
+
+// ResolveSymbols resolves the symbols of the list in order, returning them as variables
+// for address expressions. Symbols which fail to resolve are left out, and the first
+// failure is returned along with the symbols which did resolve.
+func (l *AddressList) ResolveSymbols(p *Process) (Vars, error) {
+	vars := make(Vars, len(l.Symbols))
+	var firstErr error
+	for _, s := range l.Symbols {
+		addr, err := s.Resolve(p, vars)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("symbol %q: %w", s.Name, err)
+			}
+			continue
+		}
+		vars[s.Name] = addr
+	}
+	return vars, firstErr
+}
+
+// ResolvedEntry is an AddressEntry resolved against a process.
+type ResolvedEntry struct {
+	*AddressEntry
+	Addr uintptr
+	Err  error
+}
+
+// Resolve resolves the symbols and then every entry of the list against the process.
+// Entries which fail to resolve have Err set.
+// The returned error is the first symbol which failed to resolve, if any.
+func (l *AddressList) Resolve(p *Process) ([]ResolvedEntry, error) {
+	vars, err := l.ResolveSymbols(p)
+
+	resolved := make([]ResolvedEntry, len(l.Entries))
+	for i, e := range l.Entries {
+		addr, err := e.Resolve(p, vars)
+		resolved[i] = ResolvedEntry{AddressEntry: e, Addr: addr, Err: err}
+	}
+	return resolved, err
+}
+
+// Groups returns the names of the groups in the list, in order of first appearance.
+func (l *AddressList) Groups() []string {
+	var groups []string
+	seen := make(map[string]bool)
+	for _, e := range l.Entries {
+		if !seen[e.Group] {
+			seen[e.Group] = true
+			groups = append(groups, e.Group)
+		}
+	}
+	return groups
+}
+
+// Group returns the entries in the named group.
+func (l *AddressList) Group(name string) []*AddressEntry {
+	var entries []*AddressEntry
+	for _, e := range l.Entries {
+		if e.Group == name {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Freeze resolves the entries with a freeze value and adds them to the Freezer.
+func (l *AddressList) Freeze(p *Process, f *Freezer) ([]*FreezeEntry, error) {
+	vars, err := l.ResolveSymbols(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var frozen []*FreezeEntry
+	for _, e := range l.Entries {
+		v, err := e.FreezeValue()
+		if err != nil {
+			return frozen, fmt.Errorf("entry %q: %w", e.Description, err)
+		}
+		if v == nil {
+			continue
+		}
+
+		addr, err := e.Resolve(p, vars)
+		if err != nil {
+			return frozen, fmt.Errorf("entry %q: %w", e.Description, err)
+		}
+		fe, err := f.Add(addr, v)
+		if err != nil {
+			return frozen, fmt.Errorf("entry %q: %w", e.Description, err)
+		}
+		frozen = append(frozen, fe)
+	}
+	return frozen, nil
+}
+
+// ReadAddressListJSON reads an address list in JSON format.
+func ReadAddressListJSON(r io.Reader) (*AddressList, error) {
+	var l AddressList
+	if err := json.NewDecoder(r).Decode(&l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// ReadAddressListYAML reads an address list in YAML format.
+func ReadAddressListYAML(r io.Reader) (*AddressList, error) {
+	var l AddressList
+	if err := yaml.NewDecoder(r).Decode(&l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// WriteJSON writes the address list in JSON format.
+func (l *AddressList) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(l)
+}
+
+// WriteYAML writes the address list in YAML format.
+func (l *AddressList) WriteYAML(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	defer enc.Close()
+	return enc.Encode(l)
+}
+
+// isYAMLPath reports whether the path has a YAML file extension.
+func isYAMLPath(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// LoadAddressList loads an address list from a file.
+// Files ending in .yaml or .yml are read as YAML, all others as JSON.
+func LoadAddressList(path string) (*AddressList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if isYAMLPath(path) {
+		return ReadAddressListYAML(f)
+	}
+	return ReadAddressListJSON(f)
+}
+
+// Save saves the address list to a file.
+// Files ending in .yaml or .yml are written as YAML, all others as JSON.
+func (l *AddressList) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if isYAMLPath(path) {
+		err = l.WriteYAML(f)
+	} else {
+		err = l.WriteJSON(f)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,119 @@
+package kiwi
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestAddressListRoundTrip(t *testing.T) {
+	l := &AddressList{Entries: []*AddressEntry{
+		{Description: "Health", Group: "Player", Address: "game.exe+0x1A2B30", Offsets: []Offset{0x18, -0x8}, Type: TypeFloat32, Freeze: "100"},
+		{Description: "Code", Group: "Patches", Address: "game.exe+0x400", Type: TypeBytes, Size: 3},
+	}}
+
+	formats := []struct {
+		name  string
+		write func(*AddressList, *bytes.Buffer) error
+		read  func(*bytes.Buffer) (*AddressList, error)
+	}{
+		{
+			name:  "json",
+			write: func(l *AddressList, b *bytes.Buffer) error { return l.WriteJSON(b) },
+			read:  func(b *bytes.Buffer) (*AddressList, error) { return ReadAddressListJSON(b) },
+		},
+		{
+			name:  "yaml",
+			write: func(l *AddressList, b *bytes.Buffer) error { return l.WriteYAML(b) },
+			read:  func(b *bytes.Buffer) (*AddressList, error) { return ReadAddressListYAML(b) },
+		},
+	}
+
+	for _, f := range formats {
+		t.Run(f.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := f.write(l, &buf); err != nil {
+				t.Fatalf("write: %s\n", err)
+			}
+			if !strings.Contains(buf.String(), "0x18") || !strings.Contains(buf.String(), "float32") {
+				t.Fatalf("Offsets and types should be saved readably, got:\n%s\n", buf.String())
+			}
+
+			got, err := f.read(&buf)
+			if err != nil {
+				t.Fatalf("read: %s\n", err)
+			}
+			if !reflect.DeepEqual(got, l) {
+				t.Fatalf("Round trip mismatch. Got: %+v, Expected: %+v\n", got.Entries[0], l.Entries[0])
+			}
+		})
+	}
+}
+
+func TestAddressListJSONNumbers(t *testing.T) {
+	l, err := ReadAddressListJSON(strings.NewReader(`{"entries": [{"address": "0x10", "offsets": [24, "0x8"], "type": "uint32"}]}`))
+	if err != nil {
+		t.Fatalf("ReadAddressListJSON: %s\n", err)
+	}
+	if want := []Offset{24, 8}; !reflect.DeepEqual(l.Entries[0].Offsets, want) {
+		t.Fatalf("Offsets got %v, expected %v\n", l.Entries[0].Offsets, want)
+	}
+}
+
+func TestAddressListResolve(t *testing.T) {
+	p, err := GetProcessByFileName(currentProcessName)
+	if err != nil {
+		t.Fatalf("Error trying to open process \"%s\", Error: %s\n", currentProcessName, err.Error())
+	}
+
+	type player struct {
+		pad    [3]uint64
+		health float32
+	}
+	pl := &player{health: 50}
+	root := &pl
+	heapSink = root
+
+	l := &AddressList{Entries: []*AddressEntry{
+		{
+			Description: "Health",
+			Address:     fmt.Sprintf("0x%X", uintptr(unsafe.Pointer(root))),
+			Offsets:     []Offset{0x18},
+			Type:        TypeFloat32,
+			Freeze:      "100",
+		},
+		{Description: "Broken", Address: "no_such_module.so+0x10", Type: TypeUint32},
+	}}
+
+	resolved, err := l.Resolve(&p)
+	if err != nil {
+		t.Fatalf("Resolve: %s\n", err)
+	}
+	if resolved[0].Err != nil || resolved[0].Addr != uintptr(unsafe.Pointer(&pl.health)) {
+		t.Fatalf("Resolve got 0x%X, %v, expected 0x%X\n", resolved[0].Addr, resolved[0].Err, uintptr(unsafe.Pointer(&pl.health)))
+	}
+	if resolved[1].Err == nil {
+		t.Fatalf("Expected error resolving entry with unknown module\n")
+	}
+
+	v, err := l.Entries[0].Read(&p, nil)
+	if err != nil || v != float32(50) {
+		t.Fatalf("Read got %v, %v, expected 50\n", v, err)
+	}
+	if err := l.Entries[0].Write(&p, nil, float32(75)); err != nil || pl.health != 75 {
+		t.Fatalf("Write failed: %v, health is %v\n", err, pl.health)
+	}
+	if err := l.Entries[0].Write(&p, nil, uint32(1)); err == nil {
+		t.Fatalf("Expected error writing a value of the wrong type\n")
+	}
+
+	// Freezing adds only the entries with a freeze value.
+	f := NewFreezer(&p, 0)
+	frozen, err := (&AddressList{Entries: l.Entries[:1]}).Freeze(&p, f)
+	if err != nil || len(frozen) != 1 || frozen[0].Value() != float32(100) {
+		t.Fatalf("Freeze got %v, %v\n", frozen, err)
+	}
+}
@@ -0,0 +1,231 @@
+package kiwi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Mapping maps a range of guest addresses to the host address they are mapped at.
+type Mapping struct {
+	Guest uintptr
+	Host  uintptr
+	Size  uintptr
+}
+
+// UnmappedError is returned when accessing a guest address which isn't covered by any mapping.
+type UnmappedError struct {
+	Addr uintptr
+}
+
+func (e *UnmappedError) Error() string {
+	return fmt.Sprintf("guest address 0x%X is not mapped", e.Addr)
+}
+
+// AddressSpace translates guest addresses to host addresses in a process,
+// such as the emulated RAM of a console inside of an emulator.
+//
+// The guest memory can be accessed through the Process returned by AddressSpace.Process,
+// so that all of kiwi's reads, writes, pointer chains and scans work with guest addresses.
+type AddressSpace struct {
+	host     *Process
+	mappings []Mapping
+}
+
+// NewAddressSpace returns an AddressSpace over the host process with the given mappings.
+func NewAddressSpace(host *Process, mappings ...Mapping) (*AddressSpace, error) {
+	as := &AddressSpace{host: host}
+	for _, m := range mappings {
+		if err := as.Map(m); err != nil {
+			return nil, err
+		}
+	}
+	return as, nil
+}
+
+// Map adds a mapping to the address space.
+// Returns an error if the guest range overlaps an existing mapping.
+func (as *AddressSpace) Map(m Mapping) error {
+	if m.Size == 0 {
+		return errors.New("mapping has zero size")
+	}
+	if m.Guest+m.Size < m.Guest || m.Host+m.Size < m.Host {
+		return errors.New("mapping overflows the address space")
+	}
+
+	for _, e := range as.mappings {
+		if m.Guest < e.Guest+e.Size && e.Guest < m.Guest+m.Size {
+			return fmt.Errorf("guest range 0x%X-0x%X overlaps existing mapping 0x%X-0x%X", m.Guest, m.Guest+m.Size, e.Guest, e.Guest+e.Size)
+		}
+	}
+
+	as.mappings = append(as.mappings, m)
+	sort.Slice(as.mappings, func(i, j int) bool {
+		return as.mappings[i].Guest < as.mappings[j].Guest
+	})
+	return nil
+}
+
+// Mappings returns the mappings of the address space, sorted by guest address.
+func (as *AddressSpace) Mappings() []Mapping {
+	return append([]Mapping(nil), as.mappings...)
+}
+
+// find returns the mapping containing the guest address.
+func (as *AddressSpace) find(guest uintptr) (Mapping, bool) {
+	i := sort.Search(len(as.mappings), func(i int) bool {
+		return as.mappings[i].Guest+as.mappings[i].Size > guest
+	})
+	if i < len(as.mappings) && as.mappings[i].Guest <= guest {
+		return as.mappings[i], true
+	}
+	return Mapping{}, false
+}
+
+// Translate returns the host address of the guest address.
+func (as *AddressSpace) Translate(guest uintptr) (uintptr, error) {
+	m, ok := as.find(guest)
+	if !ok {
+		return 0, &UnmappedError{Addr: guest}
+	}
+	return m.Host + (guest - m.Guest), nil
+}
+
+// Process returns a view of the host process which uses guest addresses.
+//
+// The view inherits the byte order of the host process,
+// use WithByteOrder on the view for big-endian guests.
+func (as *AddressSpace) Process() *Process {
+	view := *as.host
+	view.backend = as
+	return &view
+}
+
+// access calls fn for each host range making up the guest range [addr, addr+len(b)).
+func (as *AddressSpace) access(addr uintptr, b []byte, fn func(host uintptr, b []byte) error) error {
+	for len(b) > 0 {
+		m, ok := as.find(addr)
+		if !ok {
+			return &UnmappedError{Addr: addr}
+		}
+
+		// Split accesses spanning more than one mapping.
+		n := m.Guest + m.Size - addr
+		if n > uintptr(len(b)) {
+			n = uintptr(len(b))
+		}
+
+		if err := fn(m.Host+(addr-m.Guest), b[:n]); err != nil {
+			return err
+		}
+		addr += n
+		b = b[n:]
+	}
+	return nil
+}
+
+// ReadAt reads guest memory at addr into b.
+func (as *AddressSpace) ReadAt(b []byte, addr uintptr) (int, error) {
+	err := as.access(addr, b, func(host uintptr, b []byte) error {
+		return as.host.read(host, &b)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// WriteAt writes b to guest memory at addr.
+func (as *AddressSpace) WriteAt(b []byte, addr uintptr) (int, error) {
+	err := as.access(addr, b, func(host uintptr, b []byte) error {
+		return as.host.write(host, &b)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close does nothing, the host process is owned by the caller.
+func (as *AddressSpace) Close() error {
+	return nil
+}
+
+// Regions returns the guest mappings as regions.
+// Permissions are taken from the host region containing the start of each mapping.
+func (as *AddressSpace) Regions() ([]Region, error) {
+	hostRegions, err := as.host.Regions()
+	if err != nil {
+		return nil, err
+	}
+
+	regions := make([]Region, 0, len(as.mappings))
+	for _, m := range as.mappings {
+		r := Region{Base: m.Guest, Size: m.Size, Perm: PermRead | PermWrite}
+		for _, hr := range hostRegions {
+			if hr.Contains(m.Host) {
+				r.Perm = hr.Perm
+				break
+			}
+		}
+		regions = append(regions, r)
+	}
+	return regions, nil
+}
+
+// MapBySignature searches the host process for signature, a sequence of bytes known to be
+// at guest address sigAddr, and maps the size bytes of guest memory starting at guest
+// relative to where the signature was found.
+//
+// This is useful for emulators which allocate guest RAM at a different host address on every run.
+// The first match whose host region is large enough to hold the whole mapping is used.
+func (as *AddressSpace) MapBySignature(guest, size uintptr, signature []byte, sigAddr uintptr) (Mapping, error) {
+	if sigAddr < guest || sigAddr-guest+uintptr(len(signature)) > size {
+		return Mapping{}, errors.New("signature is outside of the guest range")
+	}
+
+	hostRegions, err := as.host.readableRegions()
+	if err != nil {
+		return Mapping{}, err
+	}
+
+	var found *Mapping
+	as.host.scanRegions(hostRegions, len(signature)-1, func(addr uintptr, data []byte) bool {
+		for off := 0; ; {
+			i := bytes.Index(data[off:], signature)
+			if i == -1 {
+				return true
+			}
+
+			m := Mapping{Guest: guest, Host: addr + uintptr(off+i) - (sigAddr - guest), Size: size}
+			if contiguous(hostRegions, m.Host, m.Size) {
+				found = &m
+				return false
+			}
+			off += i + 1
+		}
+	})
+	if found == nil {
+		return Mapping{}, errors.New("couldn't find signature in host memory")
+	}
+
+	if err := as.Map(*found); err != nil {
+		return Mapping{}, err
+	}
+	return *found, nil
+}
+
+// contiguous reports whether the range [addr, addr+size) is covered by the sorted regions without gaps.
+func contiguous(regions []Region, addr, size uintptr) bool {
+	end := addr + size
+	for _, r := range regions {
+		if r.Contains(addr) {
+			if r.End() >= end {
+				return true
+			}
+			addr = r.End()
+		}
+	}
+	return false
+}
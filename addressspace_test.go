@@ -0,0 +1,103 @@
+package kiwi
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+	"unsafe"
+)
+
+func TestAddressSpace(t *testing.T) {
+	p, err := GetProcessByFileName(currentProcessName)
+	if err != nil {
+		t.Fatalf("Error trying to open process \"%s\", Error: %s\n", currentProcessName, err.Error())
+	}
+
+	// Two separate host buffers acting as contiguous guest RAM.
+	lo := make([]byte, 0x100)
+	hi := make([]byte, 0x100)
+	binary.BigEndian.PutUint32(lo[0xFC:], 0x11223344)
+	copy(hi, []byte{0x55, 0x66, 0x77, 0x88})
+
+	as, err := NewAddressSpace(&p,
+		Mapping{Guest: 0x80000000, Host: uintptr(unsafe.Pointer(&lo[0])), Size: 0x100},
+		Mapping{Guest: 0x80000100, Host: uintptr(unsafe.Pointer(&hi[0])), Size: 0x100},
+	)
+	if err != nil {
+		t.Fatalf("NewAddressSpace: %s\n", err)
+	}
+	guest := as.Process().WithByteOrder(binary.BigEndian)
+
+	v, err := guest.ReadUint32(0x800000FC)
+	if err != nil || v != 0x11223344 {
+		t.Fatalf("ReadUint32 got 0x%X, %v, expected 0x11223344\n", v, err)
+	}
+
+	// Reads spanning two mappings.
+	v64, err := guest.ReadUint64(0x800000FC)
+	if err != nil || v64 != 0x1122334455667788 {
+		t.Fatalf("ReadUint64 got 0x%X, %v, expected 0x1122334455667788\n", v64, err)
+	}
+
+	// Writes.
+	if err := guest.WriteUint16(0x80000104, 0xABCD); err != nil {
+		t.Fatalf("WriteUint16: %s\n", err)
+	}
+	if hi[4] != 0xAB || hi[5] != 0xCD {
+		t.Fatalf("Written value does not match expected. Got: %X\n", hi[4:6])
+	}
+
+	// Unmapped addresses.
+	_, err = guest.ReadUint32(0x80000200)
+	var unmapped *UnmappedError
+	if !errors.As(err, &unmapped) {
+		t.Fatalf("Expected UnmappedError, got %v\n", err)
+	}
+
+	// Overlapping mappings are rejected.
+	if err := as.Map(Mapping{Guest: 0x80000080, Host: 0, Size: 0x10}); err == nil {
+		t.Fatalf("Expected error mapping an overlapping range\n")
+	}
+
+	// Scans return guest addresses.
+	matches, err := guest.FindBytes([]byte{0x44, 0x55, 0x66})
+	if err != nil {
+		t.Fatalf("FindBytes: %s\n", err)
+	}
+	if len(matches) != 1 || matches[0] != 0x800000FF {
+		t.Fatalf("FindBytes got %X, expected [800000FF]\n", matches)
+	}
+}
+
+func TestAddressSpaceMapBySignature(t *testing.T) {
+	p, err := GetProcessByFileName(currentProcessName)
+	if err != nil {
+		t.Fatalf("Error trying to open process \"%s\", Error: %s\n", currentProcessName, err.Error())
+	}
+
+	// Generate the signature at runtime and slice it out of the RAM itself,
+	// so that no other copy of it is in memory.
+	ram := make([]byte, 0x10000)
+	for i := 0; i < 32; i++ {
+		ram[0x20+i] = byte(i*37 + 11)
+	}
+	binary.LittleEndian.PutUint32(ram[0x8000:], 0xFEEDFACE)
+	signature := ram[0x20:0x40]
+
+	as, err := NewAddressSpace(&p)
+	if err != nil {
+		t.Fatalf("NewAddressSpace: %s\n", err)
+	}
+	m, err := as.MapBySignature(0x1000000, 0x10000, signature, 0x1000020)
+	if err != nil {
+		t.Fatalf("MapBySignature: %s\n", err)
+	}
+	if m.Host != uintptr(unsafe.Pointer(&ram[0])) {
+		t.Fatalf("MapBySignature mapped host 0x%X, expected 0x%X\n", m.Host, uintptr(unsafe.Pointer(&ram[0])))
+	}
+
+	v, err := as.Process().ReadUint32(0x1008000)
+	if err != nil || v != 0xFEEDFACE {
+		t.Fatalf("ReadUint32 got 0x%X, %v, expected 0xFEEDFACE\n", v, err)
+	}
+}
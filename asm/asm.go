@@ -0,0 +1,377 @@
+// Package asm is a minimal x86-64 assembler for generating patches and injected stubs.
+//
+// Code is built either with the Builder methods or parsed from Intel syntax text:
+//
+//	code, err := asm.Assemble(`
+//		mov rax, [rip+counter]
+//		add rax, 1
+//		mov [rip+counter], rax
+//		jmp 0x7FF612340000
+//	counter:
+//		dq 0
+//	`, 0x7FF600001000)
+//
+// Branches to labels are always encoded with 32-bit displacements. Branches to absolute
+// addresses which are out of range of a 32-bit displacement are encoded as an indirect
+// jump or call through an address stored after the instruction.
+package asm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Operand is an instruction operand: a Reg, Imm, Mem or Label.
+type Operand interface {
+	String() string
+	operand()
+}
+
+// Reg is a general purpose register.
+type Reg uint8
+
+// Registers. Only the 64-bit and 32-bit general purpose registers are supported.
+const (
+	NoReg Reg = iota
+	RAX
+	RCX
+	RDX
+	RBX
+	RSP
+	RBP
+	RSI
+	RDI
+	R8
+	R9
+	R10
+	R11
+	R12
+	R13
+	R14
+	R15
+	EAX
+	ECX
+	EDX
+	EBX
+	ESP
+	EBP
+	ESI
+	EDI
+	R8D
+	R9D
+	R10D
+	R11D
+	R12D
+	R13D
+	R14D
+	R15D
+	RIP
+)
+
+var regNames = [...]string{
+	"", "rax", "rcx", "rdx", "rbx", "rsp", "rbp", "rsi", "rdi",
+	"r8", "r9", "r10", "r11", "r12", "r13", "r14", "r15",
+	"eax", "ecx", "edx", "ebx", "esp", "ebp", "esi", "edi",
+	"r8d", "r9d", "r10d", "r11d", "r12d", "r13d", "r14d", "r15d",
+	"rip",
+}
+
+func (r Reg) String() string {
+	if int(r) < len(regNames) {
+		return regNames[r]
+	}
+	return fmt.Sprintf("Reg(%d)", r)
+}
+
+// Size returns the size of the register in bytes.
+func (r Reg) Size() int {
+	switch {
+	case r >= RAX && r <= R15, r == RIP:
+		return 8
+	case r >= EAX && r <= R15D:
+		return 4
+	}
+	return 0
+}
+
+// num returns the register number used in encodings.
+func (r Reg) num() byte {
+	if r >= EAX && r <= R15D {
+		return byte(r - EAX)
+	}
+	return byte(r - RAX)
+}
+
+func (Reg) operand() {}
+
+// Imm is an immediate value. As the target of a branch, it's an absolute address.
+type Imm int64
+
+func (i Imm) String() string {
+	if i < 0 {
+		return fmt.Sprintf("-0x%X", -int64(i))
+	}
+	return fmt.Sprintf("0x%X", int64(i))
+}
+
+func (Imm) operand() {}
+
+// Label refers to the address of a label defined with Builder.Label or Builder.Define.
+type Label string
+
+func (l Label) String() string { return string(l) }
+
+func (Label) operand() {}
+
+// Mem is a memory operand, [Base + Index*Scale + Disp].
+//
+// If Label is set, the operand is RIP-relative to the label's address plus Disp,
+// and Base and Index must not be set. A Base of RIP with no label is relative to the
+// end of the instruction.
+type Mem struct {
+	Base  Reg
+	Index Reg
+	Scale int
+	Disp  int64
+	Label Label
+
+	// Size is the size of the memory operand in bytes (4 or 8).
+	// It's only needed when it can't be taken from a register operand.
+	Size int
+}
+
+func (m Mem) String() string {
+	var sb strings.Builder
+	switch m.Size {
+	case 4:
+		sb.WriteString("dword ptr ")
+	case 8:
+		sb.WriteString("qword ptr ")
+	}
+	sb.WriteByte('[')
+	sep := ""
+	if m.Base != NoReg {
+		sb.WriteString(m.Base.String())
+		sep = "+"
+	}
+	if m.Index != NoReg {
+		fmt.Fprintf(&sb, "%s%s*%d", sep, m.Index, m.scale())
+		sep = "+"
+	}
+	if m.Label != "" {
+		if m.Base == NoReg {
+			sb.WriteString("rip")
+		}
+		fmt.Fprintf(&sb, "+%s", m.Label)
+		sep = "+"
+	}
+	if m.Disp < 0 {
+		fmt.Fprintf(&sb, "-0x%X", -m.Disp)
+	} else if m.Disp > 0 || sep == "" {
+		fmt.Fprintf(&sb, "%s0x%X", sep, m.Disp)
+	}
+	sb.WriteByte(']')
+	return sb.String()
+}
+
+func (m Mem) scale() int {
+	if m.Scale == 0 {
+		return 1
+	}
+	return m.Scale
+}
+
+func (Mem) operand() {}
+
+// Error is an error assembling an instruction.
+type Error struct {
+	Line int    // Line of the instruction in parsed text, or 0.
+	Inst string // The instruction.
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Line != 0 {
+		return fmt.Sprintf("line %d: %s: %s", e.Line, e.Inst, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Inst, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// inst is an instruction added to a Builder.
+type inst struct {
+	mnemonic string
+	args     []Operand
+	line     int
+}
+
+func (in *inst) String() string {
+	if len(in.args) == 0 {
+		return in.mnemonic
+	}
+	args := make([]string, len(in.args))
+	for i, a := range in.args {
+		args[i] = a.String()
+	}
+	return in.mnemonic + " " + strings.Join(args, ", ")
+}
+
+// Builder builds a sequence of instructions. The zero value is an empty Builder.
+//
+// Errors in instructions are reported by Assemble.
+type Builder struct {
+	insts  []inst
+	labels map[string]int    // Index of the instruction each label is before.
+	defs   map[string]uint64 // Labels defined with absolute addresses.
+	err    error
+}
+
+// Label defines a label at the current position.
+func (b *Builder) Label(name string) {
+	b.label(name, 0)
+}
+
+func (b *Builder) label(name string, line int) {
+	if b.defined(name) {
+		b.fail(&Error{Line: line, Inst: name + ":", Err: fmt.Errorf("label %s redefined", name)})
+		return
+	}
+	if b.labels == nil {
+		b.labels = make(map[string]int)
+	}
+	b.labels[name] = len(b.insts)
+}
+
+// Define defines a label with an absolute address, such as a function in the target process.
+func (b *Builder) Define(name string, addr uint64) {
+	if b.defined(name) {
+		b.fail(fmt.Errorf("label %s redefined", name))
+		return
+	}
+	if b.defs == nil {
+		b.defs = make(map[string]uint64)
+	}
+	b.defs[name] = addr
+}
+
+func (b *Builder) defined(name string) bool {
+	_, internal := b.labels[name]
+	_, external := b.defs[name]
+	return internal || external
+}
+
+func (b *Builder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// Inst adds an instruction by its mnemonic, e.g. Inst("mov", RAX, Imm(1)).
+// Conditional jumps are named by their condition, e.g. "je", "jnz" or "jge".
+func (b *Builder) Inst(mnemonic string, args ...Operand) {
+	b.insts = append(b.insts, inst{mnemonic: strings.ToLower(mnemonic), args: args})
+}
+
+// Mov adds a mov. Moves of 64-bit immediates are encoded as movabs when needed.
+func (b *Builder) Mov(dst, src Operand) { b.Inst("mov", dst, src) }
+
+// Lea adds a lea.
+func (b *Builder) Lea(dst Reg, src Mem) { b.Inst("lea", dst, src) }
+
+// Push adds a push of a register, memory or an immediate.
+func (b *Builder) Push(src Operand) { b.Inst("push", src) }
+
+// Pop adds a pop to a register or memory.
+func (b *Builder) Pop(dst Operand) { b.Inst("pop", dst) }
+
+// Call adds a call to a label, an absolute address (Imm), a register or memory.
+func (b *Builder) Call(target Operand) { b.Inst("call", target) }
+
+// Jmp adds a jmp to a label, an absolute address (Imm), a register or memory.
+func (b *Builder) Jmp(target Operand) { b.Inst("jmp", target) }
+
+// Jcc adds a conditional jump to a label or absolute address, e.g. Jcc("ne", Label("loop")).
+func (b *Builder) Jcc(cond string, target Operand) { b.Inst("j"+cond, target) }
+
+// Cmp adds a cmp.
+func (b *Builder) Cmp(a, c Operand) { b.Inst("cmp", a, c) }
+
+// Test adds a test.
+func (b *Builder) Test(a, c Operand) { b.Inst("test", a, c) }
+
+// Add adds an add.
+func (b *Builder) Add(dst, src Operand) { b.Inst("add", dst, src) }
+
+// Sub adds a sub.
+func (b *Builder) Sub(dst, src Operand) { b.Inst("sub", dst, src) }
+
+// Xor adds a xor.
+func (b *Builder) Xor(dst, src Operand) { b.Inst("xor", dst, src) }
+
+// Ret adds a ret.
+func (b *Builder) Ret() { b.Inst("ret") }
+
+// RetN adds a ret which pops n bytes of arguments.
+func (b *Builder) RetN(n uint16) { b.Inst("ret", Imm(n)) }
+
+// Int3 adds a breakpoint.
+func (b *Builder) Int3() { b.Inst("int3") }
+
+// Nop adds n bytes of NOPs, using the recommended multi-byte NOP instructions.
+func (b *Builder) Nop(n int) { b.Inst("nop", Imm(n)) }
+
+// Bytes adds raw bytes.
+func (b *Builder) Bytes(data ...byte) {
+	args := make([]Operand, len(data))
+	for i, c := range data {
+		args[i] = Imm(c)
+	}
+	b.Inst("db", args...)
+}
+
+// Quad adds a 64-bit value, or the address of a label.
+func (b *Builder) Quad(v Operand) { b.Inst("dq", v) }
+
+// Assemble encodes the instructions for the given load address.
+func (b *Builder) Assemble(base uint64) ([]byte, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	// Lay out the instructions. Sizes never depend on the addresses of labels in the code,
+	// so those are given a placeholder.
+	addrs := make([]uint64, len(b.insts)+1)
+	addrs[0] = base
+	for i := range b.insts {
+		code, err := b.encode(&b.insts[i], addrs[i], nil)
+		if err != nil {
+			return nil, err
+		}
+		addrs[i+1] = addrs[i] + uint64(len(code))
+	}
+
+	var out []byte
+	for i := range b.insts {
+		code, err := b.encode(&b.insts[i], addrs[i], addrs)
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(code)) != addrs[i+1]-addrs[i] {
+			return nil, &Error{Line: b.insts[i].line, Inst: b.insts[i].String(), Err: fmt.Errorf("internal error: size changed between passes")}
+		}
+		out = append(out, code...)
+	}
+	return out, nil
+}
+
+// Assemble parses and assembles Intel syntax text for the given load address. See Builder.Parse.
+func Assemble(src string, base uint64) ([]byte, error) {
+	var b Builder
+	if err := b.Parse(src); err != nil {
+		return nil, err
+	}
+	return b.Assemble(base)
+}
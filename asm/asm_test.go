@@ -0,0 +1,283 @@
+package asm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"golang.org/x/arch/x86/x86asm"
+)
+
+const testBase = 0x7FF600001000
+
+// decode decodes all of the instructions in code.
+func decode(t *testing.T, code []byte, pc uint64) []x86asm.Inst {
+	var insts []x86asm.Inst
+	for len(code) > 0 {
+		inst, err := x86asm.Decode(code, 64)
+		if err != nil {
+			t.Fatalf("Decode % X at 0x%X: %s\n", code, pc, err)
+		}
+		insts = append(insts, inst)
+		code = code[inst.Len:]
+		pc += uint64(inst.Len)
+	}
+	return insts
+}
+
+func TestAssemble(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string // As formatted by x86asm.
+	}{
+		{"mov rax, [rip+0x1234]", "mov rax, qword ptr [rip+0x1234]"},
+		{"mov rax, rbx", "mov rax, rbx"},
+		{"mov r12d, [r13]", "mov r12d, dword ptr [r13]"},
+		{"mov [rsp+8], r9", "mov qword ptr [rsp+0x8], r9"},
+		{"mov rax, 1", "mov rax, 0x1"},
+		{"mov rax, -1", "mov rax, -0x1"},
+		{"mov rcx, 0xFFFFFFFF", "mov ecx, -0x1"},
+		{"mov r10, 0x123456789A", "mov r10, 0x123456789a"},
+		{"mov qword ptr [rbx+rcx*8+0x10], 0x20", "mov qword ptr [rbx+rcx*8+0x10], 0x20"},
+		{"mov dword ptr [rax], 0xFFFFFFFF", "mov dword ptr [rax], -0x1"},
+		{"mov rax, [0x1000]", "mov rax, qword ptr [0x1000]"},
+		{"mov rax, [r12+r13*4-8]", "mov rax, qword ptr [r12+r13*4-0x8]"},
+		{"mov rax, [rbp]", "mov rax, qword ptr [rbp]"},
+		{"lea rdi, [rsp+0x100]", "lea rdi, ptr [rsp+0x100]"},
+		{"lea eax, [rax+rax*2]", "lea eax, ptr [rax+rax*2]"},
+		{"push rbp", "push rbp"},
+		{"push r15", "push r15"},
+		{"pop r12", "pop r12"},
+		{"push 0x10", "push 0x10"},
+		{"push 0x12345", "push 0x12345"},
+		{"push qword ptr [rax]", "push qword ptr [rax]"},
+		{"pop qword ptr [r8+4]", "pop qword ptr [r8+0x4]"},
+		{"call rax", "call rax"},
+		{"call qword ptr [rip+0x10]", "call qword ptr [rip+0x10]"},
+		{"jmp r11", "jmp r11"},
+		{"jmp [rax]", "jmp qword ptr [rax]"},
+		{"cmp rax, 5", "cmp rax, 0x5"},
+		{"cmp dword ptr [rcx], 0x1000", "cmp dword ptr [rcx], 0x1000"},
+		{"cmp rax, [rbx]", "cmp rax, qword ptr [rbx]"},
+		{"test eax, eax", "test eax, eax"},
+		{"test rax, [rdi]", "test qword ptr [rdi], rax"},
+		{"test r8, 0xFF", "test r8, 0xff"},
+		{"add rsp, 0x28", "add rsp, 0x28"},
+		{"sub rsp, 0x28", "sub rsp, 0x28"},
+		{"xor eax, eax", "xor eax, eax"},
+		{"and rax, -16", "and rax, -0x10"},
+		{"or [rax], rcx", "or qword ptr [rax], rcx"},
+		{"ret", "ret"},
+		{"ret 0x10", "ret 0x10"},
+		{"int3", "int3"},
+		{"nop", "nop"},
+	}
+	for _, tst := range tests {
+		code, err := Assemble(tst.src, testBase)
+		if err != nil {
+			t.Errorf("Assemble(%q): %s\n", tst.src, err)
+			continue
+		}
+		insts := decode(t, code, testBase)
+		if len(insts) != 1 {
+			t.Errorf("Assemble(%q) = % X, expected one instruction\n", tst.src, code)
+			continue
+		}
+		if got := x86asm.IntelSyntax(insts[0], testBase, nil); got != tst.want {
+			t.Errorf("Assemble(%q) decodes as %q, expected %q\n", tst.src, got, tst.want)
+		}
+	}
+}
+
+func TestLabels(t *testing.T) {
+	code, err := Assemble(`
+	start:
+		mov rax, [rip+counter]  ; load
+		add rax, 1
+		mov [counter], rax
+		cmp rax, 10
+		jl start
+		lea rcx, [rip+counter+4]
+		mov rdx, counter
+		jmp done
+	counter: dq 0
+	table:   dq counter, done
+	done:    ret
+	`, testBase)
+	if err != nil {
+		t.Fatalf("Assemble: %s\n", err)
+	}
+
+	// The data is between the instructions, so decode up to it.
+	counter := uint64(testBase + 7 + 4 + 7 + 4 + 6 + 7 + 10 + 5)
+	done := counter + 8 + 16
+	insts := decode(t, code[:counter-testBase], testBase)
+	if len(insts) != 8 {
+		t.Fatalf("Expected 8 instructions, got %d\n", len(insts))
+	}
+
+	pc := uint64(testBase)
+	targets := make([]uint64, len(insts))
+	for i, inst := range insts {
+		next := pc + uint64(inst.Len)
+		for _, a := range inst.Args {
+			switch a := a.(type) {
+			case x86asm.Rel:
+				targets[i] = next + uint64(a)
+			case x86asm.Mem:
+				if a.Base == x86asm.RIP {
+					targets[i] = next + uint64(a.Disp)
+				}
+			}
+		}
+		pc = next
+	}
+
+	want := []uint64{counter, 0, counter, 0, testBase, counter + 4, 0, done}
+	for i := range want {
+		if targets[i] != want[i] {
+			t.Errorf("Instruction %d (%s) targets 0x%X, expected 0x%X\n", i, insts[i], targets[i], want[i])
+		}
+	}
+	if imm, ok := insts[6].Args[1].(x86asm.Imm); !ok || uint64(imm) != counter {
+		t.Errorf("mov rdx, counter got %s, expected 0x%X\n", insts[6], counter)
+	}
+
+	table := code[counter+8-testBase:]
+	if binary.LittleEndian.Uint64(table) != counter || binary.LittleEndian.Uint64(table[8:]) != done {
+		t.Errorf("Label table got % X\n", table[:16])
+	}
+	if code[len(code)-1] != 0xC3 {
+		t.Errorf("Expected ret at the end\n")
+	}
+}
+
+func TestAbsoluteBranches(t *testing.T) {
+	near := uint64(testBase + 0x10000000)
+	far := uint64(0x12345678)
+
+	var b Builder
+	b.Define("near", near)
+	b.Define("far", far)
+	b.Jmp(Label("near"))
+	b.Jmp(Imm(far))
+	b.Call(Label("far"))
+	b.Jcc("ne", Label("far"))
+	code, err := b.Assemble(testBase)
+	if err != nil {
+		t.Fatalf("Assemble: %s\n", err)
+	}
+
+	// jmp rel32; jmp [rip]; call [rip+2]; jmp +8; jne +14; jmp [rip]
+	if len(code) != 5+14+16+16 {
+		t.Fatalf("Unexpected length %d: % X\n", len(code), code)
+	}
+	if code[0] != 0xE9 || uint64(int64(int32(binary.LittleEndian.Uint32(code[1:]))))+testBase+5 != near {
+		t.Errorf("Near jmp got % X\n", code[:5])
+	}
+
+	abs := []struct {
+		off    int
+		prefix []byte
+	}{
+		{5, []byte{0xFF, 0x25, 0, 0, 0, 0}},
+		{5 + 14, []byte{0xFF, 0x15, 2, 0, 0, 0, 0xEB, 8}},
+		{5 + 14 + 16, []byte{0x74, 0x0E, 0xFF, 0x25, 0, 0, 0, 0}},
+	}
+	for _, a := range abs {
+		got := code[a.off:]
+		if !bytes.HasPrefix(got, a.prefix) || binary.LittleEndian.Uint64(got[len(a.prefix):]) != far {
+			t.Errorf("Absolute branch at %d got % X\n", a.off, got[:len(a.prefix)+8])
+		}
+	}
+
+	// jne is inverted to je to jump over the absolute jmp.
+	if inst, _ := x86asm.Decode(code[5+14+16:], 64); inst.Op != x86asm.JE {
+		t.Errorf("Expected je, got %s\n", inst)
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	var b Builder
+	b.Label("loop")
+	b.Mov(RAX, Mem{Base: RIP, Label: "value"})
+	b.Sub(Mem{Base: RBX, Index: RCX, Scale: 8, Disp: 0x10, Size: 4}, Imm(1))
+	b.Test(EAX, EAX)
+	b.Jcc("nz", Label("loop"))
+	b.Push(R12)
+	b.Lea(R12, Mem{Base: RSP, Disp: -8})
+	b.Pop(R12)
+	b.Nop(7)
+	b.Ret()
+	b.Label("value")
+	b.Quad(Imm(0x1122334455667788))
+	got, err := b.Assemble(testBase)
+	if err != nil {
+		t.Fatalf("Assemble: %s\n", err)
+	}
+
+	want, err := Assemble(`
+	loop:
+		mov rax, [value]
+		sub dword ptr [rbx+rcx*8+0x10], 1
+		test eax, eax
+		jnz loop
+		push r12
+		lea r12, [rsp-8]
+		pop r12
+		nop 7
+		ret
+	value:
+		dq 0x1122334455667788
+	`, testBase)
+	if err != nil {
+		t.Fatalf("Assemble: %s\n", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("Builder got % X\nText got    % X\n", got, want)
+	}
+}
+
+func TestNOPs(t *testing.T) {
+	for n := 1; n <= 20; n++ {
+		code := NOPs(n)
+		if len(code) != n {
+			t.Fatalf("NOPs(%d) returned %d bytes\n", n, len(code))
+		}
+		for _, inst := range decode(t, code, 0) {
+			if inst.Op != x86asm.NOP {
+				t.Fatalf("NOPs(%d) decodes to %s\n", n, inst)
+			}
+		}
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []string{
+		"mov rax, ebx",
+		"mov [rax], 1",
+		"mov rax, [ebx]",
+		"mov rax, [rax+rsp*2]",
+		"mov rax, [rax+rcx*3]",
+		"add rax, 0x100000000",
+		"push eax",
+		"jmp undefined",
+		"frobnicate rax",
+		"mov rax",
+		"lea rax, rbx",
+		"ret 0x10000",
+		"x: x: ret",
+		"mov rax, [rip+0x100000000]",
+		"mov qword ptr rax, 1",
+	}
+	for _, src := range tests {
+		if _, err := Assemble(src, testBase); err == nil {
+			t.Errorf("Assemble(%q) should fail\n", src)
+		}
+	}
+
+	_, err := Assemble("ret\nmov rax, ebx", testBase)
+	if e, ok := err.(*Error); !ok || e.Line != 2 {
+		t.Errorf("Expected an error on line 2, got %v\n", err)
+	}
+}
@@ -0,0 +1,710 @@
+package asm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Condition codes of conditional jumps, including aliases.
+var conditions = map[string]byte{
+	"o": 0x0, "no": 0x1,
+	"b": 0x2, "c": 0x2, "nae": 0x2,
+	"ae": 0x3, "nb": 0x3, "nc": 0x3,
+	"e": 0x4, "z": 0x4,
+	"ne": 0x5, "nz": 0x5,
+	"be": 0x6, "na": 0x6,
+	"a": 0x7, "nbe": 0x7,
+	"s": 0x8, "ns": 0x9,
+	"p": 0xA, "pe": 0xA,
+	"np": 0xB, "po": 0xB,
+	"l": 0xC, "nge": 0xC,
+	"ge": 0xD, "nl": 0xD,
+	"le": 0xE, "ng": 0xE,
+	"g": 0xF, "nle": 0xF,
+}
+
+// Opcode extensions of the arithmetic instructions.
+var aluOps = map[string]byte{
+	"add": 0,
+	"or":  1,
+	"and": 4,
+	"sub": 5,
+	"xor": 6,
+	"cmp": 7,
+}
+
+// The recommended multi-byte NOPs, indexed by length.
+var nops = [...][]byte{
+	1: {0x90},
+	2: {0x66, 0x90},
+	3: {0x0F, 0x1F, 0x00},
+	4: {0x0F, 0x1F, 0x40, 0x00},
+	5: {0x0F, 0x1F, 0x44, 0x00, 0x00},
+	6: {0x66, 0x0F, 0x1F, 0x44, 0x00, 0x00},
+	7: {0x0F, 0x1F, 0x80, 0x00, 0x00, 0x00, 0x00},
+	8: {0x0F, 0x1F, 0x84, 0x00, 0x00, 0x00, 0x00, 0x00},
+	9: {0x66, 0x0F, 0x1F, 0x84, 0x00, 0x00, 0x00, 0x00, 0x00},
+}
+
+// NOPs returns n bytes of NOPs, using the recommended multi-byte NOP instructions.
+func NOPs(n int) []byte {
+	var out []byte
+	for n > 0 {
+		size := n
+		if size >= len(nops) {
+			size = len(nops) - 1
+		}
+		out = append(out, nops[size]...)
+		n -= size
+	}
+	return out
+}
+
+// encode encodes an instruction at pc.
+// addrs holds the address of each instruction, or is nil while laying out the code.
+func (b *Builder) encode(in *inst, pc uint64, addrs []uint64) ([]byte, error) {
+	e := &encoder{b: b, pc: pc, addrs: addrs, rip: -1}
+	code, err := e.encode(in.mnemonic, in.args)
+	if err != nil {
+		return nil, &Error{Line: in.line, Inst: in.String(), Err: err}
+	}
+	return code, nil
+}
+
+// encoder encodes a single instruction.
+type encoder struct {
+	b     *Builder
+	pc    uint64
+	addrs []uint64
+
+	// REX prefix bits.
+	w, r, x, rb bool
+
+	op    []byte
+	modrm []byte // ModRM, SIB and displacement.
+	imm   []byte
+
+	// Offset in modrm of a RIP-relative displacement to fix up, or -1.
+	rip       int
+	ripTarget uint64
+}
+
+var (
+	errOperands  = errors.New("invalid operands")
+	errImmediate = errors.New("immediate out of range")
+)
+
+func fits8(v int64) bool  { return v == int64(int8(v)) }
+func fits32(v int64) bool { return v == int64(int32(v)) }
+
+func le16(v uint64) []byte {
+	b := make([]byte, 2)
+	binary.LittleEndian.PutUint16(b, uint16(v))
+	return b
+}
+
+func le32(v uint64) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(v))
+	return b
+}
+
+func le64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	return b
+}
+
+// gpr reports whether r is a general purpose register.
+func gpr(r Reg) bool {
+	return r.Size() != 0 && r != RIP
+}
+
+// resolve returns the address of a label, and whether the label is in the code.
+// Labels in the code resolve to pc while laying out the code.
+func (e *encoder) resolve(l Label) (uint64, bool, error) {
+	if addr, ok := e.b.defs[string(l)]; ok {
+		return addr, false, nil
+	}
+	i, ok := e.b.labels[string(l)]
+	if !ok {
+		return 0, false, fmt.Errorf("undefined label %s", l)
+	}
+	if e.addrs == nil {
+		return e.pc, true, nil
+	}
+	return e.addrs[i], true, nil
+}
+
+// value returns the value of an immediate or label operand, and whether it's the address
+// of a label in the code. ok is false if the operand isn't an immediate or label.
+func (e *encoder) value(a Operand) (v uint64, internal, ok bool, err error) {
+	switch a := a.(type) {
+	case Imm:
+		return uint64(a), false, true, nil
+	case Label:
+		v, internal, err := e.resolve(a)
+		return v, internal, true, err
+	}
+	return 0, false, false, nil
+}
+
+// imm32 returns an immediate for an operand of the given size, sign extended to 64 bits.
+func imm32(v uint64, size int) (int64, error) {
+	if size == 4 && v <= 0xFFFFFFFF {
+		return int64(int32(v)), nil
+	}
+	if !fits32(int64(v)) {
+		return 0, errImmediate
+	}
+	return int64(v), nil
+}
+
+// opSize returns the operand size of an instruction, checking the operands agree.
+func opSize(args ...Operand) (int, error) {
+	size := 0
+	for _, a := range args {
+		s := 0
+		switch a := a.(type) {
+		case Reg:
+			s = a.Size()
+		case Mem:
+			s = a.Size
+			if s != 0 && s != 4 && s != 8 {
+				return 0, fmt.Errorf("unsupported operand size %d", s)
+			}
+		}
+		if s == 0 {
+			continue
+		}
+		if size != 0 && s != size {
+			return 0, errors.New("operand size mismatch")
+		}
+		size = s
+	}
+	if size == 0 {
+		return 0, errors.New("operand size required (e.g. qword ptr)")
+	}
+	return size, nil
+}
+
+// finish returns the encoded instruction.
+func (e *encoder) finish() ([]byte, error) {
+	var out []byte
+	rex := byte(0x40)
+	if e.w {
+		rex |= 8
+	}
+	if e.r {
+		rex |= 4
+	}
+	if e.x {
+		rex |= 2
+	}
+	if e.rb {
+		rex |= 1
+	}
+	if rex != 0x40 {
+		out = append(out, rex)
+	}
+	out = append(out, e.op...)
+	start := len(out)
+	out = append(out, e.modrm...)
+	out = append(out, e.imm...)
+
+	if e.rip >= 0 {
+		disp := int64(e.ripTarget - (e.pc + uint64(len(out))))
+		if !fits32(disp) {
+			return nil, fmt.Errorf("address 0x%X is out of range of a RIP-relative operand", e.ripTarget)
+		}
+		binary.LittleEndian.PutUint32(out[start+e.rip:], uint32(disp))
+	}
+	return out, nil
+}
+
+// setRM encodes the ModRM byte for the reg field and a register or memory operand.
+func (e *encoder) setRM(reg byte, rm Operand) error {
+	e.r = reg >= 8
+	reg = (reg & 7) << 3
+
+	switch rm := rm.(type) {
+	case Reg:
+		if !gpr(rm) {
+			return errOperands
+		}
+		n := rm.num()
+		e.rb = n >= 8
+		e.modrm = []byte{0xC0 | reg | n&7}
+		return nil
+	case Mem:
+		return e.setMem(reg, rm)
+	}
+	return errOperands
+}
+
+func (e *encoder) setMem(reg byte, m Mem) error {
+	// RIP-relative.
+	if m.Label != "" || m.Base == RIP {
+		if m.Index != NoReg || (m.Base != NoReg && m.Base != RIP) {
+			return errors.New("RIP-relative operands can't use other registers")
+		}
+		e.modrm = []byte{reg | 5, 0, 0, 0, 0}
+		if m.Label == "" {
+			if !fits32(m.Disp) {
+				return errors.New("displacement out of range")
+			}
+			binary.LittleEndian.PutUint32(e.modrm[1:], uint32(m.Disp))
+			return nil
+		}
+		addr, _, err := e.resolve(m.Label)
+		if err != nil {
+			return err
+		}
+		e.rip, e.ripTarget = 1, addr+uint64(m.Disp)
+		return nil
+	}
+
+	if (m.Base != NoReg && m.Base.Size() != 8) || (m.Index != NoReg && m.Index.Size() != 8) {
+		return errors.New("memory operands must use 64-bit registers")
+	}
+	if m.Index == RSP || m.Index == RIP {
+		return fmt.Errorf("%s can't be an index register", m.Index)
+	}
+	if !fits32(m.Disp) {
+		return errors.New("displacement out of range")
+	}
+
+	var scale byte
+	switch m.scale() {
+	case 1:
+		scale = 0
+	case 2:
+		scale = 1
+	case 4:
+		scale = 2
+	case 8:
+		scale = 3
+	default:
+		return fmt.Errorf("invalid scale %d", m.Scale)
+	}
+	index := byte(4) // No index.
+	if m.Index != NoReg {
+		index = m.Index.num()
+		e.x = index >= 8
+	}
+	sib := scale<<6 | (index&7)<<3
+
+	// Absolute address, with a SIB byte without a base.
+	if m.Base == NoReg {
+		e.modrm = append([]byte{reg | 4, sib | 5}, le32(uint64(m.Disp))...)
+		return nil
+	}
+
+	base := m.Base.num()
+	e.rb = base >= 8
+
+	// rbp and r13 can't be encoded without a displacement.
+	var mod byte
+	var disp []byte
+	switch {
+	case m.Disp == 0 && base&7 != 5:
+	case fits8(m.Disp):
+		mod, disp = 0x40, []byte{byte(m.Disp)}
+	default:
+		mod, disp = 0x80, le32(uint64(m.Disp))
+	}
+
+	// rsp and r12 can only be encoded with a SIB byte.
+	if m.Index != NoReg || base&7 == 4 {
+		e.modrm = []byte{mod | reg | 4, sib | base&7}
+	} else {
+		e.modrm = []byte{mod | reg | base&7}
+	}
+	e.modrm = append(e.modrm, disp...)
+	return nil
+}
+
+func (e *encoder) encode(mnemonic string, args []Operand) ([]byte, error) {
+	nargs := func(n int) error {
+		if len(args) != n {
+			return fmt.Errorf("%s takes %d operands", mnemonic, n)
+		}
+		return nil
+	}
+
+	if len(mnemonic) < 2 {
+		return nil, fmt.Errorf("unsupported instruction %q", mnemonic)
+	}
+	if cc, ok := conditions[mnemonic[1:]]; ok && mnemonic[0] == 'j' {
+		if err := nargs(1); err != nil {
+			return nil, err
+		}
+		return e.branch(mnemonic, cc, args[0])
+	}
+	if n, ok := aluOps[mnemonic]; ok {
+		if err := nargs(2); err != nil {
+			return nil, err
+		}
+		return e.alu(n, args[0], args[1])
+	}
+
+	switch mnemonic {
+	case "mov":
+		if err := nargs(2); err != nil {
+			return nil, err
+		}
+		return e.mov(args[0], args[1])
+
+	case "test":
+		if err := nargs(2); err != nil {
+			return nil, err
+		}
+		return e.test(args[0], args[1])
+
+	case "lea":
+		if err := nargs(2); err != nil {
+			return nil, err
+		}
+		dst, ok := args[0].(Reg)
+		src, ok2 := args[1].(Mem)
+		if !ok || !ok2 || !gpr(dst) {
+			return nil, errOperands
+		}
+		e.w = dst.Size() == 8
+		e.op = []byte{0x8D}
+		if err := e.setRM(dst.num(), src); err != nil {
+			return nil, err
+		}
+		return e.finish()
+
+	case "push", "pop":
+		if err := nargs(1); err != nil {
+			return nil, err
+		}
+		return e.pushPop(mnemonic == "push", args[0])
+
+	case "call", "jmp":
+		if err := nargs(1); err != nil {
+			return nil, err
+		}
+		return e.branch(mnemonic, 0, args[0])
+
+	case "ret":
+		if len(args) == 0 {
+			return []byte{0xC3}, nil
+		}
+		if err := nargs(1); err != nil {
+			return nil, err
+		}
+		n, ok := args[0].(Imm)
+		if !ok || n < 0 || n > 0xFFFF {
+			return nil, errOperands
+		}
+		return append([]byte{0xC2}, le16(uint64(n))...), nil
+
+	case "nop":
+		if len(args) == 0 {
+			return NOPs(1), nil
+		}
+		if err := nargs(1); err != nil {
+			return nil, err
+		}
+		n, ok := args[0].(Imm)
+		if !ok || n < 1 {
+			return nil, errOperands
+		}
+		return NOPs(int(n)), nil
+
+	case "int3":
+		if err := nargs(0); err != nil {
+			return nil, err
+		}
+		return []byte{0xCC}, nil
+
+	case "db":
+		var out []byte
+		for _, a := range args {
+			v, ok := a.(Imm)
+			if !ok || v < -0x80 || v > 0xFF {
+				return nil, errImmediate
+			}
+			out = append(out, byte(v))
+		}
+		return out, nil
+
+	case "dq":
+		var out []byte
+		for _, a := range args {
+			v, _, ok, err := e.value(a)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, errOperands
+			}
+			out = append(out, le64(v)...)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("unsupported instruction %q", mnemonic)
+}
+
+// rmReg encodes an instruction with a register or memory operand and a register operand,
+// using opRMReg if the destination is the register or memory operand, or opRegRM if it's the register.
+func (e *encoder) rmReg(opRMReg, opRegRM byte, dst, src Operand) ([]byte, error) {
+	size, err := opSize(dst, src)
+	if err != nil {
+		return nil, err
+	}
+	e.w = size == 8
+
+	if r, ok := src.(Reg); ok && gpr(r) {
+		e.op = []byte{opRMReg}
+		err = e.setRM(r.num(), dst)
+	} else if r, ok := dst.(Reg); ok && gpr(r) && opRegRM != 0 {
+		if _, ok := src.(Mem); !ok {
+			return nil, errOperands
+		}
+		e.op = []byte{opRegRM}
+		err = e.setRM(r.num(), src)
+	} else {
+		return nil, errOperands
+	}
+	if err != nil {
+		return nil, err
+	}
+	return e.finish()
+}
+
+func (e *encoder) mov(dst, src Operand) ([]byte, error) {
+	v, internal, ok, err := e.value(src)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return e.rmReg(0x89, 0x8B, dst, src)
+	}
+
+	switch dst := dst.(type) {
+	case Reg:
+		if !gpr(dst) {
+			return nil, errOperands
+		}
+		n := dst.num()
+		e.rb = n >= 8
+
+		// Addresses of labels in the code always use a 64-bit immediate, as they aren't known yet.
+		switch {
+		case dst.Size() == 4:
+			if _, err := imm32(v, 4); err != nil {
+				return nil, err
+			}
+			e.op, e.imm = []byte{0xB8 + n&7}, le32(v)
+		case !internal && fits32(int64(v)):
+			e.w = true
+			e.op, e.modrm, e.imm = []byte{0xC7}, []byte{0xC0 | n&7}, le32(v)
+		case !internal && v <= 0xFFFFFFFF:
+			// Writing the 32-bit register zero extends.
+			e.op, e.imm = []byte{0xB8 + n&7}, le32(v)
+		default:
+			e.w = true
+			e.op, e.imm = []byte{0xB8 + n&7}, le64(v)
+		}
+		return e.finish()
+
+	case Mem:
+		size, err := opSize(dst)
+		if err != nil {
+			return nil, err
+		}
+		if internal {
+			return nil, errors.New("can't store the address of a label, use lea")
+		}
+		imm, err := imm32(v, size)
+		if err != nil {
+			return nil, err
+		}
+		e.w = size == 8
+		e.op, e.imm = []byte{0xC7}, le32(uint64(imm))
+		if err := e.setRM(0, dst); err != nil {
+			return nil, err
+		}
+		return e.finish()
+	}
+	return nil, errOperands
+}
+
+func (e *encoder) alu(n byte, dst, src Operand) ([]byte, error) {
+	v, internal, ok, err := e.value(src)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return e.rmReg(n*8+1, n*8+3, dst, src)
+	}
+	if internal {
+		return nil, errors.New("can't use the address of a label as an immediate, use lea")
+	}
+
+	size, err := opSize(dst)
+	if err != nil {
+		return nil, err
+	}
+	imm, err := imm32(v, size)
+	if err != nil {
+		return nil, err
+	}
+	e.w = size == 8
+	if fits8(imm) {
+		e.op, e.imm = []byte{0x83}, []byte{byte(imm)}
+	} else {
+		e.op, e.imm = []byte{0x81}, le32(uint64(imm))
+	}
+	if err := e.setRM(n, dst); err != nil {
+		return nil, err
+	}
+	return e.finish()
+}
+
+func (e *encoder) test(a, c Operand) ([]byte, error) {
+	v, internal, ok, err := e.value(c)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// test is commutative, but only encodes a register or memory operand first.
+		if _, ok := c.(Mem); ok {
+			a, c = c, a
+		}
+		return e.rmReg(0x85, 0, a, c)
+	}
+	if internal {
+		return nil, errOperands
+	}
+
+	size, err := opSize(a)
+	if err != nil {
+		return nil, err
+	}
+	imm, err := imm32(v, size)
+	if err != nil {
+		return nil, err
+	}
+	e.w = size == 8
+	e.op, e.imm = []byte{0xF7}, le32(uint64(imm))
+	if err := e.setRM(0, a); err != nil {
+		return nil, err
+	}
+	return e.finish()
+}
+
+func (e *encoder) pushPop(push bool, a Operand) ([]byte, error) {
+	switch a := a.(type) {
+	case Reg:
+		if a.Size() != 8 || !gpr(a) {
+			return nil, errors.New("only 64-bit registers can be pushed or popped")
+		}
+		n := a.num()
+		e.rb = n >= 8
+		if push {
+			e.op = []byte{0x50 + n&7}
+		} else {
+			e.op = []byte{0x58 + n&7}
+		}
+		return e.finish()
+
+	case Mem:
+		if a.Size != 0 && a.Size != 8 {
+			return nil, errOperands
+		}
+		if push {
+			e.op = []byte{0xFF}
+			if err := e.setRM(6, a); err != nil {
+				return nil, err
+			}
+		} else {
+			e.op = []byte{0x8F}
+			if err := e.setRM(0, a); err != nil {
+				return nil, err
+			}
+		}
+		return e.finish()
+
+	case Imm:
+		if !push {
+			return nil, errOperands
+		}
+		if fits8(int64(a)) {
+			return []byte{0x6A, byte(a)}, nil
+		}
+		if !fits32(int64(a)) {
+			return nil, errImmediate
+		}
+		return append([]byte{0x68}, le32(uint64(a))...), nil
+	}
+	return nil, errOperands
+}
+
+// branch encodes a call, jmp or conditional jump with condition code cc.
+func (e *encoder) branch(mnemonic string, cc byte, target Operand) ([]byte, error) {
+	// Indirect calls and jumps.
+	switch target.(type) {
+	case Reg, Mem:
+		if r, ok := target.(Reg); ok && r.Size() != 8 {
+			return nil, errOperands
+		}
+		if m, ok := target.(Mem); ok && m.Size != 0 && m.Size != 8 {
+			return nil, errOperands
+		}
+		var ext byte
+		switch mnemonic {
+		case "call":
+			ext = 2
+		case "jmp":
+			ext = 4
+		default:
+			return nil, errOperands
+		}
+		e.op = []byte{0xFF}
+		if err := e.setRM(ext, target); err != nil {
+			return nil, err
+		}
+		return e.finish()
+	}
+
+	addr, internal, ok, err := e.value(target)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errOperands
+	}
+
+	var op []byte
+	switch mnemonic {
+	case "call":
+		op = []byte{0xE8}
+	case "jmp":
+		op = []byte{0xE9}
+	default:
+		op = []byte{0x0F, 0x80 + cc}
+	}
+	rel := int64(addr - (e.pc + uint64(len(op)+4)))
+	if internal || fits32(rel) {
+		return append(op, le32(uint64(rel))...), nil
+	}
+
+	// Out of range, so branch through the address stored after the instruction.
+	switch mnemonic {
+	case "call":
+		// call [rip+2]; jmp over the address.
+		return append([]byte{0xFF, 0x15, 0x02, 0x00, 0x00, 0x00, 0xEB, 0x08}, le64(addr)...), nil
+	case "jmp":
+		// jmp [rip+0]
+		return append([]byte{0xFF, 0x25, 0x00, 0x00, 0x00, 0x00}, le64(addr)...), nil
+	default:
+		// The inverse condition jumps over an absolute jmp.
+		return append([]byte{0x70 + (cc ^ 1), 0x0E, 0xFF, 0x25, 0x00, 0x00, 0x00, 0x00}, le64(addr)...), nil
+	}
+}
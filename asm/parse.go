@@ -0,0 +1,251 @@
+package asm
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var regsByName = func() map[string]Reg {
+	m := make(map[string]Reg, len(regNames))
+	for r, name := range regNames {
+		if name != "" {
+			m[name] = Reg(r)
+		}
+	}
+	return m
+}()
+
+// Parse parses Intel syntax assembly and adds it to the builder.
+//
+// Each line holds an instruction, optionally preceded by labels (e.g. "loop: sub rcx, 1").
+// Comments start with ';' or '#'. Numbers are decimal, or hex with a 0x prefix.
+// Memory operands may be given a size with "qword ptr" or "dword ptr", and may refer to a
+// label, which makes them RIP-relative (e.g. "[rip+counter]" or "[counter]").
+// Besides instructions, "db" adds bytes, "dq" adds 64-bit values or label addresses,
+// and "nop n" adds n bytes of NOPs.
+func (b *Builder) Parse(src string) error {
+	for i, line := range strings.Split(src, "\n") {
+		lineNum := i + 1
+		if j := strings.IndexAny(line, ";#"); j != -1 {
+			line = line[:j]
+		}
+		line = strings.TrimSpace(line)
+
+		// Labels.
+		for {
+			j := strings.IndexByte(line, ':')
+			if j == -1 || !isIdent(strings.TrimSpace(line[:j])) {
+				break
+			}
+			b.label(strings.TrimSpace(line[:j]), lineNum)
+			line = strings.TrimSpace(line[j+1:])
+		}
+		if line == "" {
+			continue
+		}
+
+		mnemonic, rest := line, ""
+		if j := strings.IndexAny(line, " \t"); j != -1 {
+			mnemonic, rest = line[:j], line[j+1:]
+		}
+		args, err := parseOperands(rest)
+		if err != nil {
+			return &Error{Line: lineNum, Inst: line, Err: err}
+		}
+		b.insts = append(b.insts, inst{mnemonic: strings.ToLower(mnemonic), args: args, line: lineNum})
+	}
+	return b.err
+}
+
+// isIdent reports whether s is a valid label name.
+func isIdent(s string) bool {
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+	for _, c := range s {
+		if !(c == '_' || c == '.' || c == '@' || c == '$' ||
+			(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseOperands parses a comma separated list of operands.
+func parseOperands(s string) ([]Operand, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, s[start:])
+
+	args := make([]Operand, len(parts))
+	for i, part := range parts {
+		a, err := parseOperand(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		args[i] = a
+	}
+	return args, nil
+}
+
+// parseOperand parses a register, number, label or memory operand.
+func parseOperand(s string) (Operand, error) {
+	lower := strings.ToLower(s)
+
+	size := 0
+	switch {
+	case strings.HasPrefix(lower, "qword ") || strings.HasPrefix(lower, "qword["):
+		size = 8
+	case strings.HasPrefix(lower, "dword ") || strings.HasPrefix(lower, "dword["):
+		size = 4
+	}
+	if size != 0 {
+		s = strings.TrimSpace(s[len("qword"):])
+		if strings.HasPrefix(strings.ToLower(s), "ptr") {
+			s = strings.TrimSpace(s[len("ptr"):])
+		}
+		lower = strings.ToLower(s)
+	}
+
+	if strings.HasPrefix(s, "[") {
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("unterminated memory operand %q", s)
+		}
+		m, err := parseMem(s[1 : len(s)-1])
+		if err != nil {
+			return nil, err
+		}
+		m.Size = size
+		return m, nil
+	}
+	if size != 0 {
+		return nil, fmt.Errorf("size given for non-memory operand %q", s)
+	}
+
+	if r, ok := regsByName[lower]; ok {
+		return r, nil
+	}
+	if v, ok := parseNumber(s); ok {
+		return Imm(v), nil
+	}
+	if isIdent(s) {
+		return Label(s), nil
+	}
+	return nil, fmt.Errorf("invalid operand %q", s)
+}
+
+// parseNumber parses a decimal or 0x prefixed hex number, with an optional sign.
+func parseNumber(s string) (int64, bool) {
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	var v uint64
+	var err error
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		v, err = strconv.ParseUint(s[2:], 16, 64)
+	} else {
+		v, err = strconv.ParseUint(s, 10, 64)
+	}
+	if err != nil {
+		return 0, false
+	}
+	if neg {
+		return -int64(v), true
+	}
+	return int64(v), true
+}
+
+// parseMem parses the inside of a memory operand, such as "rbx+rcx*8+0x10".
+func parseMem(s string) (Mem, error) {
+	var m Mem
+	s = strings.Join(strings.Fields(s), "")
+
+	for i := 0; i < len(s); {
+		neg := false
+		switch s[i] {
+		case '+':
+			i++
+		case '-':
+			neg = true
+			i++
+		}
+		j := i
+		for j < len(s) && s[j] != '+' && s[j] != '-' {
+			j++
+		}
+		term := s[i:j]
+		i = j
+		if term == "" {
+			return m, errors.New("invalid memory operand")
+		}
+
+		if v, ok := parseNumber(term); ok {
+			if neg {
+				v = -v
+			}
+			m.Disp += v
+			continue
+		}
+		if neg {
+			return m, fmt.Errorf("can't subtract %q", term)
+		}
+
+		// Scaled index.
+		if k := strings.IndexByte(term, '*'); k != -1 {
+			reg, scale := term[:k], term[k+1:]
+			if _, ok := parseNumber(reg); ok {
+				reg, scale = scale, reg
+			}
+			r, ok := regsByName[strings.ToLower(reg)]
+			n, ok2 := parseNumber(scale)
+			if !ok || !ok2 || m.Index != NoReg {
+				return m, fmt.Errorf("invalid index %q", term)
+			}
+			m.Index, m.Scale = r, int(n)
+			continue
+		}
+
+		if r, ok := regsByName[strings.ToLower(term)]; ok {
+			switch {
+			case m.Base == NoReg:
+				m.Base = r
+			case m.Index == NoReg && r != RIP:
+				m.Index, m.Scale = r, 1
+			default:
+				return m, fmt.Errorf("too many registers in memory operand")
+			}
+			continue
+		}
+
+		if isIdent(term) && m.Label == "" {
+			m.Label = Label(term)
+			continue
+		}
+		return m, fmt.Errorf("invalid memory operand term %q", term)
+	}
+
+	// [label] and [rip+label] are the same.
+	if m.Label != "" && m.Base == RIP {
+		m.Base = NoReg
+	}
+	return m, nil
+}
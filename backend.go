@@ -0,0 +1,213 @@
+package kiwi
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Backend is a source of process memory, such as a live process, a core file, a minidump
+// or a remote connection. Wrap one with NewProcess to use all of kiwi's API on it.
+//
+// ReadAt and WriteAt are like io.ReaderAt and io.WriterAt with an address for the offset:
+// they return the number of bytes read or written, and an error if it's less than len(b).
+//
+// Backends may also implement ModuleLister, SymbolLister, PointerSizer, ThreadLister, CodeWriter,
+// RegisterWriter and Debugger.
+type Backend interface {
+	ReadAt(b []byte, addr uintptr) (int, error)
+	WriteAt(b []byte, addr uintptr) (int, error)
+
+	// Regions returns the mapped memory regions, sorted by address.
+	Regions() ([]Region, error)
+
+	Close() error
+}
+
+// ModuleLister is implemented by backends which know the modules of the target.
+type ModuleLister interface {
+	Modules() ([]Module, error)
+}
+
+// SymbolLister is implemented by backends which know the symbols of modules,
+// instead of them being read from the module's image.
+type SymbolLister interface {
+	Symbols(m Module) ([]Symbol, error)
+}
+
+// PointerSizer is implemented by backends which know the pointer size of the target.
+type PointerSizer interface {
+	PointerSize() (int, error)
+}
+
+// ThreadLister is implemented by backends which know the threads of the target and their registers.
+type ThreadLister interface {
+	Threads() ([]Thread, error)
+}
+
+// RegisterWriter is implemented by backends which can change the registers of threads.
+type RegisterWriter interface {
+	SetRegisters(thread int, regs Registers) error
+}
+
+// Debugger is implemented by backends which can run the target and stop it at breakpoints.
+type Debugger interface {
+	SetBreakpoint(bp Breakpoint) error
+	ClearBreakpoint(bp Breakpoint) error
+
+	// Continue runs the target until it stops.
+	Continue() (StopEvent, error)
+
+	// Step runs a single instruction of the thread.
+	Step(thread int) (StopEvent, error)
+
+	// Interrupt stops the target while it's running, making Continue return.
+	Interrupt() error
+}
+
+// CodeWriter is implemented by backends which need to make memory writable to patch code.
+type CodeWriter interface {
+	WriteCode(b []byte, addr uintptr) error
+}
+
+// NewProcess returns a process which accesses memory through the backend.
+func NewProcess(b Backend) *Process {
+	return &Process{backend: b}
+}
+
+// Backend returns the backend the process's memory is accessed through.
+// For live processes opened with GetProcessByPID or GetProcessByFileName,
+// it's a backend which accesses the process directly.
+func (p *Process) Backend() Backend {
+	if p.backend != nil {
+		return p.backend
+	}
+	return &liveBackend{p: *p}
+}
+
+// Close closes the backend of the process. It does nothing for live processes.
+func (p *Process) Close() error {
+	if p.backend != nil {
+		return p.backend.Close()
+	}
+	return nil
+}
+
+// readFull reads len(b) bytes from the backend.
+func readFull(be Backend, addr uintptr, b []byte) error {
+	n, err := be.ReadAt(b, addr)
+	if err == nil && n < len(b) {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// writeFull writes all of b to the backend.
+func writeFull(be Backend, addr uintptr, b []byte) error {
+	n, err := be.WriteAt(b, addr)
+	if err == nil && n < len(b) {
+		err = io.ErrShortWrite
+	}
+	return err
+}
+
+// liveBackend accesses a live process through the platform's APIs.
+type liveBackend struct {
+	p Process
+}
+
+func (b *liveBackend) ReadAt(buf []byte, addr uintptr) (int, error) {
+	if err := b.p.platformRead(addr, &buf); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+func (b *liveBackend) WriteAt(buf []byte, addr uintptr) (int, error) {
+	if err := b.p.platformWrite(addr, &buf); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+func (b *liveBackend) Regions() ([]Region, error) {
+	return b.p.platformRegions()
+}
+
+func (b *liveBackend) Close() error {
+	return nil
+}
+
+func (b *liveBackend) Modules() ([]Module, error) {
+	return b.p.platformModules()
+}
+
+func (b *liveBackend) PointerSize() (int, error) {
+	return b.p.platformPointerSize()
+}
+
+func (b *liveBackend) WriteCode(buf []byte, addr uintptr) error {
+	return b.p.platformWriteCode(addr, buf)
+}
+
+// SliceBackend is a Backend over a byte slice mapped at Base, such as captured memory in a test.
+type SliceBackend struct {
+	Base uintptr
+	Data []byte
+	Perm Perm // Writes fail unless it includes PermWrite.
+}
+
+// NewSliceBackend returns a readable and writable backend over data, mapped at base.
+func NewSliceBackend(base uintptr, data []byte) *SliceBackend {
+	return &SliceBackend{Base: base, Data: data, Perm: PermRead | PermWrite}
+}
+
+// slice returns the part of Data at addr, up to n bytes.
+func (s *SliceBackend) slice(addr uintptr, n int) ([]byte, error) {
+	if addr < s.Base || addr-s.Base >= uintptr(len(s.Data)) {
+		return nil, fmt.Errorf("0x%X is outside of the slice", addr)
+	}
+	b := s.Data[addr-s.Base:]
+	if len(b) > n {
+		b = b[:n]
+	}
+	return b, nil
+}
+
+func (s *SliceBackend) ReadAt(b []byte, addr uintptr) (int, error) {
+	data, err := s.slice(addr, len(b))
+	if err != nil {
+		return 0, err
+	}
+	n := copy(b, data)
+	if n < len(b) {
+		return n, fmt.Errorf("0x%X is outside of the slice", addr+uintptr(n))
+	}
+	return n, nil
+}
+
+func (s *SliceBackend) WriteAt(b []byte, addr uintptr) (int, error) {
+	if s.Perm&PermWrite == 0 {
+		return 0, errors.New("slice is read-only")
+	}
+	data, err := s.slice(addr, len(b))
+	if err != nil {
+		return 0, err
+	}
+	n := copy(data, b)
+	if n < len(b) {
+		return n, fmt.Errorf("0x%X is outside of the slice", addr+uintptr(n))
+	}
+	return n, nil
+}
+
+func (s *SliceBackend) Regions() ([]Region, error) {
+	if len(s.Data) == 0 {
+		return nil, nil
+	}
+	return []Region{{Base: s.Base, Size: uintptr(len(s.Data)), Perm: s.Perm}}, nil
+}
+
+func (s *SliceBackend) Close() error {
+	return nil
+}
@@ -0,0 +1,73 @@
+package kiwi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unsafe"
+)
+
+func TestSliceBackend(t *testing.T) {
+	data := make([]byte, 0x100)
+	binary.LittleEndian.PutUint32(data[0x10:], 1337)
+	copy(data[0x80:], []byte{0x48, 0x8B, 0x05, 0x11, 0x22, 0x33, 0x44, 0xC3})
+	p := NewProcess(NewSliceBackend(0x10000, data)).WithPointerSize(4)
+	defer p.Close()
+
+	if v, err := p.ReadUint32(0x10010); err != nil || v != 1337 {
+		t.Errorf("Expected 1337, got %d (%v)\n", v, err)
+	}
+	if err := p.WriteFloat32(0x10020, 1.5); err != nil {
+		t.Fatalf("WriteFloat32: %s\n", err)
+	}
+	if v, err := p.ReadFloat32(0x10020); err != nil || v != 1.5 {
+		t.Errorf("Expected 1.5, got %v (%v)\n", v, err)
+	}
+	if v, err := p.Eval("[0x10010] + 1"); err != nil || v != 1338 {
+		t.Errorf("Expected 1338, got %d (%v)\n", v, err)
+	}
+
+	// Reads past the end of the slice fail.
+	if _, err := p.ReadUint32(0x100FE); err == nil {
+		t.Errorf("Expected an error reading past the end\n")
+	}
+
+	matches, err := p.FindPattern(MustParsePattern("48 8B 05 ?? ?? ?? ?? C3"), nil)
+	if err != nil || len(matches) != 1 || matches[0] != 0x10080 {
+		t.Errorf("Expected a match at 0x10080, got %X (%v)\n", matches, err)
+	}
+	if _, err := p.Modules(); err == nil {
+		t.Errorf("Expected an error listing modules of a slice\n")
+	}
+
+	ro := NewProcess(&SliceBackend{Base: 0x10000, Data: data, Perm: PermRead})
+	if err := ro.WriteUint8(0x10000, 1); err == nil {
+		t.Errorf("Expected an error writing to a read-only slice\n")
+	}
+}
+
+func TestLiveBackend(t *testing.T) {
+	p, err := GetProcessByFileName(currentProcessName)
+	if err != nil {
+		t.Fatalf("Error trying to open process \"%s\", Error: %s\n", currentProcessName, err.Error())
+	}
+
+	buf := []byte("kiwi live backend")
+	heapSink = &buf
+	addr := uintptr(unsafe.Pointer(&buf[0]))
+
+	// A process wrapping the backend of a live process works the same as the process.
+	bp := NewProcess(p.Backend())
+	if got, err := bp.ReadBytes(addr, len(buf)); err != nil || !bytes.Equal(got, buf) {
+		t.Errorf("Expected %q, got %q (%v)\n", buf, got, err)
+	}
+	if err := bp.WriteBytes(addr, []byte("KIWI")); err != nil || string(buf[:4]) != "KIWI" {
+		t.Errorf("Expected the write to be seen, got %q (%v)\n", buf, err)
+	}
+	if _, err := bp.FindModule(currentProcessName); err != nil {
+		t.Errorf("FindModule: %s\n", err)
+	}
+	if size, err := bp.PointerSize(); err != nil || size != int(unsafe.Sizeof(uintptr(0))) {
+		t.Errorf("Unexpected pointer size %d (%v)\n", size, err)
+	}
+}
@@ -0,0 +1,254 @@
+// Package broker gives unprivileged programs access to process memory through a privileged daemon.
+//
+// The broker runs as root and listens on a Unix socket. It identifies each caller with the
+// kernel's peer credentials, checks every operation against a Policy, and writes every operation
+// to an audit log. Callers use it like a remote agent:
+//
+//	c, err := broker.Dial(broker.DefaultSocket)
+//	...
+//	t, err := c.OpenByName("game")
+//	...
+//	p := t.Process()
+//
+// The broker only works on Linux, while clients work anywhere with Unix sockets.
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Andoryuuta/kiwi"
+	"github.com/Andoryuuta/kiwi/remote"
+)
+
+// DefaultSocket is the default path of the broker's socket.
+const DefaultSocket = "/run/kiwi-broker.sock"
+
+// Dial connects to the broker listening on the socket at path.
+func Dial(path string) (*remote.Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := remote.NewClient(conn, "")
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Listen listens on a Unix socket at path, replacing a stale socket left by a previous broker.
+// Any user may connect to the socket, and the policy decides what they may do.
+func Listen(path string) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0666); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Broker serves process memory to the callers allowed by its policy.
+type Broker struct {
+	Policy *Policy
+
+	// Audit is where audit records are written, as a JSON object per line.
+	// If nil, they're written with the log package.
+	Audit io.Writer
+
+	// Logf logs connection errors. If nil, the log package is used.
+	Logf func(format string, args ...interface{})
+
+	mu sync.Mutex // Serializes audit records.
+}
+
+// AuditRecord is a line of the audit log.
+type AuditRecord struct {
+	Time       time.Time `json:"time"`
+	CallerPID  int       `json:"caller_pid"`
+	CallerUID  int       `json:"caller_uid"`
+	Op         string    `json:"op"`
+	PID        int       `json:"pid,omitempty"`
+	Executable string    `json:"exe,omitempty"`
+	Addr       uint64    `json:"addr,omitempty"`
+	Size       int       `json:"size,omitempty"`
+	Count      int       `json:"count,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// conn is a connection from a caller.
+type conn struct {
+	net.Conn
+	caller Caller
+
+	mu      sync.Mutex
+	targets map[int]Target // The processes the caller opened, by PID.
+}
+
+// listener wraps a listener to get the caller of each connection.
+type listener struct {
+	net.Listener
+	b *Broker
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		caller, err := peerCredentials(c)
+		if err != nil {
+			l.b.logf("%s: %s", c.RemoteAddr(), err)
+			c.Close()
+			continue
+		}
+		return &conn{Conn: c, caller: caller, targets: make(map[int]Target)}, nil
+	}
+}
+
+// Serve accepts connections from callers on l, which should be a Unix socket from Listen.
+func (b *Broker) Serve(l net.Listener) error {
+	if b.Policy == nil {
+		return errors.New("broker has no policy")
+	}
+	bl := &listener{Listener: l, b: b}
+	for {
+		nc, err := bl.Accept()
+		if err != nil {
+			return err
+		}
+		// Each caller gets a server of its own, so it's only listed the processes it may open.
+		c := nc.(*conn)
+		s := &remote.Server{
+			List: func() ([]kiwi.ProcessInfo, error) {
+				return b.list(c)
+			},
+			Authorize: b.authorize,
+			Audit:     b.audit,
+			Logf:      b.logf,
+		}
+		go func() {
+			if err := s.ServeConn(c); err != nil {
+				b.logf("%s: %s", c.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// list lists the processes the caller may open.
+func (b *Broker) list(c *conn) ([]kiwi.ProcessInfo, error) {
+	procs, err := kiwi.ListProcesses()
+	if err != nil {
+		return nil, err
+	}
+	var allowed []kiwi.ProcessInfo
+	for _, p := range procs {
+		if t, err := targetInfo(p.PID); err == nil && b.Policy.Allows(c.caller, t, false) {
+			allowed = append(allowed, p)
+		}
+	}
+	return allowed, nil
+}
+
+func (b *Broker) logf(format string, args ...interface{}) {
+	if b.Logf != nil {
+		b.Logf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// errDenied is returned for operations the policy doesn't allow.
+var errDenied = errors.New("denied by policy")
+
+// authorize checks an operation against the policy.
+func (b *Broker) authorize(nc net.Conn, op remote.Op) error {
+	c := nc.(*conn)
+	switch op.Kind {
+	case "list":
+		if !b.Policy.AllowsCaller(c.caller) {
+			return errDenied
+		}
+		return nil
+
+	case "open":
+		t, err := targetInfo(op.PID)
+		if err != nil {
+			return err
+		}
+		if !b.Policy.Allows(c.caller, t, false) {
+			return fmt.Errorf("opening %s (%d): %w", t.Executable, t.PID, errDenied)
+		}
+		c.mu.Lock()
+		c.targets[t.PID] = t
+		c.mu.Unlock()
+		return nil
+	}
+
+	// Everything else is on a process which was allowed to be opened. It's checked again
+	// on every operation, in case it exited and its PID was reused by another process.
+	c.mu.Lock()
+	t, ok := c.targets[op.PID]
+	c.mu.Unlock()
+	if !ok {
+		return errDenied
+	}
+	if cur, err := targetInfo(op.PID); err != nil || cur != t {
+		return fmt.Errorf("%s of %s (%d): no longer the process which was opened: %w", op.Kind, t.Executable, t.PID, errDenied)
+	}
+	write := op.Kind == "write" || op.Kind == "write-code"
+	if !b.Policy.Allows(c.caller, t, write) {
+		return fmt.Errorf("%s of %s (%d): %w", op.Kind, t.Executable, t.PID, errDenied)
+	}
+	return nil
+}
+
+// audit writes an audit record for an operation.
+func (b *Broker) audit(nc net.Conn, op remote.Op, err error) {
+	c := nc.(*conn)
+	rec := AuditRecord{
+		Time:      time.Now().UTC(),
+		CallerPID: c.caller.PID,
+		CallerUID: c.caller.UID,
+		Op:        op.Kind,
+		PID:       op.PID,
+		Addr:      uint64(op.Addr),
+		Size:      op.Size,
+		Count:     op.Count,
+	}
+	c.mu.Lock()
+	rec.Executable = c.targets[op.PID].Executable
+	c.mu.Unlock()
+	if rec.Executable == "" {
+		rec.Executable = op.Name
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+
+	line, _ := json.Marshal(rec)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.Audit == nil {
+		log.Printf("audit: %s", line)
+		return
+	}
+	if _, err := b.Audit.Write(append(line, '\n')); err != nil {
+		b.logf("writing audit log: %s", err)
+	}
+}
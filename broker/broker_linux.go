@@ -0,0 +1,92 @@
+package broker
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// peerCredentials returns the caller on the other end of a Unix socket connection, with SO_PEERCRED.
+func peerCredentials(c net.Conn) (Caller, error) {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return Caller{}, errors.New("not a Unix socket connection")
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return Caller{}, err
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err == nil {
+		err = credErr
+	}
+	if err != nil {
+		return Caller{}, fmt.Errorf("SO_PEERCRED: %w", err)
+	}
+	return Caller{PID: int(cred.Pid), UID: int(cred.Uid), GID: int(cred.Gid)}, nil
+}
+
+// targetInfo returns the executable, effective UID and start time of a process.
+func targetInfo(pid int) (Target, error) {
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return Target{}, err
+	}
+	start, err := startTime(pid)
+	if err != nil {
+		return Target{}, err
+	}
+
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return Target{}, err
+	}
+	defer f.Close()
+
+	// The Uid line has the real, effective, saved and filesystem UIDs.
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) >= 3 && fields[0] == "Uid:" {
+			uid, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return Target{}, err
+			}
+			exe = strings.TrimSuffix(exe, " (deleted)")
+			return Target{PID: pid, UID: uid, Executable: filepath.Base(exe), StartTime: start}, nil
+		}
+	}
+	return Target{}, fmt.Errorf("no Uid in /proc/%d/status", pid)
+}
+
+// startTime returns the start time of a process, field 22 of /proc/<pid>/stat.
+func startTime(pid int) (uint64, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// The command name in field 2 is in parentheses and may contain spaces,
+	// so fields are counted from the last parenthesis, which ends it.
+	i := bytes.LastIndexByte(data, ')')
+	if i == -1 {
+		return 0, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package broker
+
+import (
+	"errors"
+	"net"
+)
+
+var errUnsupported = errors.New("the broker only works on Linux")
+
+func peerCredentials(c net.Conn) (Caller, error) {
+	return Caller{}, errUnsupported
+}
+
+func targetInfo(pid int) (Target, error) {
+	return Target{}, errUnsupported
+}
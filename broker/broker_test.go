@@ -0,0 +1,184 @@
+package broker
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"unsafe"
+
+	"github.com/Andoryuuta/kiwi/remote"
+)
+
+func TestPolicy(t *testing.T) {
+	p, err := ParsePolicy([]byte(`
+rules:
+  - caller_uids: [1000]
+    executables: [game]
+    write: true
+  - target_uids: [1001]
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicy: %s\n", err)
+	}
+
+	alice, bob := Caller{UID: 1000}, Caller{UID: 1002}
+	game, tool := Target{UID: 0, Executable: "game"}, Target{UID: 1001, Executable: "tool"}
+	tests := []struct {
+		c     Caller
+		t     Target
+		write bool
+		want  bool
+	}{
+		{alice, game, true, true},
+		{bob, game, false, false},
+		{bob, tool, false, true},
+		{bob, tool, true, false},
+		{alice, Target{UID: 0, Executable: "sshd"}, false, false},
+	}
+	for _, tt := range tests {
+		if got := p.Allows(tt.c, tt.t, tt.write); got != tt.want {
+			t.Errorf("Allows(%+v, %+v, %v) = %v, expected %v\n", tt.c, tt.t, tt.write, got, tt.want)
+		}
+	}
+}
+
+// syncBuffer is a buffer which can be written by the broker while the test reads it.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+var heapSink interface{}
+
+func TestBroker(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the broker only works on Linux")
+	}
+
+	dir, err := ioutil.TempDir("", "kiwi-broker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "broker.sock")
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var audit syncBuffer
+	b := &Broker{
+		Policy: &Policy{Rules: []Rule{{CallerUIDs: []int{os.Getuid()}, Executables: []string{filepath.Base(exe)}}}},
+		Audit:  &audit,
+		Logf:   func(string, ...interface{}) {},
+	}
+	l, err := Listen(socket)
+	if err != nil {
+		t.Fatalf("Listen: %s\n", err)
+	}
+	defer l.Close()
+	go b.Serve(l)
+
+	c, err := Dial(socket)
+	if err != nil {
+		t.Fatalf("Dial: %s\n", err)
+	}
+	defer c.Close()
+
+	// The policy allows reading this process, but not writing to it.
+	target, err := c.Open(os.Getpid())
+	if err != nil {
+		t.Fatalf("Open: %s\n", err)
+	}
+	p := target.Process()
+	buf := []byte("kiwi broker marker")
+	heapSink = &buf
+	addr := uintptr(unsafe.Pointer(&buf[0]))
+	if got, err := p.ReadBytes(addr, len(buf)); err != nil || !bytes.Equal(got, buf) {
+		t.Errorf("Expected %q, got %q (%v)\n", buf, got, err)
+	}
+	if err := p.WriteBytes(addr, []byte("KIWI")); err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Errorf("Expected the write to be denied, got %v\n", err)
+	}
+
+	// Other processes aren't allowed.
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Starting sleep: %s\n", err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+	if _, err := c.Open(cmd.Process.Pid); err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Errorf("Expected opening sleep to be denied, got %v\n", err)
+	}
+
+	// Only the processes the policy allows are listed.
+	procs, err := c.ListProcesses()
+	if err != nil {
+		t.Fatalf("ListProcesses: %s\n", err)
+	}
+	self := false
+	for _, proc := range procs {
+		if proc.PID == cmd.Process.Pid {
+			t.Errorf("Expected sleep not to be listed\n")
+		}
+		self = self || proc.PID == os.Getpid()
+	}
+	if !self {
+		t.Errorf("Expected this process to be listed, got %+v\n", procs)
+	}
+
+	// Operations are denied once the PID is another process's, such as after it's reused.
+	me, err := targetInfo(os.Getpid())
+	if err != nil {
+		t.Fatalf("targetInfo: %s\n", err)
+	}
+	old := me
+	old.StartTime--
+	bc := &conn{caller: Caller{PID: os.Getpid(), UID: os.Getuid()}, targets: map[int]Target{me.PID: old}}
+	if err := b.authorize(bc, remote.Op{Kind: "read", PID: me.PID}); err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Errorf("Expected the read to be denied, got %v\n", err)
+	}
+	bc.targets[me.PID] = me
+	if err := b.authorize(bc, remote.Op{Kind: "read", PID: me.PID}); err != nil {
+		t.Errorf("Expected the read to be allowed, got %v\n", err)
+	}
+
+	// Every operation is audited.
+	var ops []string
+	for _, line := range strings.Split(strings.TrimSpace(audit.String()), "\n") {
+		var rec AuditRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("Bad audit record %q: %s\n", line, err)
+		}
+		if rec.CallerPID != os.Getpid() || rec.CallerUID != os.Getuid() {
+			t.Errorf("Unexpected caller in %+v\n", rec)
+		}
+		ops = append(ops, rec.Op)
+		if rec.Op == "write" && (rec.Error == "" || rec.Addr != uint64(addr) || rec.Size != 4) {
+			t.Errorf("Unexpected write record %+v\n", rec)
+		}
+	}
+	if got := strings.Join(ops, " "); got != "open read write open list" {
+		t.Errorf("Unexpected audited operations %q\n", got)
+	}
+}
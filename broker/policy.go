@@ -0,0 +1,121 @@
+package broker
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Caller is the process on the other end of a broker connection, as reported by the kernel.
+type Caller struct {
+	PID int
+	UID int
+	GID int
+}
+
+// Target is a process a caller wants to access.
+type Target struct {
+	PID        int
+	UID        int    // The effective UID the process runs as.
+	Executable string // The file name of the process's executable, e.g. "game".
+
+	// StartTime is when the process started, in clock ticks since boot.
+	// It tells the process apart from a later one reusing its PID.
+	StartTime uint64
+}
+
+// Rule allows some callers to access some processes.
+type Rule struct {
+	// CallerUIDs are the UIDs of the callers the rule applies to. Empty applies to every caller.
+	CallerUIDs []int `yaml:"caller_uids,omitempty"`
+
+	// Executables are the file names of the executables of processes which may be accessed.
+	Executables []string `yaml:"executables,omitempty"`
+
+	// TargetUIDs are the UIDs whose processes may be accessed.
+	TargetUIDs []int `yaml:"target_uids,omitempty"`
+
+	// Write allows writing to the processes, as well as reading them.
+	Write bool `yaml:"write,omitempty"`
+}
+
+// Policy is an allowlist of the processes callers may access. Anything not allowed by a rule is denied.
+//
+// Policies are usually loaded from YAML:
+//
+//	rules:
+//	  - caller_uids: [1000]
+//	    executables: [game, game-server]
+//	    write: true
+//	  - target_uids: [1000]
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// LoadPolicy reads a policy from a YAML file.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := ParsePolicy(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// ParsePolicy parses a policy from YAML.
+func ParsePolicy(data []byte) (*Policy, error) {
+	var p Policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Allows reports whether the caller may access the target, and write to it if write is set.
+func (p *Policy) Allows(c Caller, t Target, write bool) bool {
+	for _, r := range p.Rules {
+		if r.applies(c) && r.matches(t) && (r.Write || !write) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsCaller reports whether any rule applies to the caller.
+func (p *Policy) AllowsCaller(c Caller) bool {
+	for _, r := range p.Rules {
+		if r.applies(c) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) applies(c Caller) bool {
+	return len(r.CallerUIDs) == 0 || containsInt(r.CallerUIDs, c.UID)
+}
+
+func (r *Rule) matches(t Target) bool {
+	if containsInt(r.TargetUIDs, t.UID) {
+		return true
+	}
+	for _, exe := range r.Executables {
+		if exe == t.Executable {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
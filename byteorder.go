@@ -0,0 +1,76 @@
+package kiwi
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"unsafe"
+)
+
+// nativeEndian is the byte order of the machine kiwi is running on.
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// WithByteOrder returns a copy of the process that interprets memory using the given byte order.
+//
+// The byte order applies to every integer, float, pointer chain and UTF-16 read and write.
+// Raw byte reads and writes (ReadBytes, WriteBytes, ReaderAt, Section, etc) are unaffected.
+// This is useful for targets such as emulators with a big-endian guest.
+func (p *Process) WithByteOrder(order binary.ByteOrder) *Process {
+	np := *p
+	np.byteOrder = order
+	np.swap = order != nil && order.Uint16([]byte{0x01, 0x02}) != nativeEndian.Uint16([]byte{0x01, 0x02})
+	return &np
+}
+
+// ByteOrder returns the byte order used to interpret the process's memory.
+// Defaults to the native byte order of the machine kiwi is running on.
+func (p *Process) ByteOrder() binary.ByteOrder {
+	if p.byteOrder == nil {
+		return nativeEndian
+	}
+	return p.byteOrder
+}
+
+// The swap* functions convert a natively read value to the process's byte order.
+// They are their own inverse, so are also used before writing.
+
+func (p *Process) swap16(v uint16) uint16 {
+	if p.swap {
+		return bits.ReverseBytes16(v)
+	}
+	return v
+}
+
+func (p *Process) swap32(v uint32) uint32 {
+	if p.swap {
+		return bits.ReverseBytes32(v)
+	}
+	return v
+}
+
+func (p *Process) swap64(v uint64) uint64 {
+	if p.swap {
+		return bits.ReverseBytes64(v)
+	}
+	return v
+}
+
+func (p *Process) swapFloat32(v float32) float32 {
+	if p.swap {
+		return math.Float32frombits(bits.ReverseBytes32(math.Float32bits(v)))
+	}
+	return v
+}
+
+func (p *Process) swapFloat64(v float64) float64 {
+	if p.swap {
+		return math.Float64frombits(bits.ReverseBytes64(math.Float64bits(v)))
+	}
+	return v
+}
@@ -0,0 +1,64 @@
+package kiwi
+
+import (
+	"encoding/binary"
+	"testing"
+	"unsafe"
+)
+
+func TestByteOrder(t *testing.T) {
+	p, err := GetProcessByFileName(currentProcessName)
+	if err != nil {
+		t.Fatalf("Error trying to open process \"%s\", Error: %s\n", currentProcessName, err.Error())
+	}
+	be := p.WithByteOrder(binary.BigEndian)
+
+	// Reads.
+	orgVar := []byte{0x12, 0x34, 0x56, 0x78, 0x9A, 0xBC, 0xDE, 0xF0}
+	addr := uintptr(unsafe.Pointer(&orgVar[0]))
+
+	u16, err := be.ReadUint16(addr)
+	if err != nil || u16 != 0x1234 {
+		t.Fatalf("ReadUint16 got 0x%X, %v, expected 0x1234\n", u16, err)
+	}
+	u32, err := be.ReadUint32(addr)
+	if err != nil || u32 != 0x12345678 {
+		t.Fatalf("ReadUint32 got 0x%X, %v, expected 0x12345678\n", u32, err)
+	}
+	u64, err := be.ReadUint64(addr)
+	if err != nil || u64 != 0x123456789ABCDEF0 {
+		t.Fatalf("ReadUint64 got 0x%X, %v, expected 0x123456789ABCDEF0\n", u64, err)
+	}
+	i32, err := be.ReadInt32(addr + 4)
+	if err != nil || i32 != -0x65432110 {
+		t.Fatalf("ReadInt32 got %d, %v, expected %d\n", i32, err, -0x65432110)
+	}
+
+	// Floats.
+	fBuf := []byte{0x3F, 0x80, 0x00, 0x00}
+	f32, err := be.ReadFloat32(uintptr(unsafe.Pointer(&fBuf[0])))
+	if err != nil || f32 != 1.0 {
+		t.Fatalf("ReadFloat32 got %v, %v, expected 1.0\n", f32, err)
+	}
+
+	// Writes.
+	out := make([]byte, 4)
+	if err := be.WriteUint32(uintptr(unsafe.Pointer(&out[0])), 0xCAFEBABE); err != nil {
+		t.Fatalf("WriteUint32: %s\n", err)
+	}
+	if binary.BigEndian.Uint32(out) != 0xCAFEBABE {
+		t.Fatalf("Written value does not match expected. Got: %X\n", out)
+	}
+
+	// UTF-16 without a BOM.
+	str := []byte{0x00, 0x30, 0x00, 0x31, 0x00, 0x00}
+	s, err := be.ReadNullTerminatedUTF16String(uintptr(unsafe.Pointer(&str[0])))
+	if err != nil || s != "01" {
+		t.Fatalf("ReadNullTerminatedUTF16String got %q, %v, expected \"01\"\n", s, err)
+	}
+
+	// The original process is unaffected.
+	if p.ByteOrder() != nativeEndian {
+		t.Fatalf("WithByteOrder modified the original process\n")
+	}
+}
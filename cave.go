@@ -0,0 +1,170 @@
+package kiwi
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// zeroCaveMargin is skipped at the start of runs of zeros, as the operands at the end
+// of the preceding instruction may end in zeros.
+const zeroCaveMargin = 8
+
+// CodeCave is a run of padding in executable memory which can be overwritten by a patch.
+type CodeCave struct {
+	Addr uintptr
+	Size int
+	Fill byte // The padding byte: 0x00, 0x90 (nop) or 0xCC (int3).
+}
+
+// isCaveFill reports whether b is a byte used to pad code.
+func isCaveFill(b byte) bool {
+	return b == 0x00 || b == 0x90 || b == 0xCC
+}
+
+// FindCodeCaves returns the runs of padding bytes of at least minSize bytes in the
+// executable regions of a module, largest first. If module is empty, all executable
+// memory is searched.
+//
+// Padding is runs of 0x00, 0x90 or 0xCC, such as those used to align functions.
+func (p *Process) FindCodeCaves(module string, minSize int) ([]CodeCave, error) {
+	regions, err := p.scanTargets(&ScanOptions{Module: module, Perm: PermExec})
+	if err != nil {
+		return nil, err
+	}
+
+	var caves []CodeCave
+	var run CodeCave
+	end := func() {
+		if run.Fill == 0x00 {
+			run.Addr += zeroCaveMargin
+			run.Size -= zeroCaveMargin
+		}
+		if run.Size >= minSize && run.Size > 0 {
+			caves = append(caves, run)
+		}
+		run = CodeCave{}
+	}
+
+	var next uintptr
+	p.scanRegions(regions, 0, func(addr uintptr, data []byte) bool {
+		// Runs end at pages which couldn't be read.
+		if addr != next && run.Size > 0 {
+			end()
+		}
+		for i, b := range data {
+			if run.Size > 0 && b == run.Fill {
+				run.Size++
+				continue
+			}
+			if run.Size > 0 {
+				end()
+			}
+			if isCaveFill(b) {
+				run = CodeCave{Addr: addr + uintptr(i), Size: 1, Fill: b}
+			}
+		}
+		next = addr + uintptr(len(data))
+		return true
+	})
+	if run.Size > 0 {
+		end()
+	}
+
+	sort.SliceStable(caves, func(i, j int) bool {
+		return caves[i].Size > caves[j].Size
+	})
+	return caves, nil
+}
+
+// CaveSet hands out space in code caves, so that patches don't use the same space.
+// It's safe for concurrent use.
+type CaveSet struct {
+	mu   sync.Mutex
+	free []CodeCave // Sorted by address.
+}
+
+// NewCaveSet returns a CaveSet with the caves free to be reserved.
+func NewCaveSet(caves []CodeCave) *CaveSet {
+	s := &CaveSet{}
+	for _, c := range caves {
+		s.release(c)
+	}
+	return s
+}
+
+// Caves returns the space which is still free, largest first.
+func (s *CaveSet) Caves() []CodeCave {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	caves := append([]CodeCave(nil), s.free...)
+	sort.SliceStable(caves, func(i, j int) bool {
+		return caves[i].Size > caves[j].Size
+	})
+	return caves
+}
+
+// Reserve reserves size bytes, aligned to align bytes if align is more than 1,
+// in the smallest cave they fit in. It returns the address of the reserved space.
+func (s *CaveSet) Reserve(size, align int) (uintptr, error) {
+	if align < 1 {
+		align = 1
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	best, bestAddr := -1, uintptr(0)
+	for i, c := range s.free {
+		addr := (c.Addr + uintptr(align) - 1) / uintptr(align) * uintptr(align)
+		if addr+uintptr(size) > c.Addr+uintptr(c.Size) {
+			continue
+		}
+		if best == -1 || c.Size < s.free[best].Size {
+			best, bestAddr = i, addr
+		}
+	}
+	if best == -1 {
+		return 0, fmt.Errorf("no free code cave of %d bytes", size)
+	}
+
+	// Keep the space before and after the reservation free.
+	c := s.free[best]
+	s.free = append(s.free[:best], s.free[best+1:]...)
+	if before := int(bestAddr - c.Addr); before > 0 {
+		s.release(CodeCave{Addr: c.Addr, Size: before, Fill: c.Fill})
+	}
+	if after := c.Size - int(bestAddr-c.Addr) - size; after > 0 {
+		s.release(CodeCave{Addr: bestAddr + uintptr(size), Size: after, Fill: c.Fill})
+	}
+	return bestAddr, nil
+}
+
+// Release frees size bytes at addr, which were reserved with Reserve.
+// fill is the original padding byte, which should be written back to the cave before it's released.
+func (s *CaveSet) Release(addr uintptr, size int, fill byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.release(CodeCave{Addr: addr, Size: size, Fill: fill})
+}
+
+// release adds a cave to the free list, merging it with adjacent caves of the same fill.
+func (s *CaveSet) release(c CodeCave) {
+	i := sort.Search(len(s.free), func(i int) bool {
+		return s.free[i].Addr > c.Addr
+	})
+	s.free = append(s.free, CodeCave{})
+	copy(s.free[i+1:], s.free[i:])
+	s.free[i] = c
+
+	// Merge with the next cave, then the previous one.
+	if i+1 < len(s.free) && s.free[i+1].Fill == c.Fill && c.Addr+uintptr(c.Size) == s.free[i+1].Addr {
+		s.free[i].Size += s.free[i+1].Size
+		s.free = append(s.free[:i+1], s.free[i+2:]...)
+	}
+	if i > 0 && s.free[i-1].Fill == c.Fill && s.free[i-1].Addr+uintptr(s.free[i-1].Size) == c.Addr {
+		s.free[i-1].Size += s.free[i].Size
+		s.free = append(s.free[:i], s.free[i+1:]...)
+	}
+}
@@ -0,0 +1,89 @@
+package kiwi
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFindCodeCaves(t *testing.T) {
+	p, err := GetProcessByFileName(currentProcessName)
+	if err != nil {
+		t.Fatalf("Error trying to open process \"%s\", Error: %s\n", currentProcessName, err.Error())
+	}
+
+	// Functions in Go binaries are padded with int3.
+	caves, err := p.FindCodeCaves(currentProcessName, 8)
+	if err != nil {
+		t.Fatalf("FindCodeCaves: %s\n", err)
+	}
+	if len(caves) == 0 {
+		t.Fatalf("No code caves found in %s\n", currentProcessName)
+	}
+
+	m, err := p.FindModule(currentProcessName)
+	if err != nil {
+		t.Fatalf("FindModule: %s\n", err)
+	}
+	for i, c := range caves {
+		if i > 0 && c.Size > caves[i-1].Size {
+			t.Fatalf("Caves aren't sorted by size\n")
+		}
+		if c.Size < 8 || !m.Contains(c.Addr) {
+			t.Fatalf("Unexpected cave %+v\n", c)
+		}
+		if i < 10 {
+			data, err := p.ReadBytes(c.Addr, c.Size)
+			if err != nil {
+				t.Fatalf("ReadBytes: %s\n", err)
+			}
+			if !bytes.Equal(data, bytes.Repeat([]byte{c.Fill}, c.Size)) {
+				t.Fatalf("Cave at 0x%X isn't padding: % X\n", c.Addr, data)
+			}
+		}
+	}
+}
+
+func TestCaveSet(t *testing.T) {
+	s := NewCaveSet([]CodeCave{
+		{Addr: 0x1000, Size: 0x40, Fill: 0xCC},
+		{Addr: 0x2003, Size: 0x10, Fill: 0xCC},
+	})
+
+	// The smallest cave which fits is used.
+	addr, err := s.Reserve(8, 1)
+	if err != nil || addr != 0x2003 {
+		t.Fatalf("Reserve got 0x%X, %v, expected 0x2003\n", addr, err)
+	}
+
+	// Alignment skips the start of the cave, which stays free.
+	addr, err = s.Reserve(4, 4)
+	if err != nil || addr != 0x200C {
+		t.Fatalf("Reserve got 0x%X, %v, expected 0x200C\n", addr, err)
+	}
+
+	if _, err := s.Reserve(0x41, 1); err == nil {
+		t.Fatalf("Reserve of more than the largest cave should fail\n")
+	}
+
+	addr, err = s.Reserve(0x40, 16)
+	if err != nil || addr != 0x1000 {
+		t.Fatalf("Reserve got 0x%X, %v, expected 0x1000\n", addr, err)
+	}
+	s.Release(0x1000, 0x40, 0xCC)
+	s.Release(0x2003, 8, 0xCC)
+
+	want := []CodeCave{
+		{Addr: 0x1000, Size: 0x40, Fill: 0xCC},
+		{Addr: 0x2003, Size: 9, Fill: 0xCC},
+		{Addr: 0x2010, Size: 3, Fill: 0xCC},
+	}
+	got := s.Caves()
+	if len(got) != len(want) {
+		t.Fatalf("Caves got %+v, expected %+v\n", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Caves got %+v, expected %+v\n", got, want)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package kiwi
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// XML layout of a Cheat Engine .CT file.
+type ctTable struct {
+	Entries []ctEntry  `xml:"CheatEntries>CheatEntry"`
+	Symbols []ctSymbol `xml:"UserdefinedSymbols>SymbolEntry"`
+}
+
+type ctEntry struct {
+	Description     string    `xml:"Description"`
+	VariableType    string    `xml:"VariableType"`
+	Address         string    `xml:"Address"`
+	Offsets         []string  `xml:"Offsets>Offset"`
+	ShowAsSigned    int       `xml:"ShowAsSigned"`
+	Length          int       `xml:"Length"`
+	ByteLength      int       `xml:"ByteLength"`
+	Unicode         int       `xml:"Unicode"`
+	AssemblerScript string    `xml:"AssemblerScript"`
+	Entries         []ctEntry `xml:"CheatEntries>CheatEntry"`
+}
+
+type ctSymbol struct {
+	Name    string `xml:"Name"`
+	Address string `xml:"Address"`
+}
+
+// Auto assembler commands understood when importing scripts.
+var (
+	ctAOBScanModule  = regexp.MustCompile(`(?i)\baobscanmodule\s*\(\s*([^,\s]+)\s*,\s*([^,]+?)\s*,\s*([^)]+?)\s*\)`)
+	ctAOBScan        = regexp.MustCompile(`(?i)\baobscan\s*\(\s*([^,\s]+)\s*,\s*([^)]+?)\s*\)`)
+	ctDefine         = regexp.MustCompile(`(?i)\bdefine\s*\(\s*([^,\s]+)\s*,\s*([^)]+?)\s*\)`)
+	ctRegisterSymbol = regexp.MustCompile(`(?i)\bregistersymbol\s*\(\s*([^)]+?)\s*\)`)
+	ctLineComment    = regexp.MustCompile(`//[^\n]*`)
+	ctBlockComment   = regexp.MustCompile(`(?s)\{.*?\}`)
+)
+
+// LoadCheatTable loads a Cheat Engine .CT file as an AddressList. See ImportCheatTable.
+func LoadCheatTable(path string) (*AddressList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ImportCheatTable(f)
+}
+
+// ImportCheatTable reads a Cheat Engine cheat table (.CT) as an AddressList.
+//
+// Cheat entries are converted with their address, offsets, variable type and description,
+// with nested entries placed in groups named by the path of their parents' descriptions
+// (e.g. "Player/Stats"). Entries with an address relative to their parent (e.g. "+10") are supported.
+// Strings are imported as bytes, and entries of unsupported types (binary, custom) are skipped.
+//
+// User defined symbols are imported as symbols. Auto assembler scripts are not run, but their
+// registered symbols are imported if they're defined with aobscan, aobscanmodule or define.
+//
+// Entries and symbols which fail to import are left out, and the first failure is returned
+// along with the list of everything which did import.
+func ImportCheatTable(r io.Reader) (*AddressList, error) {
+	var ct ctTable
+	if err := xml.NewDecoder(r).Decode(&ct); err != nil {
+		return nil, err
+	}
+
+	imp := &ctImporter{list: &AddressList{}, names: make(map[string]bool)}
+
+	// Collect all of the symbol names first, as addresses can refer to them before they're defined.
+	var scripts []string
+	var walk func(entries []ctEntry)
+	walk = func(entries []ctEntry) {
+		for _, e := range entries {
+			if e.AssemblerScript != "" {
+				script := ctEnableSection(e.AssemblerScript)
+				scripts = append(scripts, script)
+				for _, m := range ctRegisterSymbol.FindAllStringSubmatch(script, -1) {
+					for _, name := range strings.Split(m[1], ",") {
+						imp.names[strings.TrimSpace(name)] = true
+					}
+				}
+			}
+			walk(e.Entries)
+		}
+	}
+	walk(ct.Entries)
+	for _, s := range ct.Symbols {
+		imp.names[s.Name] = true
+	}
+
+	// Registered symbols from scripts.
+	for _, script := range scripts {
+		imp.script(script)
+	}
+
+	// User defined symbols.
+	for _, s := range ct.Symbols {
+		addr, err := imp.address(s.Address)
+		if err != nil {
+			imp.fail(fmt.Errorf("symbol %q: %w", s.Name, err))
+			continue
+		}
+		imp.list.Symbols = append(imp.list.Symbols, &SymbolEntry{Name: s.Name, Address: addr})
+	}
+
+	imp.entries(ct.Entries, "", "")
+	return imp.list, imp.firstErr
+}
+
+type ctImporter struct {
+	list     *AddressList
+	names    map[string]bool // All symbol names defined in the table.
+	firstErr error
+}
+
+// fail records an entry or symbol which couldn't be imported.
+func (imp *ctImporter) fail(err error) {
+	if imp.firstErr == nil {
+		imp.firstErr = err
+	}
+}
+
+// ctEnableSection returns the [ENABLE] section of an auto assembler script, without comments.
+func ctEnableSection(script string) string {
+	if i := strings.Index(strings.ToUpper(script), "[DISABLE]"); i != -1 {
+		script = script[:i]
+	}
+	script = ctBlockComment.ReplaceAllString(script, "")
+	return ctLineComment.ReplaceAllString(script, "")
+}
+
+// script imports the registered symbols of an auto assembler script.
+func (imp *ctImporter) script(script string) {
+	registered := make(map[string]bool)
+	for _, m := range ctRegisterSymbol.FindAllStringSubmatch(script, -1) {
+		for _, name := range strings.Split(m[1], ",") {
+			registered[strings.TrimSpace(name)] = true
+		}
+	}
+
+	for _, m := range ctAOBScanModule.FindAllStringSubmatch(script, -1) {
+		if registered[m[1]] {
+			imp.list.Symbols = append(imp.list.Symbols, &SymbolEntry{Name: m[1], Module: strings.Trim(m[2], `"`), Pattern: m[3]})
+		}
+	}
+	for _, m := range ctAOBScan.FindAllStringSubmatch(script, -1) {
+		if registered[m[1]] {
+			imp.list.Symbols = append(imp.list.Symbols, &SymbolEntry{Name: m[1], Pattern: m[2]})
+		}
+	}
+	for _, m := range ctDefine.FindAllStringSubmatch(script, -1) {
+		if !registered[m[1]] {
+			continue
+		}
+		addr, err := imp.address(m[2])
+		if err != nil {
+			imp.fail(fmt.Errorf("symbol %q: %w", m[1], err))
+			continue
+		}
+		imp.list.Symbols = append(imp.list.Symbols, &SymbolEntry{Name: m[1], Address: addr})
+	}
+}
+
+// entries imports cheat entries and their children.
+// parent is the address expression of the parent entry, for entries relative to it.
+func (imp *ctImporter) entries(entries []ctEntry, group, parent string) {
+	for _, e := range entries {
+		desc := strings.Trim(e.Description, `"`)
+
+		// The children of an entry which fails are still imported, unless they're relative to it.
+		addr, err := imp.entryAddress(e, parent)
+		if err != nil {
+			imp.fail(fmt.Errorf("entry %q: %w", desc, err))
+			addr = ""
+		}
+
+		if addr != "" && e.AssemblerScript == "" {
+			if entry, ok := ctConvertType(e); ok {
+				entry.Description = desc
+				entry.Group = group
+				entry.Address = addr
+				imp.list.Entries = append(imp.list.Entries, entry)
+			}
+		}
+
+		if len(e.Entries) > 0 {
+			childGroup := desc
+			if group != "" {
+				childGroup = group + "/" + desc
+			}
+			imp.entries(e.Entries, childGroup, addr)
+		}
+	}
+}
+
+// entryAddress returns the full address expression of the entry, including its offsets.
+func (imp *ctImporter) entryAddress(e ctEntry, parent string) (string, error) {
+	raw := strings.TrimSpace(e.Address)
+	if raw == "" {
+		return "", nil
+	}
+
+	addr, err := imp.address(raw)
+	if err != nil {
+		return "", err
+	}
+
+	// Addresses starting with a sign are relative to the parent entry.
+	if raw[0] == '+' || raw[0] == '-' {
+		if parent == "" {
+			return "", fmt.Errorf("relative address %q without a parent address", raw)
+		}
+		addr = "(" + parent + ")" + addr
+	}
+
+	// Cheat Engine lists offsets from last to first. Offsets are usually hex numbers,
+	// but may be symbols or expressions, which are converted like addresses.
+	for i := len(e.Offsets) - 1; i >= 0; i-- {
+		off := strings.TrimSpace(e.Offsets[i])
+		if off == "" {
+			return "", errors.New("empty offset")
+		}
+		neg := strings.HasPrefix(off, "-")
+		v, err := strconv.ParseUint(strings.TrimPrefix(off, "-"), 16, 64)
+		switch {
+		case err == nil && neg:
+			addr = fmt.Sprintf("[%s] - 0x%X", addr, v)
+		case err == nil:
+			addr = fmt.Sprintf("[%s] + 0x%X", addr, v)
+		default:
+			expr, err := imp.address(off)
+			if err != nil {
+				return "", fmt.Errorf("offset %q: %w", off, err)
+			}
+			addr = fmt.Sprintf("[%s] + (%s)", addr, expr)
+		}
+	}
+	return addr, nil
+}
+
+// address converts a Cheat Engine address to a kiwi address expression.
+// Cheat Engine numbers are hex by default, and names may contain characters kiwi requires quoted.
+func (imp *ctImporter) address(s string) (string, error) {
+	var out strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case strings.IndexByte("+-*/[]() \t", c) != -1:
+			out.WriteByte(c)
+			i++
+
+		case c == '"':
+			end := strings.IndexByte(s[i+1:], '"')
+			if end == -1 {
+				return "", fmt.Errorf("unterminated quote in address %q", s)
+			}
+			out.WriteString(s[i : i+end+2])
+			i += end + 2
+
+		default:
+			start := i
+			for i < len(s) && strings.IndexByte("+-*/[]() \t\"", s[i]) == -1 {
+				i++
+			}
+			w, err := imp.word(s[start:i])
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(w)
+		}
+	}
+	return out.String(), nil
+}
+
+// word converts a single name or number of a Cheat Engine address.
+func (imp *ctImporter) word(w string) (string, error) {
+	if !imp.names[w] {
+		hex := strings.TrimPrefix(strings.TrimPrefix(w, "0x"), "$")
+		if _, err := strconv.ParseUint(hex, 16, 64); err == nil {
+			return "0x" + hex, nil
+		}
+	}
+	name, ok := exprName(w)
+	if !ok {
+		return "", fmt.Errorf("unsupported name %q", w)
+	}
+	return name, nil
+}
+
+// ctConvertType returns an entry with the type of a Cheat Engine entry,
+// or false if the type isn't supported.
+func ctConvertType(e ctEntry) (*AddressEntry, bool) {
+	signed := e.ShowAsSigned != 0
+	switch e.VariableType {
+	case "Byte":
+		if signed {
+			return &AddressEntry{Type: TypeInt8}, true
+		}
+		return &AddressEntry{Type: TypeUint8}, true
+	case "2 Bytes":
+		if signed {
+			return &AddressEntry{Type: TypeInt16}, true
+		}
+		return &AddressEntry{Type: TypeUint16}, true
+	case "4 Bytes":
+		if signed {
+			return &AddressEntry{Type: TypeInt32}, true
+		}
+		return &AddressEntry{Type: TypeUint32}, true
+	case "8 Bytes":
+		if signed {
+			return &AddressEntry{Type: TypeInt64}, true
+		}
+		return &AddressEntry{Type: TypeUint64}, true
+	case "Float":
+		return &AddressEntry{Type: TypeFloat32}, true
+	case "Double":
+		return &AddressEntry{Type: TypeFloat64}, true
+	case "Array of byte":
+		return &AddressEntry{Type: TypeBytes, Size: e.ByteLength}, e.ByteLength > 0
+	case "String":
+		size := e.Length
+		if e.Unicode != 0 {
+			size *= 2
+		}
+		return &AddressEntry{Type: TypeBytes, Size: size}, size > 0
+	}
+	return nil, false
+}
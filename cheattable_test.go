@@ -0,0 +1,258 @@
+package kiwi
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+const testCheatTable = `<?xml version="1.0" encoding="utf-8"?>
+<CheatTable CheatEngineTableVersion="42">
+  <CheatEntries>
+    <CheatEntry>
+      <ID>0</ID>
+      <Description>"Find player"</Description>
+      <VariableType>Auto Assembler Script</VariableType>
+      <AssemblerScript>[ENABLE]
+aobscanmodule(INJECT,game.exe,F3 0F 11 ?? 04 C3) // should be unique
+aobscan(player,%s)
+define(scratch,%s)
+registersymbol(player, scratch)
+[DISABLE]
+unregistersymbol(player)
+</AssemblerScript>
+    </CheatEntry>
+    <CheatEntry>
+      <ID>1</ID>
+      <Description>"Player"</Description>
+      <GroupHeader>1</GroupHeader>
+      <CheatEntries>
+        <CheatEntry>
+          <ID>2</ID>
+          <Description>"Health"</Description>
+          <ShowAsSigned>1</ShowAsSigned>
+          <VariableType>4 Bytes</VariableType>
+          <Address>player+8</Address>
+        </CheatEntry>
+        <CheatEntry>
+          <ID>3</ID>
+          <Description>"Stats"</Description>
+          <VariableType>4 Bytes</VariableType>
+          <Address>root</Address>
+          <Offsets>
+            <Offset>4</Offset>
+            <Offset>10</Offset>
+          </Offsets>
+          <CheatEntries>
+            <CheatEntry>
+              <ID>4</ID>
+              <Description>"Speed"</Description>
+              <VariableType>Float</VariableType>
+              <Address>+8</Address>
+            </CheatEntry>
+          </CheatEntries>
+        </CheatEntry>
+        <CheatEntry>
+          <ID>5</ID>
+          <Description>"Flags"</Description>
+          <VariableType>Binary</VariableType>
+          <Address>player+C</Address>
+        </CheatEntry>
+      </CheatEntries>
+    </CheatEntry>
+  </CheatEntries>
+  <UserdefinedSymbols>
+    <SymbolEntry>
+      <Name>root</Name>
+      <Address>%X</Address>
+    </SymbolEntry>
+  </UserdefinedSymbols>
+</CheatTable>
+`
+
+func TestImportCheatTable(t *testing.T) {
+	p, err := GetProcessByFileName(currentProcessName)
+	if err != nil {
+		t.Fatalf("Error trying to open process \"%s\", Error: %s\n", currentProcessName, err.Error())
+	}
+
+	// The player structure starts with a signature generated at runtime, so it isn't in the binary.
+	type player struct {
+		sig    [8]byte
+		health int32
+	}
+	type stats struct {
+		pad   [4]byte
+		level uint32
+		pad2  uint32
+		speed float32
+	}
+	pl := &player{health: -5}
+	for i := range pl.sig {
+		pl.sig[i] = byte(i*29 + 101)
+	}
+	st := &stats{level: 12, speed: 1.5}
+	type holder struct {
+		pad [0x10]byte
+		st  *stats
+	}
+	h := &holder{st: st}
+	root := &h
+	heapSink = root
+
+	table := fmt.Sprintf(testCheatTable, fmt.Sprintf("% X", pl.sig[:]), "1234", uintptr(unsafe.Pointer(root)))
+	l, err := ImportCheatTable(strings.NewReader(table))
+	if err != nil {
+		t.Fatalf("ImportCheatTable: %s\n", err)
+	}
+
+	// INJECT isn't registered, so only player, scratch and root are imported.
+	if len(l.Symbols) != 3 || l.Symbols[0].Name != "player" || l.Symbols[1].Name != "scratch" || l.Symbols[2].Name != "root" {
+		t.Fatalf("Unexpected symbols %+v\n", l.Symbols)
+	}
+	if l.Symbols[1].Address != "0x1234" {
+		t.Fatalf("Define should be converted to hex, got %q\n", l.Symbols[1].Address)
+	}
+
+	// The script and the binary entry are skipped.
+	if len(l.Entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d\n", len(l.Entries))
+	}
+	if l.Entries[0].Description != "Health" || l.Entries[0].Group != "Player" || l.Entries[0].Type != TypeInt32 {
+		t.Fatalf("Unexpected entry %+v\n", l.Entries[0])
+	}
+	if l.Entries[2].Description != "Speed" || l.Entries[2].Group != "Player/Stats" || l.Entries[2].Type != TypeFloat32 {
+		t.Fatalf("Unexpected entry %+v\n", l.Entries[2])
+	}
+
+	vars, err := l.ResolveSymbols(&p)
+	if err != nil {
+		t.Fatalf("ResolveSymbols: %s\n", err)
+	}
+
+	// The parsed pattern is itself in memory and may be found before the player,
+	// so check that it matches the player's own memory and use that.
+	pat, err := ParsePattern(l.Symbols[0].Pattern)
+	if err != nil {
+		t.Fatalf("ParsePattern: %s\n", err)
+	}
+	plAddr := uintptr(unsafe.Pointer(pl))
+	matches, err := p.FindPattern(pat, &ScanOptions{Start: plAddr, End: plAddr + unsafe.Sizeof(*pl)})
+	if err != nil {
+		t.Fatalf("FindPattern: %s\n", err)
+	}
+	if len(matches) != 1 || matches[0] != plAddr {
+		t.Fatalf("Expected the player at 0x%X, got %X\n", plAddr, matches)
+	}
+	vars["player"] = plAddr
+
+	tests := []struct {
+		entry *AddressEntry
+		want  interface{}
+	}{
+		{l.Entries[0], int32(-5)},
+		{l.Entries[1], uint32(12)},
+		{l.Entries[2], float32(1.5)},
+	}
+	for _, tst := range tests {
+		got, err := tst.entry.Read(&p, vars)
+		if err != nil {
+			t.Fatalf("Read %q (%s): %s\n", tst.entry.Description, tst.entry.Address, err)
+		}
+		if got != tst.want {
+			t.Fatalf("Read %q got %v, expected %v\n", tst.entry.Description, got, tst.want)
+		}
+	}
+}
+
+// testPartialCheatTable has entries which can't be imported among ones which can.
+const testPartialCheatTable = `<?xml version="1.0" encoding="utf-8"?>
+<CheatTable>
+  <CheatEntries>
+    <CheatEntry>
+      <Description>"Broken"</Description>
+      <VariableType>4 Bytes</VariableType>
+      <Address>"game.exe+10</Address>
+      <CheatEntries>
+        <CheatEntry>
+          <Description>"Orphan"</Description>
+          <VariableType>4 Bytes</VariableType>
+          <Address>+8</Address>
+        </CheatEntry>
+        <CheatEntry>
+          <Description>"Ammo"</Description>
+          <VariableType>4 Bytes</VariableType>
+          <Address>base</Address>
+          <Offsets>
+            <Offset>ammoOff+4</Offset>
+            <Offset>-10</Offset>
+          </Offsets>
+        </CheatEntry>
+      </CheatEntries>
+    </CheatEntry>
+  </CheatEntries>
+  <UserdefinedSymbols>
+    <SymbolEntry>
+      <Name>base</Name>
+      <Address>game.exe+1000</Address>
+    </SymbolEntry>
+    <SymbolEntry>
+      <Name>ammoOff</Name>
+      <Address>20</Address>
+    </SymbolEntry>
+  </UserdefinedSymbols>
+</CheatTable>
+`
+
+func TestImportCheatTablePartial(t *testing.T) {
+	l, err := ImportCheatTable(strings.NewReader(testPartialCheatTable))
+	if err == nil || !strings.Contains(err.Error(), "Broken") {
+		t.Errorf("Expected the broken entry's error, got %v\n", err)
+	}
+	if l == nil || len(l.Symbols) != 2 || len(l.Entries) != 1 {
+		t.Fatalf("Expected the symbols and the Ammo entry, got %+v\n", l)
+	}
+	if e := l.Entries[0]; e.Description != "Ammo" || e.Group != "Broken" || e.Address != "[[base] - 0x10] + (ammoOff+0x4)" {
+		t.Errorf("Unexpected entry %+v\n", e)
+	}
+}
+
+func TestParsePattern(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{in: "48 8B 05 ?? ?? ?? ?? 89", want: "48 8B 05 ?? ?? ?? ?? 89"},
+		{in: "488B05????????89", want: "48 8B 05 ?? ?? ?? ?? 89"},
+		{in: "48 * 4? ?1", want: "48 ?? 4? ?1"},
+		{in: "?? ??", err: true},
+		{in: "4G", err: true},
+		{in: "", err: true},
+	}
+	for _, tst := range tests {
+		p, err := ParsePattern(tst.in)
+		if tst.err {
+			if err == nil {
+				t.Errorf("ParsePattern(%q) expected error\n", tst.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePattern(%q): %s\n", tst.in, err)
+			continue
+		}
+		if p.String() != tst.want {
+			t.Errorf("ParsePattern(%q) = %q, expected %q\n", tst.in, p.String(), tst.want)
+		}
+	}
+
+	p := MustParsePattern("12 ?? 3? ?4")
+	if !p.Match([]byte{0x12, 0xFF, 0x3A, 0xB4}) || p.Match([]byte{0x12, 0xFF, 0x4A, 0xB4}) {
+		t.Errorf("Pattern %s matched incorrectly\n", p)
+	}
+	if i := p.index([]byte{0, 0x12, 0x12, 0, 0x30, 0x04}); i != 2 {
+		t.Errorf("index got %d, expected 2\n", i)
+	}
+}
@@ -0,0 +1,49 @@
+// Command kiwi-agent serves the processes of this machine to kiwi's remote package.
+//
+// Usage:
+//
+//	kiwi-agent [-listen :7331] [-token TOKEN] [-cert cert.pem -key key.pem] [-read-only]
+//
+// The token can also be set with the KIWI_AGENT_TOKEN environment variable, which keeps it
+// out of the process list. Without -cert and -key, traffic including the token isn't encrypted.
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"log"
+	"net"
+	"os"
+
+	"github.com/Andoryuuta/kiwi/remote"
+)
+
+func main() {
+	listen := flag.String("listen", ":7331", "address to listen on")
+	token := flag.String("token", os.Getenv("KIWI_AGENT_TOKEN"), "token clients must send")
+	cert := flag.String("cert", "", "TLS certificate file")
+	key := flag.String("key", "", "TLS key file")
+	readOnly := flag.Bool("read-only", false, "reject writes")
+	insecure := flag.Bool("no-token", false, "allow clients without a token")
+	flag.Parse()
+
+	if *token == "" && !*insecure {
+		log.Fatal("a token is required, set one with -token or KIWI_AGENT_TOKEN, or pass -no-token")
+	}
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *cert != "" || *key != "" {
+		pair, err := tls.LoadX509KeyPair(*cert, *key)
+		if err != nil {
+			log.Fatal(err)
+		}
+		l = tls.NewListener(l, &tls.Config{Certificates: []tls.Certificate{pair}})
+	}
+
+	log.Printf("listening on %s", l.Addr())
+	s := &remote.Server{Token: *token, ReadOnly: *readOnly}
+	log.Fatal(s.Serve(l))
+}
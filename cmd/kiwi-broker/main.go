@@ -0,0 +1,55 @@
+// Command kiwi-broker is a privileged daemon giving unprivileged programs access to process memory.
+//
+// Usage:
+//
+//	kiwi-broker [-socket /run/kiwi-broker.sock] [-policy /etc/kiwi/broker.yaml] [-audit /var/log/kiwi-broker.log]
+//
+// It must run as root, or with CAP_SYS_PTRACE. Callers connect with broker.Dial, and may only
+// access the processes the policy allows. See the broker package for the policy's format.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Andoryuuta/kiwi/broker"
+)
+
+func main() {
+	socket := flag.String("socket", broker.DefaultSocket, "path of the socket to listen on")
+	policyPath := flag.String("policy", "/etc/kiwi/broker.yaml", "policy file")
+	auditPath := flag.String("audit", "/var/log/kiwi-broker.log", "audit log file, appended to")
+	flag.Parse()
+
+	policy, err := broker.LoadPolicy(*policyPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	audit, err := os.OpenFile(*auditPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer audit.Close()
+
+	l, err := broker.Listen(*socket)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Remove the socket when stopped.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		l.Close()
+	}()
+
+	log.Printf("listening on %s", *socket)
+	b := &broker.Broker{Policy: policy, Audit: audit}
+	if err := b.Serve(l); err != nil {
+		log.Print(err)
+	}
+}
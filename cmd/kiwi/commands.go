@@ -0,0 +1,661 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Andoryuuta/kiwi"
+)
+
+func runPS(e *env, args []string) error {
+	f := e.newFlags("ps", "[name]", false, 0, 1)
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	procs, err := kiwi.ListProcesses()
+	if err != nil {
+		return err
+	}
+
+	type proc struct {
+		PID  int    `json:"pid"`
+		Name string `json:"name"`
+	}
+	out := []proc{}
+	for _, pi := range procs {
+		if f.NArg() == 1 && !strings.Contains(strings.ToLower(pi.Name), strings.ToLower(f.Arg(0))) {
+			continue
+		}
+		out = append(out, proc{pi.PID, pi.Name})
+	}
+	if f.json {
+		return e.printJSON(out)
+	}
+	for _, pi := range out {
+		fmt.Fprintf(e.out, "%7d  %s\n", pi.PID, pi.Name)
+	}
+	return nil
+}
+
+func runMaps(e *env, args []string) error {
+	f := e.newFlags("maps", "", true, 0)
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	p, err := e.process(f)
+	if err != nil {
+		return err
+	}
+	regions, err := p.Regions()
+	if err != nil {
+		return err
+	}
+
+	if f.json {
+		type region struct {
+			Base   hexAddr `json:"base"`
+			End    hexAddr `json:"end"`
+			Perm   string  `json:"perm"`
+			Offset hexAddr `json:"offset"`
+			Path   string  `json:"path,omitempty"`
+		}
+		out := []region{}
+		for _, r := range regions {
+			out = append(out, region{hexAddr(r.Base), hexAddr(r.End()), r.Perm.String(), hexAddr(r.Offset), r.Path})
+		}
+		return e.printJSON(out)
+	}
+	for _, r := range regions {
+		fmt.Fprintf(e.out, "%012X-%012X %s %08X %s\n", r.Base, r.End(), r.Perm, r.Offset, r.Path)
+	}
+	return nil
+}
+
+func runModules(e *env, args []string) error {
+	f := e.newFlags("modules", "", true, 0)
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	p, err := e.process(f)
+	if err != nil {
+		return err
+	}
+	modules, err := p.Modules()
+	if err != nil {
+		return err
+	}
+
+	if f.json {
+		type module struct {
+			Name string  `json:"name"`
+			Path string  `json:"path,omitempty"`
+			Base hexAddr `json:"base"`
+			Size hexAddr `json:"size"`
+		}
+		out := []module{}
+		for _, m := range modules {
+			out = append(out, module{m.Name, m.Path, hexAddr(m.Base), hexAddr(m.Size)})
+		}
+		return e.printJSON(out)
+	}
+	for _, m := range modules {
+		fmt.Fprintf(e.out, "%012X %8X  %s\n", m.Base, m.Size, m.Path)
+	}
+	return nil
+}
+
+// maxSize is the largest number of bytes read at once for display, like remote.MaxRead.
+const maxSize = 16 << 20
+
+// checkSize checks a number of bytes to read for display.
+func checkSize(n int) error {
+	if n <= 0 || n > maxSize {
+		return fmt.Errorf("size %d isn't between 1 and %d", n, maxSize)
+	}
+	return nil
+}
+
+// readTyped reads a value of the named type. n is the number of bytes for the bytes type.
+func readTyped(p *kiwi.Process, addr uintptr, typ string, n int) (interface{}, error) {
+	switch typ {
+	case "ptr":
+		ptr, err := p.ReadPointer(addr)
+		return hexAddr(ptr), err
+	case "string":
+		return p.ReadNullTerminatedUTF8String(addr)
+	}
+	t, err := kiwi.ParseValueType(typ)
+	if err != nil {
+		return nil, err
+	}
+	if t == kiwi.TypeBytes {
+		if err := checkSize(n); err != nil {
+			return nil, err
+		}
+		return p.ReadBytes(addr, n)
+	}
+	return p.ReadValue(addr, t)
+}
+
+// writeTyped writes a value of the named type, given in the form accepted by kiwi.ParseValue.
+func writeTyped(p *kiwi.Process, addr uintptr, typ, value string) error {
+	switch typ {
+	case "ptr":
+		v, err := strconv.ParseUint(value, 0, 64)
+		if err != nil {
+			return err
+		}
+		size, err := p.PointerSize()
+		if err != nil {
+			return err
+		}
+		if size == 4 {
+			if v > 0xFFFFFFFF {
+				return fmt.Errorf("pointer 0x%X doesn't fit in 32 bits", v)
+			}
+			return p.WriteUint32(addr, uint32(v))
+		}
+		return p.WriteUint64(addr, v)
+	case "string":
+		return p.WriteBytes(addr, append([]byte(value), 0))
+	}
+	t, err := kiwi.ParseValueType(typ)
+	if err != nil {
+		return err
+	}
+	v, err := kiwi.ParseValue(t, value)
+	if err != nil {
+		return err
+	}
+	return p.WriteValue(addr, v)
+}
+
+// formatTyped formats a value returned by readTyped.
+func formatTyped(v interface{}) string {
+	switch v := v.(type) {
+	case hexAddr:
+		return fmt.Sprintf("0x%X", uintptr(v))
+	case string:
+		return strconv.Quote(v)
+	}
+	return kiwi.FormatValue(v)
+}
+
+func runRead(e *env, args []string) error {
+	f := e.newFlags("read", "<addr> <type>", true, 2)
+	n := f.Int("n", 16, "number of bytes to read for the bytes type")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	p, err := e.process(f)
+	if err != nil {
+		return err
+	}
+	addr, err := p.Eval(f.Arg(0))
+	if err != nil {
+		return err
+	}
+	v, err := readTyped(p, addr, f.Arg(1), *n)
+	if err != nil {
+		return err
+	}
+
+	if f.json {
+		if b, ok := v.([]byte); ok {
+			v = kiwi.FormatValue(b)
+		}
+		return e.printJSON(struct {
+			Addr  hexAddr     `json:"addr"`
+			Type  string      `json:"type"`
+			Value interface{} `json:"value"`
+		}{hexAddr(addr), f.Arg(1), v})
+	}
+	fmt.Fprintln(e.out, formatTyped(v))
+	return nil
+}
+
+func runWrite(e *env, args []string) error {
+	f := e.newFlags("write", "<addr> <type> <value>", true, 3)
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	p, err := e.process(f)
+	if err != nil {
+		return err
+	}
+	addr, err := p.Eval(f.Arg(0))
+	if err != nil {
+		return err
+	}
+	return writeTyped(p, addr, f.Arg(1), f.Arg(2))
+}
+
+// parseSize parses an optional size argument, in decimal or hex.
+func parseSize(f *flags, i int, def int) (int, error) {
+	if f.NArg() <= i {
+		return def, nil
+	}
+	n, err := strconv.ParseUint(f.Arg(i), 0, 31)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("bad size %q", f.Arg(i))
+	}
+	return int(n), nil
+}
+
+// hexdump writes data, read from addr, as lines of hex and ASCII.
+func hexdump(w io.Writer, addr uintptr, data []byte) {
+	for off := 0; off < len(data); off += 16 {
+		line := data[off:]
+		if len(line) > 16 {
+			line = line[:16]
+		}
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "%012X  ", addr+uintptr(off))
+		for i := 0; i < 16; i++ {
+			if i == 8 {
+				b.WriteByte(' ')
+			}
+			if i < len(line) {
+				fmt.Fprintf(&b, "%02X ", line[i])
+			} else {
+				b.WriteString("   ")
+			}
+		}
+		b.WriteString(" |")
+		for _, c := range line {
+			if c < 0x20 || c >= 0x7F {
+				c = '.'
+			}
+			b.WriteByte(c)
+		}
+		b.WriteString("|\n")
+		io.WriteString(w, b.String())
+	}
+}
+
+func runHexdump(e *env, args []string) error {
+	f := e.newFlags("hexdump", "<addr> [size]", true, 1, 2)
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	p, err := e.process(f)
+	if err != nil {
+		return err
+	}
+	addr, err := p.Eval(f.Arg(0))
+	if err != nil {
+		return err
+	}
+	size, err := parseSize(f, 1, 256)
+	if err != nil {
+		return err
+	}
+	if err := checkSize(size); err != nil {
+		return err
+	}
+	data, err := p.ReadBytes(addr, size)
+	if err != nil {
+		return err
+	}
+
+	if f.json {
+		return e.printJSON(struct {
+			Addr hexAddr `json:"addr"`
+			Data string  `json:"data"`
+		}{hexAddr(addr), fmt.Sprintf("%X", data)})
+	}
+	hexdump(e.out, addr, data)
+	return nil
+}
+
+// address is an address found by a command, for JSON output.
+type address struct {
+	Addr     hexAddr `json:"addr"`
+	Location string  `json:"location,omitempty"`
+}
+
+func runFindPattern(e *env, args []string) error {
+	f := e.newFlags("find-pattern", "<pattern>", true)
+	module := f.String("module", "", "only search the named module")
+	limit := f.Int("limit", 0, "stop after this many matches")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	if f.NArg() == 0 {
+		f.Usage()
+		return flag.ErrHelp
+	}
+	p, err := e.process(f)
+	if err != nil {
+		return err
+	}
+	// Patterns are often given unquoted, as separate arguments.
+	pat, err := kiwi.ParsePattern(strings.Join(f.Args(), " "))
+	if err != nil {
+		return err
+	}
+	matches, err := p.FindPattern(pat, &kiwi.ScanOptions{Module: *module, Limit: *limit})
+	if err != nil {
+		return err
+	}
+
+	modules, _ := p.Modules()
+	out := []address{}
+	for _, addr := range matches {
+		out = append(out, address{hexAddr(addr), location(modules, addr)})
+	}
+	if f.json {
+		return e.printJSON(out)
+	}
+	for _, a := range out {
+		fmt.Fprintf(e.out, "%012X  %s\n", uintptr(a.Addr), a.Location)
+	}
+	return nil
+}
+
+// parseEncodings parses a comma-separated list of string encodings, e.g. "ascii,utf-16le".
+func parseEncodings(s string) ([]kiwi.StringEncoding, error) {
+	if s == "" {
+		return nil, nil
+	}
+	all := []kiwi.StringEncoding{kiwi.EncodingASCII, kiwi.EncodingUTF8, kiwi.EncodingUTF16LE, kiwi.EncodingUTF16BE}
+	var encodings []kiwi.StringEncoding
+outer:
+	for _, name := range strings.Split(s, ",") {
+		for _, enc := range all {
+			if strings.EqualFold(strings.TrimSpace(name), enc.String()) {
+				encodings = append(encodings, enc)
+				continue outer
+			}
+		}
+		return nil, fmt.Errorf("unknown encoding %q", name)
+	}
+	return encodings, nil
+}
+
+func runStrings(e *env, args []string) error {
+	f := e.newFlags("strings", "", true, 0)
+	module := f.String("module", "", "only search the named module")
+	min := f.Int("min", 4, "minimum length in characters")
+	contains := f.String("contains", "", "only find strings containing this")
+	encodings := f.String("encoding", "", "comma-separated encodings to find: ascii, utf-8, utf-16le, utf-16be")
+	limit := f.Int("limit", 0, "stop after this many strings")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	p, err := e.process(f)
+	if err != nil {
+		return err
+	}
+	opts := &kiwi.StringOptions{
+		ScanOptions: kiwi.ScanOptions{Module: *module, Limit: *limit},
+		MinLength:   *min,
+		Contains:    *contains,
+	}
+	if opts.Encodings, err = parseEncodings(*encodings); err != nil {
+		return err
+	}
+	found, err := p.FindStrings(opts)
+	if err != nil {
+		return err
+	}
+
+	if f.json {
+		type str struct {
+			Addr     hexAddr `json:"addr"`
+			Encoding string  `json:"encoding"`
+			Module   string  `json:"module,omitempty"`
+			Value    string  `json:"value"`
+		}
+		out := []str{}
+		for _, s := range found {
+			out = append(out, str{hexAddr(s.Addr), s.Encoding.String(), s.Module, s.Value})
+		}
+		return e.printJSON(out)
+	}
+	for _, s := range found {
+		fmt.Fprintf(e.out, "%012X  %-8s  %q\n", s.Addr, s.Encoding, s.Value)
+	}
+	return nil
+}
+
+// readMemory reads size bytes at addr. Unreadable memory inside of the range, such as gaps
+// between the sections of a module, is read as zeros.
+func readMemory(p *kiwi.Process, addr uintptr, size int) ([]byte, error) {
+	data, err := p.ReadBytes(addr, size)
+	if err == nil {
+		return data, nil
+	}
+	regions, rerr := p.Regions()
+	if rerr != nil {
+		return nil, err
+	}
+
+	data = make([]byte, size)
+	end := addr + uintptr(size)
+	read := false
+	for _, r := range regions {
+		if r.Perm&kiwi.PermRead == 0 || r.End() <= addr || r.Base >= end {
+			continue
+		}
+		start, stop := r.Base, r.End()
+		if start < addr {
+			start = addr
+		}
+		if stop > end {
+			stop = end
+		}
+		b, rerr := p.ReadBytes(start, int(stop-start))
+		if rerr != nil {
+			continue
+		}
+		copy(data[start-addr:], b)
+		read = true
+	}
+	if !read {
+		return nil, err
+	}
+	return data, nil
+}
+
+// dumpChunk is the number of bytes read at once by dumpMemory.
+var dumpChunk = maxSize
+
+// dumpMemory writes size bytes at addr to w, reading them a chunk at a time so dumps of any size
+// don't need to fit in memory. Like readMemory, unreadable memory inside of the range is written
+// as zeros, and nothing is written if none of the range can be read.
+func dumpMemory(w io.Writer, p *kiwi.Process, addr uintptr, size int) error {
+	var firstErr error
+	zeros := 0 // Unreadable bytes not written yet, as nothing may be readable.
+	read := false
+	for off := 0; off < size; off += dumpChunk {
+		n := size - off
+		if n > dumpChunk {
+			n = dumpChunk
+		}
+		data, err := readMemory(p, addr+uintptr(off), n)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			zeros += n
+			continue
+		}
+		if err := writeZeros(w, zeros); err != nil {
+			return err
+		}
+		zeros = 0
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		read = true
+	}
+	if !read {
+		return firstErr
+	}
+	return writeZeros(w, zeros)
+}
+
+// writeZeros writes n zero bytes to w.
+func writeZeros(w io.Writer, n int) error {
+	zero := make([]byte, dumpChunk)
+	if n < len(zero) {
+		zero = zero[:n]
+	}
+	for n > 0 {
+		m := n
+		if m > len(zero) {
+			m = len(zero)
+		}
+		if _, err := w.Write(zero[:m]); err != nil {
+			return err
+		}
+		n -= m
+	}
+	return nil
+}
+
+// defaultSize returns the size to dump at addr if none is given: the size of the module
+// if addr is a module's base, otherwise the rest of the region containing addr.
+func defaultSize(p *kiwi.Process, addr uintptr) (int, error) {
+	if m, ok := p.ModuleAt(addr); ok && m.Base == addr {
+		return int(m.Size), nil
+	}
+	regions, err := p.Regions()
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range regions {
+		if r.Contains(addr) {
+			return int(r.End() - addr), nil
+		}
+	}
+	return 0, fmt.Errorf("0x%X isn't mapped", addr)
+}
+
+func runDump(e *env, args []string) error {
+	f := e.newFlags("dump", "<addr> [size]", true, 1, 2)
+	output := f.String("o", "", "`file` to write to, instead of standard output")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	p, err := e.process(f)
+	if err != nil {
+		return err
+	}
+	addr, err := p.Eval(f.Arg(0))
+	if err != nil {
+		return err
+	}
+	size, err := parseSize(f, 1, 0)
+	if err != nil {
+		return err
+	}
+	if size == 0 {
+		if size, err = defaultSize(p, addr); err != nil {
+			return err
+		}
+	}
+
+	if *output == "" || *output == "-" {
+		return dumpMemory(e.out, p, addr, size)
+	}
+	out, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	err = dumpMemory(out, p, addr, size)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(*output)
+		return err
+	}
+	if f.json {
+		return e.printJSON(struct {
+			Addr hexAddr `json:"addr"`
+			Size int     `json:"size"`
+			File string  `json:"file"`
+		}{hexAddr(addr), size, *output})
+	}
+	fmt.Fprintf(e.out, "Dumped %d bytes at 0x%X to %s\n", size, addr, *output)
+	return nil
+}
+
+// change is a run of bytes which differ between memory and a dump.
+type change struct {
+	Addr     hexAddr `json:"addr"`
+	Location string  `json:"location,omitempty"`
+	Old      string  `json:"old"`
+	New      string  `json:"new"`
+}
+
+// diffBytes returns the runs of bytes which differ between old and new, read from addr.
+func diffBytes(modules []kiwi.Module, addr uintptr, old, new []byte) []change {
+	changes := []change{}
+	for i := 0; i < len(old); {
+		if old[i] == new[i] {
+			i++
+			continue
+		}
+		j := i
+		for j < len(old) && old[j] != new[j] {
+			j++
+		}
+		a := addr + uintptr(i)
+		changes = append(changes, change{hexAddr(a), location(modules, a), fmt.Sprintf("% X", old[i:j]), fmt.Sprintf("% X", new[i:j])})
+		i = j
+	}
+	return changes
+}
+
+func runDiff(e *env, args []string) error {
+	f := e.newFlags("diff", "<addr> <file>", true, 2)
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	p, err := e.process(f)
+	if err != nil {
+		return err
+	}
+	addr, err := p.Eval(f.Arg(0))
+	if err != nil {
+		return err
+	}
+	old, err := ioutil.ReadFile(f.Arg(1))
+	if err != nil {
+		return err
+	}
+	if len(old) == 0 {
+		return errors.New(f.Arg(1) + " is empty")
+	}
+	data, err := readMemory(p, addr, len(old))
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(old, data) {
+		if f.json {
+			return e.printJSON([]change{})
+		}
+		return nil
+	}
+
+	modules, _ := p.Modules()
+	changes := diffBytes(modules, addr, old, data)
+	if f.json {
+		return e.printJSON(changes)
+	}
+	for _, c := range changes {
+		fmt.Fprintf(e.out, "%012X  %s\n  - %s\n  + %s\n", uintptr(c.Addr), c.Location, c.Old, c.New)
+	}
+	return nil
+}
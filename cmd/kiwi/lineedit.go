@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// errInterrupted is returned by readLine when the line is cancelled with Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+// maxHistory is the number of lines of history kept.
+const maxHistory = 1000
+
+// lineEditor reads lines from a terminal, with history and tab completion.
+// If the input isn't a terminal, lines are read as is.
+type lineEditor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	history []string
+
+	// makeRaw puts the terminal into raw mode, returning a function restoring it.
+	// nil if the input isn't a terminal.
+	makeRaw func() (restore func(), err error)
+
+	// complete returns the word ending the text before the cursor, and the completions of it.
+	complete func(head string) (word string, candidates []string)
+
+	// Editing state.
+	buf     []rune
+	pos     int
+	prompt  string
+	histPos int    // Index into history being edited, len(history) for a new line.
+	saved   string // The new line, while history is being browsed.
+	lastTab bool   // Whether the last key was tab, to list candidates on a second press.
+}
+
+// newLineEditor returns a line editor reading from in, which is treated as a terminal if it's one.
+func newLineEditor(in io.Reader, out io.Writer) *lineEditor {
+	ed := &lineEditor{in: bufio.NewReader(in), out: out}
+	if f, ok := in.(*os.File); ok {
+		ed.makeRaw = func() (func(), error) {
+			return makeRaw(f.Fd())
+		}
+	}
+	return ed
+}
+
+// addHistory adds a line to the history, unless it's empty or repeats the last line.
+func (ed *lineEditor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" || (len(ed.history) > 0 && ed.history[len(ed.history)-1] == line) {
+		return
+	}
+	ed.history = append(ed.history, line)
+	if len(ed.history) > maxHistory {
+		ed.history = ed.history[len(ed.history)-maxHistory:]
+	}
+}
+
+// loadHistory reads history from a file, one line per entry. A missing file is ignored.
+func (ed *lineEditor) loadHistory(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		ed.addHistory(s.Text())
+	}
+	return s.Err()
+}
+
+// saveHistory writes the history to a file.
+func (ed *lineEditor) saveHistory(path string) error {
+	var b strings.Builder
+	for _, line := range ed.history {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return writeFileAtomic(path, []byte(b.String()))
+}
+
+// writeFileAtomic writes a file through a temporary file, so it's never left half written.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readLine reads a line, showing the prompt if the input is a terminal.
+// It returns io.EOF at the end of the input or when Ctrl-D is pressed on an empty line.
+func (ed *lineEditor) readLine(prompt string) (string, error) {
+	var restore func()
+	var err error
+	if ed.makeRaw != nil {
+		restore, err = ed.makeRaw()
+	}
+	if ed.makeRaw == nil || err != nil {
+		return ed.readPlain()
+	}
+	defer restore()
+
+	ed.prompt = prompt
+	ed.buf = ed.buf[:0]
+	ed.pos = 0
+	ed.histPos = len(ed.history)
+	ed.lastTab = false
+	ed.refresh()
+
+	for {
+		r, _, err := ed.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		tab := r == '\t'
+		done, err := ed.key(r)
+		ed.lastTab = tab
+		if done || err != nil {
+			fmt.Fprint(ed.out, "\r\n")
+			return string(ed.buf), err
+		}
+	}
+}
+
+// readPlain reads a line from input which isn't a terminal.
+func (ed *lineEditor) readPlain() (string, error) {
+	line, err := ed.in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// key handles a key, returning whether the line is finished.
+func (ed *lineEditor) key(r rune) (bool, error) {
+	switch r {
+	case '\r', '\n':
+		return true, nil
+	case 3: // Ctrl-C
+		ed.buf = ed.buf[:0]
+		fmt.Fprint(ed.out, "^C")
+		return true, errInterrupted
+	case 4: // Ctrl-D
+		if len(ed.buf) == 0 {
+			return true, io.EOF
+		}
+		ed.delete(ed.pos)
+	case 1: // Ctrl-A
+		ed.pos = 0
+	case 5: // Ctrl-E
+		ed.pos = len(ed.buf)
+	case 2: // Ctrl-B
+		ed.move(-1)
+	case 6: // Ctrl-F
+		ed.move(1)
+	case 11: // Ctrl-K
+		ed.buf = ed.buf[:ed.pos]
+	case 21: // Ctrl-U
+		ed.buf = append(ed.buf[:0], ed.buf[ed.pos:]...)
+		ed.pos = 0
+	case 23: // Ctrl-W
+		start := ed.pos
+		for start > 0 && ed.buf[start-1] == ' ' {
+			start--
+		}
+		for start > 0 && ed.buf[start-1] != ' ' {
+			start--
+		}
+		ed.buf = append(ed.buf[:start], ed.buf[ed.pos:]...)
+		ed.pos = start
+	case 12: // Ctrl-L
+		fmt.Fprint(ed.out, "\x1b[H\x1b[2J")
+	case 16: // Ctrl-P
+		ed.browse(-1)
+	case 14: // Ctrl-N
+		ed.browse(1)
+	case 8, 127: // Backspace
+		if ed.pos > 0 {
+			ed.pos--
+			ed.delete(ed.pos)
+		}
+	case '\t':
+		ed.tab()
+	case 27: // Escape sequences for the arrow keys and others.
+		ed.escape()
+	default:
+		if unicode.IsPrint(r) {
+			ed.buf = append(ed.buf, 0)
+			copy(ed.buf[ed.pos+1:], ed.buf[ed.pos:])
+			ed.buf[ed.pos] = r
+			ed.pos++
+		}
+	}
+	ed.refresh()
+	return false, nil
+}
+
+// escape handles the rest of an escape sequence, such as "[A" for the up arrow.
+func (ed *lineEditor) escape() {
+	r, _, err := ed.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return
+	}
+	// Read parameters up to the final byte.
+	var params []rune
+	for {
+		r, _, err = ed.in.ReadRune()
+		if err != nil {
+			return
+		}
+		if (r < '0' || r > '9') && r != ';' {
+			break
+		}
+		params = append(params, r)
+	}
+
+	switch r {
+	case 'A':
+		ed.browse(-1)
+	case 'B':
+		ed.browse(1)
+	case 'C':
+		ed.move(1)
+	case 'D':
+		ed.move(-1)
+	case 'H':
+		ed.pos = 0
+	case 'F':
+		ed.pos = len(ed.buf)
+	case '~':
+		switch string(params) {
+		case "1", "7":
+			ed.pos = 0
+		case "4", "8":
+			ed.pos = len(ed.buf)
+		case "3":
+			ed.delete(ed.pos)
+		}
+	}
+}
+
+func (ed *lineEditor) move(n int) {
+	ed.pos += n
+	if ed.pos < 0 {
+		ed.pos = 0
+	}
+	if ed.pos > len(ed.buf) {
+		ed.pos = len(ed.buf)
+	}
+}
+
+// delete deletes the character at i, if there is one.
+func (ed *lineEditor) delete(i int) {
+	if i < len(ed.buf) {
+		ed.buf = append(ed.buf[:i], ed.buf[i+1:]...)
+	}
+}
+
+// browse moves through the history by n lines.
+func (ed *lineEditor) browse(n int) {
+	i := ed.histPos + n
+	if i < 0 || i > len(ed.history) {
+		return
+	}
+	if ed.histPos == len(ed.history) {
+		ed.saved = string(ed.buf)
+	}
+	ed.histPos = i
+	line := ed.saved
+	if i < len(ed.history) {
+		line = ed.history[i]
+	}
+	ed.buf = []rune(line)
+	ed.pos = len(ed.buf)
+}
+
+// tab completes the word before the cursor. If there are several completions, as much as they
+// have in common is inserted, and they're listed when tab is pressed again.
+func (ed *lineEditor) tab() {
+	if ed.complete == nil {
+		return
+	}
+	word, candidates := ed.complete(string(ed.buf[:ed.pos]))
+	if len(candidates) == 0 {
+		return
+	}
+
+	prefix := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	insert := []rune(strings.TrimPrefix(prefix, word))
+	if len(candidates) == 1 {
+		insert = append(insert, ' ')
+	}
+	if len(insert) > 0 {
+		rest := append([]rune(nil), ed.buf[ed.pos:]...)
+		ed.buf = append(append(ed.buf[:ed.pos], insert...), rest...)
+		ed.pos += len(insert)
+		return
+	}
+	if ed.lastTab {
+		fmt.Fprintf(ed.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+	}
+}
+
+// refresh redraws the line, leaving the cursor in place.
+func (ed *lineEditor) refresh() {
+	fmt.Fprintf(ed.out, "\r%s%s\x1b[K", ed.prompt, string(ed.buf))
+	if back := len(ed.buf) - ed.pos; back > 0 {
+		fmt.Fprintf(ed.out, "\x1b[%dD", back)
+	}
+}
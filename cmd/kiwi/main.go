@@ -0,0 +1,208 @@
+// Command kiwi reads, writes and searches the memory of running processes.
+//
+// Usage:
+//
+//	kiwi ps [-json] [name]
+//	kiwi maps -p <pid|name> [-json]
+//	kiwi modules -p <pid|name> [-json]
+//	kiwi read -p <pid|name> [-n size] [-json] <addr> <type>
+//	kiwi write -p <pid|name> <addr> <type> <value>
+//	kiwi hexdump -p <pid|name> [-json] <addr> [size]
+//	kiwi find-pattern -p <pid|name> [-module name] [-limit n] [-json] <pattern>
+//	kiwi strings -p <pid|name> [-module name] [-min n] [-contains s] [-limit n] [-json]
+//	kiwi dump -p <pid|name> [-o file] <addr> [size]
+//	kiwi diff -p <pid|name> [-json] <addr> <file>
+//	kiwi repl <pid|name>
+//
+// Processes are selected by PID or executable name, and addresses are address expressions
+// such as "game.exe+0x1A2B30 -> [+0x18]" (see kiwi.ParseExpr). Flags go before other arguments.
+//
+// Types are those of kiwi.ParseValueType, such as uint32 and float32, as well as ptr for
+// a pointer of the process's size and string for a null-terminated UTF-8 string.
+//
+// The repl command starts an interactive session with a process, with history and tab
+// completion, for reading and writing values, following pointers, disassembling, and
+// scanning for values step by step. Type help in it for its commands.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/Andoryuuta/kiwi"
+)
+
+// command is a subcommand of kiwi.
+type command struct {
+	name    string
+	summary string
+	run     func(e *env, args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"ps", "list processes", runPS},
+		{"maps", "list memory regions", runMaps},
+		{"modules", "list loaded modules", runModules},
+		{"read", "read a value", runRead},
+		{"write", "write a value", runWrite},
+		{"hexdump", "show memory in hex", runHexdump},
+		{"find-pattern", "find a byte pattern, e.g. \"48 8B ?? ?? 89\"", runFindPattern},
+		{"strings", "find strings", runStrings},
+		{"dump", "save memory to a file", runDump},
+		{"diff", "compare memory with a file saved by dump", runDiff},
+		{"repl", "explore a process interactively", runREPL},
+	}
+}
+
+// env is what commands run with, replaced in tests.
+type env struct {
+	in     io.Reader
+	out    io.Writer
+	errOut io.Writer
+
+	// open opens the process selected with -p.
+	open func(target string) (*kiwi.Process, error)
+
+	// history is the file the REPL's history is kept in, none if empty.
+	history string
+}
+
+func main() {
+	e := &env{in: os.Stdin, out: os.Stdout, errOut: os.Stderr, open: openProcess}
+	if home, err := os.UserHomeDir(); err == nil {
+		e.history = filepath.Join(home, ".kiwi_history")
+	}
+	os.Exit(e.run(os.Args[1:]))
+}
+
+// run runs the command line and returns the exit status.
+func (e *env) run(args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "-help" {
+		e.usage()
+		return 2
+	}
+	for _, c := range commands {
+		if c.name != args[0] {
+			continue
+		}
+		err := c.run(e, args[1:])
+		switch {
+		case err == flag.ErrHelp:
+			return 2
+		case err != nil:
+			fmt.Fprintf(e.errOut, "kiwi %s: %s\n", c.name, err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Fprintf(e.errOut, "kiwi: unknown command %q\n", args[0])
+	e.usage()
+	return 2
+}
+
+func (e *env) usage() {
+	fmt.Fprintf(e.errOut, "Usage: kiwi <command> [flags] [args]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(e.errOut, "  %-13s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(e.errOut, "\nRun kiwi <command> -h for a command's flags.\n")
+}
+
+// openProcess opens a process by PID, or by executable name if target isn't a number.
+func openProcess(target string) (*kiwi.Process, error) {
+	var p kiwi.Process
+	var err error
+	if pid, perr := strconv.Atoi(target); perr == nil {
+		p, err = kiwi.GetProcessByPID(pid)
+	} else {
+		p, err = kiwi.GetProcessByFileName(target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// flags are a command's flags, with those common to all commands.
+type flags struct {
+	*flag.FlagSet
+	target string
+	json   bool
+	nargs  []int // Allowed numbers of arguments.
+}
+
+// newFlags returns the flags of a command taking the given arguments, described by usage.
+// Commands which act on a process get the -p flag.
+func (e *env) newFlags(name, usage string, process bool, nargs ...int) *flags {
+	f := &flags{FlagSet: flag.NewFlagSet(name, flag.ContinueOnError), nargs: nargs}
+	f.SetOutput(e.errOut)
+	if process {
+		f.StringVar(&f.target, "p", "", "the process, by `pid or name`")
+	}
+	f.BoolVar(&f.json, "json", false, "print JSON")
+	f.Usage = func() {
+		fmt.Fprintf(e.errOut, "Usage: kiwi %s [flags] %s\n", name, usage)
+		f.PrintDefaults()
+	}
+	return f
+}
+
+// parse parses the command line, checking the number of arguments.
+// Errors are printed with the command's usage.
+func (f *flags) parse(args []string) error {
+	if err := f.Parse(args); err != nil {
+		return flag.ErrHelp
+	}
+	for _, n := range f.nargs {
+		if f.NArg() == n {
+			return nil
+		}
+	}
+	if len(f.nargs) == 0 {
+		return nil
+	}
+	f.Usage()
+	return flag.ErrHelp
+}
+
+// process opens the process selected with -p.
+func (e *env) process(f *flags) (*kiwi.Process, error) {
+	if f.target == "" {
+		return nil, errors.New("select a process with -p <pid|name>")
+	}
+	return e.open(f.target)
+}
+
+// printJSON prints v as indented JSON.
+func (e *env) printJSON(v interface{}) error {
+	enc := json.NewEncoder(e.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// hexAddr is an address, written in hex in JSON.
+type hexAddr uintptr
+
+// MarshalText implements encoding.TextMarshaler.
+func (a hexAddr) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("0x%X", uintptr(a))), nil
+}
+
+// location returns addr as module+offset, or "" if it isn't inside of a module.
+func location(modules []kiwi.Module, addr uintptr) string {
+	for _, m := range modules {
+		if m.Contains(addr) {
+			return fmt.Sprintf("%s+0x%X", m.Name, addr-m.Base)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Andoryuuta/kiwi"
+	"github.com/Andoryuuta/kiwi/kiwitest"
+)
+
+// testEnv returns an env which opens a fake process named "game.exe", and its output.
+func testEnv() (*env, *kiwitest.Fake, *bytes.Buffer) {
+	f := kiwitest.New()
+	image := f.Map(0x140000000, 0x2000, kiwi.PermRead|kiwi.PermExec)
+	copy(image[0x100:], []byte{0x48, 0x8B, 0x05, 0x11, 0x22, 0x33, 0x44, 0x90})
+	copy(image[0x200:], "Hello, kiwi!\x00")
+	f.AddModule("game.exe", 0x140000000, 0x2000)
+	f.Map(0x20000000, 0x1000, kiwi.PermRead|kiwi.PermWrite)
+	f.PutUint64(0x20000010, 0x20000100)
+	f.PutUint32(0x20000108, 1337)
+
+	var out bytes.Buffer
+	e := &env{out: &out, errOut: ioutil.Discard, open: func(target string) (*kiwi.Process, error) {
+		return f.Process(), nil
+	}}
+	return e, f, &out
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"read", "-p", "game.exe", "[0x20000010] + 8", "uint32"}, "1337\n"},
+		{[]string{"read", "-p", "game.exe", "0x20000010", "ptr"}, "0x20000100\n"},
+		{[]string{"read", "-p", "game.exe", "game.exe+0x200", "string"}, "\"Hello, kiwi!\"\n"},
+		{[]string{"read", "-p", "game.exe", "-n", "3", "game.exe+0x100", "bytes"}, "48 8B 05\n"},
+		{[]string{"hexdump", "-p", "game.exe", "game.exe+0x200", "13"},
+			"000140000200  48 65 6C 6C 6F 2C 20 6B  69 77 69 21 00           |Hello, kiwi!.|\n"},
+		{[]string{"find-pattern", "-p", "game.exe", "48", "8B", "05", "??", "??", "??", "??", "90"}, "000140000100  game.exe+0x100\n"},
+		{[]string{"strings", "-p", "game.exe", "-min", "6", "-encoding", "ascii"}, "000140000200  ascii     \"Hello, kiwi!\"\n"},
+		{[]string{"modules", "-p", "game.exe"}, "000140000000     2000  game.exe\n"},
+	}
+	for _, test := range tests {
+		e, _, out := testEnv()
+		if status := e.run(test.args); status != 0 || out.String() != test.want {
+			t.Errorf("%s: expected %q, got %q (status %d)\n", strings.Join(test.args, " "), test.want, out.String(), status)
+		}
+	}
+}
+
+func TestWriteAndJSON(t *testing.T) {
+	e, f, out := testEnv()
+	if status := e.run([]string{"write", "-p", "1000", "0x20000020", "float32", "2.5"}); status != 0 {
+		t.Fatalf("write failed with status %d\n", status)
+	}
+	if status := e.run([]string{"write", "-p", "1000", "0x20000030", "ptr", "0x1234"}); status != 0 {
+		t.Fatalf("write failed with status %d\n", status)
+	}
+	if got := f.Peek(0x20000030, 8); !bytes.Equal(got, []byte{0x34, 0x12, 0, 0, 0, 0, 0, 0}) {
+		t.Errorf("Unexpected pointer % X\n", got)
+	}
+
+	out.Reset()
+	if status := e.run([]string{"read", "-p", "1000", "-json", "0x20000020", "float32"}); status != 0 {
+		t.Fatalf("read failed with status %d\n", status)
+	}
+	var v struct {
+		Addr  string
+		Type  string
+		Value float64
+	}
+	if err := json.Unmarshal(out.Bytes(), &v); err != nil || v.Addr != "0x20000020" || v.Type != "float32" || v.Value != 2.5 {
+		t.Errorf("Unexpected output %q (%v)\n", out.String(), err)
+	}
+
+	out.Reset()
+	if status := e.run([]string{"maps", "-p", "1000", "-json"}); status != 0 {
+		t.Fatalf("maps failed with status %d\n", status)
+	}
+	var regions []map[string]string
+	if err := json.Unmarshal(out.Bytes(), &regions); err != nil || len(regions) != 2 || regions[0]["perm"] != "rw-" || regions[0]["end"] != "0x20001000" {
+		t.Errorf("Unexpected output %q (%v)\n", out.String(), err)
+	}
+
+	// Errors and bad command lines fail.
+	if status := e.run([]string{"read", "-p", "1000", "0x30000000", "uint32"}); status != 1 {
+		t.Errorf("Expected status 1 reading unmapped memory, got %d\n", status)
+	}
+	if status := e.run([]string{"read", "0x20000000", "uint32"}); status != 1 {
+		t.Errorf("Expected status 1 without a process, got %d\n", status)
+	}
+	if status := e.run([]string{"read", "-p", "1000", "0x20000000"}); status != 2 {
+		t.Errorf("Expected status 2 with a missing argument, got %d\n", status)
+	}
+	for _, args := range [][]string{
+		{"read", "-p", "1000", "-n", "-1", "0x20000000", "bytes"},
+		{"read", "-p", "1000", "-n", "0x7FFFFFFF", "0x20000000", "bytes"},
+		{"hexdump", "-p", "1000", "0x20000000", "0"},
+		{"hexdump", "-p", "1000", "0x20000000", "0x7FFFFFFF"},
+	} {
+		if status := e.run(args); status != 1 {
+			t.Errorf("Expected status 1 for the size in %q, got %d\n", args, status)
+		}
+	}
+}
+
+func TestDumpAndDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kiwi")
+	if err != nil {
+		t.Fatalf("TempDir: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "heap.bin")
+
+	e, f, out := testEnv()
+	if status := e.run([]string{"dump", "-p", "game.exe", "-o", path, "0x20000000"}); status != 0 {
+		t.Fatalf("dump failed with status %d\n", status)
+	}
+	if data, err := ioutil.ReadFile(path); err != nil || len(data) != 0x1000 || !bytes.Equal(data[0x108:0x10C], []byte{0x39, 0x05, 0, 0}) {
+		t.Fatalf("Unexpected dump (%v)\n", err)
+	}
+
+	// Dumps are read a chunk at a time, with unreadable chunks written as zeros.
+	defer func(n int) { dumpChunk = n }(dumpChunk)
+	dumpChunk = 0x100
+	if status := e.run([]string{"dump", "-p", "game.exe", "-o", path + ".2", "0x1FFFFF00", "0x300"}); status != 0 {
+		t.Fatalf("dump failed with status %d\n", status)
+	}
+	if data, err := ioutil.ReadFile(path + ".2"); err != nil || len(data) != 0x300 || data[0] != 0 || !bytes.Equal(data[0x208:0x20C], []byte{0x39, 0x05, 0, 0}) {
+		t.Fatalf("Unexpected chunked dump (%v)\n", err)
+	}
+	if status := e.run([]string{"dump", "-p", "game.exe", "-o", path + ".3", "0x10000000", "0x300"}); status != 1 {
+		t.Errorf("Expected status 1 dumping unmapped memory, got %d\n", status)
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Errorf("Expected the failed dump to be removed\n")
+	}
+
+	f.PutUint32(0x20000108, 1338)
+	f.PutUint32(0x20000200, 0xAABBCCDD)
+	out.Reset()
+	if status := e.run([]string{"diff", "-p", "game.exe", "-json", "0x20000000", path}); status != 0 {
+		t.Fatalf("diff failed with status %d\n", status)
+	}
+	var changes []struct{ Addr, Old, New string }
+	if err := json.Unmarshal(out.Bytes(), &changes); err != nil {
+		t.Fatalf("Unexpected output %q (%s)\n", out.String(), err)
+	}
+	if len(changes) != 2 || changes[0].Addr != "0x20000108" || changes[0].Old != "39" || changes[0].New != "3A" || changes[1].Old != "00 00 00 00" || changes[1].New != "DD CC BB AA" {
+		t.Errorf("Unexpected changes %+v\n", changes)
+	}
+}
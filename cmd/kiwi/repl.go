@@ -0,0 +1,674 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Andoryuuta/kiwi"
+)
+
+// errQuit is returned by a REPL command to end the session.
+var errQuit = errors.New("quit")
+
+// maxScanResults is the most results a first scan keeps.
+const maxScanResults = 100000
+
+// replCommand is a command of the REPL. Commands with a count, like x/64, take it as n.
+type replCommand struct {
+	name  string
+	usage string
+	run   func(r *repl, n int, args string) error
+}
+
+var replCommands []replCommand
+
+func init() {
+	replCommands = []replCommand{
+		{"help", "help                      show this help", (*repl).help},
+		{"read", "read <type> <expr>        read a value", (*repl).read},
+		{"write", "write <type> <expr> = <v> write a value", (*repl).write},
+		{"print", "print <expr>              evaluate an address expression", (*repl).print},
+		{"ptr", "ptr[/depth] <expr>        follow pointers from an address", (*repl).ptr},
+		{"x", "x[/size] <expr>           show memory in hex", (*repl).hexdump},
+		{"dis", "dis[/count] <expr>        disassemble", (*repl).disassemble},
+		{"set", "set <name> = <expr>       set a variable, usable in expressions", (*repl).set},
+		{"unset", "unset <name>              remove a variable", (*repl).unset},
+		{"vars", "vars                      list variables", (*repl).listVars},
+		{"modules", "modules                   list modules", (*repl).listModules},
+		{"maps", "maps                      list memory regions", (*repl).listMaps},
+		{"scan", "scan <type> <value>       start a scan of writable memory for a value", (*repl).scan},
+		{"next", "next <cond>               narrow the scan: <value>, = v, != v, > v, < v,\n" +
+			"                          changed, unchanged, increased or decreased", (*repl).next},
+		{"results", "results[/count]           list the scan's results and their current values", (*repl).listResults},
+		{"quit", "quit                      exit", (*repl).quit},
+	}
+}
+
+// scanTypes are the types accepted by read, write and scan.
+var scanTypes = []string{"int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64", "float32", "float64", "bytes", "ptr", "string"}
+
+// nextConditions are the conditions of next which don't take a value.
+var nextConditions = []string{"changed", "unchanged", "increased", "decreased"}
+
+// repl is an interactive session with a process.
+type repl struct {
+	out     io.Writer
+	p       *kiwi.Process
+	vars    kiwi.Vars
+	modules []kiwi.Module
+
+	// The current scan, with the value of each result when it was last scanned.
+	scanType string
+	results  []scanResult
+}
+
+// scanResult is an address found by a scan, and its value when it was last scanned.
+type scanResult struct {
+	addr  uintptr
+	value interface{}
+}
+
+func runREPL(e *env, args []string) error {
+	f := e.newFlags("repl", "<pid|name>", false, 1)
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	p, err := e.open(f.Arg(0))
+	if err != nil {
+		return err
+	}
+	r := newREPL(e.out, p)
+
+	ed := newLineEditor(e.in, e.out)
+	ed.complete = r.complete
+	if e.history != "" {
+		ed.loadHistory(e.history)
+	}
+
+	fmt.Fprintf(e.out, "Attached to process %d. Type help for commands.\n", p.PID)
+	for {
+		line, err := ed.readLine("kiwi> ")
+		if err == errInterrupted {
+			continue
+		}
+		if err != nil {
+			break
+		}
+		ed.addHistory(strings.TrimSpace(line))
+		if err := r.exec(line); err == errQuit {
+			break
+		} else if err != nil {
+			fmt.Fprintf(e.out, "error: %s\n", err)
+		}
+	}
+
+	if e.history != "" {
+		if err := ed.saveHistory(e.history); err != nil {
+			return fmt.Errorf("saving history: %w", err)
+		}
+	}
+	return nil
+}
+
+// newREPL returns a session with the process.
+func newREPL(out io.Writer, p *kiwi.Process) *repl {
+	r := &repl{out: out, p: p, vars: kiwi.Vars{}}
+	r.modules, _ = p.Modules()
+	return r
+}
+
+// exec runs a line of input.
+func (r *repl) exec(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' {
+		return nil
+	}
+	name, args := splitWord(line)
+	n := 0
+	if i := strings.IndexByte(name, '/'); i >= 0 {
+		v, err := strconv.ParseUint(name[i+1:], 0, 31)
+		if err != nil || v == 0 {
+			return fmt.Errorf("bad count %q", name[i+1:])
+		}
+		name, n = name[:i], int(v)
+	}
+
+	switch name {
+	case "p":
+		name = "print"
+	case "exit", "q":
+		name = "quit"
+	case "?":
+		name = "help"
+	}
+	for _, c := range replCommands {
+		if c.name == name {
+			return c.run(r, n, args)
+		}
+	}
+	return fmt.Errorf("unknown command %q, type help for commands", name)
+}
+
+// splitWord splits the first word from the rest of s.
+func splitWord(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[:i], strings.TrimSpace(s[i+1:])
+	}
+	return s, ""
+}
+
+// splitAssign splits "left = right".
+func splitAssign(s string) (string, string, error) {
+	i := strings.IndexByte(s, '=')
+	if i < 0 {
+		return "", "", errors.New("expected <left> = <right>")
+	}
+	left, right := strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+	if left == "" || right == "" {
+		return "", "", errors.New("expected <left> = <right>")
+	}
+	return left, right, nil
+}
+
+// eval evaluates an address expression with the session's variables.
+func (r *repl) eval(expr string) (uintptr, error) {
+	if expr == "" {
+		return 0, errors.New("missing address")
+	}
+	return r.p.EvalWith(expr, r.vars)
+}
+
+// describe returns addr in hex, followed by where it is if it's inside of a module.
+func (r *repl) describe(addr uintptr) string {
+	if loc := location(r.modules, addr); loc != "" {
+		return fmt.Sprintf("0x%X (%s)", addr, loc)
+	}
+	return fmt.Sprintf("0x%X", addr)
+}
+
+func (r *repl) help(n int, args string) error {
+	for _, c := range replCommands {
+		fmt.Fprintf(r.out, "  %s\n", c.usage)
+	}
+	fmt.Fprintf(r.out, "\nTypes: %s\n", strings.Join(scanTypes, " "))
+	fmt.Fprintf(r.out, "Expressions are address expressions like game.exe+0x10 -> [+8], and may use variables.\n")
+	return nil
+}
+
+func (r *repl) read(n int, args string) error {
+	typ, expr := splitWord(args)
+	addr, err := r.eval(expr)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		n = 16
+	}
+	v, err := readTyped(r.p, addr, typ, n)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(r.out, "%s = %s\n", r.describe(addr), formatTyped(v))
+	return nil
+}
+
+func (r *repl) write(n int, args string) error {
+	typ, rest := splitWord(args)
+	expr, value, err := splitAssign(rest)
+	if err != nil {
+		return err
+	}
+	addr, err := r.eval(expr)
+	if err != nil {
+		return err
+	}
+	return writeTyped(r.p, addr, typ, value)
+}
+
+func (r *repl) print(n int, args string) error {
+	addr, err := r.eval(args)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(r.out, r.describe(addr))
+	return nil
+}
+
+func (r *repl) ptr(n int, args string) error {
+	addr, err := r.eval(args)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		n = 4
+	}
+	for i := 0; i < n; i++ {
+		next, err := r.p.ReadPointer(addr)
+		if err != nil {
+			fmt.Fprintf(r.out, "%s -> unreadable\n", r.describe(addr))
+			return nil
+		}
+		fmt.Fprintf(r.out, "%s -> %s\n", r.describe(addr), r.describe(next))
+		addr = next
+	}
+	return nil
+}
+
+func (r *repl) hexdump(n int, args string) error {
+	addr, err := r.eval(args)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		n = 64
+	}
+	if err := checkSize(n); err != nil {
+		return err
+	}
+	data, err := r.p.ReadBytes(addr, n)
+	if err != nil {
+		return err
+	}
+	hexdump(r.out, addr, data)
+	return nil
+}
+
+func (r *repl) disassemble(n int, args string) error {
+	addr, err := r.eval(args)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		n = 10
+	}
+	insts, err := r.p.Disassemble(addr, n)
+	if err != nil {
+		return err
+	}
+	for _, inst := range insts {
+		loc := location(r.modules, inst.Addr)
+		fmt.Fprintf(r.out, "%012X  %-24s  %-30s  %s\n", inst.Addr, loc, fmt.Sprintf("% X", inst.Bytes), inst.String())
+	}
+	return nil
+}
+
+// isVarName reports whether name can be used as a variable in address expressions.
+func isVarName(name string) bool {
+	if name == "" || !(name[0] == '_' || isLetter(name[0])) {
+		return false
+	}
+	for i := 1; i < len(name); i++ {
+		c := name[i]
+		if !(c == '_' || isLetter(c) || (c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func (r *repl) set(n int, args string) error {
+	name, expr, err := splitAssign(args)
+	if err != nil {
+		return err
+	}
+	if !isVarName(name) {
+		return fmt.Errorf("bad variable name %q", name)
+	}
+	addr, err := r.eval(expr)
+	if err != nil {
+		return err
+	}
+	r.vars[name] = addr
+	fmt.Fprintf(r.out, "%s = %s\n", name, r.describe(addr))
+	return nil
+}
+
+func (r *repl) unset(n int, args string) error {
+	if _, ok := r.vars[args]; !ok {
+		return fmt.Errorf("no variable %q", args)
+	}
+	delete(r.vars, args)
+	return nil
+}
+
+// varNames returns the names of the variables, sorted.
+func (r *repl) varNames() []string {
+	names := make([]string, 0, len(r.vars))
+	for name := range r.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *repl) listVars(n int, args string) error {
+	for _, name := range r.varNames() {
+		fmt.Fprintf(r.out, "%s = %s\n", name, r.describe(r.vars[name]))
+	}
+	return nil
+}
+
+func (r *repl) listModules(n int, args string) error {
+	modules, err := r.p.Modules()
+	if err != nil {
+		return err
+	}
+	r.modules = modules
+	for _, m := range modules {
+		fmt.Fprintf(r.out, "%012X %8X  %s\n", m.Base, m.Size, m.Name)
+	}
+	return nil
+}
+
+func (r *repl) listMaps(n int, args string) error {
+	regions, err := r.p.Regions()
+	if err != nil {
+		return err
+	}
+	for _, reg := range regions {
+		fmt.Fprintf(r.out, "%012X-%012X %s %08X %s\n", reg.Base, reg.End(), reg.Perm, reg.Offset, reg.Path)
+	}
+	return nil
+}
+
+// parseScanValue parses a value to scan for. ptr values are scanned for as unsigned integers
+// of the pointer size.
+func (r *repl) parseScanValue(typ, s string) (interface{}, error) {
+	if typ == "ptr" {
+		size, err := r.p.PointerSize()
+		if err != nil {
+			return nil, err
+		}
+		typ = "uint64"
+		if size == 4 {
+			typ = "uint32"
+		}
+	}
+	t, err := kiwi.ParseValueType(typ)
+	if err != nil {
+		return nil, err
+	}
+	return kiwi.ParseValue(t, s)
+}
+
+// encodeValue returns the bytes of a value in the process's byte order.
+func (r *repl) encodeValue(v interface{}) []byte {
+	if b, ok := v.([]byte); ok {
+		return b
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, r.p.ByteOrder(), v)
+	return buf.Bytes()
+}
+
+// readLike reads a value of the same type as v.
+func (r *repl) readLike(addr uintptr, v interface{}) (interface{}, error) {
+	if b, ok := v.([]byte); ok {
+		return r.p.ReadBytes(addr, len(b))
+	}
+	t, err := kiwi.TypeOf(v)
+	if err != nil {
+		return nil, err
+	}
+	return r.p.ReadValue(addr, t)
+}
+
+func (r *repl) scan(n int, args string) error {
+	typ, s := splitWord(args)
+	scanType := typ
+	if typ == "string" {
+		// Strings are scanned for as their bytes.
+		typ, s = "bytes", fmt.Sprintf("%X", s)
+	}
+	v, err := r.parseScanValue(typ, s)
+	if err != nil {
+		return err
+	}
+	data := r.encodeValue(v)
+	if len(data) == 0 {
+		return errors.New("missing value")
+	}
+
+	// Values are found with a pattern of their bytes, aligned to their size for numbers.
+	pat, err := kiwi.ParsePattern(fmt.Sprintf("% X", data))
+	if err != nil {
+		return err
+	}
+	matches, err := r.p.FindPattern(pat, &kiwi.ScanOptions{Perm: kiwi.PermWrite, Limit: maxScanResults})
+	if err != nil {
+		return err
+	}
+	align := uintptr(1)
+	if _, ok := v.([]byte); !ok {
+		align = uintptr(len(data))
+	}
+	r.scanType, r.results = scanType, r.results[:0]
+	for _, addr := range matches {
+		if addr%align == 0 {
+			r.results = append(r.results, scanResult{addr, v})
+		}
+	}
+
+	fmt.Fprintf(r.out, "%d results\n", len(r.results))
+	if len(matches) == maxScanResults {
+		fmt.Fprintf(r.out, "Stopped after %d matches, scan for a less common value to find them all.\n", maxScanResults)
+	}
+	return nil
+}
+
+// compare compares two values of the same numeric type, returning -1, 0 or 1.
+func compare(a, b interface{}) (int, error) {
+	var c int
+	switch a := a.(type) {
+	case int8:
+		c = cmpInt(int64(a), int64(b.(int8)))
+	case int16:
+		c = cmpInt(int64(a), int64(b.(int16)))
+	case int32:
+		c = cmpInt(int64(a), int64(b.(int32)))
+	case int64:
+		c = cmpInt(a, b.(int64))
+	case uint8:
+		c = cmpUint(uint64(a), uint64(b.(uint8)))
+	case uint16:
+		c = cmpUint(uint64(a), uint64(b.(uint16)))
+	case uint32:
+		c = cmpUint(uint64(a), uint64(b.(uint32)))
+	case uint64:
+		c = cmpUint(a, b.(uint64))
+	case float32:
+		c = cmpFloat(float64(a), float64(b.(float32)))
+	case float64:
+		c = cmpFloat(a, b.(float64))
+	default:
+		return 0, errors.New("bytes can only be compared for equality")
+	}
+	return c, nil
+}
+
+func cmpInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func cmpUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// equal reports whether two values of the same type are equal.
+func equal(a, b interface{}) bool {
+	if ab, ok := a.([]byte); ok {
+		return bytes.Equal(ab, b.([]byte))
+	}
+	return a == b
+}
+
+func (r *repl) next(n int, args string) error {
+	if r.scanType == "" {
+		return errors.New("no scan, start one with scan <type> <value>")
+	}
+
+	// match reports whether a result is kept, given its new value and the one last scanned.
+	var match func(cur, last interface{}) (bool, error)
+	cond, s := splitWord(args)
+	if (cond == "increased" || cond == "decreased" || cond == ">" || cond == "<") &&
+		(r.scanType == "bytes" || r.scanType == "string") {
+		return fmt.Errorf("%s values can only be compared for equality", r.scanType)
+	}
+	switch cond {
+	case "changed":
+		match = func(cur, last interface{}) (bool, error) { return !equal(cur, last), nil }
+	case "unchanged":
+		match = func(cur, last interface{}) (bool, error) { return equal(cur, last), nil }
+	case "increased", "decreased":
+		want := 1
+		if cond == "decreased" {
+			want = -1
+		}
+		match = func(cur, last interface{}) (bool, error) {
+			c, err := compare(cur, last)
+			return c == want, err
+		}
+	default:
+		op := "="
+		switch cond {
+		case "=", "==", "!=", ">", "<":
+			op = cond
+		default:
+			s = args
+		}
+		typ := r.scanType
+		if typ == "string" {
+			typ, s = "bytes", fmt.Sprintf("%X", s)
+		}
+		v, err := r.parseScanValue(typ, s)
+		if err != nil {
+			return err
+		}
+		match = func(cur, last interface{}) (bool, error) {
+			switch op {
+			case "=", "==":
+				return equal(cur, v), nil
+			case "!=":
+				return !equal(cur, v), nil
+			}
+			c, err := compare(cur, v)
+			return (op == ">" && c > 0) || (op == "<" && c < 0), err
+		}
+	}
+
+	kept := r.results[:0]
+	for _, res := range r.results {
+		cur, err := r.readLike(res.addr, res.value)
+		if err != nil {
+			// Memory which was freed can't match.
+			continue
+		}
+		ok, err := match(cur, res.value)
+		if err != nil {
+			return err
+		}
+		if ok {
+			kept = append(kept, scanResult{res.addr, cur})
+		}
+	}
+	r.results = kept
+	fmt.Fprintf(r.out, "%d results\n", len(r.results))
+	return nil
+}
+
+func (r *repl) listResults(n int, args string) error {
+	if n == 0 {
+		n = 20
+	}
+	for i, res := range r.results {
+		if i == n {
+			fmt.Fprintf(r.out, "... %d more\n", len(r.results)-n)
+			break
+		}
+		cur, err := r.readLike(res.addr, res.value)
+		value := "unreadable"
+		if b, ok := cur.([]byte); ok && err == nil && r.scanType == "string" {
+			value = strconv.Quote(string(b))
+		} else if err == nil {
+			value = formatTyped(cur)
+		}
+		fmt.Fprintf(r.out, "%s = %s\n", r.describe(res.addr), value)
+	}
+	return nil
+}
+
+func (r *repl) quit(n int, args string) error {
+	return errQuit
+}
+
+// complete completes commands, types and scan conditions by position, and
+// variables and module names in expressions.
+func (r *repl) complete(head string) (string, []string) {
+	// The word being completed starts after the last character which can't be in a name.
+	start := strings.LastIndexAny(head, " \t+-*/[]()<>=,") + 1
+	word := head[start:]
+	words := strings.Fields(head[:start])
+
+	var options []string
+	switch {
+	case len(words) == 0:
+		for _, c := range replCommands {
+			options = append(options, c.name)
+		}
+	case len(words) == 1 && (words[0] == "read" || words[0] == "write" || words[0] == "scan"):
+		options = scanTypes
+	case len(words) == 1 && words[0] == "next":
+		options = nextConditions
+	case len(words) == 1 && words[0] == "unset":
+		options = r.varNames()
+	default:
+		options = r.varNames()
+		for _, m := range r.modules {
+			options = append(options, m.Name)
+		}
+	}
+
+	var candidates []string
+	seen := make(map[string]bool)
+	for _, o := range options {
+		if strings.HasPrefix(o, word) && !seen[o] {
+			candidates = append(candidates, o)
+			seen[o] = true
+		}
+	}
+	sort.Strings(candidates)
+	return word, candidates
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// execAll runs lines in the REPL and returns their output, failing on errors.
+func execAll(t *testing.T, r *repl, out *bytes.Buffer, lines ...string) string {
+	out.Reset()
+	for _, line := range lines {
+		if err := r.exec(line); err != nil {
+			t.Fatalf("%s: %s\n", line, err)
+		}
+	}
+	return out.String()
+}
+
+func TestREPL(t *testing.T) {
+	_, f, _ := testEnv()
+	var out bytes.Buffer
+	r := newREPL(&out, f.Process())
+
+	if got := execAll(t, r, &out, "set player = [0x20000010]", "read uint32 player + 8"); got != "player = 0x20000100\n0x20000108 = 1337\n" {
+		t.Errorf("Unexpected output %q\n", got)
+	}
+	if got := execAll(t, r, &out, "write float32 player+0x20 = 1.5", "p player+0x20", "read float32 player+0x20"); got != "0x20000120\n0x20000120 = 1.5\n" {
+		t.Errorf("Unexpected output %q\n", got)
+	}
+	if got := execAll(t, r, &out, "ptr/2 0x20000010"); got != "0x20000010 -> 0x20000100\n0x20000100 -> 0x0\n" {
+		t.Errorf("Unexpected output %q\n", got)
+	}
+	if got := execAll(t, r, &out, "dis/2 game.exe+0x100"); !strings.Contains(got, "game.exe+0x100") || !strings.Contains(got, "mov rax") || !strings.Contains(got, "nop") {
+		t.Errorf("Unexpected output %q\n", got)
+	}
+	if got := execAll(t, r, &out, "x/4 game.exe+0x200"); !strings.HasSuffix(got, "|Hell|\n") {
+		t.Errorf("Unexpected output %q\n", got)
+	}
+	for _, line := range []string{"x/0x7FFFFFFF game.exe+0x200", "read/0x7FFFFFFF bytes game.exe+0x200", "x/0 game.exe+0x200"} {
+		if err := r.exec(line); err == nil {
+			t.Errorf("%s: expected an error for the size\n", line)
+		}
+	}
+	if err := r.exec("frobnicate"); err == nil {
+		t.Errorf("Expected an error for an unknown command\n")
+	}
+	if err := r.exec("quit"); err != errQuit {
+		t.Errorf("Expected errQuit, got %v\n", err)
+	}
+}
+
+func TestREPLScan(t *testing.T) {
+	_, f, _ := testEnv()
+	var out bytes.Buffer
+	r := newREPL(&out, f.Process())
+	f.PutUint32(0x20000200, 1337)
+	f.PutUint32(0x20000301, 1337) // Unaligned, so not found.
+
+	if got := execAll(t, r, &out, "scan uint32 1337"); got != "2 results\n" {
+		t.Fatalf("Unexpected output %q\n", got)
+	}
+	f.PutUint32(0x20000200, 1340)
+	if got := execAll(t, r, &out, "next increased", "results"); got != "1 results\n0x20000200 = 1340\n" {
+		t.Errorf("Unexpected output %q\n", got)
+	}
+	if got := execAll(t, r, &out, "next unchanged", "next < 1000"); got != "1 results\n0 results\n" {
+		t.Errorf("Unexpected output %q\n", got)
+	}
+
+	f.Poke(0x20000400, []byte("kiwi"))
+	if got := execAll(t, r, &out, "scan string kiwi"); got != "1 results\n" {
+		t.Errorf("Unexpected output %q\n", got)
+	}
+	if err := r.exec("next increased"); err == nil {
+		t.Errorf("Expected an error comparing strings\n")
+	}
+	if got := execAll(t, r, &out, "next = kiwi", "results"); got != "1 results\n0x20000400 = \"kiwi\"\n" {
+		t.Errorf("Unexpected output %q\n", got)
+	}
+}
+
+func TestREPLComplete(t *testing.T) {
+	_, f, _ := testEnv()
+	r := newREPL(ioutil.Discard, f.Process())
+	r.vars["gamepad"] = 1
+
+	tests := []struct {
+		head, word string
+		want       []string
+	}{
+		{"re", "re", []string{"read", "results"}},
+		{"read ui", "ui", []string{"uint16", "uint32", "uint64", "uint8"}},
+		{"next ch", "ch", []string{"changed"}},
+		{"read uint32 [ga", "ga", []string{"game.exe", "gamepad"}},
+		{"p gamepad+", "", []string{"game.exe", "gamepad"}},
+	}
+	for _, test := range tests {
+		word, got := r.complete(test.head)
+		if word != test.word || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: expected %q %q, got %q %q\n", test.head, test.word, test.want, word, got)
+		}
+	}
+}
+
+func TestLineEditor(t *testing.T) {
+	var out bytes.Buffer
+	keys := "" +
+		"pnt\x1b[D\x1b[Dri\x1b[F 1\r" + // Cursor movement and insertion.
+		"\x1b[A\x7f2\r" + // History.
+		"re\tu\tx\r" + // Completion.
+		"junk\x03" + // Ctrl-C.
+		"\x04" // Ctrl-D.
+	ed := newLineEditor(strings.NewReader(keys), &out)
+	ed.makeRaw = func() (func(), error) { return func() {}, nil }
+	ed.complete = func(head string) (string, []string) {
+		word := head[strings.LastIndex(head, " ")+1:]
+		var candidates []string
+		for _, c := range []string{"read", "uint32"} {
+			if strings.HasPrefix(c, word) {
+				candidates = append(candidates, c)
+			}
+		}
+		return word, candidates
+	}
+
+	var lines []string
+	for {
+		line, err := ed.readLine("> ")
+		if err == io.EOF {
+			break
+		}
+		if err == errInterrupted {
+			lines = append(lines, "^C")
+			continue
+		}
+		if err != nil {
+			t.Fatalf("readLine: %s\n", err)
+		}
+		ed.addHistory(line)
+		lines = append(lines, line)
+	}
+	want := []string{"print 1", "print 2", "read uint32 x", "^C"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("Expected %q, got %q\n", want, lines)
+	}
+
+	// Input which isn't a terminal is read as is.
+	ed = newLineEditor(strings.NewReader("read uint32 x\r\nquit"), &out)
+	if line, err := ed.readLine("> "); err != nil || line != "read uint32 x" {
+		t.Errorf("Expected the first line, got %q (%v)\n", line, err)
+	}
+	if line, err := ed.readLine("> "); err != nil || line != "quit" {
+		t.Errorf("Expected the last line, got %q (%v)\n", line, err)
+	}
+	if _, err := ed.readLine("> "); err != io.EOF {
+		t.Errorf("Expected EOF, got %v\n", err)
+	}
+}
+
+func TestREPLCommand(t *testing.T) {
+	e, _, out := testEnv()
+	e.in = strings.NewReader("set hp = 0x20000108\nread uint32 hp\nbogus\nquit\n")
+	if status := e.run([]string{"repl", "game.exe"}); status != 0 {
+		t.Fatalf("repl failed with status %d\n", status)
+	}
+	want := "Attached to process 1000. Type help for commands.\n" +
+		"hp = 0x20000108\n0x20000108 = 1337\n" +
+		"error: unknown command \"bogus\", type help for commands\n"
+	if out.String() != want {
+		t.Errorf("Expected %q, got %q\n", want, out.String())
+	}
+}
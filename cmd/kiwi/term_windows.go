@@ -0,0 +1,34 @@
+package main
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// makeRaw puts the console into raw mode with VT sequences for special keys,
+// returning a function restoring it.
+func makeRaw(fd uintptr) (func(), error) {
+	in := windows.Handle(fd)
+	var oldIn uint32
+	if err := windows.GetConsoleMode(in, &oldIn); err != nil {
+		return nil, err
+	}
+	raw := oldIn&^(windows.ENABLE_LINE_INPUT|windows.ENABLE_ECHO_INPUT|windows.ENABLE_PROCESSED_INPUT) | windows.ENABLE_VIRTUAL_TERMINAL_INPUT
+	if err := windows.SetConsoleMode(in, raw); err != nil {
+		return nil, err
+	}
+
+	// The escape sequences used to redraw the line need VT processing of output.
+	out := windows.Handle(windows.Stdout)
+	var oldOut uint32
+	outOK := windows.GetConsoleMode(out, &oldOut) == nil
+	if outOK {
+		windows.SetConsoleMode(out, oldOut|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING)
+	}
+
+	return func() {
+		windows.SetConsoleMode(in, oldIn)
+		if outOK {
+			windows.SetConsoleMode(out, oldOut)
+		}
+	}, nil
+}
@@ -0,0 +1,404 @@
+package kiwi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// ELF note types found in core files.
+const (
+	ntPrstatus = 1
+	ntPrpsinfo = 3
+	ntFile     = 0x46494C45 // "FILE"
+)
+
+// Offsets in the x86-64 NT_PRSTATUS note.
+const (
+	prstatusPid  = 32
+	prstatusRegs = 112
+	prstatusSize = 336
+)
+
+// dumpSegment is a region of memory saved in a dump file.
+type dumpSegment struct {
+	Region
+	fileOff  int64
+	fileSize uintptr // Bytes of the region stored in the file, from the start.
+}
+
+// dumpMemory is the memory saved in a dump file, such as a core file or minidump.
+// It's read-only.
+type dumpMemory struct {
+	r        io.ReaderAt
+	segments []dumpSegment // Sorted by address.
+}
+
+func (m *dumpMemory) sortSegments() {
+	sort.Slice(m.segments, func(i, j int) bool {
+		return m.segments[i].Base < m.segments[j].Base
+	})
+}
+
+// segment returns the segment containing addr.
+func (m *dumpMemory) segment(addr uintptr) (*dumpSegment, bool) {
+	i := sort.Search(len(m.segments), func(i int) bool {
+		return m.segments[i].End() > addr
+	})
+	if i < len(m.segments) && m.segments[i].Contains(addr) {
+		return &m.segments[i], true
+	}
+	return nil, false
+}
+
+// ReadAt reads the saved memory at addr into b.
+func (m *dumpMemory) ReadAt(b []byte, addr uintptr) (int, error) {
+	read := 0
+	for read < len(b) {
+		seg, ok := m.segment(addr)
+		if !ok {
+			return read, fmt.Errorf("0x%X isn't mapped in the dump", addr)
+		}
+		off := addr - seg.Base
+		if off >= seg.fileSize {
+			return read, fmt.Errorf("0x%X isn't included in the dump", addr)
+		}
+
+		// Split reads spanning more than one segment.
+		n := seg.fileSize - off
+		if n > uintptr(len(b)-read) {
+			n = uintptr(len(b) - read)
+		}
+		if _, err := m.r.ReadAt(b[read:read+int(n)], seg.fileOff+int64(off)); err != nil {
+			return read, fmt.Errorf("read 0x%X: %w", addr, err)
+		}
+		addr += n
+		read += int(n)
+	}
+	return read, nil
+}
+
+// WriteAt returns an error, as dumps are read-only.
+func (m *dumpMemory) WriteAt(b []byte, addr uintptr) (int, error) {
+	return 0, errors.New("dumps are read-only")
+}
+
+// Regions returns the regions saved in the dump, sorted by address.
+func (m *dumpMemory) Regions() ([]Region, error) {
+	regions := make([]Region, len(m.segments))
+	for i, seg := range m.segments {
+		regions[i] = seg.Region
+	}
+	return regions, nil
+}
+
+// Core is an ELF core dump, opened with OpenCore. It's a read-only Backend.
+//
+// Its memory is read through the Process returned by Core.Process, so that all of kiwi's
+// reads, pointer chains and scans work offline.
+type Core struct {
+	dumpMemory
+	closer     io.Closer
+	order      binary.ByteOrder
+	ptrSize    int
+	machine    elf.Machine
+	pid        uint64
+	threadList []Thread
+}
+
+// OpenCore opens an ELF core dump, such as one written by the kernel or DumpCore.
+// Gzip compressed cores are decompressed to a temporary file.
+func OpenCore(path string) (*Core, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	temp := false
+	var magic [2]byte
+	if _, err := f.ReadAt(magic[:], 0); err == nil && magic == [2]byte{0x1F, 0x8B} {
+		tmp, err := gunzipTemp(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		f, temp = tmp, true
+	}
+	closeFile := func() error {
+		err := f.Close()
+		if temp {
+			os.Remove(f.Name())
+		}
+		return err
+	}
+
+	c, err := NewCore(f)
+	if err != nil {
+		closeFile()
+		return nil, err
+	}
+	c.closer = closerFunc(closeFile)
+	return c, nil
+}
+
+// gunzipTemp decompresses r to a temporary file.
+func gunzipTemp(r io.Reader) (*os.File, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile("", "kiwi-core-")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(tmp, zr); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("decompress core: %w", err)
+	}
+	return tmp, nil
+}
+
+// maxNoteSize is the largest note segment NewCore reads, well over what cores with many threads need.
+const maxNoteSize = 16 << 20
+
+// readerSize returns the size of r, if it can tell.
+func readerSize(r io.ReaderAt) (int64, bool) {
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		return r.Size(), true
+	case interface{ Stat() (os.FileInfo, error) }:
+		if fi, err := r.Stat(); err == nil {
+			return fi.Size(), true
+		}
+	}
+	return 0, false
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+// NewCore reads an ELF core dump from r.
+func NewCore(r io.ReaderAt) (*Core, error) {
+	ef, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	if ef.Type != elf.ET_CORE {
+		return nil, fmt.Errorf("ELF file is %s, not a core file", ef.Type)
+	}
+
+	c := &Core{dumpMemory: dumpMemory{r: r}, order: ef.ByteOrder, ptrSize: 8, machine: ef.Machine}
+	if ef.Class == elf.ELFCLASS32 {
+		c.ptrSize = 4
+	}
+
+	var files []Region
+	for _, prog := range ef.Progs {
+		switch prog.Type {
+		case elf.PT_LOAD:
+			seg := dumpSegment{
+				Region:   Region{Base: uintptr(prog.Vaddr), Size: uintptr(prog.Memsz), Perm: elfPerm(prog.Flags)},
+				fileOff:  int64(prog.Off),
+				fileSize: uintptr(prog.Filesz),
+			}
+			if seg.fileSize > seg.Size {
+				seg.fileSize = seg.Size
+			}
+			if seg.Size > 0 {
+				c.segments = append(c.segments, seg)
+			}
+		case elf.PT_NOTE:
+			// The size comes from the file, so it's checked before the notes are read into memory.
+			if prog.Filesz > maxNoteSize {
+				return nil, fmt.Errorf("note segment of %d bytes is over the limit of %d", prog.Filesz, maxNoteSize)
+			}
+			if size, ok := readerSize(r); ok && (prog.Off > uint64(size) || prog.Filesz > uint64(size)-prog.Off) {
+				return nil, errors.New("note segment is past the end of the file")
+			}
+			data := make([]byte, prog.Filesz)
+			if _, err := prog.ReadAt(data, 0); err != nil {
+				return nil, fmt.Errorf("read notes: %w", err)
+			}
+			err := readNotes(data, c.order, func(typ uint32, name string, desc []byte) error {
+				if name != "CORE" {
+					return nil
+				}
+				switch typ {
+				case ntFile:
+					f, err := c.parseFileNote(desc)
+					if err != nil {
+						return err
+					}
+					files = append(files, f...)
+				case ntPrstatus:
+					// Registers are only read from x86-64 cores, as other architectures lay out
+					// NT_PRSTATUS differently.
+					if c.machine == elf.EM_X86_64 && c.ptrSize == 8 && len(desc) >= prstatusSize {
+						t := Thread{ID: int(c.order.Uint32(desc[prstatusPid:]))}
+						binary.Read(bytes.NewReader(desc[prstatusRegs:]), c.order, &t.Regs)
+						c.threadList = append(c.threadList, t)
+					}
+				case ntPrpsinfo:
+					// pr_pid follows the state, flags, uid and gid.
+					off := 24
+					if c.ptrSize == 4 {
+						off = 12
+					}
+					if len(desc) >= off+4 {
+						c.pid = uint64(c.order.Uint32(desc[off:]))
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if c.pid == 0 && len(c.threadList) > 0 {
+		c.pid = uint64(c.threadList[0].ID)
+	}
+
+	c.sortSegments()
+
+	// Name the segments after the files mapped into them.
+	for i := range c.segments {
+		seg := &c.segments[i]
+		for _, f := range files {
+			if f.Contains(seg.Base) {
+				seg.Path = f.Path
+				seg.Offset = f.Offset + uint64(seg.Base-f.Base)
+				break
+			}
+		}
+	}
+	return c, nil
+}
+
+// elfPerm converts ELF segment flags to permissions.
+func elfPerm(flags elf.ProgFlag) Perm {
+	var perm Perm
+	if flags&elf.PF_R != 0 {
+		perm |= PermRead
+	}
+	if flags&elf.PF_W != 0 {
+		perm |= PermWrite
+	}
+	if flags&elf.PF_X != 0 {
+		perm |= PermExec
+	}
+	return perm
+}
+
+// readNotes calls fn for each note in the contents of a PT_NOTE segment.
+func readNotes(data []byte, order binary.ByteOrder, fn func(typ uint32, name string, desc []byte) error) error {
+	// Sizes are aligned in 64 bits, so they can't wrap around.
+	align := func(n uint32) uint64 { return (uint64(n) + 3) &^ 3 }
+	for len(data) >= 12 {
+		namesz, descsz, typ := order.Uint32(data), order.Uint32(data[4:]), order.Uint32(data[8:])
+		data = data[12:]
+		if align(namesz)+align(descsz) > uint64(len(data)) {
+			return errors.New("truncated note")
+		}
+		descStart, next := int(align(namesz)), int(align(namesz)+align(descsz))
+		name := string(bytes.TrimRight(data[:namesz], "\x00"))
+		desc := data[descStart : descStart+int(descsz)]
+		if err := fn(typ, name, desc); err != nil {
+			return err
+		}
+		data = data[next:]
+	}
+	return nil
+}
+
+// appendNote appends an ELF note to b.
+func appendNote(b []byte, order binary.ByteOrder, name string, typ uint32, desc []byte) []byte {
+	var hdr [12]byte
+	order.PutUint32(hdr[0:], uint32(len(name)+1))
+	order.PutUint32(hdr[4:], uint32(len(desc)))
+	order.PutUint32(hdr[8:], typ)
+	b = append(b, hdr[:]...)
+	b = append(b, name...)
+	b = append(b, 0)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	b = append(b, desc...)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// parseFileNote parses an NT_FILE note, which lists the files mapped into the process.
+func (c *Core) parseFileNote(desc []byte) ([]Region, error) {
+	word := func(i int) uint64 {
+		if c.ptrSize == 4 {
+			return uint64(c.order.Uint32(desc[i*4:]))
+		}
+		return c.order.Uint64(desc[i*8:])
+	}
+
+	if len(desc) < 2*c.ptrSize {
+		return nil, errors.New("truncated NT_FILE note")
+	}
+	// The header is followed by count entries of 3 words, then the file names.
+	count, pageSize := word(0), word(1)
+	if count > uint64(len(desc)) || (2+3*count)*uint64(c.ptrSize) > uint64(len(desc)) {
+		return nil, errors.New("truncated NT_FILE note")
+	}
+
+	files := make([]Region, count)
+	names := bytes.Split(desc[(2+3*int(count))*c.ptrSize:], []byte{0})
+	if uint64(len(names)) < count {
+		return nil, errors.New("truncated NT_FILE note")
+	}
+	for i := range files {
+		start, end, off := word(2+i*3), word(3+i*3), word(4+i*3)
+		files[i] = Region{Base: uintptr(start), Size: uintptr(end - start), Path: string(names[i]), Offset: off * pageSize}
+	}
+	return files, nil
+}
+
+// Process returns a process which reads the memory of the core.
+// It uses the byte order and pointer size of the core file.
+func (c *Core) Process() *Process {
+	p := NewProcess(c)
+	p.PID = c.pid
+	return p.WithByteOrder(c.order)
+}
+
+// Threads returns the threads saved in the core, with their registers.
+// The first thread is the one which crashed, or the main thread for cores written by DumpCore.
+func (c *Core) Threads() ([]Thread, error) {
+	return append([]Thread(nil), c.threadList...), nil
+}
+
+// Close closes the core file, if it was opened with OpenCore.
+func (c *Core) Close() error {
+	if c.closer == nil {
+		return nil
+	}
+	return c.closer.Close()
+}
+
+// Modules returns the files mapped into the process, as listed in the NT_FILE note.
+func (c *Core) Modules() ([]Module, error) {
+	regions, _ := c.Regions()
+	return modulesFromRegions(regions), nil
+}
+
+// PointerSize returns the pointer size of the core file's class.
+func (c *Core) PointerSize() (int, error) {
+	return c.ptrSize, nil
+}
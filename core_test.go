@@ -0,0 +1,250 @@
+package kiwi
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+)
+
+// testCoreSegment is a PT_LOAD segment of a core built by buildTestCore.
+type testCoreSegment struct {
+	addr  uint64
+	flags elf.ProgFlag
+	data  []byte
+	size  uint64 // Size in memory, if more than len(data).
+}
+
+// buildTestCore builds a 64-bit little-endian ELF core file with the given segments and notes.
+func buildTestCore(segs []testCoreSegment, notes []byte) []byte {
+	const ehsize, phsize = 64, 56
+
+	off := uint64(ehsize + phsize*(len(segs)+1))
+	progs := []elf.Prog64{{Type: uint32(elf.PT_NOTE), Off: off, Filesz: uint64(len(notes))}}
+	off += uint64(len(notes))
+	for _, s := range segs {
+		size := s.size
+		if size < uint64(len(s.data)) {
+			size = uint64(len(s.data))
+		}
+		progs = append(progs, elf.Prog64{
+			Type: uint32(elf.PT_LOAD), Flags: uint32(s.flags), Off: off,
+			Vaddr: s.addr, Filesz: uint64(len(s.data)), Memsz: size, Align: 0x1000,
+		})
+		off += uint64(len(s.data))
+	}
+
+	var buf bytes.Buffer
+	hdr := elf.Header64{
+		Type: uint16(elf.ET_CORE), Machine: uint16(elf.EM_X86_64), Version: uint32(elf.EV_CURRENT),
+		Phoff: ehsize, Ehsize: ehsize, Phentsize: phsize, Phnum: uint16(len(progs)),
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	binary.Write(&buf, binary.LittleEndian, &hdr)
+	binary.Write(&buf, binary.LittleEndian, progs)
+	buf.Write(notes)
+	for _, s := range segs {
+		buf.Write(s.data)
+	}
+	return buf.Bytes()
+}
+
+// testCoreNote encodes an ELF note.
+func testCoreNote(name string, typ uint32, desc []byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{uint32(len(name) + 1), uint32(len(desc)), typ})
+	buf.WriteString(name)
+	buf.WriteByte(0)
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(0)
+	}
+	buf.Write(desc)
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+func TestOpenCore(t *testing.T) {
+	code := bytes.Repeat([]byte{0x90}, 0x1000)
+	copy(code[0x100:], []byte{0x48, 0x8B, 0x05, 0x11, 0x22, 0x33, 0x44, 0xC3})
+	data := make([]byte, 0x1000)
+	binary.LittleEndian.PutUint64(data[0x10:], 0x7F0000000000)
+	heap := make([]byte, 0x1000)
+	binary.LittleEndian.PutUint32(heap[0x40:], 1337)
+
+	segs := []testCoreSegment{
+		{addr: 0x400000, flags: elf.PF_R | elf.PF_X, data: code},
+		{addr: 0x401000, flags: elf.PF_R | elf.PF_W, data: data},
+		{addr: 0x402000, flags: elf.PF_R, size: 0x1000}, // Not included in the core.
+		{addr: 0x7F0000000000, flags: elf.PF_R | elf.PF_W, data: heap},
+	}
+
+	// NT_FILE: count, page size, then start, end and page offset of each file, then the names.
+	var files bytes.Buffer
+	binary.Write(&files, binary.LittleEndian, []uint64{2, 0x1000, 0x400000, 0x401000, 0, 0x401000, 0x403000, 1})
+	files.WriteString("/opt/game/bin/game\x00/opt/game/bin/game\x00")
+	prstatus := make([]byte, 336)
+	binary.LittleEndian.PutUint32(prstatus[32:], 4242)
+	notes := append(testCoreNote("CORE", ntPrstatus, prstatus), testCoreNote("CORE", ntFile, files.Bytes())...)
+
+	core, err := NewCore(bytes.NewReader(buildTestCore(segs, notes)))
+	if err != nil {
+		t.Fatalf("NewCore: %s\n", err)
+	}
+	defer core.Close()
+	p := core.Process()
+
+	if p.PID != 4242 {
+		t.Errorf("Expected PID 4242, got %d\n", p.PID)
+	}
+	if size, err := p.PointerSize(); err != nil || size != 8 {
+		t.Errorf("Expected pointer size 8, got %d (%v)\n", size, err)
+	}
+
+	// Follow the pointer in the data segment to the heap.
+	v, err := p.Eval("[game+0x1010] + 0x40")
+	if err != nil {
+		t.Fatalf("Eval: %s\n", err)
+	}
+	if got, err := p.ReadUint32(v); err != nil || got != 1337 {
+		t.Errorf("Expected 1337, got %d (%v)\n", got, err)
+	}
+
+	// Reads may span segments, but not memory missing from the core.
+	if b, err := p.ReadBytes(0x400FFC, 8); err != nil || !bytes.Equal(b, []byte{0x90, 0x90, 0x90, 0x90, 0, 0, 0, 0}) {
+		t.Errorf("Read across segments: % X (%v)\n", b, err)
+	}
+	if _, err := p.ReadUint8(0x402000); err == nil {
+		t.Errorf("Expected an error reading memory missing from the core\n")
+	}
+	if err := p.WriteUint32(0x7F0000000040, 1); err == nil {
+		t.Errorf("Expected an error writing to a core\n")
+	}
+
+	regions, err := p.Regions()
+	if err != nil || len(regions) != 4 {
+		t.Fatalf("Expected 4 regions, got %+v (%v)\n", regions, err)
+	}
+	if r := regions[1]; r.Path != "/opt/game/bin/game" || r.Offset != 0x1000 || r.Perm != PermRead|PermWrite {
+		t.Errorf("Unexpected region %+v\n", r)
+	}
+	m, err := p.FindModule("game")
+	if err != nil || m.Base != 0x400000 || m.Size != 0x3000 {
+		t.Errorf("Unexpected module %+v (%v)\n", m, err)
+	}
+
+	matches, err := p.FindPattern(MustParsePattern("48 8B 05 ?? ?? ?? ?? C3"), &ScanOptions{Module: "game"})
+	if err != nil || len(matches) != 1 || matches[0] != 0x400100 {
+		t.Errorf("Expected a match at 0x400100, got %X (%v)\n", matches, err)
+	}
+}
+
+func TestReadNotes(t *testing.T) {
+	note := testCoreNote("CORE", ntPrstatus, []byte{1, 2, 3, 4, 5})
+	header := func(namesz, descsz uint32) []byte {
+		b := make([]byte, 12)
+		binary.LittleEndian.PutUint32(b, namesz)
+		binary.LittleEndian.PutUint32(b[4:], descsz)
+		return append(b, make([]byte, 16)...)
+	}
+
+	tests := []struct {
+		name  string
+		data  []byte
+		notes int
+		err   bool
+	}{
+		{"two notes", append(append([]byte(nil), note...), note...), 2, false},
+		{"trailing bytes", append(append([]byte(nil), note...), 0, 0, 0), 1, false},
+		{"truncated desc", note[:len(note)-4], 0, true},
+		{"truncated name", note[:14], 0, true},
+		{"oversized name", header(0xFFFFFFFF, 0), 0, true},
+		{"oversized desc", header(4, 0xFFFFFFFE), 0, true},
+		{"wrapping sizes", header(0xFFFFFFFD, 0xFFFFFFFD), 0, true},
+	}
+	for _, tst := range tests {
+		n := 0
+		err := readNotes(tst.data, binary.LittleEndian, func(typ uint32, name string, desc []byte) error {
+			if typ != ntPrstatus || name != "CORE" || !bytes.Equal(desc, []byte{1, 2, 3, 4, 5}) {
+				t.Errorf("%s: unexpected note %d %q % X\n", tst.name, typ, name, desc)
+			}
+			n++
+			return nil
+		})
+		if (err != nil) != tst.err || n != tst.notes {
+			t.Errorf("%s: expected %d notes and error %v, got %d notes and %v\n", tst.name, tst.notes, tst.err, n, err)
+		}
+	}
+}
+
+func TestNewCoreBadNotes(t *testing.T) {
+	prstatus := make([]byte, 336)
+	binary.LittleEndian.PutUint32(prstatus[32:], 4242)
+	core := buildTestCore(nil, testCoreNote("CORE", ntPrstatus, prstatus))
+
+	// The note segment's file size is the second to last field of its program header.
+	const filesz = 64 + 32
+	for _, size := range []uint64{1 << 40, maxNoteSize + 1, uint64(len(core))} {
+		bad := append([]byte(nil), core...)
+		binary.LittleEndian.PutUint64(bad[filesz:], size)
+		if _, err := NewCore(bytes.NewReader(bad)); err == nil {
+			t.Errorf("Expected an error for a note segment of %d bytes\n", size)
+		}
+	}
+
+	// NT_PRSTATUS is only read as x86-64 registers from x86-64 cores.
+	c, err := NewCore(bytes.NewReader(core))
+	if err != nil {
+		t.Fatalf("NewCore: %s\n", err)
+	}
+	if threads, _ := c.Threads(); len(threads) != 1 || threads[0].ID != 4242 {
+		t.Errorf("Expected thread 4242, got %+v\n", threads)
+	}
+	arm := append([]byte(nil), core...)
+	binary.LittleEndian.PutUint16(arm[18:], uint16(elf.EM_AARCH64))
+	c, err = NewCore(bytes.NewReader(arm))
+	if err != nil {
+		t.Fatalf("NewCore: %s\n", err)
+	}
+	if threads, _ := c.Threads(); len(threads) != 0 {
+		t.Errorf("Expected no threads from an aarch64 core, got %+v\n", threads)
+	}
+}
+
+func TestParseFileNote(t *testing.T) {
+	words := func(w ...uint64) []byte {
+		var b bytes.Buffer
+		binary.Write(&b, binary.LittleEndian, w)
+		return b.Bytes()
+	}
+
+	tests := []struct {
+		name  string
+		desc  []byte
+		files int
+		err   bool
+	}{
+		{"one file", append(words(1, 0x1000, 0x400000, 0x401000, 2), "/bin/game\x00"...), 1, false},
+		{"no files", words(0, 0x1000), 0, false},
+		{"truncated header", words(1)[:4], 0, true},
+		{"truncated entries", words(1, 0x1000, 0x400000), 0, true},
+		{"missing names", words(2, 0x1000, 0, 0, 0, 0, 0, 0), 0, true},
+		{"oversized count", words(1<<62, 0x1000, 0, 0, 0), 0, true},
+		{"wrapping count", words(0x5555555555555556, 0x1000, 0, 0, 0), 0, true},
+	}
+	c := &Core{order: binary.LittleEndian, ptrSize: 8}
+	for _, tst := range tests {
+		files, err := c.parseFileNote(tst.desc)
+		if (err != nil) != tst.err || len(files) != tst.files {
+			t.Errorf("%s: expected %d files and error %v, got %+v (%v)\n", tst.name, tst.files, tst.err, files, err)
+		}
+	}
+	files, _ := c.parseFileNote(tests[0].desc)
+	if len(files) == 1 && (files[0].Base != 0x400000 || files[0].Size != 0x1000 || files[0].Offset != 0x2000 || files[0].Path != "/bin/game") {
+		t.Errorf("Unexpected file %+v\n", files[0])
+	}
+}
@@ -0,0 +1,317 @@
+package kiwi
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// CoreOptions configures DumpCore.
+type CoreOptions struct {
+	// Filter selects the regions to include. All readable regions are included if nil.
+	Filter func(r Region) bool
+
+	// Attach stops the process while it's dumped and saves the registers of its threads.
+	// It's only supported for 64-bit processes on Linux amd64, and cores opened with OpenCore.
+	Attach bool
+
+	// Gzip compresses the core. OpenCore decompresses it.
+	Gzip bool
+
+	// Machine is the architecture written to the ELF header. If zero, it's that of kiwi's
+	// build for live processes, that of the core for cores opened with OpenCore, and x86
+	// for other little-endian processes.
+	Machine elf.Machine
+}
+
+// DumpCore writes the memory of the process to w as an ELF core file, which can be opened
+// with OpenCore, gdb and other tools. opts may be nil.
+//
+// Each readable region is saved as a PT_LOAD segment, and the files mapped into the process
+// are listed in an NT_FILE note. Pages which can't be read are saved as zeros.
+func (p *Process) DumpCore(w io.Writer, opts *CoreOptions) error {
+	if opts == nil {
+		opts = &CoreOptions{}
+	}
+	if opts.Gzip {
+		zw := gzip.NewWriter(w)
+		if err := p.dumpCore(zw, opts); err != nil {
+			return err
+		}
+		return zw.Close()
+	}
+	return p.dumpCore(w, opts)
+}
+
+func (p *Process) dumpCore(w io.Writer, opts *CoreOptions) error {
+	ptrSize, err := p.PointerSize()
+	if err != nil {
+		ptrSize = 8
+	}
+	order := p.ByteOrder()
+
+	machine := opts.Machine
+	if machine == elf.EM_NONE {
+		machine = p.coreMachine(ptrSize)
+	}
+
+	var threads []Thread
+	if opts.Attach {
+		// Only the x86-64 layout of NT_PRSTATUS is written.
+		if machine != elf.EM_X86_64 {
+			return fmt.Errorf("registers can't be saved for %s processes", machine)
+		}
+		var detach func()
+		threads, detach, err = p.attach()
+		if err != nil {
+			return err
+		}
+		defer detach()
+	}
+
+	all, err := p.readableRegions()
+	if err != nil {
+		return err
+	}
+	var regions []Region
+	for _, r := range all {
+		if opts.Filter == nil || opts.Filter(r) {
+			regions = append(regions, r)
+		}
+	}
+
+	cw := &coreWriter{w: bufio.NewWriter(w), order: order, ptrSize: ptrSize, machine: machine}
+	notes := cw.notes(p, threads, regions)
+
+	// Lay out the file: the headers, the notes, then the contents of each region, page aligned.
+	ehsize, phsize := 64, 56
+	if ptrSize == 4 {
+		ehsize, phsize = 52, 32
+	}
+	off := uint64(ehsize + phsize*(len(regions)+1))
+	progs := []elf.Prog64{{Type: uint32(elf.PT_NOTE), Off: off, Filesz: uint64(len(notes)), Align: 4}}
+	off += uint64(len(notes))
+	for _, r := range regions {
+		off = (off + pageSize - 1) &^ (pageSize - 1)
+		progs = append(progs, elf.Prog64{
+			Type:   uint32(elf.PT_LOAD),
+			Flags:  uint32(coreProgFlags(r.Perm)),
+			Off:    off,
+			Vaddr:  uint64(r.Base),
+			Filesz: uint64(r.Size),
+			Memsz:  uint64(r.Size),
+			Align:  pageSize,
+		})
+		off += uint64(r.Size)
+	}
+
+	cw.header(len(progs))
+	for _, prog := range progs {
+		cw.prog(prog)
+	}
+	cw.write(notes)
+	for i, r := range regions {
+		cw.pad(progs[i+1].Off)
+		cw.region(p, r)
+	}
+	if cw.err != nil {
+		return cw.err
+	}
+	return cw.w.Flush()
+}
+
+// coreMachine returns the ELF machine of the process. For live processes, it's that of kiwi's
+// build, with 32-bit processes on 64-bit systems taken to be their 32-bit counterpart.
+func (p *Process) coreMachine(ptrSize int) elf.Machine {
+	arch := runtime.GOARCH
+	switch b := p.backend.(type) {
+	case *Core:
+		return b.machine
+	case nil: // Live processes.
+	default:
+		// Other little-endian targets are assumed to be x86. The machine of big-endian
+		// targets, such as emulated consoles, is unknown.
+		if p.ByteOrder().Uint16([]byte{0x01, 0x02}) != 0x0201 {
+			return elf.EM_NONE
+		}
+		arch = "amd64"
+	}
+
+	switch arch {
+	case "amd64", "386":
+		if ptrSize == 4 {
+			return elf.EM_386
+		}
+		return elf.EM_X86_64
+	case "arm64", "arm":
+		if ptrSize == 4 {
+			return elf.EM_ARM
+		}
+		return elf.EM_AARCH64
+	}
+	return elf.EM_NONE
+}
+
+// coreProgFlags converts permissions to ELF segment flags.
+func coreProgFlags(perm Perm) elf.ProgFlag {
+	var flags elf.ProgFlag
+	if perm&PermRead != 0 {
+		flags |= elf.PF_R
+	}
+	if perm&PermWrite != 0 {
+		flags |= elf.PF_W
+	}
+	if perm&PermExec != 0 {
+		flags |= elf.PF_X
+	}
+	return flags
+}
+
+// coreWriter writes the parts of an ELF core file, remembering the first error.
+type coreWriter struct {
+	w       *bufio.Writer
+	order   binary.ByteOrder
+	ptrSize int
+	machine elf.Machine
+	off     uint64
+	err     error
+}
+
+func (cw *coreWriter) write(b []byte) {
+	if cw.err != nil {
+		return
+	}
+	var n int
+	n, cw.err = cw.w.Write(b)
+	cw.off += uint64(n)
+}
+
+func (cw *coreWriter) data(v interface{}) {
+	var buf bytes.Buffer
+	binary.Write(&buf, cw.order, v)
+	cw.write(buf.Bytes())
+}
+
+// word encodes a value of the pointer size.
+func (cw *coreWriter) word(b []byte, v uint64) []byte {
+	if cw.ptrSize == 4 {
+		var w [4]byte
+		cw.order.PutUint32(w[:], uint32(v))
+		return append(b, w[:]...)
+	}
+	var w [8]byte
+	cw.order.PutUint64(w[:], v)
+	return append(b, w[:]...)
+}
+
+// pad writes zeros up to the offset.
+func (cw *coreWriter) pad(off uint64) {
+	for cw.off < off && cw.err == nil {
+		n := off - cw.off
+		if n > uint64(len(zeroPage)) {
+			n = uint64(len(zeroPage))
+		}
+		cw.write(zeroPage[:n])
+	}
+}
+
+var zeroPage = make([]byte, pageSize)
+
+func (cw *coreWriter) header(phnum int) {
+	var ident [elf.EI_NIDENT]byte
+	copy(ident[:], elf.ELFMAG)
+	ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	if cw.ptrSize == 4 {
+		ident[elf.EI_CLASS] = byte(elf.ELFCLASS32)
+	}
+	ident[elf.EI_DATA] = byte(elf.ELFDATA2MSB)
+	if cw.order.Uint16([]byte{0x01, 0x02}) == 0x0201 {
+		ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	}
+	ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	if cw.ptrSize == 4 {
+		cw.data(&elf.Header32{
+			Ident: ident, Type: uint16(elf.ET_CORE), Machine: uint16(cw.machine), Version: uint32(elf.EV_CURRENT),
+			Phoff: 52, Ehsize: 52, Phentsize: 32, Phnum: uint16(phnum),
+		})
+		return
+	}
+	cw.data(&elf.Header64{
+		Ident: ident, Type: uint16(elf.ET_CORE), Machine: uint16(cw.machine), Version: uint32(elf.EV_CURRENT),
+		Phoff: 64, Ehsize: 64, Phentsize: 56, Phnum: uint16(phnum),
+	})
+}
+
+func (cw *coreWriter) prog(p elf.Prog64) {
+	if cw.ptrSize == 4 {
+		cw.data(&elf.Prog32{
+			Type: p.Type, Off: uint32(p.Off), Vaddr: uint32(p.Vaddr), Filesz: uint32(p.Filesz),
+			Memsz: uint32(p.Memsz), Flags: p.Flags, Align: uint32(p.Align),
+		})
+		return
+	}
+	cw.data(&p)
+}
+
+// notes returns the contents of the PT_NOTE segment: the registers of each thread,
+// the process info and the mapped files.
+func (cw *coreWriter) notes(p *Process, threads []Thread, regions []Region) []byte {
+	var notes []byte
+	for _, t := range threads {
+		desc := make([]byte, prstatusSize)
+		cw.order.PutUint32(desc[prstatusPid:], uint32(t.ID))
+		var regs bytes.Buffer
+		binary.Write(&regs, cw.order, &t.Regs)
+		copy(desc[prstatusRegs:], regs.Bytes())
+		notes = appendNote(notes, cw.order, "CORE", ntPrstatus, desc)
+	}
+
+	// The process info holds the PID and the name of the executable.
+	pidOff, fnameOff, size := 24, 40, 136
+	if cw.ptrSize == 4 {
+		pidOff, fnameOff, size = 12, 28, 124
+	}
+	info := make([]byte, size)
+	cw.order.PutUint32(info[pidOff:], uint32(p.PID))
+	if modules, err := p.Modules(); err == nil && len(modules) > 0 {
+		copy(info[fnameOff:fnameOff+15], modules[0].Name)
+	}
+	notes = appendNote(notes, cw.order, "CORE", ntPrpsinfo, info)
+
+	// Files: count and page size, then the start, end and page offset of each, then their names.
+	var files []Region
+	for _, r := range regions {
+		if r.Path != "" && r.Path[0] == '/' {
+			files = append(files, r)
+		}
+	}
+	desc := cw.word(nil, uint64(len(files)))
+	desc = cw.word(desc, pageSize)
+	for _, f := range files {
+		desc = cw.word(desc, uint64(f.Base))
+		desc = cw.word(desc, uint64(f.End()))
+		desc = cw.word(desc, f.Offset/pageSize)
+	}
+	for _, f := range files {
+		desc = append(desc, f.Path...)
+		desc = append(desc, 0)
+	}
+	return appendNote(notes, cw.order, "CORE", ntFile, desc)
+}
+
+// region writes the contents of a region, with zeros for pages which can't be read.
+func (cw *coreWriter) region(p *Process, r Region) {
+	start := cw.off
+	p.scanRegions([]Region{r}, 0, func(addr uintptr, data []byte) bool {
+		cw.pad(start + uint64(addr-r.Base))
+		cw.write(data)
+		return cw.err == nil
+	})
+	cw.pad(start + uint64(r.Size))
+}
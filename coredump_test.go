@@ -0,0 +1,145 @@
+package kiwi
+
+import (
+	"bytes"
+	"debug/elf"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestDumpCore(t *testing.T) {
+	p, err := GetProcessByFileName(currentProcessName)
+	if err != nil {
+		t.Fatalf("Error trying to open process \"%s\", Error: %s\n", currentProcessName, err.Error())
+	}
+
+	marker := []byte("kiwi core dump marker")
+	buf := make([]byte, 64)
+	copy(buf[8:], marker)
+	heapSink = &buf
+	addr := uintptr(unsafe.Pointer(&buf[8]))
+
+	exe, err := p.FindModule(currentProcessName)
+	if err != nil {
+		t.Fatalf("FindModule: %s\n", err)
+	}
+
+	// Only dump the executable and the region holding the marker.
+	opts := &CoreOptions{Filter: func(r Region) bool {
+		return r.Contains(addr) || r.Path == exe.Path
+	}}
+	var dump bytes.Buffer
+	if err := p.DumpCore(&dump, opts); err != nil {
+		t.Fatalf("DumpCore: %s\n", err)
+	}
+
+	core, err := NewCore(bytes.NewReader(dump.Bytes()))
+	if err != nil {
+		t.Fatalf("NewCore: %s\n", err)
+	}
+	cp := core.Process()
+	if cp.PID != p.PID {
+		t.Errorf("Expected PID %d, got %d\n", p.PID, cp.PID)
+	}
+	if got, err := cp.ReadBytes(addr, len(marker)); err != nil || !bytes.Equal(got, marker) {
+		t.Errorf("Expected %q, got %q (%v)\n", marker, got, err)
+	}
+	m, err := cp.FindModule(currentProcessName)
+	if err != nil || m.Base != exe.Base || m.Path != exe.Path {
+		t.Errorf("Expected module %+v, got %+v (%v)\n", exe, m, err)
+	}
+	if ef, err := elf.NewFile(bytes.NewReader(dump.Bytes())); err != nil || (runtime.GOARCH == "amd64" && ef.Machine != elf.EM_X86_64) {
+		t.Errorf("Expected the machine of the build, got %+v (%v)\n", ef, err)
+	}
+
+	// The machine can be given, but registers are only saved for x86-64.
+	dump.Reset()
+	if err := p.DumpCore(&dump, &CoreOptions{Filter: opts.Filter, Machine: elf.EM_AARCH64}); err != nil {
+		t.Fatalf("DumpCore: %s\n", err)
+	}
+	if ef, err := elf.NewFile(bytes.NewReader(dump.Bytes())); err != nil || ef.Machine != elf.EM_AARCH64 {
+		t.Errorf("Expected EM_AARCH64, got %+v (%v)\n", ef, err)
+	}
+	if err := p.DumpCore(ioutil.Discard, &CoreOptions{Attach: true, Machine: elf.EM_AARCH64}); err == nil {
+		t.Errorf("Expected an error saving registers of an unsupported machine\n")
+	}
+
+	// Compressed cores are decompressed by OpenCore.
+	dir, err := ioutil.TempDir("", "kiwi-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "core.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Gzip = true
+	err = p.DumpCore(f, opts)
+	f.Close()
+	if err != nil {
+		t.Fatalf("DumpCore: %s\n", err)
+	}
+
+	core, err = OpenCore(path)
+	if err != nil {
+		t.Fatalf("OpenCore: %s\n", err)
+	}
+	defer core.Close()
+	if got, err := core.Process().ReadBytes(addr, len(marker)); err != nil || !bytes.Equal(got, marker) {
+		t.Errorf("Expected %q, got %q (%v)\n", marker, got, err)
+	}
+}
+
+func TestDumpCoreAttach(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("registers are only saved on Linux amd64")
+	}
+
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("Couldn't start sleep: %s\n", err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+	time.Sleep(100 * time.Millisecond)
+
+	p, err := GetProcessByPID(cmd.Process.Pid)
+	if err != nil {
+		t.Fatalf("GetProcessByPID: %s\n", err)
+	}
+
+	var dump bytes.Buffer
+	err = p.DumpCore(&dump, &CoreOptions{Attach: true, Filter: func(r Region) bool {
+		return r.Path == "[stack]"
+	}})
+	if err != nil {
+		if os.IsPermission(err) || bytes.Contains([]byte(err.Error()), []byte(syscall.EPERM.Error())) {
+			t.Skipf("Not allowed to ptrace: %s\n", err)
+		}
+		t.Fatalf("DumpCore: %s\n", err)
+	}
+
+	core, err := NewCore(bytes.NewReader(dump.Bytes()))
+	if err != nil {
+		t.Fatalf("NewCore: %s\n", err)
+	}
+	threads, _ := core.Threads()
+	if len(threads) != 1 || threads[0].ID != cmd.Process.Pid {
+		t.Fatalf("Expected the thread %d, got %+v\n", cmd.Process.Pid, threads)
+	}
+
+	// The stack pointer is inside the dumped stack.
+	regions, _ := core.Process().Regions()
+	if len(regions) != 1 || !regions[0].Contains(uintptr(threads[0].Regs.RSP)) || threads[0].Regs.RIP == 0 {
+		t.Errorf("Unexpected registers %+v for stack %+v\n", threads[0].Regs, regions)
+	}
+}
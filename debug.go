@@ -0,0 +1,115 @@
+package kiwi
+
+import "errors"
+
+// BreakpointKind is the kind of a breakpoint, numbered like GDB's Z packets.
+type BreakpointKind int
+
+const (
+	// BreakSoftware stops when an instruction is executed, by replacing it with a trap.
+	BreakSoftware BreakpointKind = iota
+
+	// BreakHardware stops when an instruction is executed, using a debug register.
+	BreakHardware
+
+	// WatchWrite stops when memory is written.
+	WatchWrite
+
+	// WatchRead stops when memory is read.
+	WatchRead
+
+	// WatchAccess stops when memory is read or written.
+	WatchAccess
+)
+
+var breakpointKindNames = [...]string{"software", "hardware", "write", "read", "access"}
+
+func (k BreakpointKind) String() string {
+	if k >= 0 && int(k) < len(breakpointKindNames) {
+		return breakpointKindNames[k]
+	}
+	return "unknown"
+}
+
+// Breakpoint is a breakpoint or watchpoint.
+type Breakpoint struct {
+	Kind BreakpointKind
+	Addr uintptr
+
+	// Size is the number of bytes watched for watchpoints,
+	// and the size of the instruction for breakpoints (1 on x86).
+	Size int
+}
+
+// StopEvent describes why a target stopped.
+type StopEvent struct {
+	// Signal is the signal which stopped the target, e.g. 5 (SIGTRAP) for breakpoints and steps.
+	Signal int
+
+	// Thread is the thread which stopped, or 0 if unknown.
+	Thread int
+
+	// WatchAddr is the address accessed, if a watchpoint was hit.
+	WatchAddr uintptr
+
+	// Exited is set if the target exited, with its exit status in Status,
+	// or the signal which killed it in Signal.
+	Exited bool
+	Status int
+}
+
+// errNoDebugger is returned by the debugging methods of processes whose backend isn't a Debugger.
+var errNoDebugger = errors.New("debugging isn't supported for this process")
+
+// debugger returns the process's backend as a Debugger.
+func (p *Process) debugger() (Debugger, error) {
+	if d, ok := p.backend.(Debugger); ok {
+		return d, nil
+	}
+	return nil, errNoDebugger
+}
+
+// SetBreakpoint sets a breakpoint or watchpoint, if the backend supports debugging.
+func (p *Process) SetBreakpoint(bp Breakpoint) error {
+	d, err := p.debugger()
+	if err != nil {
+		return err
+	}
+	return d.SetBreakpoint(bp)
+}
+
+// ClearBreakpoint removes a breakpoint or watchpoint set with SetBreakpoint.
+func (p *Process) ClearBreakpoint(bp Breakpoint) error {
+	d, err := p.debugger()
+	if err != nil {
+		return err
+	}
+	return d.ClearBreakpoint(bp)
+}
+
+// Continue runs the process until it stops, at a breakpoint or otherwise.
+func (p *Process) Continue() (StopEvent, error) {
+	d, err := p.debugger()
+	if err != nil {
+		return StopEvent{}, err
+	}
+	return d.Continue()
+}
+
+// Step runs a single instruction of a thread.
+func (p *Process) Step(thread int) (StopEvent, error) {
+	d, err := p.debugger()
+	if err != nil {
+		return StopEvent{}, err
+	}
+	return d.Step(thread)
+}
+
+// Interrupt stops the process while Continue is running it.
+func (p *Process) Interrupt() error {
+	d, err := p.debugger()
+	if err != nil {
+		return err
+	}
+	return d.Interrupt()
+}
@@ -0,0 +1,136 @@
+package kiwi
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/arch/x86/x86asm"
+)
+
+// maxInstructionLen is the maximum length of an x86 instruction.
+const maxInstructionLen = 15
+
+// Instruction is a decoded x86 or x86-64 instruction.
+type Instruction struct {
+	Addr  uintptr
+	Bytes []byte
+	Len   int
+
+	// Mnemonic and Operands in Intel syntax, e.g. "mov" and ["rax", "qword ptr [rip+0x10]"].
+	Mnemonic string
+	Operands []string
+
+	// Target is the address a branch or RIP-relative operand refers to, if HasTarget is set.
+	Target    uintptr
+	HasTarget bool
+
+	// Symbol is the symbolic name of Target (see SymbolAt), if it's inside of a module.
+	Symbol string
+
+	// Inst is the decoded instruction. Invalid instructions have an Op of 0.
+	Inst x86asm.Inst
+}
+
+// IsBranch reports whether the instruction is a jump, call or loop with a relative target.
+func (inst *Instruction) IsBranch() bool {
+	for _, a := range inst.Inst.Args {
+		if _, ok := a.(x86asm.Rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the instruction in Intel syntax, with targets replaced by symbols where available.
+func (inst *Instruction) String() string {
+	if len(inst.Operands) == 0 {
+		return inst.Mnemonic
+	}
+	return inst.Mnemonic + " " + strings.Join(inst.Operands, ", ")
+}
+
+// Disassemble decodes count instructions starting at addr.
+//
+// The instructions are decoded as x86-64 or x86 depending on the pointer size of the process.
+// Bytes which don't decode to a valid instruction are returned as a one byte "(bad)" instruction.
+// Fewer than count instructions are returned if the end of readable memory is reached.
+func (p *Process) Disassemble(addr uintptr, count int) ([]Instruction, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("can't disassemble %d instructions", count)
+	}
+	mode := 64
+	if size, err := p.PointerSize(); err == nil && size == 4 {
+		mode = 32
+	}
+
+	code := make([]byte, count*maxInstructionLen)
+	n, err := p.readPartial(addr, code)
+	if n == 0 {
+		return nil, fmt.Errorf("readPartial 0x%X: %w", addr, err)
+	}
+	code = code[:n]
+
+	syms := newSymbolizer(p)
+	insts := make([]Instruction, 0, count)
+	for off := 0; len(insts) < count && off < len(code); {
+		inst, err := x86asm.Decode(code[off:], mode)
+		if err != nil {
+			// An instruction cut off at the end of readable memory.
+			if err == x86asm.ErrTruncated {
+				break
+			}
+			inst = x86asm.Inst{Len: 1, Mode: mode}
+		}
+
+		insts = append(insts, decodedInstruction(addr+uintptr(off), code[off:off+inst.Len], inst, syms))
+		off += inst.Len
+	}
+	return insts, nil
+}
+
+// decodedInstruction fills in an Instruction from a decoded instruction at pc.
+func decodedInstruction(pc uintptr, code []byte, inst x86asm.Inst, syms *symbolizer) Instruction {
+	out := Instruction{
+		Addr:  pc,
+		Bytes: append([]byte(nil), code...),
+		Len:   inst.Len,
+		Inst:  inst,
+	}
+	if inst.Op == 0 {
+		out.Mnemonic = "(bad)"
+		return out
+	}
+
+	next := pc + uintptr(inst.Len)
+	for _, a := range inst.Args {
+		switch a := a.(type) {
+		case x86asm.Rel:
+			out.Target, out.HasTarget = next+uintptr(int64(a)), true
+		case x86asm.Mem:
+			if a.Base == x86asm.RIP || a.Base == x86asm.EIP {
+				out.Target, out.HasTarget = next+uintptr(a.Disp), true
+			}
+		}
+	}
+	if out.HasTarget {
+		out.Symbol, _ = syms.name(out.Target)
+	}
+
+	// Only the target is symbolized, so immediates aren't mistaken for addresses.
+	text := x86asm.IntelSyntax(inst, uint64(pc), func(addr uint64) (string, uint64) {
+		if out.Symbol != "" && addr == uint64(out.Target) {
+			return out.Symbol, addr
+		}
+		return "", 0
+	})
+
+	// Split off the prefixes and mnemonic, which are all separated by spaces.
+	mnemonic := strings.ToLower(inst.Op.String())
+	if i := strings.Index(text, mnemonic+" "); i != -1 {
+		out.Mnemonic = text[:i+len(mnemonic)]
+		out.Operands = strings.Split(text[i+len(mnemonic)+1:], ", ")
+	} else {
+		out.Mnemonic = text
+	}
+	return out
+}
@@ -0,0 +1,73 @@
+package kiwi
+
+import (
+	"fmt"
+	"testing"
+	"unsafe"
+)
+
+func TestDisassemble(t *testing.T) {
+	p, err := GetProcessByFileName(currentProcessName)
+	if err != nil {
+		t.Fatalf("Error trying to open process \"%s\", Error: %s\n", currentProcessName, err.Error())
+	}
+
+	code := &[16]byte{
+		0x48, 0x8B, 0x05, 0x10, 0x00, 0x00, 0x00, // mov rax, qword ptr [rip+0x10]
+		0xE8, 0xF4, 0xFF, 0xFF, 0xFF, // call -0xC
+		0x90, // nop
+		0x06, // invalid in 64-bit mode
+		0xC3, // ret
+	}
+	heapSink = code
+	addr := uintptr(unsafe.Pointer(code))
+
+	insts, err := p.WithPointerSize(8).Disassemble(addr, 5)
+	if err != nil {
+		t.Fatalf("Disassemble: %s\n", err)
+	}
+	if len(insts) != 5 {
+		t.Fatalf("Expected 5 instructions, got %d\n", len(insts))
+	}
+
+	tests := []struct {
+		text   string
+		len    int
+		target uintptr
+	}{
+		{"mov rax, qword ptr [rip+0x10]", 7, addr + 7 + 0x10},
+		{fmt.Sprintf("call 0x%x", addr), 5, addr},
+		{"nop", 1, 0},
+		{"(bad)", 1, 0},
+		{"ret", 1, 0},
+	}
+	off := uintptr(0)
+	for i, tst := range tests {
+		inst := insts[i]
+		if inst.String() != tst.text || inst.Len != tst.len || len(inst.Bytes) != tst.len || inst.Addr != addr+off {
+			t.Errorf("Instruction %d got %q (len %d at 0x%X), expected %q (len %d at 0x%X)\n", i, inst.String(), inst.Len, inst.Addr, tst.text, tst.len, addr+off)
+		}
+		if inst.HasTarget != (tst.target != 0) || inst.Target != tst.target {
+			t.Errorf("Instruction %d got target 0x%X, expected 0x%X\n", i, inst.Target, tst.target)
+		}
+		off += uintptr(tst.len)
+	}
+	if !insts[1].IsBranch() || insts[0].IsBranch() {
+		t.Errorf("IsBranch is wrong\n")
+	}
+
+	for _, count := range []int{0, -1} {
+		if _, err := p.Disassemble(addr, count); err == nil {
+			t.Errorf("Expected an error disassembling %d instructions\n", count)
+		}
+	}
+
+	// The same bytes decode differently in 32-bit mode.
+	insts, err = p.WithPointerSize(4).Disassemble(addr, 1)
+	if err != nil {
+		t.Fatalf("Disassemble: %s\n", err)
+	}
+	if insts[0].Mnemonic != "dec" {
+		t.Errorf("Expected dec in 32-bit mode, got %q\n", insts[0].String())
+	}
+}
@@ -0,0 +1,524 @@
+package kiwi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Address expressions
+//
+// An address expression describes how to compute an address in a process, for example:
+//
+//	libgame.so+0x1A2B30 -> [+0x18] -> [+0x40] + 0x10
+//
+// Expressions support:
+//   - Numbers, in hex (0x1A2B30) or decimal (16).
+//   - Module names, evaluating to the module's base (libgame.so, kernel32.dll).
+//     Names which aren't plain identifiers can be quoted ("libc-2.31.so").
+//   - Exported symbols, as module!symbol (kernel32.dll!LoadLibraryA).
+//   - Named variables, given to EvalWith. Variables take precedence over module names.
+//   - Arithmetic with +, -, *, / and parentheses.
+//   - Dereferences of the target's pointer size, as [expr].
+//   - Pointer chains with ->, which make the left value available to the right side.
+//     On the right of ->, [+expr] and [-expr] dereference relative to the left value,
+//     and a leading + or - adds to it. For example, "a -> [+8] -> +4" is "[a+8]+4".
+
+// Vars is a set of named variables available to address expressions.
+type Vars map[string]uintptr
+
+// ExprError is an error parsing or evaluating an address expression.
+type ExprError struct {
+	Expr string
+	Pos  int // Byte offset into Expr.
+	Msg  string
+	Err  error // Underlying error, if any.
+}
+
+func (e *ExprError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s at position %d: %s", e.Msg, e.Pos, e.Err)
+	}
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+func (e *ExprError) Unwrap() error {
+	return e.Err
+}
+
+// Expr is a parsed address expression.
+type Expr struct {
+	src  string
+	root exprNode
+}
+
+// ParseExpr parses an address expression.
+func ParseExpr(s string) (*Expr, error) {
+	ps := &exprParser{src: s}
+	if err := ps.lex(); err != nil {
+		return nil, err
+	}
+
+	root, err := ps.parseChain()
+	if err != nil {
+		return nil, err
+	}
+	if t := ps.peek(); t.kind != tokEOF {
+		return nil, ps.errorf(t.pos, "unexpected %s", t)
+	}
+	return &Expr{src: s, root: root}, nil
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval evaluates the expression against the process, with the given variables.
+func (e *Expr) Eval(p *Process, vars Vars) (uintptr, error) {
+	ev := &exprEval{p: p, vars: vars, src: e.src}
+	return ev.eval(e.root, 0, false)
+}
+
+// Eval parses and evaluates an address expression, such as "libgame.so+0x1A2B30 -> [+0x18]".
+func (p *Process) Eval(expr string) (uintptr, error) {
+	return p.EvalWith(expr, nil)
+}
+
+// EvalWith parses and evaluates an address expression with the given named variables.
+func (p *Process) EvalWith(expr string, vars Vars) (uintptr, error) {
+	e, err := ParseExpr(expr)
+	if err != nil {
+		return 0, err
+	}
+	return e.Eval(p, vars)
+}
+
+// Lexing.
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokNum
+	tokIdent
+	tokOp // One of + - * / ( ) [ ] ! ->
+)
+
+type token struct {
+	kind tokKind
+	pos  int
+	text string
+	num  uint64
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokNum:
+		return fmt.Sprintf("number %s", t.text)
+	case tokIdent:
+		return fmt.Sprintf("identifier %q", t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+type exprParser struct {
+	src  string
+	toks []token
+	i    int
+
+	// Depth of -> right hand sides being parsed, where relative forms are allowed.
+	chainDepth int
+}
+
+func (ps *exprParser) errorf(pos int, format string, args ...interface{}) error {
+	return &ExprError{Expr: ps.src, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9') || c == '.' || c == '@' || c == '$'
+}
+
+// exprName returns name as it's written in an address expression, quoted if it isn't a plain identifier.
+// Names containing a quote can't be written, as quoted names can't escape them, and return false.
+func exprName(name string) (string, bool) {
+	if strings.IndexByte(name, '"') != -1 {
+		return "", false
+	}
+	if name == "" || !isIdentStart(name[0]) {
+		return `"` + name + `"`, true
+	}
+	for i := 1; i < len(name); i++ {
+		if !isIdentChar(name[i]) {
+			return `"` + name + `"`, true
+		}
+	}
+	return name, true
+}
+
+func (ps *exprParser) lex() error {
+	s := ps.src
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '-' && i+1 < len(s) && s[i+1] == '>':
+			ps.toks = append(ps.toks, token{kind: tokOp, pos: i, text: "->"})
+			i += 2
+
+		case strings.IndexByte("+-*/()[]!", c) != -1:
+			ps.toks = append(ps.toks, token{kind: tokOp, pos: i, text: s[i : i+1]})
+			i++
+
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(s) && isIdentChar(s[i]) {
+				i++
+			}
+			text := s[start:i]
+			n, err := strconv.ParseUint(text, 0, 64)
+			if err != nil {
+				return ps.errorf(start, "invalid number %q", text)
+			}
+			ps.toks = append(ps.toks, token{kind: tokNum, pos: start, text: text, num: n})
+
+		case isIdentStart(c):
+			start := i
+			for i < len(s) && isIdentChar(s[i]) {
+				i++
+			}
+			ps.toks = append(ps.toks, token{kind: tokIdent, pos: start, text: s[start:i]})
+
+		case c == '"':
+			start := i
+			end := strings.IndexByte(s[i+1:], '"')
+			if end == -1 {
+				return ps.errorf(start, "unterminated quoted name")
+			}
+			ps.toks = append(ps.toks, token{kind: tokIdent, pos: start, text: s[i+1 : i+1+end]})
+			i += end + 2
+
+		default:
+			return ps.errorf(i, "unexpected character %q", c)
+		}
+	}
+	ps.toks = append(ps.toks, token{kind: tokEOF, pos: len(s)})
+	return nil
+}
+
+// Parsing.
+//
+//	chain   = sum { "->" rel }
+//	rel     = [ "+" | "-" ] term { ("+" | "-") term }    (a leading sign is relative to the left value)
+//	sum     = term { ("+" | "-") term }
+//	term    = unary { ("*" | "/") unary }
+//	unary   = "-" unary | primary
+//	primary = number | name [ "!" name ] | "(" chain ")" | "[" [ "+" | "-" ] chain "]"
+
+type exprNode interface{}
+
+type (
+	numNode struct {
+		v uint64
+	}
+	nameNode struct {
+		pos  int
+		name string
+	}
+	symNode struct {
+		pos            int
+		module, symbol string
+	}
+	curNode struct {
+		pos int
+	}
+	derefNode struct {
+		pos int
+		x   exprNode
+	}
+	negNode struct {
+		x exprNode
+	}
+	binNode struct {
+		pos  int
+		op   byte
+		l, r exprNode
+	}
+	chainNode struct {
+		l, r exprNode
+	}
+)
+
+func (ps *exprParser) peek() token {
+	return ps.toks[ps.i]
+}
+
+func (ps *exprParser) next() token {
+	t := ps.toks[ps.i]
+	if t.kind != tokEOF {
+		ps.i++
+	}
+	return t
+}
+
+func (ps *exprParser) isOp(ops ...string) bool {
+	t := ps.peek()
+	if t.kind != tokOp {
+		return false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (ps *exprParser) expect(op string) error {
+	if !ps.isOp(op) {
+		t := ps.peek()
+		return ps.errorf(t.pos, "expected %q, found %s", op, t)
+	}
+	ps.next()
+	return nil
+}
+
+func (ps *exprParser) parseChain() (exprNode, error) {
+	l, err := ps.parseSum(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for ps.isOp("->") {
+		ps.next()
+
+		ps.chainDepth++
+		var r exprNode
+		if ps.isOp("+", "-") {
+			// Leading sign, relative to the left value.
+			r, err = ps.parseSum(curNode{pos: ps.peek().pos})
+		} else {
+			r, err = ps.parseSum(nil)
+		}
+		ps.chainDepth--
+		if err != nil {
+			return nil, err
+		}
+
+		l = chainNode{l: l, r: r}
+	}
+	return l, nil
+}
+
+// parseSum parses a sum. If l is non-nil it is used as the left operand of a leading + or -.
+func (ps *exprParser) parseSum(l exprNode) (exprNode, error) {
+	if l == nil {
+		var err error
+		l, err = ps.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for ps.isOp("+", "-") {
+		op := ps.next()
+		r, err := ps.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		l = binNode{pos: op.pos, op: op.text[0], l: l, r: r}
+	}
+	return l, nil
+}
+
+func (ps *exprParser) parseTerm() (exprNode, error) {
+	l, err := ps.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for ps.isOp("*", "/") {
+		op := ps.next()
+		r, err := ps.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = binNode{pos: op.pos, op: op.text[0], l: l, r: r}
+	}
+	return l, nil
+}
+
+func (ps *exprParser) parseUnary() (exprNode, error) {
+	if ps.isOp("-") {
+		ps.next()
+		x, err := ps.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negNode{x: x}, nil
+	}
+	return ps.parsePrimary()
+}
+
+func (ps *exprParser) parsePrimary() (exprNode, error) {
+	t := ps.next()
+	switch t.kind {
+	case tokNum:
+		return numNode{v: t.num}, nil
+
+	case tokIdent:
+		if !ps.isOp("!") {
+			return nameNode{pos: t.pos, name: t.text}, nil
+		}
+		ps.next()
+		sym := ps.next()
+		if sym.kind != tokIdent {
+			return nil, ps.errorf(sym.pos, "expected symbol name, found %s", sym)
+		}
+		return symNode{pos: t.pos, module: t.text, symbol: sym.text}, nil
+
+	case tokOp:
+		switch t.text {
+		case "(":
+			x, err := ps.parseChain()
+			if err != nil {
+				return nil, err
+			}
+			if err := ps.expect(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+
+		case "[":
+			var x exprNode
+			var err error
+			if ps.isOp("+", "-") {
+				// [+expr] and [-expr] are relative to the left side of a ->.
+				if ps.chainDepth == 0 {
+					return nil, ps.errorf(ps.peek().pos, "relative dereference outside of ->")
+				}
+				x, err = ps.parseSum(curNode{pos: ps.peek().pos})
+				if err == nil && ps.isOp("->") {
+					err = ps.errorf(ps.peek().pos, "-> inside of relative dereference")
+				}
+			} else {
+				x, err = ps.parseChain()
+			}
+			if err != nil {
+				return nil, err
+			}
+			if err := ps.expect("]"); err != nil {
+				return nil, err
+			}
+			return derefNode{pos: t.pos, x: x}, nil
+		}
+	}
+	return nil, ps.errorf(t.pos, "unexpected %s", t)
+}
+
+// Evaluation.
+
+type exprEval struct {
+	p    *Process
+	vars Vars
+	src  string
+
+	// Loaded on first use.
+	modules []Module
+}
+
+func (ev *exprEval) errorf(pos int, err error, format string, args ...interface{}) error {
+	return &ExprError{Expr: ev.src, Pos: pos, Msg: fmt.Sprintf(format, args...), Err: err}
+}
+
+// eval evaluates n. cur is the left value of the enclosing ->, if hasCur is set.
+func (ev *exprEval) eval(n exprNode, cur uintptr, hasCur bool) (uintptr, error) {
+	switch n := n.(type) {
+	case numNode:
+		return uintptr(n.v), nil
+
+	case curNode:
+		if !hasCur {
+			return 0, ev.errorf(n.pos, nil, "relative expression outside of ->")
+		}
+		return cur, nil
+
+	case nameNode:
+		if v, ok := ev.vars[n.name]; ok {
+			return v, nil
+		}
+		if ev.modules == nil {
+			modules, err := ev.p.Modules()
+			if err != nil {
+				return 0, ev.errorf(n.pos, err, "unknown name %q", n.name)
+			}
+			ev.modules = modules
+		}
+		m, err := findModule(ev.modules, n.name)
+		if err != nil {
+			return 0, ev.errorf(n.pos, nil, "unknown variable or module %q", n.name)
+		}
+		return m.Base, nil
+
+	case symNode:
+		addr, err := ev.p.LookupSymbol(n.module, n.symbol)
+		if err != nil {
+			return 0, ev.errorf(n.pos, err, "can't resolve %s!%s", n.module, n.symbol)
+		}
+		return addr, nil
+
+	case derefNode:
+		addr, err := ev.eval(n.x, cur, hasCur)
+		if err != nil {
+			return 0, err
+		}
+		v, err := ev.p.ReadPointer(addr)
+		if err != nil {
+			return 0, ev.errorf(n.pos, err, "can't dereference 0x%X", addr)
+		}
+		return v, nil
+
+	case negNode:
+		x, err := ev.eval(n.x, cur, hasCur)
+		return -x, err
+
+	case binNode:
+		l, err := ev.eval(n.l, cur, hasCur)
+		if err != nil {
+			return 0, err
+		}
+		r, err := ev.eval(n.r, cur, hasCur)
+		if err != nil {
+			return 0, err
+		}
+		switch n.op {
+		case '+':
+			return l + r, nil
+		case '-':
+			return l - r, nil
+		case '*':
+			return l * r, nil
+		case '/':
+			if r == 0 {
+				return 0, ev.errorf(n.pos, nil, "division by zero")
+			}
+			return l / r, nil
+		}
+
+	case chainNode:
+		l, err := ev.eval(n.l, cur, hasCur)
+		if err != nil {
+			return 0, err
+		}
+		return ev.eval(n.r, l, true)
+	}
+	panic(fmt.Sprintf("unknown expression node %T", n))
+}
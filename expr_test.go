@@ -0,0 +1,193 @@
+package kiwi
+
+import (
+	"debug/elf"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestEval(t *testing.T) {
+	p, err := GetProcessByFileName(currentProcessName)
+	if err != nil {
+		t.Fatalf("Error trying to open process \"%s\", Error: %s\n", currentProcessName, err.Error())
+	}
+
+	// A small pointer chain: root -> node1 -> node2, with a value at node2+0x10.
+	type node struct {
+		pad  [2]uintptr
+		next *node
+		val  uint64
+	}
+	node2 := &node{val: 0x1234}
+	node1 := &node{next: node2}
+	root := &node1
+	heapSink = root
+
+	mod, err := p.FindModule(currentProcessName)
+	if err != nil {
+		t.Fatalf("FindModule: %s\n", err)
+	}
+
+	vars := Vars{
+		"root": uintptr(unsafe.Pointer(root)),
+		"n2":   uintptr(unsafe.Pointer(node2)),
+	}
+
+	tests := []struct {
+		expr string
+		want uintptr
+	}{
+		{"0x10 + 2 * 3", 0x16},
+		{"(0x10 + 2) * 3", 0x36},
+		{"0x20 / 4 - 1", 7},
+		{"-1 + 2", 1},
+		{"n2", uintptr(unsafe.Pointer(node2))},
+		{"[root]", uintptr(unsafe.Pointer(node1))},
+		{"[root] -> [+0x10] + 0x18", uintptr(unsafe.Pointer(&node2.val))},
+		{"root -> [+0] -> [+0x10] -> +0x18", uintptr(unsafe.Pointer(&node2.val))},
+		{"[[[root] + 0x10] + 0x18]", 0x1234},
+		{"\"" + currentProcessName + "\" + 0x10", mod.Base + 0x10},
+	}
+
+	for _, tst := range tests {
+		got, err := p.EvalWith(tst.expr, vars)
+		if err != nil {
+			t.Errorf("EvalWith(%q): %s\n", tst.expr, err)
+			continue
+		}
+		if got != tst.want {
+			t.Errorf("EvalWith(%q) = 0x%X, expected 0x%X\n", tst.expr, got, tst.want)
+		}
+	}
+}
+
+func TestExprName(t *testing.T) {
+	tests := []struct {
+		name, want string
+		ok         bool
+	}{
+		{"kernel32.dll", "kernel32.dll", true},
+		{"libc-2.31.so", `"libc-2.31.so"`, true},
+		{"?Tick@@YAXXZ", `"?Tick@@YAXXZ"`, true},
+		{"", `""`, true},
+		{`say"hi"`, "", false},
+	}
+	for _, tst := range tests {
+		if got, ok := exprName(tst.name); got != tst.want || ok != tst.ok {
+			t.Errorf("exprName(%q) = %q %v, expected %q %v\n", tst.name, got, ok, tst.want, tst.ok)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	p, err := GetProcessByFileName(currentProcessName)
+	if err != nil {
+		t.Fatalf("Error trying to open process \"%s\", Error: %s\n", currentProcessName, err.Error())
+	}
+
+	tests := []struct {
+		expr string
+		pos  int
+	}{
+		{"0x10 +", 6},
+		{"0x10 + 1A", 7},
+		{"[+8]", 1},
+		{"(1 + 2", 6},
+		{"1 ? 2", 2},
+		{"no_such_module.so + 8", 0},
+		{"8 / 0", 2},
+		{"0x10 -> [0]", 8},
+	}
+
+	for _, tst := range tests {
+		_, err := p.Eval(tst.expr)
+		var ee *ExprError
+		if !errors.As(err, &ee) {
+			t.Errorf("Eval(%q) returned %v, expected an ExprError\n", tst.expr, err)
+			continue
+		}
+		if ee.Pos != tst.pos {
+			t.Errorf("Eval(%q) error at position %d, expected %d: %s\n", tst.expr, ee.Pos, tst.pos, err)
+		}
+	}
+}
+
+func TestEvalSymbol(t *testing.T) {
+	// Test binaries are stripped, so look up a libc symbol in a child process instead.
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("Couldn't start sleep: %s\n", err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	p, err := GetProcessByPID(cmd.Process.Pid)
+	if err != nil {
+		t.Fatalf("Error trying to open process with PID %d, Error: %s\n", cmd.Process.Pid, err.Error())
+	}
+
+	// Wait for the dynamic loader to map libc.
+	var libc Module
+	for i := 0; i < 100; i++ {
+		if libc, err = p.FindModule("libc.so.6"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Skipf("sleep doesn't load libc.so.6: %s\n", err)
+	}
+
+	addr, err := p.Eval("libc.so.6!malloc")
+	if err != nil {
+		t.Fatalf("Eval: %s\n", err)
+	}
+	if !libc.Contains(addr) {
+		t.Fatalf("malloc at 0x%X is outside of libc at 0x%X-0x%X\n", addr, libc.Base, libc.Base+libc.Size)
+	}
+
+	// The code in memory should match the file at the symbol's offset.
+	f, err := elf.Open(libc.Path)
+	if err != nil {
+		t.Fatalf("elf.Open: %s\n", err)
+	}
+	defer f.Close()
+	syms, err := f.DynamicSymbols()
+	if err != nil {
+		t.Fatalf("DynamicSymbols: %s\n", err)
+	}
+	for _, s := range syms {
+		if s.Name != "malloc" || s.Section == elf.SHN_UNDEF {
+			continue
+		}
+		sect := f.Sections[s.Section]
+		want := make([]byte, 16)
+		if _, err := sect.ReadAt(want, int64(s.Value-sect.Addr)); err != nil {
+			t.Fatalf("ReadAt: %s\n", err)
+		}
+		got, err := p.ReadBytes(addr, len(want))
+		if err != nil {
+			t.Fatalf("ReadBytes: %s\n", err)
+		}
+		if string(got) != string(want) {
+			t.Fatalf("Code at malloc doesn't match the file. Got: %X, Expected: %X\n", got, want)
+		}
+
+		// Symbolic names should evaluate back to the address.
+		for _, a := range []uintptr{addr, addr + 1} {
+			name, ok := p.SymbolAt(a)
+			if !ok {
+				t.Fatalf("SymbolAt 0x%X found no module\n", a)
+			}
+			got, err := p.Eval(name)
+			if err != nil || got != a {
+				t.Fatalf("SymbolAt 0x%X = %q, which evaluates to 0x%X (%v)\n", a, name, got, err)
+			}
+		}
+		return
+	}
+	t.Fatalf("malloc not found in %s\n", libc.Path)
+}
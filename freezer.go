@@ -0,0 +1,218 @@
+package kiwi
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FreezeMode controls when a frozen value is rewritten.
+type FreezeMode int
+
+const (
+	// FreezeAlways rewrites the value on every tick.
+	FreezeAlways FreezeMode = iota
+
+	// FreezeOnChange reads the value on every tick and only rewrites it if it changed.
+	FreezeOnChange
+)
+
+// FreezeEntry is an address held at a fixed value by a Freezer.
+type FreezeEntry struct {
+	Addr uintptr
+
+	mu      sync.Mutex
+	value   interface{}
+	mode    FreezeMode
+	enabled bool
+}
+
+// Value returns the value the entry is frozen to.
+func (e *FreezeEntry) Value() interface{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.value
+}
+
+// SetValue changes the value the entry is frozen to.
+// The value must be of a type accepted by WriteValue.
+func (e *FreezeEntry) SetValue(v interface{}) error {
+	if _, err := TypeOf(v); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.value = v
+	return nil
+}
+
+// SetMode changes when the entry is rewritten.
+func (e *FreezeEntry) SetMode(mode FreezeMode) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.mode = mode
+}
+
+// Enable resumes freezing the entry.
+func (e *FreezeEntry) Enable() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.enabled = true
+}
+
+// Disable stops freezing the entry, without removing it from the Freezer.
+func (e *FreezeEntry) Disable() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.enabled = false
+}
+
+// Enabled reports whether the entry is being frozen.
+func (e *FreezeEntry) Enabled() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enabled
+}
+
+// FreezeError is sent on a Freezer's error channel when rewriting an entry fails.
+type FreezeError struct {
+	Entry *FreezeEntry
+	Err   error
+}
+
+func (e *FreezeError) Error() string {
+	return fmt.Sprintf("freeze 0x%X: %s", e.Entry.Addr, e.Err)
+}
+
+func (e *FreezeError) Unwrap() error {
+	return e.Err
+}
+
+// Freezer keeps a set of addresses pinned to chosen values by periodically rewriting them.
+//
+// Entries can be added, removed, enabled and disabled while the Freezer is running.
+type Freezer struct {
+	p        *Process
+	interval time.Duration
+
+	mu      sync.Mutex
+	entries []*FreezeEntry
+
+	errs chan error
+}
+
+// NewFreezer returns a Freezer which rewrites its entries in p every interval.
+// Call Run to start freezing.
+func NewFreezer(p *Process, interval time.Duration) *Freezer {
+	return &Freezer{
+		p:        p,
+		interval: interval,
+		errs:     make(chan error, 16),
+	}
+}
+
+// Add freezes addr to value, which must be of a type accepted by WriteValue.
+// The returned entry is enabled and uses FreezeAlways.
+func (f *Freezer) Add(addr uintptr, value interface{}) (*FreezeEntry, error) {
+	if _, err := TypeOf(value); err != nil {
+		return nil, err
+	}
+
+	e := &FreezeEntry{Addr: addr, value: value, enabled: true}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries = append(f.entries, e)
+	return e, nil
+}
+
+// Remove stops freezing the entry and removes it from the Freezer.
+func (f *Freezer) Remove(e *FreezeEntry) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, fe := range f.entries {
+		if fe == e {
+			f.entries = append(f.entries[:i], f.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// Entries returns the entries of the Freezer.
+func (f *Freezer) Entries() []*FreezeEntry {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*FreezeEntry(nil), f.entries...)
+}
+
+// Errors returns the channel write errors are reported on, as *FreezeError.
+// Errors are dropped if the channel is full, so freezing is never blocked by a slow reader.
+// The channel is closed when Run returns.
+func (f *Freezer) Errors() <-chan error {
+	return f.errs
+}
+
+// Run rewrites the entries every interval until ctx is done, then returns ctx.Err().
+// It returns an error straight away if the interval isn't positive.
+// Run must only be called once.
+func (f *Freezer) Run(ctx context.Context) error {
+	defer close(f.errs)
+	if f.interval <= 0 {
+		return fmt.Errorf("freeze interval %v isn't positive", f.interval)
+	}
+
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		f.tick()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick rewrites each enabled entry once.
+func (f *Freezer) tick() {
+	for _, e := range f.Entries() {
+		e.mu.Lock()
+		value, mode, enabled := e.value, e.mode, e.enabled
+		e.mu.Unlock()
+
+		if !enabled {
+			continue
+		}
+
+		if mode == FreezeOnChange {
+			cur, err := f.readCurrent(e.Addr, value)
+			if err == nil && valuesEqual(cur, value) {
+				continue
+			}
+		}
+
+		if err := f.p.WriteValue(e.Addr, value); err != nil {
+			select {
+			case f.errs <- &FreezeError{Entry: e, Err: err}:
+			default:
+			}
+		}
+	}
+}
+
+// readCurrent reads the value at addr with the same type as value.
+func (f *Freezer) readCurrent(addr uintptr, value interface{}) (interface{}, error) {
+	if b, ok := value.([]byte); ok {
+		return f.p.ReadBytes(addr, len(b))
+	}
+
+	t, err := TypeOf(value)
+	if err != nil {
+		return nil, err
+	}
+	return f.p.ReadValue(addr, t)
+}
@@ -0,0 +1,74 @@
+package kiwi
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestFreezer(t *testing.T) {
+	p, err := GetProcessByFileName(currentProcessName)
+	if err != nil {
+		t.Fatalf("Error trying to open process \"%s\", Error: %s\n", currentProcessName, err.Error())
+	}
+
+	var frozen, disabled uint32 = 1, 1
+
+	f := NewFreezer(&p, time.Millisecond)
+	if _, err := f.Add(uintptr(unsafe.Pointer(&frozen)), uint32(1000)); err != nil {
+		t.Fatalf("Add: %s\n", err)
+	}
+	de, err := f.Add(uintptr(unsafe.Pointer(&disabled)), uint32(1000))
+	if err != nil {
+		t.Fatalf("Add: %s\n", err)
+	}
+	de.Disable()
+	if _, err := f.Add(0, uint32(1)); err != nil {
+		t.Fatalf("Add: %s\n", err)
+	}
+	if _, err := f.Add(0, 5); err == nil {
+		t.Fatalf("Expected error adding an int value\n")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- f.Run(ctx)
+	}()
+
+	// The write to address 0 should be reported.
+	select {
+	case err := <-f.Errors():
+		var fe *FreezeError
+		if !errors.As(err, &fe) || fe.Entry.Addr != 0 {
+			t.Fatalf("Expected FreezeError for address 0, got %v\n", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for freeze error\n")
+	}
+
+	// The frozen value is restored after being changed.
+	atomic.StoreUint32(&frozen, 5)
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadUint32(&frozen) != 1000 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Frozen value was not restored, got %d\n", atomic.LoadUint32(&frozen))
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Run returned %v, expected context.Canceled\n", err)
+	}
+
+	if v := atomic.LoadUint32(&disabled); v != 1 {
+		t.Fatalf("Disabled entry was written, got %d\n", v)
+	}
+	if err := NewFreezer(&p, 0).Run(context.Background()); err == nil {
+		t.Fatalf("Expected an error running with a zero interval\n")
+	}
+}
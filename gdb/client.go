@@ -0,0 +1,366 @@
+// Package gdb accesses targets through the GDB remote serial protocol, such as emulators
+// (QEMU, Dolphin, PCSX2) and embedded boards with a gdbstub, or gdbserver itself.
+//
+// A Client is a kiwi.Backend, so all of kiwi's API works on the target:
+//
+//	c, err := gdb.Dial("localhost:1234")
+//	...
+//	p := c.Process()
+//	v, err := p.ReadUint32(0x80001234)
+//
+// Memory is read and written with the m and M packets, registers with g and G,
+// and breakpoints are set with Z and z. The memory map and register layout are read with
+// qXfer when the stub supports it.
+package gdb
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Andoryuuta/kiwi"
+	"github.com/Andoryuuta/kiwi/internal/rsp"
+)
+
+// defaultPacketSize is the packet size assumed if the stub doesn't say.
+const defaultPacketSize = 400
+
+// Client is a connection to a GDB stub. It implements kiwi.Backend, along with
+// kiwi.PointerSizer, kiwi.ThreadLister, kiwi.RegisterWriter and kiwi.Debugger.
+//
+// Requests are made one at a time, so memory accesses wait while Continue runs the target.
+type Client struct {
+	conn *rsp.Conn
+
+	mu         sync.Mutex // Serializes requests.
+	features   map[string]string
+	packetSize int
+	desc       *targetDesc // nil if the stub has no target description.
+	memoryMap  []kiwi.Region
+	stop       kiwi.StopEvent // The last stop.
+
+	// Output receives the console output of the target, sent with O packets.
+	// It's discarded if nil.
+	Output io.Writer
+}
+
+// Dial connects to the stub listening at addr, e.g. "localhost:1234".
+func Dial(addr string) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewClient returns a client over an established connection to a stub.
+func NewClient(conn io.ReadWriteCloser) (*Client, error) {
+	c := &Client{conn: rsp.NewConn(conn), packetSize: defaultPacketSize}
+	if err := c.handshake(); err != nil {
+		c.conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// handshake negotiates features and reads the target's description and memory map.
+func (c *Client) handshake() error {
+	resp, err := c.request("qSupported:swbreak+;hwbreak+;xmlRegisters=i386")
+	if err != nil {
+		return err
+	}
+	c.features = parseFeatures(resp)
+	if s, ok := c.features["PacketSize"]; ok {
+		if n, err := strconv.ParseUint(s, 16, 32); err == nil && n >= 64 {
+			c.packetSize = int(n)
+		}
+	}
+	// Replies to reads are up to twice the packet size in hex, so allow a few times more.
+	if max := 4 * c.packetSize; max > rsp.DefaultMaxPacket {
+		c.conn.SetMaxPacket(max)
+	}
+
+	if c.features["QStartNoAckMode"] == "+" {
+		if resp, err := c.request("QStartNoAckMode"); err == nil && resp == "OK" {
+			c.conn.DisableAcks()
+		}
+	}
+
+	resp, err = c.request("?")
+	if err != nil {
+		return err
+	}
+	if c.stop, err = parseStop(resp); err != nil {
+		return err
+	}
+
+	if c.features["qXfer:features:read"] == "+" {
+		data, err := c.xfer("features", "target.xml")
+		if err != nil {
+			return fmt.Errorf("reading target description: %w", err)
+		}
+		c.desc, err = parseTargetDesc(data, func(name string) ([]byte, error) {
+			return c.xfer("features", name)
+		})
+		if err != nil {
+			return fmt.Errorf("target description: %w", err)
+		}
+	}
+	if c.features["qXfer:memory-map:read"] == "+" {
+		data, err := c.xfer("memory-map", "")
+		if err != nil {
+			return fmt.Errorf("reading memory map: %w", err)
+		}
+		if c.memoryMap, err = parseMemoryMap(data); err != nil {
+			return fmt.Errorf("memory map: %w", err)
+		}
+	}
+	return nil
+}
+
+// parseFeatures parses the reply to qSupported, e.g. "PacketSize=1000;qXfer:features:read+".
+func parseFeatures(resp string) map[string]string {
+	features := make(map[string]string)
+	for _, f := range strings.Split(resp, ";") {
+		switch {
+		case strings.Contains(f, "="):
+			i := strings.IndexByte(f, '=')
+			features[f[:i]] = f[i+1:]
+		case strings.HasSuffix(f, "+"), strings.HasSuffix(f, "-"), strings.HasSuffix(f, "?"):
+			features[f[:len(f)-1]] = f[len(f)-1:]
+		}
+	}
+	return features
+}
+
+// StubError is an error reply from the stub.
+type StubError struct {
+	Request string
+	Code    string // Usually a hex errno, e.g. "0E".
+}
+
+func (e *StubError) Error() string {
+	return fmt.Sprintf("gdb stub: %s: error %s", e.Request, e.Code)
+}
+
+// errUnsupported is returned when the stub replies to a request with an empty packet.
+var errUnsupported = errors.New("not supported by the gdb stub")
+
+// request sends a request and returns the reply. Console output is passed to Output.
+func (c *Client) request(req string) (string, error) {
+	if err := c.conn.SendString(req); err != nil {
+		return "", err
+	}
+	for {
+		p, err := c.conn.Receive()
+		if err != nil {
+			return "", err
+		}
+		if p.Interrupt {
+			continue
+		}
+		resp := string(p.Data)
+		if len(resp) > 1 && resp[0] == 'O' && resp != "OK" && isStopRequest(req) {
+			c.output(resp[1:])
+			continue
+		}
+		return resp, nil
+	}
+}
+
+// isStopRequest reports whether the reply to req is a stop reply, which may be preceded by console output.
+func isStopRequest(req string) bool {
+	return req == "c" || req == "s" || req == "?" || strings.HasPrefix(req, "vCont;")
+}
+
+func (c *Client) output(h string) {
+	if c.Output == nil {
+		return
+	}
+	if b, err := hex.DecodeString(h); err == nil {
+		c.Output.Write(b)
+	}
+}
+
+// command sends a request which is replied to with "OK" or an error.
+func (c *Client) command(req string) error {
+	resp, err := c.request(req)
+	if err != nil {
+		return err
+	}
+	return okReply(req, resp)
+}
+
+func okReply(req, resp string) error {
+	switch {
+	case resp == "OK":
+		return nil
+	case resp == "":
+		return fmt.Errorf("%s: %w", strings.SplitN(req, ",", 2)[0], errUnsupported)
+	case isErrorReply(resp):
+		return &StubError{Request: strings.SplitN(req, ",", 2)[0], Code: resp[1:]}
+	}
+	return fmt.Errorf("unexpected reply %q to %s", resp, req)
+}
+
+// isErrorReply reports whether resp is an error reply, "E" and two hex digits.
+// Other replies may start with 'E' too, such as hex data.
+func isErrorReply(resp string) bool {
+	if len(resp) != 3 || resp[0] != 'E' {
+		return false
+	}
+	_, err := hex.DecodeString(resp[1:])
+	return err == nil
+}
+
+// xfer reads an object with qXfer.
+func (c *Client) xfer(object, annex string) ([]byte, error) {
+	var data []byte
+	chunk := c.packetSize - 8
+	for {
+		req := fmt.Sprintf("qXfer:%s:read:%s:%x,%x", object, annex, len(data), chunk)
+		resp, err := c.request(req)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case resp == "":
+			return nil, fmt.Errorf("qXfer:%s: %w", object, errUnsupported)
+		case resp[0] == 'm':
+			data = append(data, resp[1:]...)
+			if len(resp) == 1 {
+				return nil, fmt.Errorf("qXfer:%s: empty chunk", object)
+			}
+		case resp[0] == 'l':
+			return append(data, resp[1:]...), nil
+		case isErrorReply(resp):
+			return nil, &StubError{Request: "qXfer:" + object, Code: resp[1:]}
+		default:
+			return nil, fmt.Errorf("unexpected reply %q to qXfer:%s", resp, object)
+		}
+	}
+}
+
+// Process returns a kiwi.Process which accesses the target.
+// Targets which are big-endian, like the PowerPC of the GameCube and Wii, are read as such.
+func (c *Client) Process() *kiwi.Process {
+	p := kiwi.NewProcess(c)
+	if c.desc != nil && strings.HasPrefix(c.desc.arch, "powerpc") {
+		p = p.WithByteOrder(binary.BigEndian)
+	}
+	return p
+}
+
+// Architecture returns the target's architecture from its description, e.g. "i386:x86-64",
+// or "" if the stub doesn't describe the target.
+func (c *Client) Architecture() string {
+	if c.desc == nil {
+		return ""
+	}
+	return c.desc.arch
+}
+
+// maxChunk returns the most bytes which can be read or written in one m or M packet.
+func (c *Client) maxChunk() int {
+	return (c.packetSize - 32) / 2
+}
+
+// ReadAt reads memory at addr into b with m packets.
+func (c *Client) ReadAt(b []byte, addr uintptr) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for n < len(b) {
+		size := len(b) - n
+		if size > c.maxChunk() {
+			size = c.maxChunk()
+		}
+		req := fmt.Sprintf("m%x,%x", addr+uintptr(n), size)
+		resp, err := c.request(req)
+		if err != nil {
+			return n, err
+		}
+		if resp == "" || isErrorReply(resp) {
+			return n, fmt.Errorf("reading 0x%X: %w", addr+uintptr(n), okReply(req, resp))
+		}
+		data, err := hex.DecodeString(resp)
+		if err != nil || len(data) > size {
+			return n, fmt.Errorf("reading 0x%X: bad reply %q", addr+uintptr(n), resp)
+		}
+		// Stubs may return less than asked for at the end of readable memory,
+		// in which case the rest is asked for again, failing if none of it can be read.
+		n += copy(b[n:], data)
+	}
+	return n, nil
+}
+
+// WriteAt writes b to memory at addr with M packets.
+func (c *Client) WriteAt(b []byte, addr uintptr) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for n < len(b) {
+		size := len(b) - n
+		if size > c.maxChunk() {
+			size = c.maxChunk()
+		}
+		req := fmt.Sprintf("M%x,%x:%x", addr+uintptr(n), size, b[n:n+size])
+		if err := c.command(req); err != nil {
+			return n, fmt.Errorf("writing 0x%X: %w", addr+uintptr(n), err)
+		}
+		n += size
+	}
+	return n, nil
+}
+
+// Regions returns the memory map of the target, from the stub or set with SetRegions.
+func (c *Client) Regions() ([]kiwi.Region, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.memoryMap == nil {
+		return nil, errors.New("the gdb stub doesn't provide a memory map, set one with SetRegions")
+	}
+	return append([]kiwi.Region(nil), c.memoryMap...), nil
+}
+
+// SetRegions sets the memory map of the target, for stubs which don't provide one,
+// such as the RAM of an emulated console.
+func (c *Client) SetRegions(regions []kiwi.Region) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.memoryMap = append([]kiwi.Region(nil), regions...)
+}
+
+// PointerSize returns the pointer size of the target's architecture.
+func (c *Client) PointerSize() (int, error) {
+	arch := c.Architecture()
+	switch {
+	case arch == "i386:x86-64", arch == "aarch64", strings.HasSuffix(arch, "64"):
+		return 8, nil
+	case arch != "":
+		return 4, nil
+	}
+	return 0, errors.New("the gdb stub doesn't describe the target, set the pointer size with WithPointerSize")
+}
+
+// Close detaches from the target, letting it run, and closes the connection.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	c.request("D")
+	c.mu.Unlock()
+	return c.conn.Close()
+}
@@ -0,0 +1,282 @@
+package gdb
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Andoryuuta/kiwi"
+)
+
+// registerFields maps the names of x86 registers in target descriptions to the fields of regs.
+func registerFields(regs *kiwi.Registers) map[string]*uint64 {
+	return map[string]*uint64{
+		"rax": &regs.RAX, "rbx": &regs.RBX, "rcx": &regs.RCX, "rdx": &regs.RDX,
+		"rsi": &regs.RSI, "rdi": &regs.RDI, "rbp": &regs.RBP, "rsp": &regs.RSP,
+		"r8": &regs.R8, "r9": &regs.R9, "r10": &regs.R10, "r11": &regs.R11,
+		"r12": &regs.R12, "r13": &regs.R13, "r14": &regs.R14, "r15": &regs.R15,
+		"rip": &regs.RIP, "eflags": &regs.EFLAGS,
+		"cs": &regs.CS, "ss": &regs.SS, "ds": &regs.DS, "es": &regs.ES, "fs": &regs.FS, "gs": &regs.GS,
+		"fs_base": &regs.FSBase, "gs_base": &regs.GSBase, "orig_rax": &regs.OrigRAX,
+
+		// 32-bit x86 targets.
+		"eax": &regs.RAX, "ebx": &regs.RBX, "ecx": &regs.RCX, "edx": &regs.RDX,
+		"esi": &regs.RSI, "edi": &regs.RDI, "ebp": &regs.RBP, "esp": &regs.RSP, "eip": &regs.RIP,
+	}
+}
+
+// selectThread makes thread the one later g and G packets apply to. 0 is any thread.
+func (c *Client) selectThread(op byte, thread int) error {
+	return c.command(fmt.Sprintf("H%c%x", op, thread))
+}
+
+// ReadRegisters returns the raw contents of a thread's registers, in the layout of the target's 'g' packet.
+// Registers the stub can't read are zero.
+func (c *Client) ReadRegisters(thread int) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.readRegisters(thread)
+}
+
+func (c *Client) readRegisters(thread int) ([]byte, error) {
+	if err := c.selectThread('g', thread); err != nil {
+		return nil, err
+	}
+	resp, err := c.request("g")
+	if err != nil {
+		return nil, err
+	}
+	if resp == "" || isErrorReply(resp) {
+		return nil, okReply("g", resp)
+	}
+	// Unavailable registers are sent as "xx".
+	data, err := hex.DecodeString(strings.Replace(resp, "x", "0", -1))
+	if err != nil {
+		return nil, fmt.Errorf("bad reply to g: %w", err)
+	}
+	return data, nil
+}
+
+// WriteRegisters sets the raw contents of a thread's registers, in the layout of the target's 'g' packet.
+func (c *Client) WriteRegisters(thread int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.writeRegisters(thread, data)
+}
+
+func (c *Client) writeRegisters(thread int, data []byte) error {
+	if err := c.selectThread('g', thread); err != nil {
+		return err
+	}
+	return c.command(fmt.Sprintf("G%x", data))
+}
+
+// threadIDs returns the IDs of the target's threads.
+func (c *Client) threadIDs() ([]int, error) {
+	var ids []int
+	for req := "qfThreadInfo"; ; req = "qsThreadInfo" {
+		resp, err := c.request(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp == "" {
+			// Stubs without threads have one, which is selected with 0.
+			return []int{0}, nil
+		}
+		if resp == "l" || resp[0] != 'm' {
+			break
+		}
+		for _, s := range strings.Split(resp[1:], ",") {
+			id, err := strconv.ParseInt(s, 16, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad thread ID %q", s)
+			}
+			ids = append(ids, int(id))
+		}
+	}
+	return ids, nil
+}
+
+// Threads returns the threads of the target. Their registers are only filled in for x86
+// targets whose stub sends a target description.
+func (c *Client) Threads() ([]kiwi.Thread, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ids, err := c.threadIDs()
+	if err != nil {
+		return nil, err
+	}
+	threads := make([]kiwi.Thread, len(ids))
+	for i, id := range ids {
+		threads[i].ID = id
+		if c.desc == nil {
+			continue
+		}
+		data, err := c.readRegisters(id)
+		if err != nil {
+			return nil, err
+		}
+		fields := registerFields(&threads[i].Regs)
+		for _, r := range c.desc.regs {
+			if f, ok := fields[r.name]; ok && r.offset+r.size <= len(data) {
+				*f = readUint(data[r.offset : r.offset+r.size])
+			}
+		}
+	}
+	return threads, nil
+}
+
+// SetRegisters sets the registers of a thread. It's only supported for x86 targets whose stub
+// sends a target description. Registers the target doesn't have are ignored.
+func (c *Client) SetRegisters(thread int, regs kiwi.Registers) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.desc == nil {
+		return errors.New("the gdb stub doesn't describe the target's registers")
+	}
+	data, err := c.readRegisters(thread)
+	if err != nil {
+		return err
+	}
+	fields := registerFields(&regs)
+	for _, r := range c.desc.regs {
+		if f, ok := fields[r.name]; ok && r.offset+r.size <= len(data) {
+			writeUint(data[r.offset:r.offset+r.size], *f)
+		}
+	}
+	return c.writeRegisters(thread, data)
+}
+
+// readUint reads a little-endian register of up to 8 bytes.
+func readUint(b []byte) uint64 {
+	var buf [8]byte
+	copy(buf[:], b)
+	return binary.LittleEndian.Uint64(buf[:])
+}
+
+// writeUint writes a little-endian register of up to 8 bytes.
+func writeUint(b []byte, v uint64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	copy(b, buf[:])
+}
+
+// breakpointRequest returns the Z or z packet for a breakpoint.
+func breakpointRequest(op byte, bp kiwi.Breakpoint) string {
+	size := bp.Size
+	if size == 0 {
+		size = 1
+	}
+	return fmt.Sprintf("%c%d,%x,%x", op, bp.Kind, bp.Addr, size)
+}
+
+// SetBreakpoint sets a breakpoint or watchpoint with a Z packet.
+func (c *Client) SetBreakpoint(bp kiwi.Breakpoint) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.command(breakpointRequest('Z', bp))
+}
+
+// ClearBreakpoint removes a breakpoint or watchpoint with a z packet.
+func (c *Client) ClearBreakpoint(bp kiwi.Breakpoint) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.command(breakpointRequest('z', bp))
+}
+
+// Continue runs the target until it stops. Call Interrupt from another goroutine to stop it.
+func (c *Client) Continue() (kiwi.StopEvent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resume("c")
+}
+
+// Step runs a single instruction of a thread. 0 steps any thread.
+func (c *Client) Step(thread int) (kiwi.StopEvent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.selectThread('c', thread); err != nil {
+		return kiwi.StopEvent{}, err
+	}
+	return c.resume("s")
+}
+
+func (c *Client) resume(req string) (kiwi.StopEvent, error) {
+	resp, err := c.request(req)
+	if err != nil {
+		return kiwi.StopEvent{}, err
+	}
+	if resp == "" || isErrorReply(resp) {
+		return kiwi.StopEvent{}, okReply(req, resp)
+	}
+	stop, err := parseStop(resp)
+	if err != nil {
+		return kiwi.StopEvent{}, err
+	}
+	c.stop = stop
+	return stop, nil
+}
+
+// Interrupt stops the target while Continue is running it.
+func (c *Client) Interrupt() error {
+	return c.conn.SendInterrupt()
+}
+
+// LastStop returns why the target last stopped, including when the client connected.
+func (c *Client) LastStop() kiwi.StopEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stop
+}
+
+// parseStop parses a stop reply, such as "S05", "T05thread:1;swbreak:;" or "W00".
+func parseStop(resp string) (kiwi.StopEvent, error) {
+	if len(resp) < 3 {
+		return kiwi.StopEvent{}, fmt.Errorf("bad stop reply %q", resp)
+	}
+	code, err := strconv.ParseUint(resp[1:3], 16, 8)
+	if err != nil {
+		return kiwi.StopEvent{}, fmt.Errorf("bad stop reply %q", resp)
+	}
+
+	var stop kiwi.StopEvent
+	switch resp[0] {
+	case 'S':
+		stop.Signal = int(code)
+	case 'T':
+		stop.Signal = int(code)
+		for _, pair := range strings.Split(resp[3:], ";") {
+			kv := strings.SplitN(pair, ":", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "thread":
+				// Multiprocess stubs send "p<pid>.<tid>".
+				tid := kv[1]
+				if i := strings.IndexByte(tid, '.'); i >= 0 {
+					tid = tid[i+1:]
+				}
+				id, _ := strconv.ParseInt(tid, 16, 64)
+				stop.Thread = int(id)
+			case "watch", "rwatch", "awatch":
+				addr, _ := strconv.ParseUint(kv[1], 16, 64)
+				stop.WatchAddr = uintptr(addr)
+			}
+		}
+	case 'W':
+		stop.Exited = true
+		stop.Status = int(code)
+	case 'X':
+		stop.Exited = true
+		stop.Signal = int(code)
+	default:
+		return kiwi.StopEvent{}, fmt.Errorf("bad stop reply %q", resp)
+	}
+	return stop, nil
+}
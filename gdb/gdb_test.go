@@ -0,0 +1,351 @@
+package gdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Andoryuuta/kiwi"
+	"github.com/Andoryuuta/kiwi/internal/rsp"
+)
+
+const (
+	ramBase = 0x80000000
+	ramSize = 0x1000
+)
+
+var coreRegs = []string{
+	"rax", "rbx", "rcx", "rdx", "rsi", "rdi", "rbp", "rsp",
+	"r8", "r9", "r10", "r11", "r12", "r13", "r14", "r15", "rip",
+	"eflags", "cs", "ss", "ds", "es", "fs", "gs",
+}
+
+// mockFiles are the target description and memory map of the mock stub.
+func mockFiles() map[string]string {
+	var core strings.Builder
+	core.WriteString(`<?xml version="1.0"?><!DOCTYPE feature SYSTEM "gdb-target.dtd"><feature name="org.gnu.gdb.i386.core">`)
+	for i, name := range coreRegs {
+		bits := 64
+		if i > 16 {
+			bits = 32
+		}
+		fmt.Fprintf(&core, `<reg name="%s" bitsize="%d" type="int"/>`, name, bits)
+	}
+	core.WriteString(`</feature>`)
+
+	return map[string]string{
+		"features:target.xml": `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <architecture>i386:x86-64</architecture>
+  <xi:include href="core.xml"/>
+  <feature name="org.gnu.gdb.i386.linux">
+    <reg name="fs_base" bitsize="64" type="int"/>
+    <reg name="gs_base" bitsize="64" type="int"/>
+  </feature>
+</target>`,
+		"features:core.xml": core.String(),
+		"memory-map:": `<?xml version="1.0"?>
+<!DOCTYPE memory-map PUBLIC "+//IDN gnu.org//DTD GDB Memory Map V1.0//EN" "http://sourceware.org/gdb/gdb-memory-map.dtd">
+<memory-map>
+  <memory type="rom" start="0x0" length="0x100"/>
+  <memory type="ram" start="0x80000000" length="0x1000"/>
+</memory-map>`,
+	}
+}
+
+// regsSize is the size of the mock's registers: 17 64-bit, 7 32-bit, then fs_base and gs_base.
+const regsSize = 17*8 + 7*4 + 2*8
+
+// mockStub is a minimal gdb stub for an x86-64 target with two threads.
+type mockStub struct {
+	conn        *rsp.Conn
+	ram         []byte
+	regs        map[int][]byte
+	gThread     int
+	cThread     int
+	breakpoints map[string]bool
+	failResume  bool // Reply to c with an error.
+}
+
+func newMockStub(c net.Conn) *mockStub {
+	s := &mockStub{
+		conn:        rsp.NewConn(c),
+		ram:         make([]byte, ramSize),
+		regs:        map[int][]byte{1: make([]byte, regsSize), 2: make([]byte, regsSize)},
+		breakpoints: make(map[string]bool),
+	}
+	for tid, regs := range s.regs {
+		binary.LittleEndian.PutUint64(regs[7*8:], uint64(0x7FFF0000+tid*0x1000)) // rsp
+		binary.LittleEndian.PutUint64(regs[16*8:], uint64(0x401000+tid))         // rip
+		binary.LittleEndian.PutUint64(regs[17*8+7*4:], 0x7F0000000000)           // fs_base
+	}
+	return s
+}
+
+func (s *mockStub) serve() {
+	files := mockFiles()
+	for {
+		p, err := s.conn.Receive()
+		if err != nil {
+			return
+		}
+		if p.Interrupt {
+			continue
+		}
+		req := string(p.Data)
+		reply := s.handle(req, files)
+		s.conn.SendString(reply)
+		if req == "QStartNoAckMode" {
+			s.conn.DisableAcks()
+		}
+	}
+}
+
+func (s *mockStub) handle(req string, files map[string]string) string {
+	switch {
+	case strings.HasPrefix(req, "qSupported"):
+		return "PacketSize=100;qXfer:features:read+;qXfer:memory-map:read+;QStartNoAckMode+"
+	case req == "QStartNoAckMode", req == "D":
+		return "OK"
+	case req == "?":
+		return "S05"
+
+	case strings.HasPrefix(req, "qXfer:"):
+		// qXfer:object:read:annex:offset,length
+		parts := strings.Split(req, ":")
+		doc, ok := files[parts[1]+":"+parts[3]]
+		if !ok {
+			return "E00"
+		}
+		var off, length int
+		fmt.Sscanf(parts[4], "%x,%x", &off, &length)
+		if off+length >= len(doc) {
+			return "l" + string(rsp.Escape([]byte(doc[off:])))
+		}
+		return "m" + string(rsp.Escape([]byte(doc[off:off+length])))
+
+	case req[0] == 'm':
+		var addr, length int
+		fmt.Sscanf(req[1:], "%x,%x", &addr, &length)
+		if addr < ramBase || addr >= ramBase+ramSize {
+			return "E0e"
+		}
+		// Reads past the end of RAM are cut short.
+		end := addr + length
+		if end > ramBase+ramSize {
+			end = ramBase + ramSize
+		}
+		// Some stubs send uppercase hex, so data can start with 'E' like an error.
+		return strings.ToUpper(hex.EncodeToString(s.ram[addr-ramBase : end-ramBase]))
+
+	case req[0] == 'M':
+		var addr, length int
+		colon := strings.IndexByte(req, ':')
+		fmt.Sscanf(req[1:colon], "%x,%x", &addr, &length)
+		data, err := hex.DecodeString(req[colon+1:])
+		if err != nil || len(data) != length || addr < ramBase || addr+length > ramBase+ramSize {
+			return "E0e"
+		}
+		copy(s.ram[addr-ramBase:], data)
+		return "OK"
+
+	case req[0] == 'H':
+		tid, _ := strconv.ParseInt(req[2:], 16, 64)
+		if req[1] == 'g' {
+			s.gThread = int(tid)
+		} else {
+			s.cThread = int(tid)
+		}
+		return "OK"
+	case req == "g":
+		return hex.EncodeToString(s.regs[s.gThread])
+	case req[0] == 'G':
+		data, _ := hex.DecodeString(req[1:])
+		s.regs[s.gThread] = data
+		return "OK"
+	case req == "qfThreadInfo":
+		return "m1,2"
+	case req == "qsThreadInfo":
+		return "l"
+
+	case strings.HasPrefix(req, "Z0"):
+		s.breakpoints[req[1:]] = true
+		return "OK"
+	case strings.HasPrefix(req, "z0"):
+		delete(s.breakpoints, req[1:])
+		return "OK"
+	case req[0] == 'Z', req[0] == 'z':
+		return ""
+
+	case req == "c" && s.failResume:
+		return "E01"
+	case req == "c":
+		s.conn.SendString("O" + hex.EncodeToString([]byte("hello\n")))
+		if len(s.breakpoints) > 0 {
+			return "T05thread:2;swbreak:;"
+		}
+		// Run until interrupted.
+		for {
+			p, err := s.conn.Receive()
+			if err != nil || p.Interrupt {
+				return "T02thread:1;"
+			}
+		}
+	case req == "s":
+		return fmt.Sprintf("T05thread:%x;", s.cThread)
+	}
+	return ""
+}
+
+// dialMock returns a client connected to a mock stub.
+func dialMock(t *testing.T) (*Client, *mockStub) {
+	a, b := net.Pipe()
+	stub := newMockStub(b)
+	go stub.serve()
+	c, err := NewClient(a)
+	if err != nil {
+		t.Fatalf("NewClient: %s\n", err)
+	}
+	return c, stub
+}
+
+func TestClientMemory(t *testing.T) {
+	c, stub := dialMock(t)
+	defer c.Close()
+
+	if arch := c.Architecture(); arch != "i386:x86-64" {
+		t.Errorf("Expected i386:x86-64, got %q\n", arch)
+	}
+	regions, err := c.Regions()
+	if err != nil || len(regions) != 2 || regions[1].Base != ramBase || regions[1].Size != ramSize ||
+		regions[0].Perm&kiwi.PermWrite != 0 || regions[1].Perm&kiwi.PermWrite == 0 {
+		t.Errorf("Unexpected regions %+v (%v)\n", regions, err)
+	}
+
+	p := c.Process()
+	if err := p.WriteUint32(ramBase+0x10, 1337); err != nil {
+		t.Fatalf("WriteUint32: %s\n", err)
+	}
+	if v, err := p.ReadUint32(ramBase + 0x10); err != nil || v != 1337 {
+		t.Errorf("Expected 1337, got %d (%v)\n", v, err)
+	}
+
+	// Large accesses are split to fit the stub's packet size.
+	data := bytes.Repeat([]byte("kiwi"), 0x100)
+	if err := p.WriteBytes(ramBase+0x200, data); err != nil {
+		t.Fatalf("WriteBytes: %s\n", err)
+	}
+	if !bytes.Equal(stub.ram[0x200:0x600], data) {
+		t.Errorf("The write didn't reach the stub\n")
+	}
+	if got, err := p.ReadBytes(ramBase+0x200, len(data)); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Expected the written data, got %q (%v)\n", got, err)
+	}
+	if matches, err := p.FindBytes([]byte("kiwikiwi")); err != nil || len(matches) == 0 || matches[0] != ramBase+0x200 {
+		t.Errorf("Unexpected matches %X (%v)\n", matches, err)
+	}
+
+	// Data which looks like the start of an error reply is still data.
+	if err := p.WriteBytes(ramBase+0x20, []byte{0xE5, 0x01}); err != nil {
+		t.Fatalf("WriteBytes: %s\n", err)
+	}
+	if got, err := p.ReadBytes(ramBase+0x20, 2); err != nil || !bytes.Equal(got, []byte{0xE5, 0x01}) {
+		t.Errorf("Expected E5 01, got %X (%v)\n", got, err)
+	}
+
+	// Reads running off the end of memory return what was read and an error.
+	buf := make([]byte, 8)
+	if n, err := c.ReadAt(buf, ramBase+ramSize-4); n != 4 || err == nil {
+		t.Errorf("Expected a partial read of 4 bytes, got %d (%v)\n", n, err)
+	}
+	var stubErr *StubError
+	if _, err := p.ReadUint8(0x1000); !errors.As(err, &stubErr) || stubErr.Code != "0e" {
+		t.Errorf("Expected a stub error, got %v\n", err)
+	}
+}
+
+func TestClientDebug(t *testing.T) {
+	c, stub := dialMock(t)
+	defer c.Close()
+	var output bytes.Buffer
+	c.Output = &output
+	p := c.Process()
+
+	threads, err := p.Threads()
+	if err != nil || len(threads) != 2 {
+		t.Fatalf("Unexpected threads %+v (%v)\n", threads, err)
+	}
+	if r := threads[1].Regs; threads[1].ID != 2 || r.RSP != 0x7FFF2000 || r.RIP != 0x401002 || r.FSBase != 0x7F0000000000 {
+		t.Errorf("Unexpected thread %+v\n", threads[1])
+	}
+
+	regs := threads[0].Regs
+	regs.RAX, regs.EFLAGS = 0x1122334455667788, 0x246
+	if err := p.SetRegisters(1, regs); err != nil {
+		t.Fatalf("SetRegisters: %s\n", err)
+	}
+	if got := binary.LittleEndian.Uint64(stub.regs[1]); got != regs.RAX {
+		t.Errorf("Expected rax 0x%X, got 0x%X\n", regs.RAX, got)
+	}
+	if got := binary.LittleEndian.Uint32(stub.regs[1][17*8:]); got != 0x246 {
+		t.Errorf("Expected eflags 0x246, got 0x%X\n", got)
+	}
+
+	bp := kiwi.Breakpoint{Kind: kiwi.BreakSoftware, Addr: 0x401234}
+	if err := p.SetBreakpoint(bp); err != nil || !stub.breakpoints["0,401234,1"] {
+		t.Fatalf("SetBreakpoint: %v %v\n", err, stub.breakpoints)
+	}
+	if err := p.SetBreakpoint(kiwi.Breakpoint{Kind: kiwi.WatchWrite, Addr: ramBase, Size: 4}); err == nil {
+		t.Errorf("Expected an error setting an unsupported watchpoint\n")
+	}
+	stop, err := p.Continue()
+	if err != nil || stop.Signal != 5 || stop.Thread != 2 {
+		t.Errorf("Unexpected stop %+v (%v)\n", stop, err)
+	}
+	if output.String() != "hello\n" {
+		t.Errorf("Expected the console output, got %q\n", output.String())
+	}
+	if stop, err := p.Step(1); err != nil || stop.Thread != 1 {
+		t.Errorf("Unexpected stop %+v (%v)\n", stop, err)
+	}
+
+	// Without breakpoints, the target runs until it's interrupted.
+	if err := p.ClearBreakpoint(bp); err != nil || len(stub.breakpoints) != 0 {
+		t.Fatalf("ClearBreakpoint: %v %v\n", err, stub.breakpoints)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		p.Interrupt()
+	}()
+	if stop, err := p.Continue(); err != nil || stop.Signal != 2 {
+		t.Errorf("Unexpected stop %+v (%v)\n", stop, err)
+	}
+
+	// Errors from the stub aren't taken for stop replies.
+	stub.failResume = true
+	var stubErr *StubError
+	if _, err := p.Continue(); !errors.As(err, &stubErr) || stubErr.Code != "01" {
+		t.Errorf("Expected a stub error, got %v\n", err)
+	}
+}
+
+func TestParseTargetDescBitsize(t *testing.T) {
+	for _, bits := range []string{"", "x", "0", "-64", "12"} {
+		desc := `<target><feature><reg name="r0" bitsize="` + bits + `"/></feature></target>`
+		if _, err := parseTargetDesc([]byte(desc), nil); err == nil {
+			t.Errorf("Expected an error for bitsize %q\n", bits)
+		}
+	}
+	d, err := parseTargetDesc([]byte(`<target><feature><reg name="r0" bitsize="32"/><reg name="r1" bitsize="64"/></feature></target>`), nil)
+	if err != nil || len(d.regs) != 2 || d.regs[1].offset != 4 || d.regs[1].size != 8 {
+		t.Errorf("Unexpected registers %+v (%v)\n", d, err)
+	}
+}
@@ -0,0 +1,231 @@
+package gdb
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Andoryuuta/kiwi"
+	"github.com/Andoryuuta/kiwi/kiwitest"
+)
+
+// debugFake is a fake process which can be debugged. Continue stops at the first breakpoint,
+// or waits to be interrupted if none are set.
+type debugFake struct {
+	*kiwitest.Fake
+
+	mu          sync.Mutex
+	threads     []kiwi.Thread
+	breakpoints []kiwi.Breakpoint
+	interrupt   chan struct{}
+}
+
+func newDebugFake() *debugFake {
+	d := &debugFake{Fake: kiwitest.New(), interrupt: make(chan struct{}, 1)}
+	for tid := 1; tid <= 2; tid++ {
+		var t kiwi.Thread
+		t.ID = 100 + tid
+		t.Regs.RSP = uint64(0x7FFF0000 + tid*0x1000)
+		t.Regs.RIP = uint64(0x401000 + tid)
+		t.Regs.FSBase = 0x7F0000000000
+		d.threads = append(d.threads, t)
+	}
+	return d
+}
+
+func (d *debugFake) Threads() ([]kiwi.Thread, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]kiwi.Thread(nil), d.threads...), nil
+}
+
+func (d *debugFake) SetRegisters(thread int, regs kiwi.Registers) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.threads {
+		if d.threads[i].ID == thread {
+			d.threads[i].Regs = regs
+			return nil
+		}
+	}
+	return errors.New("no such thread")
+}
+
+func (d *debugFake) SetBreakpoint(bp kiwi.Breakpoint) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakpoints = append(d.breakpoints, bp)
+	return nil
+}
+
+func (d *debugFake) ClearBreakpoint(bp kiwi.Breakpoint) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, b := range d.breakpoints {
+		if b == bp {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("no such breakpoint")
+}
+
+func (d *debugFake) Continue() (kiwi.StopEvent, error) {
+	d.mu.Lock()
+	bps := append([]kiwi.Breakpoint(nil), d.breakpoints...)
+	d.mu.Unlock()
+	if len(bps) > 0 {
+		stop := kiwi.StopEvent{Signal: 5, Thread: 102}
+		if bps[0].Kind != kiwi.BreakSoftware {
+			stop.WatchAddr = bps[0].Addr
+		}
+		return stop, nil
+	}
+	<-d.interrupt
+	return kiwi.StopEvent{Signal: 2, Thread: 101}, nil
+}
+
+func (d *debugFake) Step(thread int) (kiwi.StopEvent, error) {
+	return kiwi.StopEvent{Signal: 5, Thread: thread}, nil
+}
+
+func (d *debugFake) Interrupt() error {
+	select {
+	case d.interrupt <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// serveGDB serves p with kiwi.ServeGDB and returns a client connected to it.
+// Close the listener when done.
+func serveGDB(t *testing.T, p *kiwi.Process) (*Client, net.Listener) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %s\n", err)
+	}
+	go kiwi.ServeGDB(l, p)
+	c, err := Dial(l.Addr().String())
+	if err != nil {
+		l.Close()
+		t.Fatalf("Dial: %s\n", err)
+	}
+	return c, l
+}
+
+func TestServeGDBMemory(t *testing.T) {
+	f := kiwitest.New()
+	f.Map(0x10000, 0x1000, kiwi.PermRead|kiwi.PermExec)
+	f.Map(0x11000, 0x2000, kiwi.PermRead|kiwi.PermWrite)
+	c, l := serveGDB(t, f.Process())
+	defer l.Close()
+	defer c.Close()
+
+	if arch := c.Architecture(); arch != "i386:x86-64" {
+		t.Errorf("Expected i386:x86-64, got %q\n", arch)
+	}
+	regions, err := c.Regions()
+	if err != nil || len(regions) != 2 || regions[0].Base != 0x10000 || regions[1].Size != 0x2000 ||
+		regions[0].Perm&kiwi.PermWrite != 0 || regions[1].Perm&kiwi.PermWrite == 0 {
+		t.Errorf("Unexpected regions %+v (%v)\n", regions, err)
+	}
+
+	p := c.Process()
+	if err := p.WriteUint32(0x11010, 1337); err != nil {
+		t.Fatalf("WriteUint32: %s\n", err)
+	}
+	if v, err := p.ReadUint32(0x11010); err != nil || v != 1337 {
+		t.Errorf("Expected 1337, got %d (%v)\n", v, err)
+	}
+	if v := f.Peek(0x11010, 4); !bytes.Equal(v, []byte{0x39, 0x05, 0, 0}) {
+		t.Errorf("The write didn't reach the process, got %X\n", v)
+	}
+
+	data := bytes.Repeat([]byte("kiwi"), 0x800)
+	if err := p.WriteBytes(0x11000, data); err != nil {
+		t.Fatalf("WriteBytes: %s\n", err)
+	}
+	if got, err := p.ReadBytes(0x11000, len(data)); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Expected the written data (%v)\n", err)
+	}
+
+	// Read-only memory can't be written, and unmapped memory can't be read.
+	var stubErr *StubError
+	if err := p.WriteUint32(0x10000, 1); !errors.As(err, &stubErr) {
+		t.Errorf("Expected a stub error writing read-only memory, got %v\n", err)
+	}
+	if _, err := p.ReadUint8(0x20000); !errors.As(err, &stubErr) || stubErr.Code != "0e" {
+		t.Errorf("Expected a stub error reading unmapped memory, got %v\n", err)
+	}
+
+	// Offsets past the end of a document read nothing, however large, and lengths are clipped.
+	if resp, err := c.request("qXfer:features:read:target.xml:ffffffffffffffff,10"); err != nil || resp != "l" {
+		t.Errorf("Expected l for a huge offset, got %q (%v)\n", resp, err)
+	}
+	if resp, err := c.request("qXfer:features:read:target.xml:10,7fffffff"); err != nil || !strings.HasPrefix(resp, "l") {
+		t.Errorf("Expected the rest of the document for a huge length, got %.20q (%v)\n", resp, err)
+	}
+
+	// The process can't be debugged, so breakpoints aren't supported.
+	if err := p.SetBreakpoint(kiwi.Breakpoint{Addr: 0x10000}); !errors.Is(err, errUnsupported) {
+		t.Errorf("Expected breakpoints to be unsupported, got %v\n", err)
+	}
+	if _, err := p.Continue(); err == nil {
+		t.Errorf("Expected an error continuing\n")
+	}
+}
+
+func TestServeGDBDebug(t *testing.T) {
+	d := newDebugFake()
+	c, l := serveGDB(t, kiwi.NewProcess(d))
+	defer l.Close()
+	defer c.Close()
+	p := c.Process()
+
+	threads, err := p.Threads()
+	if err != nil || len(threads) != 2 {
+		t.Fatalf("Unexpected threads %+v (%v)\n", threads, err)
+	}
+	if r := threads[1].Regs; threads[1].ID != 102 || r.RSP != 0x7FFF2000 || r.RIP != 0x401002 || r.FSBase != 0x7F0000000000 {
+		t.Errorf("Unexpected thread %+v\n", threads[1])
+	}
+
+	regs := threads[0].Regs
+	regs.RAX, regs.EFLAGS = 0x1122334455667788, 0x246
+	if err := p.SetRegisters(101, regs); err != nil {
+		t.Fatalf("SetRegisters: %s\n", err)
+	}
+	if got, _ := d.Threads(); got[0].Regs != regs {
+		t.Errorf("Expected %+v, got %+v\n", regs, got[0].Regs)
+	}
+
+	watch := kiwi.Breakpoint{Kind: kiwi.WatchWrite, Addr: 0x601000, Size: 4}
+	if err := p.SetBreakpoint(watch); err != nil {
+		t.Fatalf("SetBreakpoint: %s\n", err)
+	}
+	if d.breakpoints[0] != watch {
+		t.Errorf("Expected %+v, got %+v\n", watch, d.breakpoints)
+	}
+	if stop, err := p.Continue(); err != nil || stop.Signal != 5 || stop.Thread != 102 || stop.WatchAddr != 0x601000 {
+		t.Errorf("Unexpected stop %+v (%v)\n", stop, err)
+	}
+	if stop, err := p.Step(102); err != nil || stop.Thread != 102 {
+		t.Errorf("Unexpected stop %+v (%v)\n", stop, err)
+	}
+
+	// Without breakpoints, the process runs until it's interrupted.
+	if err := p.ClearBreakpoint(watch); err != nil || len(d.breakpoints) != 0 {
+		t.Fatalf("ClearBreakpoint: %v %v\n", err, d.breakpoints)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		p.Interrupt()
+	}()
+	if stop, err := p.Continue(); err != nil || stop.Signal != 2 || stop.Thread != 101 {
+		t.Errorf("Unexpected stop %+v (%v)\n", stop, err)
+	}
+}
@@ -0,0 +1,155 @@
+package gdb
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/Andoryuuta/kiwi"
+)
+
+// register is a register in the target description, and where it is in the 'g' packet.
+type register struct {
+	name   string
+	regnum int
+	offset int // In bytes.
+	size   int // In bytes.
+}
+
+// targetDesc is the part of a target description kiwi uses.
+type targetDesc struct {
+	arch string
+	regs []register // Sorted by regnum, with offsets set.
+}
+
+// maxIncludes is the maximum number of files a target description may include, to stop loops.
+const maxIncludes = 32
+
+// parseTargetDesc parses a target description, reading included files with fetch.
+func parseTargetDesc(data []byte, fetch func(name string) ([]byte, error)) (*targetDesc, error) {
+	d := &targetDesc{}
+	next := 0
+	includes := 0
+
+	var parse func(data []byte) error
+	parse = func(data []byte) error {
+		dec := xml.NewDecoder(bytes.NewReader(data))
+		dec.Strict = false
+		for {
+			tok, err := dec.Token()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			se, ok := tok.(xml.StartElement)
+			if !ok {
+				continue
+			}
+
+			switch se.Name.Local {
+			case "architecture":
+				var arch string
+				if err := dec.DecodeElement(&arch, &se); err != nil {
+					return err
+				}
+				d.arch = arch
+
+			case "include":
+				includes++
+				if includes > maxIncludes {
+					return fmt.Errorf("more than %d included files", maxIncludes)
+				}
+				href := attr(se, "href")
+				sub, err := fetch(href)
+				if err != nil {
+					return fmt.Errorf("%s: %w", href, err)
+				}
+				if err := parse(sub); err != nil {
+					return fmt.Errorf("%s: %w", href, err)
+				}
+
+			case "reg":
+				bits, err := strconv.Atoi(attr(se, "bitsize"))
+				if err != nil || bits <= 0 || bits%8 != 0 {
+					return fmt.Errorf("register %q: bad bitsize", attr(se, "name"))
+				}
+				if s := attr(se, "regnum"); s != "" {
+					if next, err = strconv.Atoi(s); err != nil {
+						return fmt.Errorf("register %q: bad regnum", attr(se, "name"))
+					}
+				}
+				d.regs = append(d.regs, register{name: attr(se, "name"), regnum: next, size: bits / 8})
+				next++
+			}
+		}
+	}
+	if err := parse(data); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(d.regs, func(i, j int) bool {
+		return d.regs[i].regnum < d.regs[j].regnum
+	})
+	offset := 0
+	for i := range d.regs {
+		d.regs[i].offset = offset
+		offset += d.regs[i].size
+	}
+	return d, nil
+}
+
+func attr(se xml.StartElement, name string) string {
+	for _, a := range se.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// memoryMap is a memory map returned by qXfer:memory-map:read.
+type memoryMap struct {
+	Memory []struct {
+		Type   string `xml:"type,attr"`
+		Start  string `xml:"start,attr"`
+		Length string `xml:"length,attr"`
+	} `xml:"memory"`
+}
+
+// parseMemoryMap parses a memory map into regions, sorted by address.
+// RAM is readable, writable and executable, since emulated memory usually isn't protected,
+// while ROM and flash are read-only.
+func parseMemoryMap(data []byte) ([]kiwi.Region, error) {
+	var m memoryMap
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+
+	regions := make([]kiwi.Region, 0, len(m.Memory))
+	for _, mem := range m.Memory {
+		start, err := strconv.ParseUint(mem.Start, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad start %q", mem.Start)
+		}
+		length, err := strconv.ParseUint(mem.Length, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad length %q", mem.Length)
+		}
+		perm := kiwi.PermRead | kiwi.PermExec
+		if mem.Type == "ram" {
+			perm |= kiwi.PermWrite
+		}
+		regions = append(regions, kiwi.Region{Base: uintptr(start), Size: uintptr(length), Perm: perm, Path: "[" + mem.Type + "]"})
+	}
+	sort.Slice(regions, func(i, j int) bool {
+		return regions[i].Base < regions[j].Base
+	})
+	return regions, nil
+}
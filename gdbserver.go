@@ -0,0 +1,559 @@
+package kiwi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/Andoryuuta/kiwi/internal/rsp"
+)
+
+// gdbPacketSize is the packet size the gdbserver tells clients to use.
+const gdbPacketSize = 0x4000
+
+// gdbReg is a register in the gdbserver's target description.
+type gdbReg struct {
+	name    string
+	bits    int
+	typ     string
+	feature string
+}
+
+// gdbRegs returns the registers the gdbserver describes, in the order of its g packet.
+func gdbRegs(ptrSize int) []gdbReg {
+	var regs []gdbReg
+	add := func(feature, typ string, bits int, names ...string) {
+		for _, name := range names {
+			regs = append(regs, gdbReg{name: name, bits: bits, typ: typ, feature: feature})
+		}
+	}
+	x87 := func(feature string) {
+		for i := 0; i < 8; i++ {
+			add(feature, "i387_ext", 80, fmt.Sprintf("st%d", i))
+		}
+		add(feature, "int", 32, "fctrl", "fstat", "ftag", "fiseg", "fioff", "foseg", "fooff", "fop")
+	}
+
+	if ptrSize == 4 {
+		add("core", "int32", 32, "eax", "ecx", "edx", "ebx")
+		add("core", "data_ptr", 32, "esp", "ebp")
+		add("core", "int32", 32, "esi", "edi")
+		add("core", "code_ptr", 32, "eip")
+		add("core", "int32", 32, "eflags", "cs", "ss", "ds", "es", "fs", "gs")
+		x87("core")
+		for i := 0; i < 8; i++ {
+			add("sse", "uint128", 128, fmt.Sprintf("xmm%d", i))
+		}
+		add("sse", "int", 32, "mxcsr")
+		add("linux", "int", 32, "orig_eax")
+		return regs
+	}
+
+	add("core", "int64", 64, "rax", "rbx", "rcx", "rdx", "rsi", "rdi")
+	add("core", "data_ptr", 64, "rbp", "rsp")
+	add("core", "int64", 64, "r8", "r9", "r10", "r11", "r12", "r13", "r14", "r15")
+	add("core", "code_ptr", 64, "rip")
+	add("core", "int32", 32, "eflags", "cs", "ss", "ds", "es", "fs", "gs")
+	x87("core")
+	for i := 0; i < 16; i++ {
+		add("sse", "uint128", 128, fmt.Sprintf("xmm%d", i))
+	}
+	add("sse", "int", 32, "mxcsr")
+	add("segments", "int", 64, "fs_base", "gs_base")
+	add("linux", "int", 64, "orig_rax")
+	return regs
+}
+
+// gdbTargetXML returns the gdbserver's target description.
+func gdbTargetXML(ptrSize int) string {
+	arch := "i386:x86-64"
+	if ptrSize == 4 {
+		arch = "i386"
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?><!DOCTYPE target SYSTEM "gdb-target.dtd"><target version="1.0">`)
+	fmt.Fprintf(&b, "<architecture>%s</architecture>", arch)
+	feature := ""
+	for _, r := range gdbRegs(ptrSize) {
+		if r.feature != feature {
+			if feature != "" {
+				b.WriteString("</feature>")
+			}
+			feature = r.feature
+			fmt.Fprintf(&b, `<feature name="org.gnu.gdb.i386.%s">`, feature)
+		}
+		fmt.Fprintf(&b, `<reg name="%s" bitsize="%d" type="%s"/>`, r.name, r.bits, r.typ)
+	}
+	b.WriteString("</feature></target>")
+	return b.String()
+}
+
+// gdbRegisterFields maps register names to the fields of regs.
+func gdbRegisterFields(regs *Registers) map[string]*uint64 {
+	return map[string]*uint64{
+		"rax": &regs.RAX, "rbx": &regs.RBX, "rcx": &regs.RCX, "rdx": &regs.RDX,
+		"rsi": &regs.RSI, "rdi": &regs.RDI, "rbp": &regs.RBP, "rsp": &regs.RSP,
+		"r8": &regs.R8, "r9": &regs.R9, "r10": &regs.R10, "r11": &regs.R11,
+		"r12": &regs.R12, "r13": &regs.R13, "r14": &regs.R14, "r15": &regs.R15,
+		"rip": &regs.RIP, "eflags": &regs.EFLAGS,
+		"cs": &regs.CS, "ss": &regs.SS, "ds": &regs.DS, "es": &regs.ES, "fs": &regs.FS, "gs": &regs.GS,
+		"fs_base": &regs.FSBase, "gs_base": &regs.GSBase, "orig_rax": &regs.OrigRAX,
+
+		"eax": &regs.RAX, "ebx": &regs.RBX, "ecx": &regs.RCX, "edx": &regs.RDX,
+		"esi": &regs.RSI, "edi": &regs.RDI, "ebp": &regs.RBP, "esp": &regs.RSP,
+		"eip": &regs.RIP, "orig_eax": &regs.OrigRAX,
+	}
+}
+
+// ServeGDB serves the process to GDB remote serial protocol clients, such as gdb, IDA and Ghidra,
+// until l is closed. Connect to it with "target remote host:port" in gdb.
+//
+// Memory is always available. Registers are available if the process's threads are, as for
+// live Linux processes and core files, and breakpoints and running the process are available if
+// its backend is a Debugger. The process isn't killed when a client disconnects or asks for it.
+func ServeGDB(l net.Listener, p *Process) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go serveGDBConn(conn, p)
+	}
+}
+
+// gdbSession is the state of a connection to the gdbserver.
+type gdbSession struct {
+	p       *Process
+	conn    *rsp.Conn
+	ptrSize int
+
+	threads  []Thread // Cached until the process runs. nil if not read yet.
+	haveRegs bool     // Whether the threads' registers were read.
+	gThread  int      // The thread selected by Hg.
+	cThread  int      // The thread selected by Hc.
+	stop     StopEvent
+}
+
+func serveGDBConn(c io.ReadWriteCloser, p *Process) {
+	s := &gdbSession{p: p, conn: rsp.NewConn(c), stop: StopEvent{Signal: 5}}
+	defer s.conn.Close()
+	// Clients send at most gdbPacketSize, so anything much bigger is a broken or hostile client.
+	s.conn.SetMaxPacket(4 * gdbPacketSize)
+	var err error
+	if s.ptrSize, err = p.PointerSize(); err != nil || (s.ptrSize != 4 && s.ptrSize != 8) {
+		s.ptrSize = 8
+	}
+
+	for {
+		pkt, err := s.conn.Receive()
+		if err != nil {
+			return
+		}
+		if pkt.Interrupt {
+			// The process isn't running, so it's already stopped.
+			continue
+		}
+
+		req := string(pkt.Data)
+		resp, done := s.handle(req)
+		if err := s.conn.SendString(resp); err != nil {
+			return
+		}
+		if req == "QStartNoAckMode" {
+			s.conn.DisableAcks()
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// handle handles a request, returning the reply and whether the session is over.
+func (s *gdbSession) handle(req string) (string, bool) {
+	if req == "" {
+		return "", false
+	}
+
+	switch {
+	case strings.HasPrefix(req, "qSupported"):
+		return fmt.Sprintf("PacketSize=%x;qXfer:features:read+;qXfer:memory-map:read+;QStartNoAckMode+;swbreak+;hwbreak+", gdbPacketSize), false
+	case req == "QStartNoAckMode":
+		return "OK", false
+	case req == "?":
+		return s.stopReply(), false
+	case req == "qAttached":
+		// Attached to an existing process, so gdb detaches rather than kills it when quitting.
+		return "1", false
+	case req == "qSymbol::":
+		return "OK", false
+	case req == "D" || strings.HasPrefix(req, "D;"):
+		return "OK", true
+	case req == "k":
+		// Nothing is killed, the connection is just closed.
+		return "OK", true
+
+	case strings.HasPrefix(req, "qXfer:"):
+		return s.xfer(req), false
+
+	case req == "qfThreadInfo":
+		threads := s.threadList()
+		ids := make([]string, len(threads))
+		for i, t := range threads {
+			ids[i] = strconv.FormatInt(int64(t.ID), 16)
+		}
+		return "m" + strings.Join(ids, ","), false
+	case req == "qsThreadInfo":
+		return "l", false
+	case req == "qC":
+		return fmt.Sprintf("QC%x", s.thread(0).ID), false
+	case req[0] == 'T':
+		if _, ok := s.findThread(req[1:]); !ok {
+			return "E01", false
+		}
+		return "OK", false
+	case req[0] == 'H' && len(req) > 2:
+		t, ok := s.findThread(req[2:])
+		if !ok {
+			return "E01", false
+		}
+		if req[1] == 'g' {
+			s.gThread = t.ID
+		} else {
+			s.cThread = t.ID
+		}
+		return "OK", false
+
+	case req[0] == 'm':
+		return s.readMemory(req[1:]), false
+	case req[0] == 'M':
+		return s.writeMemory(req[1:], false), false
+	case req[0] == 'X':
+		return s.writeMemory(req[1:], true), false
+
+	case req == "g":
+		return s.readRegisters(), false
+	case req[0] == 'G':
+		return s.writeRegisters(req[1:]), false
+
+	case req[0] == 'Z' || req[0] == 'z':
+		return s.breakpoint(req), false
+	case req[0] == 'c':
+		return s.resume(false), false
+	case req[0] == 's':
+		return s.resume(true), false
+	}
+
+	// An empty reply tells the client the request isn't supported.
+	return "", false
+}
+
+// gdbFault is the reply to requests which fail. It's EFAULT, as gdb only shows the number.
+const gdbFault = "E0e"
+
+// parseAddrLen parses "addr,length" from m, M and X packets.
+func parseAddrLen(s string) (uintptr, int, error) {
+	comma := strings.IndexByte(s, ',')
+	if comma < 0 {
+		return 0, 0, errors.New("missing length")
+	}
+	addr, err := strconv.ParseUint(s[:comma], 16, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	n, err := strconv.ParseUint(s[comma+1:], 16, 31) // Fits in an int everywhere.
+	if err != nil {
+		return 0, 0, err
+	}
+	return uintptr(addr), int(n), nil
+}
+
+func (s *gdbSession) readMemory(args string) string {
+	addr, n, err := parseAddrLen(args)
+	if err != nil || n > gdbPacketSize/2 {
+		return "E01"
+	}
+	buf := make([]byte, n)
+	got, err := s.p.Backend().ReadAt(buf, addr)
+	if got == 0 && n > 0 {
+		return gdbFault
+	}
+	// Partial reads are replied to with what was read.
+	return hex.EncodeToString(buf[:got])
+}
+
+func (s *gdbSession) writeMemory(args string, escaped bool) string {
+	colon := strings.IndexByte(args, ':')
+	if colon < 0 {
+		return "E01"
+	}
+	addr, n, err := parseAddrLen(args[:colon])
+	if err != nil {
+		return "E01"
+	}
+	data := []byte(args[colon+1:])
+	if !escaped {
+		if data, err = hex.DecodeString(args[colon+1:]); err != nil {
+			return "E01"
+		}
+	}
+	if len(data) != n {
+		return "E01"
+	}
+	if n == 0 {
+		return "OK"
+	}
+	if err := writeFull(s.p.Backend(), addr, data); err != nil {
+		return gdbFault
+	}
+	return "OK"
+}
+
+// xfer handles "qXfer:object:read:annex:offset,length".
+func (s *gdbSession) xfer(req string) string {
+	parts := strings.SplitN(req, ":", 5)
+	if len(parts) != 5 || parts[2] != "read" {
+		return ""
+	}
+
+	var doc string
+	switch {
+	case parts[1] == "features" && parts[3] == "target.xml":
+		doc = gdbTargetXML(s.ptrSize)
+	case parts[1] == "memory-map":
+		regions, err := s.p.Regions()
+		if err != nil {
+			return gdbFault
+		}
+		doc = gdbMemoryMap(regions)
+	case parts[1] == "features":
+		return "E00"
+	default:
+		return ""
+	}
+
+	off, n, err := parseAddrLen(parts[4])
+	if err != nil {
+		return "E01"
+	}
+	// The offset and length come from the client, so they're checked in 64 bits before slicing.
+	start, size := uint64(off), uint64(len(doc))
+	if start >= size {
+		return "l"
+	}
+	end := start + uint64(n)
+	if end < start || end >= size {
+		return "l" + string(rsp.Escape([]byte(doc[start:])))
+	}
+	return "m" + string(rsp.Escape([]byte(doc[start:end])))
+}
+
+// gdbMemoryMap returns a memory map of the regions. Adjacent regions are merged, as gdb doesn't
+// need them separate, writable memory is RAM and the rest is ROM.
+func gdbMemoryMap(regions []Region) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?><!DOCTYPE memory-map PUBLIC "+//IDN gnu.org//DTD GDB Memory Map V1.0//EN" "http://sourceware.org/gdb/gdb-memory-map.dtd"><memory-map>`)
+	var merged []Region
+	for _, r := range regions {
+		if r.Perm&PermRead == 0 {
+			continue
+		}
+		if n := len(merged); n > 0 && merged[n-1].End() == r.Base && merged[n-1].Perm&PermWrite == r.Perm&PermWrite {
+			merged[n-1].Size += r.Size
+			continue
+		}
+		merged = append(merged, r)
+	}
+	for _, r := range merged {
+		typ := "rom"
+		if r.Perm&PermWrite != 0 {
+			typ = "ram"
+		}
+		fmt.Fprintf(&b, `<memory type="%s" start="0x%x" length="0x%x"/>`, typ, r.Base, r.Size)
+	}
+	b.WriteString("</memory-map>")
+	return b.String()
+}
+
+// threadList returns the process's threads, reading them if they haven't been since it last ran.
+// Processes without threads are given one with ID 1.
+func (s *gdbSession) threadList() []Thread {
+	if s.threads == nil {
+		threads, err := s.p.Threads()
+		s.haveRegs = err == nil && len(threads) > 0
+		if !s.haveRegs {
+			threads = []Thread{{ID: 1}}
+		}
+		s.threads = threads
+	}
+	return s.threads
+}
+
+// findThread finds a thread by its ID in hex. 0 and -1 mean any thread.
+func (s *gdbSession) findThread(id string) (Thread, bool) {
+	if id == "0" || id == "-1" {
+		return s.thread(0), true
+	}
+	tid, err := strconv.ParseInt(id, 16, 64)
+	if err != nil {
+		return Thread{}, false
+	}
+	for _, t := range s.threadList() {
+		if t.ID == int(tid) {
+			return t, true
+		}
+	}
+	return Thread{}, false
+}
+
+// thread returns the thread with the ID, or the thread which last stopped for 0.
+func (s *gdbSession) thread(id int) Thread {
+	threads := s.threadList()
+	if id == 0 {
+		id = s.stop.Thread
+	}
+	for _, t := range threads {
+		if t.ID == id {
+			return t
+		}
+	}
+	return threads[0]
+}
+
+func (s *gdbSession) readRegisters() string {
+	t := s.thread(s.gThread)
+	fields := gdbRegisterFields(&t.Regs)
+
+	var b strings.Builder
+	var buf [16]byte
+	for _, r := range gdbRegs(s.ptrSize) {
+		size := r.bits / 8
+		f, ok := fields[r.name]
+		if !ok || !s.haveRegs {
+			// Registers kiwi doesn't have are unavailable.
+			b.WriteString(strings.Repeat("xx", size))
+			continue
+		}
+		binary.LittleEndian.PutUint64(buf[:], *f)
+		b.WriteString(hex.EncodeToString(buf[:size]))
+	}
+	return b.String()
+}
+
+func (s *gdbSession) writeRegisters(h string) string {
+	data, err := hex.DecodeString(strings.Replace(h, "x", "0", -1))
+	if err != nil {
+		return "E01"
+	}
+	t := s.thread(s.gThread)
+	regs := t.Regs
+	fields := gdbRegisterFields(&regs)
+	off := 0
+	for _, r := range gdbRegs(s.ptrSize) {
+		size := r.bits / 8
+		if off+size > len(data) {
+			break
+		}
+		if f, ok := fields[r.name]; ok {
+			var buf [8]byte
+			copy(buf[:], data[off:off+size])
+			*f = binary.LittleEndian.Uint64(buf[:])
+		}
+		off += size
+	}
+	if err := s.p.SetRegisters(t.ID, regs); err != nil {
+		return gdbFault
+	}
+	s.threads = nil
+	return "OK"
+}
+
+// breakpoint handles "Ztype,addr,kind" and "ztype,addr,kind".
+func (s *gdbSession) breakpoint(req string) string {
+	parts := strings.Split(req[1:], ",")
+	if len(parts) < 3 {
+		return "E01"
+	}
+	kind, err1 := strconv.Atoi(parts[0])
+	addr, err2 := strconv.ParseUint(parts[1], 16, 64)
+	size, err3 := strconv.ParseUint(strings.SplitN(parts[2], ";", 2)[0], 16, 32)
+	if err1 != nil || err2 != nil || err3 != nil || kind < 0 || kind > int(WatchAccess) {
+		return "E01"
+	}
+
+	bp := Breakpoint{Kind: BreakpointKind(kind), Addr: uintptr(addr), Size: int(size)}
+	var err error
+	if req[0] == 'Z' {
+		err = s.p.SetBreakpoint(bp)
+	} else {
+		err = s.p.ClearBreakpoint(bp)
+	}
+	switch {
+	case err == errNoDebugger:
+		return ""
+	case err != nil:
+		return gdbFault
+	}
+	return "OK"
+}
+
+// resume continues or steps the process, stopping it if the client sends an interrupt.
+func (s *gdbSession) resume(step bool) string {
+	type result struct {
+		stop StopEvent
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var r result
+		if step {
+			r.stop, r.err = s.p.Step(s.thread(s.cThread).ID)
+		} else {
+			r.stop, r.err = s.p.Continue()
+		}
+		done <- r
+	}()
+
+	for {
+		select {
+		case r := <-done:
+			if r.err != nil {
+				// gdb shows a warning and treats the process as stopped.
+				return "E01"
+			}
+			s.stop = r.stop
+			s.threads = nil
+			return s.stopReply()
+		case pkt := <-s.conn.Packets():
+			if pkt.Interrupt {
+				s.p.Interrupt()
+			}
+		case <-s.conn.Done():
+			s.p.Interrupt()
+			return "E01"
+		}
+	}
+}
+
+// stopReply returns the stop reply for the last stop.
+func (s *gdbSession) stopReply() string {
+	if s.stop.Exited {
+		if s.stop.Signal != 0 {
+			return fmt.Sprintf("X%02x", s.stop.Signal)
+		}
+		return fmt.Sprintf("W%02x", s.stop.Status&0xFF)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "T%02xthread:%x;", s.stop.Signal&0xFF, s.thread(s.stop.Thread).ID)
+	if s.stop.WatchAddr != 0 {
+		fmt.Fprintf(&b, "watch:%x;", s.stop.WatchAddr)
+	}
+	return b.String()
+}
@@ -4,6 +4,8 @@ go 1.13
 
 require (
 	github.com/kardianos/osext v0.0.0-20190222173326-2bc1f35cddc0
+	golang.org/x/arch v0.0.0-20200826200359-b19915210f00
 	golang.org/x/sys v0.0.0-20200217220822-9197077df867
 	golang.org/x/text v0.3.2
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,319 @@
+// Package rsp implements the packet layer of the GDB remote serial protocol,
+// shared by kiwi's gdbserver and its gdb client.
+//
+// Packets are "$data#cc", where cc is the checksum of data as two hex digits. Until acks are
+// disabled with QStartNoAckMode, the receiver of each packet replies "+" if it was received
+// intact or "-" to have it sent again. A lone 0x03 byte interrupts a running target.
+package rsp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// maxRetries is the number of times a packet is sent again after being rejected with "-".
+const maxRetries = 3
+
+// DefaultMaxPacket is the largest packet received before SetMaxPacket is called.
+const DefaultMaxPacket = 64 << 10
+
+// Packet is a packet received from the peer, or an interrupt.
+type Packet struct {
+	Data      []byte
+	Interrupt bool
+}
+
+// Conn is a connection speaking the protocol. A goroutine reads from the connection,
+// so acks and interrupts are seen while waiting for a packet.
+type Conn struct {
+	c io.ReadWriteCloser
+
+	wmu sync.Mutex // Guards w.
+	w   *bufio.Writer
+
+	mu        sync.Mutex
+	noAck     bool
+	maxPacket int
+
+	packets chan Packet
+	acks    chan bool
+	done    chan struct{}
+	err     error // Set before done is closed.
+}
+
+// NewConn returns a connection over c.
+func NewConn(c io.ReadWriteCloser) *Conn {
+	conn := &Conn{
+		c:         c,
+		w:         bufio.NewWriter(c),
+		maxPacket: DefaultMaxPacket,
+		packets:   make(chan Packet, 16),
+		acks:      make(chan bool, 16),
+		done:      make(chan struct{}),
+	}
+	go conn.readLoop()
+	return conn
+}
+
+// ErrClosed is returned once the connection is closed.
+var ErrClosed = errors.New("rsp: connection closed")
+
+func (c *Conn) readLoop() {
+	r := bufio.NewReader(c.c)
+	err := func() error {
+		for {
+			b, err := r.ReadByte()
+			if err != nil {
+				return err
+			}
+			switch b {
+			case '+', '-':
+				select {
+				case c.acks <- b == '+':
+				default:
+					// Nobody is waiting for an ack, e.g. acks were just disabled.
+				}
+			case 0x03:
+				c.packets <- Packet{Interrupt: true}
+			case '$':
+				data, ok, err := readPacket(r, c.maxPacketSize())
+				if err != nil {
+					return err
+				}
+				if !c.ackMode() {
+					c.packets <- Packet{Data: data}
+					continue
+				}
+				if !ok {
+					c.writeRaw([]byte{'-'})
+					continue
+				}
+				if err := c.writeRaw([]byte{'+'}); err != nil {
+					return err
+				}
+				c.packets <- Packet{Data: data}
+			default:
+				// Ignore noise between packets, and notifications, which start with '%'.
+			}
+		}
+	}()
+	if err == io.EOF {
+		err = ErrClosed
+	}
+	c.err = err
+	close(c.done)
+}
+
+// readPacket reads the rest of a packet after its '$', reporting whether its checksum is right.
+// The data is unescaped and run-length decoded. Packets of more than max bytes are an error,
+// as the peer is either broken or trying to make us run out of memory.
+func readPacket(r *bufio.Reader, max int) ([]byte, bool, error) {
+	var raw []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, false, err
+		}
+		if b == '#' {
+			break
+		}
+		if len(raw) == max {
+			return nil, false, fmt.Errorf("rsp: packet longer than %d bytes", max)
+		}
+		raw = append(raw, b)
+	}
+	var cs [2]byte
+	if _, err := io.ReadFull(r, cs[:]); err != nil {
+		return nil, false, err
+	}
+	want, ok := parseHexByte(cs[0], cs[1])
+	if !ok || checksum(raw) != want {
+		return nil, false, nil
+	}
+	data, err := decode(raw)
+	return data, err == nil, nil
+}
+
+// decode unescapes and run-length decodes the data of a packet.
+func decode(raw []byte) ([]byte, error) {
+	data := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		switch raw[i] {
+		case '}':
+			if i+1 >= len(raw) {
+				return nil, errors.New("rsp: escape at end of packet")
+			}
+			i++
+			data = append(data, raw[i]^0x20)
+		case '*':
+			if i+1 >= len(raw) || len(data) == 0 {
+				return nil, errors.New("rsp: bad run-length encoding")
+			}
+			i++
+			prev := data[len(data)-1]
+			for n := int(raw[i]) - 29; n > 0; n-- {
+				data = append(data, prev)
+			}
+		default:
+			data = append(data, raw[i])
+		}
+	}
+	return data, nil
+}
+
+func checksum(data []byte) byte {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return sum
+}
+
+func parseHexByte(hi, lo byte) (byte, bool) {
+	h, ok1 := hexDigit(hi)
+	l, ok2 := hexDigit(lo)
+	return h<<4 | l, ok1 && ok2
+}
+
+func hexDigit(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// Escape escapes binary data for a packet, such as the data of an X packet or a qXfer response.
+func Escape(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for _, b := range data {
+		switch b {
+		case '$', '#', '}', '*':
+			out = append(out, '}', b^0x20)
+		default:
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+func (c *Conn) ackMode() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.noAck
+}
+
+func (c *Conn) maxPacketSize() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.maxPacket
+}
+
+// SetMaxPacket sets the largest packet received, before unescaping, after which the connection fails.
+func (c *Conn) SetMaxPacket(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxPacket = n
+}
+
+// DisableAcks stops sending and expecting acks, after QStartNoAckMode is agreed.
+func (c *Conn) DisableAcks() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.noAck = true
+}
+
+func (c *Conn) writeRaw(b []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if _, err := c.w.Write(b); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+// Send sends a packet, and waits for it to be acked unless acks are disabled.
+// data must already be escaped if it contains any of "$#}*".
+func (c *Conn) Send(data []byte) error {
+	var buf bytes.Buffer
+	buf.Grow(len(data) + 4)
+	buf.WriteByte('$')
+	buf.Write(data)
+	fmt.Fprintf(&buf, "#%02x", checksum(data))
+
+	for try := 0; ; try++ {
+		if err := c.writeRaw(buf.Bytes()); err != nil {
+			return err
+		}
+		if !c.ackMode() {
+			return nil
+		}
+		select {
+		case ok := <-c.acks:
+			if ok {
+				return nil
+			}
+			if try == maxRetries {
+				return errors.New("rsp: packet rejected by peer")
+			}
+		case <-c.done:
+			return c.err
+		}
+	}
+}
+
+// SendString sends a packet of a string.
+func (c *Conn) SendString(s string) error {
+	return c.Send([]byte(s))
+}
+
+// SendInterrupt interrupts the running target.
+func (c *Conn) SendInterrupt() error {
+	return c.writeRaw([]byte{0x03})
+}
+
+// Receive waits for a packet or an interrupt.
+func (c *Conn) Receive() (Packet, error) {
+	select {
+	case p := <-c.packets:
+		return p, nil
+	case <-c.done:
+		// Packets received before the connection closed are still delivered.
+		select {
+		case p := <-c.packets:
+			return p, nil
+		default:
+			return Packet{}, c.err
+		}
+	}
+}
+
+// Packets returns the channel packets are delivered on, for selecting on with other events.
+// Done is closed once no more packets will arrive.
+func (c *Conn) Packets() <-chan Packet {
+	return c.packets
+}
+
+// Done returns a channel which is closed when the connection fails or is closed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the error the connection failed with, after Done is closed.
+func (c *Conn) Err() error {
+	<-c.done
+	return c.err
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.c.Close()
+}
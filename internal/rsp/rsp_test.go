@@ -0,0 +1,85 @@
+package rsp
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		raw, want string
+	}{
+		{"OK", "OK"},
+		{"0* ", "0000"},
+		{"}]}\x03}\x04}\x0a", "}#$*"},
+	}
+	for _, tt := range tests {
+		got, err := decode([]byte(tt.raw))
+		if err != nil || string(got) != tt.want {
+			t.Errorf("decode(%q) = %q (%v), expected %q\n", tt.raw, got, err, tt.want)
+		}
+	}
+	if got := Escape([]byte("a$b#c}d*")); string(got) != "a}\x04b}\x03c}]d}\x0a" {
+		t.Errorf("Unexpected escaped data %q\n", got)
+	}
+}
+
+func TestConn(t *testing.T) {
+	a, b := net.Pipe()
+	conn := NewConn(a)
+	defer conn.Close()
+	peer := bufio.NewReader(b)
+
+	// Sent packets are resent until they're acked.
+	sent := make(chan error, 1)
+	go func() { sent <- conn.SendString("m1000,4") }()
+	for _, ack := range []byte("-+") {
+		want := "$m1000,4#8e"
+		got := make([]byte, len(want))
+		if _, err := io.ReadFull(peer, got); err != nil || string(got) != want {
+			t.Fatalf("Expected %q, got %q (%v)\n", want, got, err)
+		}
+		b.Write([]byte{ack})
+	}
+	if err := <-sent; err != nil {
+		t.Fatalf("Send: %s\n", err)
+	}
+
+	// Received packets are acked, and ones with a bad checksum are rejected.
+	go b.Write([]byte("$OK#00$OK#9a\x03"))
+	for _, want := range []byte("-+") {
+		if got, err := peer.ReadByte(); err != nil || got != want {
+			t.Fatalf("Expected %q, got %q (%v)\n", want, got, err)
+		}
+	}
+	if p, err := conn.Receive(); err != nil || !bytes.Equal(p.Data, []byte("OK")) {
+		t.Errorf("Expected OK, got %+v (%v)\n", p, err)
+	}
+	if p, err := conn.Receive(); err != nil || !p.Interrupt {
+		t.Errorf("Expected an interrupt, got %+v (%v)\n", p, err)
+	}
+
+	b.Close()
+	if _, err := conn.Receive(); err == nil {
+		t.Errorf("Expected an error after the peer closed\n")
+	}
+}
+
+func TestConnMaxPacket(t *testing.T) {
+	a, b := net.Pipe()
+	conn := NewConn(a)
+	defer conn.Close()
+	conn.DisableAcks()
+	conn.SetMaxPacket(4)
+
+	go b.Write([]byte("$OK#9a$12345#00"))
+	if p, err := conn.Receive(); err != nil || !bytes.Equal(p.Data, []byte("OK")) {
+		t.Errorf("Expected OK, got %+v (%v)\n", p, err)
+	}
+	if p, err := conn.Receive(); err == nil {
+		t.Errorf("Expected an error for an oversized packet, got %+v\n", p)
+	}
+}
@@ -0,0 +1,204 @@
+package kiwi
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// pageSize is the granularity used when retrying a failed read or write
+// piece by piece, so that the readable prefix of a range can be returned.
+const pageSize = 0x1000
+
+// errNegativeAddr is returned by the io views when given a negative offset.
+var errNegativeAddr = errors.New("negative address")
+
+// readPartial reads len(b) bytes at addr into b. If the whole range can't be read
+// at once, it falls back to reading page by page and returns the number of bytes
+// that could be read before the first failure, along with that failure.
+func (p *Process) readPartial(addr uintptr, b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if err := p.read(addr, &b); err == nil {
+		return len(b), nil
+	}
+
+	n := 0
+	for n < len(b) {
+		// Read up to the next page boundary.
+		chunk := pageSize - int((addr+uintptr(n))%pageSize)
+		if chunk > len(b)-n {
+			chunk = len(b) - n
+		}
+
+		v := b[n : n+chunk]
+		if err := p.read(addr+uintptr(n), &v); err != nil {
+			return n, fmt.Errorf("read 0x%X: %w", addr+uintptr(n), err)
+		}
+		n += chunk
+	}
+	return n, nil
+}
+
+// writePartial is the write counterpart of readPartial.
+func (p *Process) writePartial(addr uintptr, b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if err := p.write(addr, &b); err == nil {
+		return len(b), nil
+	}
+
+	n := 0
+	for n < len(b) {
+		// Write up to the next page boundary.
+		chunk := pageSize - int((addr+uintptr(n))%pageSize)
+		if chunk > len(b)-n {
+			chunk = len(b) - n
+		}
+
+		v := b[n : n+chunk]
+		if err := p.write(addr+uintptr(n), &v); err != nil {
+			return n, fmt.Errorf("write 0x%X: %w", addr+uintptr(n), err)
+		}
+		n += chunk
+	}
+	return n, nil
+}
+
+// memoryAt implements io.ReaderAt and io.WriterAt over a process's memory,
+// with offsets being absolute addresses.
+type memoryAt struct {
+	p *Process
+}
+
+func (m memoryAt) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativeAddr
+	}
+	return m.p.readPartial(uintptr(off), b)
+}
+
+func (m memoryAt) WriteAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativeAddr
+	}
+	return m.p.writePartial(uintptr(off), b)
+}
+
+// ReaderAt returns an io.ReaderAt over the process's memory.
+// The offset passed to ReadAt is the absolute address to read from.
+func (p *Process) ReaderAt() io.ReaderAt {
+	return memoryAt{p}
+}
+
+// WriterAt returns an io.WriterAt over the process's memory.
+// The offset passed to WriteAt is the absolute address to write to.
+func (p *Process) WriterAt() io.WriterAt {
+	return memoryAt{p}
+}
+
+// Section is a fixed-size window over a process's memory, similar to io.SectionReader
+// but also supporting writes. Offsets are relative to the start of the section.
+//
+// Section implements io.Reader, io.Writer, io.Seeker, io.ReaderAt and io.WriterAt.
+type Section struct {
+	p    *Process
+	base uintptr
+	size int64
+	off  int64
+}
+
+// Section returns a Section covering size bytes of memory starting at addr.
+func (p *Process) Section(addr uintptr, size int64) *Section {
+	return &Section{p: p, base: addr, size: size}
+}
+
+// Addr returns the address the section starts at.
+func (s *Section) Addr() uintptr {
+	return s.base
+}
+
+// Size returns the size of the section in bytes.
+func (s *Section) Size() int64 {
+	return s.size
+}
+
+// Read implements io.Reader.
+func (s *Section) Read(b []byte) (int, error) {
+	n, err := s.ReadAt(b, s.off)
+	s.off += int64(n)
+	return n, err
+}
+
+// Write implements io.Writer.
+func (s *Section) Write(b []byte) (int, error) {
+	n, err := s.WriteAt(b, s.off)
+	s.off += int64(n)
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (s *Section) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.off
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, errors.New("Seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("Seek: negative position")
+	}
+	s.off = offset
+	return offset, nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (s *Section) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("ReadAt: negative offset")
+	}
+	if off >= s.size {
+		return 0, io.EOF
+	}
+
+	// Truncate reads past the end of the section.
+	var eof error
+	if max := s.size - off; int64(len(b)) > max {
+		b = b[:max]
+		eof = io.EOF
+	}
+
+	n, err := s.p.readPartial(s.base+uintptr(off), b)
+	if err != nil {
+		return n, err
+	}
+	return n, eof
+}
+
+// WriteAt implements io.WriterAt.
+// Writes past the end of the section are truncated and return an error.
+func (s *Section) WriteAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("WriteAt: negative offset")
+	}
+	if off >= s.size {
+		return 0, errors.New("WriteAt: offset past end of section")
+	}
+
+	var short error
+	if max := s.size - off; int64(len(b)) > max {
+		b = b[:max]
+		short = io.ErrShortWrite
+	}
+
+	n, err := s.p.writePartial(s.base+uintptr(off), b)
+	if err != nil {
+		return n, err
+	}
+	return n, short
+}
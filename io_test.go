@@ -0,0 +1,96 @@
+package kiwi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"testing"
+	"unsafe"
+)
+
+func TestReaderAt(t *testing.T) {
+	p, err := GetProcessByFileName(currentProcessName)
+	if err != nil {
+		t.Fatalf("Error trying to open process \"%s\", Error: %s\n", currentProcessName, err.Error())
+	}
+
+	orgVar := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	addr := uintptr(unsafe.Pointer(&orgVar[0]))
+
+	got := make([]byte, len(orgVar))
+	n, err := p.ReaderAt().ReadAt(got, int64(addr))
+	if err != nil || n != len(orgVar) {
+		t.Fatalf("ReadAt returned %d, %v\n", n, err)
+	}
+	if !bytes.Equal(got, orgVar) {
+		t.Fatalf("Read values are not the same. Original: %v, Read: %v\n", orgVar, got)
+	}
+
+	n, err = p.WriterAt().WriteAt([]byte{9, 9}, int64(addr)+2)
+	if err != nil || n != 2 {
+		t.Fatalf("WriteAt returned %d, %v\n", n, err)
+	}
+	if want := []byte{1, 2, 9, 9, 5, 6, 7, 8}; !bytes.Equal(orgVar, want) {
+		t.Fatalf("Written value does not match expected. Got: %v, Expected: %v\n", orgVar, want)
+	}
+}
+
+func TestSection(t *testing.T) {
+	p, err := GetProcessByFileName(currentProcessName)
+	if err != nil {
+		t.Fatalf("Error trying to open process \"%s\", Error: %s\n", currentProcessName, err.Error())
+	}
+
+	var orgVar struct {
+		A uint32
+		B uint16
+		C uint16
+	}
+	orgVar.A = 0xDEADBEEF
+	orgVar.B = 0x1234
+	orgVar.C = 0x5678
+
+	s := p.Section(uintptr(unsafe.Pointer(&orgVar)), int64(unsafe.Sizeof(orgVar)))
+
+	// Decode directly from the section with encoding/binary.
+	var decoded struct {
+		A uint32
+		B uint16
+		C uint16
+	}
+	if err := binary.Read(s, binary.LittleEndian, &decoded); err != nil {
+		t.Fatalf("binary.Read: %s\n", err)
+	}
+	if decoded != orgVar {
+		t.Fatalf("Read values are not the same. Original: %v, Read: %v\n", orgVar, decoded)
+	}
+
+	// Reading at the end of the section should return io.EOF.
+	if _, err := s.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("Expected io.EOF at end of section, got %v\n", err)
+	}
+
+	// Write through the section.
+	if _, err := s.Seek(4, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %s\n", err)
+	}
+	if err := binary.Write(s, binary.LittleEndian, uint16(0xAAAA)); err != nil {
+		t.Fatalf("binary.Write: %s\n", err)
+	}
+	if orgVar.B != 0xAAAA {
+		t.Fatalf("Written value does not match expected. Got: 0x%X, Expected: 0x%X\n", orgVar.B, 0xAAAA)
+	}
+
+	// Reads past the end are truncated.
+	if _, err := s.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %s\n", err)
+	}
+	all, err := ioutil.ReadAll(s)
+	if err != nil {
+		t.Fatalf("ReadAll: %s\n", err)
+	}
+	if len(all) != int(s.Size()) {
+		t.Fatalf("ReadAll read %d bytes, expected %d\n", len(all), s.Size())
+	}
+}
@@ -15,6 +15,10 @@ import (
 // Set in TestMain.
 var currentProcessName string
 
+// heapSink forces test variables whose address is taken to the heap,
+// as the stack can move while their address is being used.
+var heapSink interface{}
+
 func TestMain(m *testing.M) {
 	// Get current executable name.
 	fn, err := osext.Executable()
@@ -44,6 +48,22 @@ func TestGetProcessByFileName(t *testing.T) {
 	}
 }
 
+func TestListProcesses(t *testing.T) {
+	procs, err := ListProcesses()
+	if err != nil {
+		t.Fatalf("ListProcesses: %s\n", err)
+	}
+	for _, proc := range procs {
+		if proc.PID == os.Getpid() {
+			if proc.Name != currentProcessName {
+				t.Errorf("Expected the name %q, got %q\n", currentProcessName, proc.Name)
+			}
+			return
+		}
+	}
+	t.Errorf("The current process isn't listed\n")
+}
+
 func TestRead(t *testing.T) {
 	tests := []struct {
 		name string
@@ -0,0 +1,450 @@
+// Package kiwitest provides a fake process for testing code written against kiwi.Process.
+//
+// A Fake has sparse mapped regions with permissions, modules, symbols and threads, all set up
+// by the test, and can inject faults such as unreadable pages, partial reads and the process exiting:
+//
+//	f := kiwitest.New()
+//	f.MapBytes(0x140000000, image, kiwi.PermRead|kiwi.PermExec)
+//	f.AddModule("game.exe", 0x140000000, 0x5000)
+//	f.Map(0x20000000, 0x1000, kiwi.PermRead|kiwi.PermWrite)
+//	f.PutUint64(0x140003010, 0x20000000)
+//
+//	p := f.Process()
+//	health, err := p.Eval("[game.exe+0x3010] + 0x40")
+package kiwitest
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/Andoryuuta/kiwi"
+)
+
+// ErrExited is returned by every operation after Exit is called.
+var ErrExited = errors.New("kiwitest: process exited")
+
+// ErrPartialRead is returned with the bytes that were read when a read is cut short by SetMaxRead.
+var ErrPartialRead = errors.New("kiwitest: partial read")
+
+// pageSize is the granularity of unreadable pages.
+const pageSize = 0x1000
+
+// region is a mapped region and its contents.
+type region struct {
+	base uintptr
+	data []byte
+	perm kiwi.Perm
+}
+
+func (r *region) end() uintptr {
+	return r.base + uintptr(len(r.data))
+}
+
+// Fake is a fake process. It implements kiwi.Backend, along with kiwi.ModuleLister,
+// kiwi.SymbolLister, kiwi.PointerSizer, kiwi.ThreadLister and kiwi.CodeWriter.
+// It's safe for concurrent use.
+type Fake struct {
+	mu         sync.Mutex
+	pid        uint64
+	ptrSize    int
+	order      binary.ByteOrder
+	regions    []*region // Sorted by address.
+	modules    []kiwi.Module
+	symbols    map[string][]kiwi.Symbol
+	threads    []kiwi.Thread
+	unreadable map[uintptr]bool // Pages which can't be accessed.
+	maxRead    int
+	exited     bool
+	reads      int
+	writes     int
+}
+
+// New returns an empty fake 64-bit little-endian process.
+func New() *Fake {
+	return &Fake{
+		pid:        1000,
+		ptrSize:    8,
+		order:      binary.LittleEndian,
+		symbols:    make(map[string][]kiwi.Symbol),
+		unreadable: make(map[uintptr]bool),
+	}
+}
+
+// Process returns a kiwi.Process which accesses the fake.
+func (f *Fake) Process() *kiwi.Process {
+	p := kiwi.NewProcess(f)
+	f.mu.Lock()
+	p.PID = f.pid
+	order := f.order
+	f.mu.Unlock()
+	return p.WithByteOrder(order)
+}
+
+// SetPID sets the PID of processes returned by Process.
+func (f *Fake) SetPID(pid uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pid = pid
+}
+
+// SetPointerSize sets the pointer size of the process, 4 or 8.
+func (f *Fake) SetPointerSize(size int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ptrSize = size
+}
+
+// SetByteOrder sets the byte order of processes returned by Process, and of the Put methods.
+func (f *Fake) SetByteOrder(order binary.ByteOrder) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.order = order
+}
+
+// Map maps size bytes of zeros at addr. It panics if the range overlaps a mapped region.
+func (f *Fake) Map(addr, size uintptr, perm kiwi.Perm) []byte {
+	return f.MapBytes(addr, make([]byte, size), perm)
+}
+
+// MapBytes maps data at addr, and returns the slice holding the region's contents,
+// which the test can change directly. It panics if the range overlaps a mapped region.
+func (f *Fake) MapBytes(addr uintptr, data []byte, perm kiwi.Perm) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r := &region{base: addr, data: append([]byte(nil), data...), perm: perm}
+	for _, e := range f.regions {
+		if r.base < e.end() && e.base < r.end() {
+			panic(fmt.Sprintf("kiwitest: mapping 0x%X-0x%X overlaps 0x%X-0x%X", r.base, r.end(), e.base, e.end()))
+		}
+	}
+	f.regions = append(f.regions, r)
+	sort.Slice(f.regions, func(i, j int) bool {
+		return f.regions[i].base < f.regions[j].base
+	})
+	return r.data
+}
+
+// Unmap unmaps the region starting at addr.
+func (f *Fake) Unmap(addr uintptr) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, r := range f.regions {
+		if r.base == addr {
+			f.regions = append(f.regions[:i], f.regions[i+1:]...)
+			return
+		}
+	}
+}
+
+// Protect sets the permissions of the region starting at addr.
+func (f *Fake) Protect(addr uintptr, perm kiwi.Perm) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, r := range f.regions {
+		if r.base == addr {
+			r.perm = perm
+			return
+		}
+	}
+	panic(fmt.Sprintf("kiwitest: no region at 0x%X", addr))
+}
+
+// AddModule adds a module. Its memory must be mapped separately.
+// Regions inside of the module are reported with its name as their path.
+func (f *Fake) AddModule(name string, base, size uintptr) kiwi.Module {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m := kiwi.Module{Name: name, Path: name, Base: base, Size: size}
+	f.modules = append(f.modules, m)
+	return m
+}
+
+// AddSymbol adds a symbol to a module, at an absolute address.
+func (f *Fake) AddSymbol(module, name string, addr uintptr) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.symbols[module] = append(f.symbols[module], kiwi.Symbol{Name: name, Addr: addr})
+}
+
+// AddThread adds a thread.
+func (f *Fake) AddThread(t kiwi.Thread) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.threads = append(f.threads, t)
+}
+
+// SetUnreadable makes the pages in [addr, addr+size) fail to be read or written,
+// while their regions stay mapped. This is how guard pages and memory freed during a
+// scan look to a real process.
+func (f *Fake) SetUnreadable(addr, size uintptr) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for page := addr &^ (pageSize - 1); page < addr+size; page += pageSize {
+		f.unreadable[page] = true
+	}
+}
+
+// SetMaxRead limits reads to n bytes. Longer reads return the first n bytes and ErrPartialRead.
+// Zero removes the limit.
+func (f *Fake) SetMaxRead(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.maxRead = n
+}
+
+// Exit makes every later operation fail with ErrExited, as if the process exited.
+func (f *Fake) Exit() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.exited = true
+}
+
+// Reads returns the number of calls to ReadAt so far.
+func (f *Fake) Reads() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reads
+}
+
+// Writes returns the number of calls to WriteAt and WriteCode so far.
+func (f *Fake) Writes() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.writes
+}
+
+// Peek returns a copy of n bytes at addr, ignoring permissions and faults.
+func (f *Fake) Peek(addr uintptr, n int) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b := make([]byte, n)
+	f.access(b, addr, func(r *region, off int, b []byte) {
+		copy(b, r.data[off:])
+	})
+	return b
+}
+
+// Poke writes data at addr, ignoring permissions and faults,
+// as if the process itself changed its memory. It panics if the range isn't mapped.
+func (f *Fake) Poke(addr uintptr, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if n := f.access(data, addr, func(r *region, off int, b []byte) {
+		copy(r.data[off:], b)
+	}); n < len(data) {
+		panic(fmt.Sprintf("kiwitest: 0x%X is not mapped", addr+uintptr(n)))
+	}
+}
+
+// PutUint32 pokes a uint32 in the fake's byte order.
+func (f *Fake) PutUint32(addr uintptr, v uint32) {
+	var b [4]byte
+	f.byteOrder().PutUint32(b[:], v)
+	f.Poke(addr, b[:])
+}
+
+// PutUint64 pokes a uint64 in the fake's byte order.
+func (f *Fake) PutUint64(addr uintptr, v uint64) {
+	var b [8]byte
+	f.byteOrder().PutUint64(b[:], v)
+	f.Poke(addr, b[:])
+}
+
+// PutPointer pokes a pointer of the fake's pointer size.
+func (f *Fake) PutPointer(addr, v uintptr) {
+	f.mu.Lock()
+	size := f.ptrSize
+	f.mu.Unlock()
+	if size == 4 {
+		f.PutUint32(addr, uint32(v))
+		return
+	}
+	f.PutUint64(addr, uint64(v))
+}
+
+func (f *Fake) byteOrder() binary.ByteOrder {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.order
+}
+
+// access calls fn for each region making up [addr, addr+len(b)), stopping at the first
+// unmapped byte. It returns the number of bytes covered.
+func (f *Fake) access(b []byte, addr uintptr, fn func(r *region, off int, b []byte)) int {
+	n := 0
+	for n < len(b) {
+		a := addr + uintptr(n)
+		i := sort.Search(len(f.regions), func(i int) bool {
+			return f.regions[i].end() > a
+		})
+		if i == len(f.regions) || f.regions[i].base > a {
+			break
+		}
+		r := f.regions[i]
+		off := int(a - r.base)
+		chunk := len(r.data) - off
+		if chunk > len(b)-n {
+			chunk = len(b) - n
+		}
+		fn(r, off, b[n:n+chunk])
+		n += chunk
+	}
+	return n
+}
+
+// check returns how many bytes of [addr, addr+size) can be accessed with the permission,
+// and the error for the first byte which can't. A permission of 0 only requires the bytes to be mapped.
+func (f *Fake) check(addr uintptr, size int, perm kiwi.Perm) (int, error) {
+	if f.exited {
+		return 0, ErrExited
+	}
+
+	n := 0
+	var err error
+	covered := f.access(make([]byte, size), addr, func(r *region, off int, b []byte) {
+		if err != nil {
+			return
+		}
+		if perm != 0 && r.perm&perm == 0 {
+			err = fmt.Errorf("kiwitest: 0x%X is not %s", r.base+uintptr(off), permName(perm))
+			return
+		}
+		for i := 0; i < len(b); {
+			a := r.base + uintptr(off+i)
+			if f.unreadable[a&^(pageSize-1)] {
+				err = fmt.Errorf("kiwitest: 0x%X is unreadable", a)
+				return
+			}
+			next := int((a&^(pageSize-1))+pageSize-a) + i
+			if next > len(b) {
+				next = len(b)
+			}
+			n += next - i
+			i = next
+		}
+	})
+	if err == nil && covered < size {
+		err = fmt.Errorf("kiwitest: 0x%X is not mapped", addr+uintptr(covered))
+	}
+	return n, err
+}
+
+func permName(perm kiwi.Perm) string {
+	if perm == kiwi.PermWrite {
+		return "writable"
+	}
+	return "readable"
+}
+
+// ReadAt reads memory at addr into b.
+func (f *Fake) ReadAt(b []byte, addr uintptr) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reads++
+
+	want := len(b)
+	if f.maxRead > 0 && want > f.maxRead {
+		want = f.maxRead
+	}
+	n, err := f.check(addr, want, kiwi.PermRead)
+	f.access(b[:n], addr, func(r *region, off int, b []byte) {
+		copy(b, r.data[off:])
+	})
+	if err == nil && n < len(b) {
+		err = ErrPartialRead
+	}
+	return n, err
+}
+
+// WriteAt writes b to memory at addr.
+func (f *Fake) WriteAt(b []byte, addr uintptr) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writes++
+	return f.write(b, addr, kiwi.PermWrite)
+}
+
+// WriteCode writes b to memory at addr, even if it isn't writable, like a code patch.
+func (f *Fake) WriteCode(b []byte, addr uintptr) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writes++
+	_, err := f.write(b, addr, 0)
+	return err
+}
+
+func (f *Fake) write(b []byte, addr uintptr, perm kiwi.Perm) (int, error) {
+	n, err := f.check(addr, len(b), perm)
+	f.access(b[:n], addr, func(r *region, off int, b []byte) {
+		copy(r.data[off:], b)
+	})
+	return n, err
+}
+
+// Regions returns the mapped regions, named after the modules they're in.
+func (f *Fake) Regions() ([]kiwi.Region, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.exited {
+		return nil, ErrExited
+	}
+
+	regions := make([]kiwi.Region, len(f.regions))
+	for i, r := range f.regions {
+		regions[i] = kiwi.Region{Base: r.base, Size: uintptr(len(r.data)), Perm: r.perm}
+		for _, m := range f.modules {
+			if m.Contains(r.base) {
+				regions[i].Path = m.Path
+				regions[i].Offset = uint64(r.base - m.Base)
+				break
+			}
+		}
+	}
+	return regions, nil
+}
+
+// Modules returns the modules added with AddModule.
+func (f *Fake) Modules() ([]kiwi.Module, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.exited {
+		return nil, ErrExited
+	}
+	return append([]kiwi.Module(nil), f.modules...), nil
+}
+
+// Symbols returns the symbols added to a module with AddSymbol.
+func (f *Fake) Symbols(m kiwi.Module) ([]kiwi.Symbol, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.exited {
+		return nil, ErrExited
+	}
+	return append([]kiwi.Symbol(nil), f.symbols[m.Name]...), nil
+}
+
+// Threads returns the threads added with AddThread.
+func (f *Fake) Threads() ([]kiwi.Thread, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.exited {
+		return nil, ErrExited
+	}
+	return append([]kiwi.Thread(nil), f.threads...), nil
+}
+
+// PointerSize returns the pointer size set with SetPointerSize, 8 by default.
+func (f *Fake) PointerSize() (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.ptrSize, nil
+}
+
+// Close does nothing. The fake can still be used afterwards.
+func (f *Fake) Close() error {
+	return nil
+}
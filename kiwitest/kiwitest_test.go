@@ -0,0 +1,134 @@
+package kiwitest
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/Andoryuuta/kiwi"
+)
+
+const (
+	imageBase = 0x140000000
+	heapBase  = 0x20000000
+)
+
+// newGame returns a fake with a game.exe module and a heap.
+func newGame() *Fake {
+	f := New()
+	f.Map(imageBase, 0x1000, kiwi.PermRead)
+	f.Map(imageBase+0x1000, 0x1000, kiwi.PermRead|kiwi.PermExec)
+	f.Map(imageBase+0x2000, 0x1000, kiwi.PermRead|kiwi.PermWrite)
+	f.AddModule("game.exe", imageBase, 0x3000)
+	f.AddSymbol("game.exe", "Update", imageBase+0x1100)
+	f.AddSymbol("game.exe", "Render", imageBase+0x1000)
+	f.Map(heapBase, 0x3000, kiwi.PermRead|kiwi.PermWrite)
+	f.PutPointer(imageBase+0x2010, heapBase)
+	f.PutUint32(heapBase+0x40, 100)
+	return f
+}
+
+func TestReadWrite(t *testing.T) {
+	f := newGame()
+	p := f.Process()
+
+	addr, err := p.Eval("[game.exe+0x2010] + 0x40")
+	if err != nil || addr != heapBase+0x40 {
+		t.Fatalf("Expected 0x%X, got 0x%X (%v)\n", heapBase+0x40, addr, err)
+	}
+	if v, err := p.ReadUint32(addr); err != nil || v != 100 {
+		t.Errorf("Expected 100, got %d (%v)\n", v, err)
+	}
+	if err := p.WriteUint32(addr, 99); err != nil {
+		t.Fatalf("WriteUint32: %s\n", err)
+	}
+	if got := f.Peek(addr, 4); !bytes.Equal(got, []byte{99, 0, 0, 0}) {
+		t.Errorf("Expected the write to be seen, got % X\n", got)
+	}
+
+	// Writes need the region to be writable, except for code patches.
+	if err := p.WriteUint8(imageBase+0x1000, 0x90); err == nil {
+		t.Errorf("Expected an error writing to code\n")
+	}
+	if err := p.WriteCode(imageBase+0x1000, []byte{0x90}); err != nil {
+		t.Errorf("WriteCode: %s\n", err)
+	}
+	f.Protect(heapBase, 0)
+	if _, err := p.ReadUint32(addr); err == nil {
+		t.Errorf("Expected an error reading inaccessible memory\n")
+	}
+	if _, err := p.ReadUint8(heapBase + 0x3000); err == nil {
+		t.Errorf("Expected an error reading unmapped memory\n")
+	}
+}
+
+func TestModulesAndSymbols(t *testing.T) {
+	p := newGame().Process()
+
+	m, err := p.FindModule("GAME.EXE")
+	if err != nil || m.Base != imageBase || m.Size != 0x3000 {
+		t.Fatalf("Unexpected module %+v (%v)\n", m, err)
+	}
+	regions, err := p.Regions()
+	if err != nil || len(regions) != 4 || regions[0].Path != "" || regions[2].Path != "game.exe" || regions[2].Offset != 0x1000 {
+		t.Errorf("Unexpected regions %+v (%v)\n", regions, err)
+	}
+
+	if addr, err := p.LookupSymbol("game.exe", "Update"); err != nil || addr != imageBase+0x1100 {
+		t.Errorf("Expected 0x%X, got 0x%X (%v)\n", imageBase+0x1100, addr, err)
+	}
+	if name, ok := p.SymbolAt(imageBase + 0x1108); !ok || name != "game.exe!Update+0x8" {
+		t.Errorf("Expected game.exe!Update+0x8, got %q\n", name)
+	}
+
+	// Names which aren't identifiers are quoted, so they evaluate back to the address.
+	f := newGame()
+	f.AddModule("libgame-1.2.so", 0x30000000, 0x1000)
+	f.AddSymbol("libgame-1.2.so", "?Tick@@YAXXZ", 0x30000100)
+	p = f.Process()
+	name, ok := p.SymbolAt(0x30000104)
+	if want := `"libgame-1.2.so"!"?Tick@@YAXXZ"+0x4`; !ok || name != want {
+		t.Errorf("Expected %s, got %q\n", want, name)
+	}
+	if addr, err := p.Eval(name); err != nil || addr != 0x30000104 {
+		t.Errorf("Expected 0x30000104, got 0x%X (%v)\n", addr, err)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	f := newGame()
+	p := f.Process()
+	f.Map(0x30000000, 0x3000, kiwi.PermRead)
+	f.Poke(0x30000010, []byte("needle"))
+	f.Poke(0x30001010, []byte("needle"))
+	f.Poke(0x30002010, []byte("needle"))
+
+	// Scans skip unreadable pages.
+	f.SetUnreadable(0x30001000, 0x1000)
+	matches, err := p.FindBytes([]byte("needle"))
+	if err != nil || len(matches) != 2 || matches[0] != 0x30000010 || matches[1] != 0x30002010 {
+		t.Errorf("Unexpected matches %X (%v)\n", matches, err)
+	}
+	if _, err := p.ReadBytes(0x30000FF0, 0x20); err == nil {
+		t.Errorf("Expected an error reading into an unreadable page\n")
+	}
+
+	// Partial reads return what was read and an error.
+	f.SetMaxRead(4)
+	buf := make([]byte, 8)
+	if n, err := f.ReadAt(buf, 0x30000010); n != 4 || err != ErrPartialRead || string(buf[:4]) != "need" {
+		t.Errorf("Expected a partial read of 4 bytes, got %d %q (%v)\n", n, buf[:n], err)
+	}
+	if _, err := p.ReadUint64(0x30000010); err == nil {
+		t.Errorf("Expected an error from a partial read\n")
+	}
+	f.SetMaxRead(0)
+
+	f.Exit()
+	if _, err := p.ReadUint8(heapBase); !errors.Is(err, ErrExited) {
+		t.Errorf("Expected ErrExited, got %v\n", err)
+	}
+	if _, err := p.Modules(); !errors.Is(err, ErrExited) {
+		t.Errorf("Expected ErrExited, got %v\n", err)
+	}
+}
@@ -0,0 +1,351 @@
+package kiwi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// Minidump stream types.
+const (
+	mdThreadListStream     = 3
+	mdModuleListStream     = 4
+	mdMemoryListStream     = 5
+	mdSystemInfoStream     = 7
+	mdMemory64ListStream   = 9
+	mdMiscInfoStream       = 15
+	mdMemoryInfoListStream = 16
+)
+
+// Processor architectures in the minidump system info.
+const (
+	ArchX86   = 0
+	ArchARM   = 5
+	ArchAMD64 = 9
+	ArchARM64 = 12
+)
+
+// Windows memory protection and state constants, as saved in the memory info list.
+const (
+	mdMemCommit         = 0x1000
+	mdPageReadOnly      = 0x02
+	mdPageReadWrite     = 0x04
+	mdPageWriteCopy     = 0x08
+	mdPageExecute       = 0x10
+	mdPageExecuteRead   = 0x20
+	mdPageExecuteRW     = 0x40
+	mdPageExecuteWC     = 0x80
+	mdPageProtectionMsk = 0xFF
+)
+
+// mdContextAMD64Size is the size of the AMD64 CONTEXT structure up to the end of Rip.
+const mdContextAMD64Size = 256
+
+// SystemInfo is the system a minidump was written on.
+type SystemInfo struct {
+	Arch               uint16 // One of the Arch constants.
+	NumberOfProcessors int
+	MajorVersion       uint32
+	MinorVersion       uint32
+	BuildNumber        uint32
+}
+
+// Minidump is a Windows minidump (.dmp) file, opened with OpenMinidump. It's a read-only Backend.
+//
+// Its memory is read through the Process returned by Minidump.Process, so that all of
+// kiwi's reads, pointer chains and scans work offline.
+type Minidump struct {
+	dumpMemory
+	closer     io.Closer
+	pid        uint64
+	sysInfo    SystemInfo
+	hasSysInfo bool
+	moduleList []Module
+	threadList []Thread
+}
+
+// OpenMinidump opens a Windows minidump file.
+func OpenMinidump(path string) (*Minidump, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	d, err := NewMinidump(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	d.closer = f
+	return d, nil
+}
+
+// mdReader reads little-endian values from a minidump, remembering the first error.
+type mdReader struct {
+	r   io.ReaderAt
+	err error
+}
+
+func (r *mdReader) bytes(off int64, n int) []byte {
+	b := make([]byte, n)
+	if r.err == nil {
+		if _, err := r.r.ReadAt(b, off); err != nil {
+			r.err = fmt.Errorf("read minidump at 0x%X: %w", off, err)
+		}
+	}
+	return b
+}
+
+func (r *mdReader) u32(off int64) uint32 {
+	return binary.LittleEndian.Uint32(r.bytes(off, 4))
+}
+
+func (r *mdReader) u64(off int64) uint64 {
+	return binary.LittleEndian.Uint64(r.bytes(off, 8))
+}
+
+// string reads a MINIDUMP_STRING: a length in bytes followed by UTF-16 text.
+func (r *mdReader) string(off int64) string {
+	n := r.u32(off)
+	if r.err != nil || n > 0xFFFF {
+		return ""
+	}
+	b := r.bytes(off+4, int(n))
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// NewMinidump reads a Windows minidump from r.
+func NewMinidump(r io.ReaderAt) (*Minidump, error) {
+	mr := &mdReader{r: r}
+	if string(mr.bytes(0, 4)) != "MDMP" {
+		if mr.err != nil {
+			return nil, mr.err
+		}
+		return nil, errors.New("not a minidump")
+	}
+	numStreams, dirRva := mr.u32(8), int64(mr.u32(12))
+	if mr.err != nil {
+		return nil, mr.err
+	}
+	if numStreams > 0x10000 {
+		return nil, fmt.Errorf("minidump has too many streams (%d)", numStreams)
+	}
+
+	d := &Minidump{dumpMemory: dumpMemory{r: r}}
+	type stream struct {
+		size uint32
+		rva  int64
+	}
+	streams := make(map[uint32]stream)
+	for i := int64(0); i < int64(numStreams); i++ {
+		typ, size, rva := mr.u32(dirRva+i*12), mr.u32(dirRva+i*12+4), mr.u32(dirRva+i*12+8)
+		if _, ok := streams[typ]; !ok {
+			streams[typ] = stream{size, int64(rva)}
+		}
+	}
+
+	if s, ok := streams[mdSystemInfoStream]; ok {
+		d.sysInfo = SystemInfo{
+			Arch:               binary.LittleEndian.Uint16(mr.bytes(s.rva, 2)),
+			NumberOfProcessors: int(mr.bytes(s.rva+6, 1)[0]),
+			MajorVersion:       mr.u32(s.rva + 8),
+			MinorVersion:       mr.u32(s.rva + 12),
+			BuildNumber:        mr.u32(s.rva + 16),
+		}
+		d.hasSysInfo = true
+	}
+	if s, ok := streams[mdMiscInfoStream]; ok && s.size >= 12 {
+		// The process ID is valid if the first flag is set.
+		if mr.u32(s.rva+4)&1 != 0 {
+			d.pid = uint64(mr.u32(s.rva + 8))
+		}
+	}
+
+	if s, ok := streams[mdModuleListStream]; ok {
+		n := int64(mr.u32(s.rva))
+		if n > int64(s.size)/108 {
+			return nil, errors.New("truncated module list")
+		}
+		for i := int64(0); i < n && mr.err == nil; i++ {
+			off := s.rva + 4 + i*108
+			path := mr.string(int64(mr.u32(off + 20)))
+			d.moduleList = append(d.moduleList, Module{
+				Name: path[strings.LastIndexAny(path, `\/`)+1:],
+				Path: path,
+				Base: uintptr(mr.u64(off)),
+				Size: uintptr(mr.u32(off + 8)),
+			})
+		}
+	}
+
+	if s, ok := streams[mdThreadListStream]; ok {
+		n := int64(mr.u32(s.rva))
+		if n > int64(s.size)/48 {
+			return nil, errors.New("truncated thread list")
+		}
+		for i := int64(0); i < n && mr.err == nil; i++ {
+			off := s.rva + 4 + i*48
+			t := Thread{ID: int(mr.u32(off))}
+			ctxSize, ctxRva := mr.u32(off+40), int64(mr.u32(off+44))
+			if d.sysInfo.Arch == ArchAMD64 && ctxSize >= mdContextAMD64Size {
+				t.Regs = mdRegistersAMD64(mr.bytes(ctxRva, mdContextAMD64Size))
+			}
+			d.threadList = append(d.threadList, t)
+		}
+	}
+
+	// Full memory dumps use the 64-bit list, with the data of every range stored one after another.
+	if s, ok := streams[mdMemory64ListStream]; ok {
+		n, rva := int64(mr.u64(s.rva)), int64(mr.u64(s.rva+8))
+		if n < 0 || n > int64(s.size)/16 {
+			return nil, errors.New("truncated memory list")
+		}
+		for i := int64(0); i < n && mr.err == nil; i++ {
+			base, size := mr.u64(s.rva+16+i*16), mr.u64(s.rva+24+i*16)
+			d.segments = append(d.segments, dumpSegment{
+				Region:   Region{Base: uintptr(base), Size: uintptr(size), Perm: PermRead},
+				fileOff:  rva,
+				fileSize: uintptr(size),
+			})
+			rva += int64(size)
+		}
+	}
+	if s, ok := streams[mdMemoryListStream]; ok {
+		n := int64(mr.u32(s.rva))
+		if n > int64(s.size)/16 {
+			return nil, errors.New("truncated memory list")
+		}
+		for i := int64(0); i < n && mr.err == nil; i++ {
+			off := s.rva + 4 + i*16
+			base, size, rva := mr.u64(off), mr.u32(off+8), mr.u32(off+12)
+			d.segments = append(d.segments, dumpSegment{
+				Region:   Region{Base: uintptr(base), Size: uintptr(size), Perm: PermRead},
+				fileOff:  int64(rva),
+				fileSize: uintptr(size),
+			})
+		}
+	}
+	if mr.err != nil {
+		return nil, mr.err
+	}
+	d.sortSegments()
+
+	// Take the permissions from the memory info list, and the paths from the modules.
+	if s, ok := streams[mdMemoryInfoListStream]; ok {
+		hdrSize, entrySize, n := int64(mr.u32(s.rva)), int64(mr.u32(s.rva+4)), int64(mr.u64(s.rva+8))
+		if entrySize < 48 || n < 0 || n > int64(s.size)/entrySize {
+			return nil, errors.New("truncated memory info list")
+		}
+		for i := int64(0); i < n && mr.err == nil; i++ {
+			off := s.rva + hdrSize + i*entrySize
+			info := Region{Base: uintptr(mr.u64(off)), Size: uintptr(mr.u64(off + 24))}
+			state, protect := mr.u32(off+32), mr.u32(off+36)
+			if state != mdMemCommit {
+				continue
+			}
+			j := sort.Search(len(d.segments), func(j int) bool {
+				return d.segments[j].Base >= info.Base
+			})
+			for ; j < len(d.segments) && info.Contains(d.segments[j].Base); j++ {
+				d.segments[j].Perm = mdPerm(protect)
+			}
+		}
+		if mr.err != nil {
+			return nil, mr.err
+		}
+	}
+	for i := range d.segments {
+		for _, m := range d.moduleList {
+			if m.Contains(d.segments[i].Base) {
+				d.segments[i].Path = m.Path
+				break
+			}
+		}
+	}
+	return d, nil
+}
+
+// mdPerm converts Windows page protection to permissions.
+func mdPerm(protect uint32) Perm {
+	switch protect & mdPageProtectionMsk {
+	case mdPageReadOnly:
+		return PermRead
+	case mdPageReadWrite, mdPageWriteCopy:
+		return PermRead | PermWrite
+	case mdPageExecute:
+		return PermExec
+	case mdPageExecuteRead:
+		return PermRead | PermExec
+	case mdPageExecuteRW, mdPageExecuteWC:
+		return PermRead | PermWrite | PermExec
+	}
+	return 0
+}
+
+// mdRegistersAMD64 reads the general purpose registers from an AMD64 CONTEXT structure.
+func mdRegistersAMD64(ctx []byte) Registers {
+	u16 := func(off int) uint64 { return uint64(binary.LittleEndian.Uint16(ctx[off:])) }
+	u64 := func(off int) uint64 { return binary.LittleEndian.Uint64(ctx[off:]) }
+	return Registers{
+		CS: u16(56), DS: u16(58), ES: u16(60), FS: u16(62), GS: u16(64), SS: u16(66),
+		EFLAGS: uint64(binary.LittleEndian.Uint32(ctx[68:])),
+		RAX:    u64(120), RCX: u64(128), RDX: u64(136), RBX: u64(144),
+		RSP: u64(152), RBP: u64(160), RSI: u64(168), RDI: u64(176),
+		R8: u64(184), R9: u64(192), R10: u64(200), R11: u64(208),
+		R12: u64(216), R13: u64(224), R14: u64(232), R15: u64(240),
+		RIP: u64(248),
+	}
+}
+
+// Process returns a process which reads the memory of the minidump.
+// It uses the pointer size of the dumped system's architecture.
+func (d *Minidump) Process() *Process {
+	p := NewProcess(d)
+	p.PID = d.pid
+	return p
+}
+
+// SystemInfo returns information about the system the minidump was written on.
+func (d *Minidump) SystemInfo() SystemInfo {
+	return d.sysInfo
+}
+
+// Threads returns the threads saved in the minidump. Registers are only read from AMD64 dumps.
+func (d *Minidump) Threads() ([]Thread, error) {
+	return append([]Thread(nil), d.threadList...), nil
+}
+
+// Close closes the minidump file, if it was opened with OpenMinidump.
+func (d *Minidump) Close() error {
+	if d.closer == nil {
+		return nil
+	}
+	return d.closer.Close()
+}
+
+// Modules returns the modules in the minidump's module list.
+func (d *Minidump) Modules() ([]Module, error) {
+	return append([]Module(nil), d.moduleList...), nil
+}
+
+// PointerSize returns the pointer size of the dumped system's architecture.
+func (d *Minidump) PointerSize() (int, error) {
+	if !d.hasSysInfo {
+		return 0, errors.New("minidump has no system info, set the pointer size with WithPointerSize")
+	}
+	switch d.sysInfo.Arch {
+	case ArchX86, ArchARM:
+		return 4, nil
+	case ArchAMD64, ArchARM64:
+		return 8, nil
+	}
+	return 0, fmt.Errorf("unknown processor architecture %d", d.sysInfo.Arch)
+}
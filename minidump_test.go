@@ -0,0 +1,184 @@
+package kiwi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+)
+
+// testMinidump builds a minidump from streams, laid out one after another.
+type testMinidump struct {
+	types   []uint32
+	streams [][]byte
+}
+
+func (m *testMinidump) add(typ uint32, data []byte) {
+	m.types = append(m.types, typ)
+	m.streams = append(m.streams, data)
+}
+
+// bytes returns the minidump. Streams can refer to their own offset through fix,
+// which is called with the offset of the stream before it's written.
+func (m *testMinidump) bytes(fix map[int]func(off uint32, data []byte)) []byte {
+	dirOff := uint32(32)
+	off := dirOff + uint32(12*len(m.streams))
+
+	var dir, body bytes.Buffer
+	for i, data := range m.streams {
+		if f, ok := fix[i]; ok {
+			f(off, data)
+		}
+		binary.Write(&dir, binary.LittleEndian, []uint32{m.types[i], uint32(len(data)), off})
+		body.Write(data)
+		off += uint32(len(data))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("MDMP")
+	binary.Write(&buf, binary.LittleEndian, []uint32{0xA793, uint32(len(m.streams)), dirOff, 0, 0})
+	binary.Write(&buf, binary.LittleEndian, uint64(0))
+	buf.Write(dir.Bytes())
+	buf.Write(body.Bytes())
+	return buf.Bytes()
+}
+
+func TestMinidump(t *testing.T) {
+	le := binary.LittleEndian
+	var md testMinidump
+
+	sysInfo := make([]byte, 56)
+	le.PutUint16(sysInfo, ArchAMD64)
+	sysInfo[6] = 8
+	le.PutUint32(sysInfo[8:], 10)
+	le.PutUint32(sysInfo[16:], 19045)
+	md.add(mdSystemInfoStream, sysInfo)
+
+	misc := make([]byte, 24)
+	le.PutUint32(misc, 24)
+	le.PutUint32(misc[4:], 1)
+	le.PutUint32(misc[8:], 4242)
+	md.add(mdMiscInfoStream, misc)
+
+	// One module, with its name stored after the list.
+	name := utf16.Encode([]rune(`C:\Games\Game\game.exe`))
+	modules := make([]byte, 4+108+4+len(name)*2)
+	le.PutUint32(modules, 1)
+	le.PutUint64(modules[4:], 0x140000000)
+	le.PutUint32(modules[12:], 0x3000)
+	le.PutUint32(modules[112:], uint32(len(name)*2))
+	for i, u := range name {
+		le.PutUint16(modules[116+i*2:], u)
+	}
+	md.add(mdModuleListStream, modules)
+
+	// One thread, with its context after the list.
+	threads := make([]byte, 4+48+1232)
+	le.PutUint32(threads, 1)
+	le.PutUint32(threads[4:], 77)
+	le.PutUint32(threads[44:], 1232)
+	ctx := threads[52:]
+	le.PutUint64(ctx[152:], 0x2000F00)   // Rsp
+	le.PutUint64(ctx[248:], 0x140000100) // Rip
+	md.add(mdThreadListStream, threads)
+
+	// The image in the 64-bit memory list, with its data after the list.
+	code := bytes.Repeat([]byte{0xCC}, 0x1000)
+	copy(code[0x100:], []byte{0x48, 0x8B, 0x05, 0x11, 0x22, 0x33, 0x44, 0xC3})
+	data := make([]byte, 0x1000)
+	le.PutUint64(data[0x10:], 0x2000000)
+	mem64 := make([]byte, 16+32)
+	le.PutUint64(mem64, 2)
+	le.PutUint64(mem64[16:], 0x140000000)
+	le.PutUint64(mem64[24:], 0x1000)
+	le.PutUint64(mem64[32:], 0x140001000)
+	le.PutUint64(mem64[40:], 0x1000)
+	mem64 = append(append(mem64, code...), data...)
+	md.add(mdMemory64ListStream, mem64)
+
+	// The heap in the 32-bit memory list.
+	heap := make([]byte, 0x1000)
+	le.PutUint32(heap[0x40:], 1337)
+	mem := make([]byte, 4+16)
+	le.PutUint32(mem, 1)
+	le.PutUint64(mem[4:], 0x2000000)
+	le.PutUint32(mem[12:], 0x1000)
+	mem = append(mem, heap...)
+	md.add(mdMemoryListStream, mem)
+
+	// Memory info for the image sections and the heap.
+	infos := make([]byte, 16+3*48)
+	le.PutUint32(infos, 16)
+	le.PutUint32(infos[4:], 48)
+	le.PutUint64(infos[8:], 3)
+	for i, info := range []struct {
+		base, size uint64
+		protect    uint32
+	}{{0x140000000, 0x1000, mdPageExecuteRead}, {0x140001000, 0x1000, mdPageReadWrite}, {0x2000000, 0x1000, mdPageReadWrite}} {
+		e := infos[16+i*48:]
+		le.PutUint64(e, info.base)
+		le.PutUint64(e[24:], info.size)
+		le.PutUint32(e[32:], mdMemCommit)
+		le.PutUint32(e[36:], info.protect)
+	}
+	md.add(mdMemoryInfoListStream, infos)
+
+	dump := md.bytes(map[int]func(uint32, []byte){
+		2: func(off uint32, b []byte) { le.PutUint32(b[24:], off+112) },
+		3: func(off uint32, b []byte) { le.PutUint32(b[48:], off+52) },
+		4: func(off uint32, b []byte) { le.PutUint64(b[8:], uint64(off+48)) },
+		5: func(off uint32, b []byte) { le.PutUint32(b[16:], off+20) },
+	})
+
+	d, err := NewMinidump(bytes.NewReader(dump))
+	if err != nil {
+		t.Fatalf("NewMinidump: %s\n", err)
+	}
+	defer d.Close()
+	p := d.Process()
+
+	if p.PID != 4242 {
+		t.Errorf("Expected PID 4242, got %d\n", p.PID)
+	}
+	if info := d.SystemInfo(); info.Arch != ArchAMD64 || info.NumberOfProcessors != 8 || info.BuildNumber != 19045 {
+		t.Errorf("Unexpected system info %+v\n", info)
+	}
+	if size, err := p.PointerSize(); err != nil || size != 8 {
+		t.Errorf("Expected pointer size 8, got %d (%v)\n", size, err)
+	}
+
+	m, err := p.FindModule("GAME.EXE")
+	if err != nil || m.Base != 0x140000000 || m.Size != 0x3000 || m.Path != `C:\Games\Game\game.exe` {
+		t.Errorf("Unexpected module %+v (%v)\n", m, err)
+	}
+	if th, _ := d.Threads(); len(th) != 1 || th[0].ID != 77 || th[0].Regs.RIP != 0x140000100 || th[0].Regs.RSP != 0x2000F00 {
+		t.Errorf("Unexpected threads %+v\n", th)
+	}
+
+	v, err := p.Eval("[game.exe+0x1010] + 0x40")
+	if err != nil {
+		t.Fatalf("Eval: %s\n", err)
+	}
+	if got, err := p.ReadUint32(v); err != nil || got != 1337 {
+		t.Errorf("Expected 1337, got %d (%v)\n", got, err)
+	}
+	if _, err := p.ReadUint8(0x140002000); err == nil {
+		t.Errorf("Expected an error reading memory missing from the dump\n")
+	}
+
+	regions, err := p.Regions()
+	if err != nil || len(regions) != 3 {
+		t.Fatalf("Expected 3 regions, got %+v (%v)\n", regions, err)
+	}
+	if regions[0].Base != 0x2000000 || regions[0].Perm != PermRead|PermWrite {
+		t.Errorf("Unexpected heap region %+v\n", regions[0])
+	}
+	if regions[1].Perm != PermRead|PermExec || regions[1].Path != m.Path {
+		t.Errorf("Unexpected code region %+v\n", regions[1])
+	}
+
+	matches, err := p.FindPattern(MustParsePattern("48 8B 05 ?? ?? ?? ?? C3"), &ScanOptions{Module: "game.exe", Perm: PermExec})
+	if err != nil || len(matches) != 1 || matches[0] != 0x140000100 {
+		t.Errorf("Expected a match at 0x140000100, got %X (%v)\n", matches, err)
+	}
+}
@@ -0,0 +1,149 @@
+package kiwi
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Module is an executable or library loaded into a process.
+type Module struct {
+	Name string
+	Path string
+	Base uintptr
+	Size uintptr
+}
+
+// Contains reports whether addr is inside the module's image.
+func (m Module) Contains(addr uintptr) bool {
+	return addr >= m.Base && addr-m.Base < m.Size
+}
+
+// Modules returns the modules loaded into the process.
+func (p *Process) Modules() ([]Module, error) {
+	if p.backend != nil {
+		if ml, ok := p.backend.(ModuleLister); ok {
+			return ml.Modules()
+		}
+		return nil, errors.New("modules aren't available for this process")
+	}
+	return p.platformModules()
+}
+
+// FindModule returns the module with the given name (e.g. "kernel32.dll" or "libc.so.6").
+// An exact match is preferred, otherwise the name is matched case-insensitively.
+func (p *Process) FindModule(name string) (Module, error) {
+	modules, err := p.Modules()
+	if err != nil {
+		return Module{}, err
+	}
+	return findModule(modules, name)
+}
+
+func findModule(modules []Module, name string) (Module, error) {
+	for _, m := range modules {
+		if m.Name == name {
+			return m, nil
+		}
+	}
+	for _, m := range modules {
+		if strings.EqualFold(m.Name, name) {
+			return m, nil
+		}
+	}
+	return Module{}, fmt.Errorf("couldn't find module %q", name)
+}
+
+// modulesFromRegions returns a module for each file mapped into the regions, as listed in
+// /proc/<pid>/maps or the NT_FILE note of a core file.
+func modulesFromRegions(regions []Region) []Module {
+	var modules []Module
+	index := make(map[string]int)
+	for _, r := range regions {
+		// Skip anonymous and special ([heap], [stack], etc) mappings.
+		if !strings.HasPrefix(r.Path, "/") {
+			continue
+		}
+
+		if i, ok := index[r.Path]; ok {
+			if r.End() > modules[i].Base+modules[i].Size {
+				modules[i].Size = r.End() - modules[i].Base
+			}
+			continue
+		}
+
+		index[r.Path] = len(modules)
+		modules = append(modules, Module{
+			Name: path.Base(r.Path),
+			Path: r.Path,
+			Base: r.Base,
+			Size: r.Size,
+		})
+	}
+	return modules
+}
+
+// GetModuleBase takes a module name as an argument. (e.g. "kernel32.dll")
+// Returns the modules base address.
+func (p *Process) GetModuleBase(moduleName string) (uintptr, error) {
+	m, err := p.FindModule(moduleName)
+	if err != nil {
+		return 0, err
+	}
+	return m.Base, nil
+}
+
+// ModuleAt returns the module containing addr.
+func (p *Process) ModuleAt(addr uintptr) (Module, bool) {
+	modules, err := p.Modules()
+	if err != nil {
+		return Module{}, false
+	}
+	for _, m := range modules {
+		if m.Contains(addr) {
+			return m, true
+		}
+	}
+	return Module{}, false
+}
+
+// WithPointerSize returns a copy of the process which uses the given pointer size, in bytes.
+// This is needed for backends which can't detect it, such as an AddressSpace over a 32-bit guest.
+func (p *Process) WithPointerSize(size int) *Process {
+	np := *p
+	np.ptrSize = size
+	return &np
+}
+
+// PointerSize returns the size of a pointer in the process, in bytes.
+func (p *Process) PointerSize() (int, error) {
+	if p.ptrSize != 0 {
+		return p.ptrSize, nil
+	}
+	if p.backend != nil {
+		if ps, ok := p.backend.(PointerSizer); ok {
+			return ps.PointerSize()
+		}
+		return 0, errors.New("pointer size is unknown, set it with WithPointerSize")
+	}
+	return p.platformPointerSize()
+}
+
+// ReadPointer reads a pointer of the process's pointer size.
+func (p *Process) ReadPointer(addr uintptr) (uintptr, error) {
+	size, err := p.PointerSize()
+	if err != nil {
+		return 0, err
+	}
+
+	switch size {
+	case 4:
+		v, err := p.ReadUint32(addr)
+		return uintptr(v), err
+	case 8:
+		v, err := p.ReadUint64(addr)
+		return uintptr(v), err
+	}
+	return 0, fmt.Errorf("unsupported pointer size %d", size)
+}
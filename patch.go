@@ -0,0 +1,328 @@
+package kiwi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// nop is the one byte x86 NOP instruction.
+const nop = 0x90
+
+// WriteCode writes data to memory which may not be writable, such as the code of a module.
+// On Windows, the pages are made writable for the duration of the write and the instruction cache is flushed.
+func (p *Process) WriteCode(addr uintptr, data []byte) error {
+	if p.backend != nil {
+		if cw, ok := p.backend.(CodeWriter); ok {
+			return cw.WriteCode(data, addr)
+		}
+		return writeFull(p.backend, addr, data)
+	}
+	return p.platformWriteCode(addr, data)
+}
+
+// PatchError is returned when memory doesn't contain the bytes a patch expects.
+type PatchError struct {
+	Addr     uintptr
+	Expected []byte
+	Actual   []byte
+}
+
+func (e *PatchError) Error() string {
+	return fmt.Sprintf("patch at 0x%X expected % X, found % X", e.Addr, e.Expected, e.Actual)
+}
+
+// Patch is a reversible change to the memory of a process, usually its code.
+//
+// The original bytes are recorded when the patch is applied, so that it can be reverted.
+// Patches can be saved and loaded as JSON (see PatchSet), so a tool can revert its patches
+// after being restarted.
+type Patch struct {
+	Addr uintptr
+
+	// Original is the memory before the patch.
+	// If set before the patch is applied, the memory must match it for the patch to be applied.
+	Original []byte
+
+	// Patched is the memory after the patch.
+	Patched []byte
+
+	p       *Process
+	applied bool
+}
+
+// NewPatch returns a patch writing newBytes to addr, which isn't applied yet.
+// If expected isn't nil, the patch is only applied if memory matches it.
+func (p *Process) NewPatch(addr uintptr, newBytes, expected []byte) (*Patch, error) {
+	if expected != nil && len(expected) != len(newBytes) {
+		return nil, fmt.Errorf("patch at 0x%X has %d new bytes but %d expected bytes", addr, len(newBytes), len(expected))
+	}
+	return &Patch{
+		Addr:     addr,
+		Original: append([]byte(nil), expected...),
+		Patched:  append([]byte(nil), newBytes...),
+		p:        p,
+	}, nil
+}
+
+// Patch writes newBytes to addr, returning a Patch which can revert it.
+func (p *Process) Patch(addr uintptr, newBytes []byte) (*Patch, error) {
+	return p.PatchExpect(addr, newBytes, nil)
+}
+
+// PatchExpect is like Patch, but first verifies that memory contains the expected bytes.
+// A *PatchError is returned if it doesn't.
+func (p *Process) PatchExpect(addr uintptr, newBytes, expected []byte) (*Patch, error) {
+	pt, err := p.NewPatch(addr, newBytes, expected)
+	if err != nil {
+		return nil, err
+	}
+	if err := pt.Apply(); err != nil {
+		return nil, err
+	}
+	return pt, nil
+}
+
+// PatchNOP replaces count whole instructions starting at addr with NOPs.
+// The instructions are decoded with Disassemble.
+func (p *Process) PatchNOP(addr uintptr, count int) (*Patch, error) {
+	insts, err := p.Disassemble(addr, count)
+	if err != nil {
+		return nil, err
+	}
+	if len(insts) < count {
+		return nil, fmt.Errorf("only %d of %d instructions at 0x%X could be decoded", len(insts), count, addr)
+	}
+
+	size := 0
+	for _, inst := range insts {
+		if inst.Inst.Op == 0 {
+			return nil, fmt.Errorf("invalid instruction at 0x%X", inst.Addr)
+		}
+		size += inst.Len
+	}
+
+	// The decoded bytes are the expected bytes, so the code can't change in between.
+	expected := make([]byte, 0, size)
+	for _, inst := range insts {
+		expected = append(expected, inst.Bytes...)
+	}
+	return p.PatchExpect(addr, bytes.Repeat([]byte{nop}, size), expected)
+}
+
+// Applied reports whether the patch is currently applied.
+func (pt *Patch) Applied() bool {
+	return pt.applied
+}
+
+// Size returns the number of bytes changed by the patch.
+func (pt *Patch) Size() int {
+	return len(pt.Patched)
+}
+
+// check returns a *PatchError if memory doesn't contain want.
+func (pt *Patch) check(want []byte) error {
+	cur, err := pt.p.ReadBytes(pt.Addr, len(pt.Patched))
+	if err != nil {
+		return fmt.Errorf("ReadBytes 0x%X: %w", pt.Addr, err)
+	}
+	if !bytes.Equal(cur, want) {
+		return &PatchError{Addr: pt.Addr, Expected: want, Actual: cur}
+	}
+	return nil
+}
+
+// Apply applies the patch. It does nothing if the patch is already applied.
+func (pt *Patch) Apply() error {
+	if pt.applied {
+		return nil
+	}
+
+	if pt.Original != nil {
+		if err := pt.check(pt.Original); err != nil {
+			return err
+		}
+	} else {
+		orig, err := pt.p.ReadBytes(pt.Addr, len(pt.Patched))
+		if err != nil {
+			return fmt.Errorf("ReadBytes 0x%X: %w", pt.Addr, err)
+		}
+		pt.Original = orig
+	}
+
+	if err := pt.p.WriteCode(pt.Addr, pt.Patched); err != nil {
+		return fmt.Errorf("WriteCode 0x%X: %w", pt.Addr, err)
+	}
+	pt.applied = true
+	return nil
+}
+
+// Revert restores the original bytes. It does nothing if the patch isn't applied.
+// A *PatchError is returned if the patched memory has been changed since the patch was applied.
+func (pt *Patch) Revert() error {
+	if !pt.applied {
+		return nil
+	}
+	if err := pt.check(pt.Patched); err != nil {
+		return err
+	}
+	if err := pt.p.WriteCode(pt.Addr, pt.Original); err != nil {
+		return fmt.Errorf("WriteCode 0x%X: %w", pt.Addr, err)
+	}
+	pt.applied = false
+	return nil
+}
+
+// PatchSet is a group of patches which are applied and reverted together.
+type PatchSet struct {
+	Patches []*Patch
+	p       *Process
+}
+
+// NewPatchSet returns an empty patch set for the process.
+func (p *Process) NewPatchSet() *PatchSet {
+	return &PatchSet{p: p}
+}
+
+// Add adds a patch writing newBytes to addr to the set, without applying it.
+// If expected isn't nil, the set is only applied if memory matches it.
+func (s *PatchSet) Add(addr uintptr, newBytes, expected []byte) (*Patch, error) {
+	pt, err := s.p.NewPatch(addr, newBytes, expected)
+	if err != nil {
+		return nil, err
+	}
+	s.Patches = append(s.Patches, pt)
+	return pt, nil
+}
+
+// Apply applies every patch of the set.
+// The expected bytes of all patches are checked before any are written,
+// and if a write fails the patches already applied are reverted.
+func (s *PatchSet) Apply() error {
+	for _, pt := range s.Patches {
+		if !pt.applied && pt.Original != nil {
+			if err := pt.check(pt.Original); err != nil {
+				return err
+			}
+		}
+	}
+
+	var applied []*Patch
+	for _, pt := range s.Patches {
+		if pt.applied {
+			continue
+		}
+		if err := pt.Apply(); err != nil {
+			revertAll(applied)
+			return err
+		}
+		applied = append(applied, pt)
+	}
+	return nil
+}
+
+// Revert reverts every patch of the set, in the reverse order they were applied.
+// The patched bytes of all patches are checked before any are restored,
+// and if a write fails the patches already reverted are applied again.
+func (s *PatchSet) Revert() error {
+	for _, pt := range s.Patches {
+		if pt.applied {
+			if err := pt.check(pt.Patched); err != nil {
+				return err
+			}
+		}
+	}
+
+	var reverted []*Patch
+	for i := len(s.Patches) - 1; i >= 0; i-- {
+		pt := s.Patches[i]
+		if !pt.applied {
+			continue
+		}
+		if err := pt.Revert(); err != nil {
+			for _, r := range reverted {
+				r.Apply()
+			}
+			return err
+		}
+		reverted = append(reverted, pt)
+	}
+	return nil
+}
+
+// revertAll reverts patches in reverse order, ignoring errors.
+func revertAll(patches []*Patch) {
+	for i := len(patches) - 1; i >= 0; i-- {
+		patches[i].Revert()
+	}
+}
+
+// JSON layout of a patch, with bytes in the form accepted by ParsePattern.
+type patchJSON struct {
+	Addr     string `json:"addr"`
+	Original string `json:"original"`
+	Patched  string `json:"patched"`
+}
+
+// WriteJSON writes the patches of the set, including their original bytes.
+func (s *PatchSet) WriteJSON(w io.Writer) error {
+	out := make([]patchJSON, len(s.Patches))
+	for i, pt := range s.Patches {
+		out[i] = patchJSON{
+			Addr:     fmt.Sprintf("0x%X", pt.Addr),
+			Original: fmt.Sprintf("% X", pt.Original),
+			Patched:  fmt.Sprintf("% X", pt.Patched),
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// ReadPatchSetJSON reads patches written by WriteJSON for the process.
+// Patches whose patched bytes are found in memory are marked as applied, so they can be reverted.
+func (p *Process) ReadPatchSetJSON(r io.Reader) (*PatchSet, error) {
+	var in []patchJSON
+	if err := json.NewDecoder(r).Decode(&in); err != nil {
+		return nil, err
+	}
+
+	s := p.NewPatchSet()
+	for _, pj := range in {
+		var addr uint64
+		if _, err := fmt.Sscanf(pj.Addr, "0x%X", &addr); err != nil {
+			return nil, fmt.Errorf("invalid patch address %q", pj.Addr)
+		}
+		orig, err := decodeHexBytes(pj.Original)
+		if err != nil {
+			return nil, err
+		}
+		patched, err := decodeHexBytes(pj.Patched)
+		if err != nil {
+			return nil, err
+		}
+		if len(orig) != len(patched) {
+			return nil, errors.New("patch original and patched bytes have different lengths")
+		}
+
+		pt, err := s.Add(uintptr(addr), patched, orig)
+		if err != nil {
+			return nil, err
+		}
+		pt.applied = pt.check(pt.Patched) == nil
+	}
+	return s, nil
+}
+
+// decodeHexBytes decodes space separated hex bytes, such as "48 8B 05".
+func decodeHexBytes(s string) ([]byte, error) {
+	b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid bytes %q: %w", s, err)
+	}
+	return b, nil
+}
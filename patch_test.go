@@ -0,0 +1,116 @@
+package kiwi
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"unsafe"
+)
+
+func TestPatch(t *testing.T) {
+	p, err := GetProcessByFileName(currentProcessName)
+	if err != nil {
+		t.Fatalf("Error trying to open process \"%s\", Error: %s\n", currentProcessName, err.Error())
+	}
+
+	code := &[16]byte{
+		0x48, 0x8B, 0x05, 0x10, 0x00, 0x00, 0x00, // mov rax, qword ptr [rip+0x10]
+		0xE8, 0xF4, 0xFF, 0xFF, 0xFF, // call -0xC
+		0xC3, // ret
+	}
+	heapSink = code
+	orig := *code
+	addr := uintptr(unsafe.Pointer(code))
+
+	// Expected bytes which don't match.
+	var perr *PatchError
+	if _, err := p.PatchExpect(addr, []byte{0xC3}, []byte{0x90}); !errors.As(err, &perr) {
+		t.Fatalf("PatchExpect with wrong bytes should return a PatchError, got %v\n", err)
+	}
+
+	pt, err := p.PatchExpect(addr+7, []byte{0xC3}, []byte{0xE8})
+	if err != nil {
+		t.Fatalf("PatchExpect: %s\n", err)
+	}
+	if code[7] != 0xC3 || !pt.Applied() {
+		t.Fatalf("Patch wasn't applied\n")
+	}
+	if err := pt.Revert(); err != nil {
+		t.Fatalf("Revert: %s\n", err)
+	}
+	if *code != orig || pt.Applied() {
+		t.Fatalf("Patch wasn't reverted\n")
+	}
+
+	// NOP out the mov and call.
+	pt, err = p.PatchNOP(addr, 2)
+	if err != nil {
+		t.Fatalf("PatchNOP: %s\n", err)
+	}
+	if pt.Size() != 12 || !bytes.Equal(code[:12], bytes.Repeat([]byte{0x90}, 12)) || code[12] != 0xC3 {
+		t.Fatalf("PatchNOP got % X\n", code[:])
+	}
+
+	// Patched memory which was changed since can't be reverted.
+	code[0] = 0xCC
+	if err := pt.Revert(); !errors.As(err, &perr) {
+		t.Fatalf("Revert of changed memory should return a PatchError, got %v\n", err)
+	}
+	code[0] = 0x90
+	if err := pt.Revert(); err != nil || *code != orig {
+		t.Fatalf("Revert: %v\n", err)
+	}
+}
+
+func TestPatchSet(t *testing.T) {
+	p, err := GetProcessByFileName(currentProcessName)
+	if err != nil {
+		t.Fatalf("Error trying to open process \"%s\", Error: %s\n", currentProcessName, err.Error())
+	}
+
+	buf := &[8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+	heapSink = buf
+	orig := *buf
+	addr := uintptr(unsafe.Pointer(buf))
+
+	// A set with one wrong expectation isn't applied at all.
+	s := p.NewPatchSet()
+	s.Add(addr, []byte{0xAA}, nil)
+	s.Add(addr+4, []byte{0xBB}, []byte{0xFF})
+	if err := s.Apply(); err == nil {
+		t.Fatalf("Apply should fail\n")
+	}
+	if *buf != orig {
+		t.Fatalf("Failed Apply changed memory: % X\n", buf[:])
+	}
+
+	s = p.NewPatchSet()
+	s.Add(addr, []byte{0xAA, 0xAB}, nil)
+	s.Add(addr+4, []byte{0xBB}, []byte{5})
+	if err := s.Apply(); err != nil {
+		t.Fatalf("Apply: %s\n", err)
+	}
+	want := [8]byte{0xAA, 0xAB, 3, 4, 0xBB, 6, 7, 8}
+	if *buf != want {
+		t.Fatalf("Apply got % X, expected % X\n", buf[:], want[:])
+	}
+
+	// Save the set and load it again, as if the tool was restarted.
+	var saved bytes.Buffer
+	if err := s.WriteJSON(&saved); err != nil {
+		t.Fatalf("WriteJSON: %s\n", err)
+	}
+	loaded, err := p.ReadPatchSetJSON(&saved)
+	if err != nil {
+		t.Fatalf("ReadPatchSetJSON: %s\n", err)
+	}
+	if len(loaded.Patches) != 2 || !loaded.Patches[0].Applied() || !loaded.Patches[1].Applied() {
+		t.Fatalf("Loaded patches should be applied\n")
+	}
+	if err := loaded.Revert(); err != nil {
+		t.Fatalf("Revert: %s\n", err)
+	}
+	if *buf != orig {
+		t.Fatalf("Revert got % X, expected % X\n", buf[:], orig[:])
+	}
+}
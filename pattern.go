@@ -0,0 +1,238 @@
+package kiwi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Pattern is a byte pattern with wildcards, as used for array of bytes (AOB) scans.
+type Pattern struct {
+	Bytes []byte
+	Mask  []byte // Bits set in the mask must match, others are wildcards.
+}
+
+// ParsePattern parses a byte pattern such as "48 8B 05 ?? ?? ?? ?? 89".
+//
+// Bytes are given in hex, with "??", "?" or "*" matching any byte, and a "?" in place of
+// either hex digit matching any nibble (e.g. "4?"). Spaces between bytes are optional.
+func ParsePattern(s string) (*Pattern, error) {
+	fields := strings.Fields(s)
+
+	// Split patterns written without spaces into bytes.
+	if len(fields) == 1 && len(fields[0]) > 2 {
+		f := fields[0]
+		if len(f)%2 != 0 {
+			return nil, fmt.Errorf("pattern %q has an odd number of digits", s)
+		}
+		fields = fields[:0]
+		for i := 0; i < len(f); i += 2 {
+			fields = append(fields, f[i:i+2])
+		}
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("empty pattern")
+	}
+
+	p := &Pattern{Bytes: make([]byte, len(fields)), Mask: make([]byte, len(fields))}
+	for i, f := range fields {
+		switch f {
+		case "?", "??", "*":
+			continue
+		}
+		if len(f) != 2 {
+			return nil, fmt.Errorf("invalid pattern byte %q", f)
+		}
+
+		for j, c := range []byte(f) {
+			shift := uint(4 - j*4)
+			if c == '?' {
+				continue
+			}
+			v, err := strconv.ParseUint(string(c), 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern byte %q", f)
+			}
+			p.Bytes[i] |= byte(v) << shift
+			p.Mask[i] |= 0xF << shift
+		}
+	}
+
+	if bytes.Count(p.Mask, []byte{0}) == len(p.Mask) {
+		return nil, errors.New("pattern is only wildcards")
+	}
+	return p, nil
+}
+
+// MustParsePattern is like ParsePattern but panics if the pattern can't be parsed.
+func MustParsePattern(s string) *Pattern {
+	p, err := ParsePattern(s)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the pattern in the form accepted by ParsePattern.
+func (p *Pattern) String() string {
+	parts := make([]string, len(p.Bytes))
+	for i, b := range p.Bytes {
+		switch p.Mask[i] {
+		case 0xFF:
+			parts[i] = fmt.Sprintf("%02X", b)
+		case 0:
+			parts[i] = "??"
+		case 0xF0:
+			parts[i] = fmt.Sprintf("%X?", b>>4)
+		case 0x0F:
+			parts[i] = fmt.Sprintf("?%X", b&0xF)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Len returns the length of the pattern in bytes.
+func (p *Pattern) Len() int {
+	return len(p.Bytes)
+}
+
+// Match reports whether data starts with the pattern.
+func (p *Pattern) Match(data []byte) bool {
+	if len(data) < len(p.Bytes) {
+		return false
+	}
+	for i, b := range p.Bytes {
+		if data[i]&p.Mask[i] != b {
+			return false
+		}
+	}
+	return true
+}
+
+// anchor returns the index of the first fully specified byte of the pattern, or -1 if none.
+func (p *Pattern) anchor() int {
+	return bytes.IndexByte(p.Mask, 0xFF)
+}
+
+// index returns the index of the first match of the pattern in data, or -1 if none.
+func (p *Pattern) index(data []byte) int {
+	a := p.anchor()
+	if a == -1 {
+		// No fully specified byte to search for, check every position.
+		for i := 0; i+len(p.Bytes) <= len(data); i++ {
+			if p.Match(data[i:]) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for off := a; off < len(data); {
+		i := bytes.IndexByte(data[off:], p.Bytes[a])
+		if i == -1 {
+			return -1
+		}
+		start := off + i - a
+		if start+len(p.Bytes) > len(data) {
+			return -1
+		}
+		if p.Match(data[start:]) {
+			return start
+		}
+		off += i + 1
+	}
+	return -1
+}
+
+// ScanOptions limits which memory is searched by a scan.
+// The zero value scans all readable memory of the process.
+type ScanOptions struct {
+	// Module limits the scan to the image of the named module.
+	Module string
+
+	// Start and End limit the scan to the address range [Start, End), if End is non-zero.
+	Start, End uintptr
+
+	// Perm limits the scan to regions with at least these permissions.
+	// Regions must always be readable to be scanned.
+	Perm Perm
+
+	// Limit stops the scan after this many results, if non-zero.
+	Limit int
+}
+
+// scanTargets returns the readable regions selected by the options, clipped to their ranges.
+func (p *Process) scanTargets(opts *ScanOptions) ([]Region, error) {
+	if opts == nil {
+		opts = &ScanOptions{}
+	}
+
+	start, end := opts.Start, opts.End
+	if opts.Module != "" {
+		m, err := p.FindModule(opts.Module)
+		if err != nil {
+			return nil, err
+		}
+		if start < m.Base {
+			start = m.Base
+		}
+		if end == 0 || end > m.Base+m.Size {
+			end = m.Base + m.Size
+		}
+	}
+
+	regions, err := p.readableRegions()
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []Region
+	for _, r := range regions {
+		if r.Perm&opts.Perm != opts.Perm {
+			continue
+		}
+
+		// Clip to the range.
+		if end != 0 {
+			if r.End() <= start || r.Base >= end {
+				continue
+			}
+			if r.Base < start {
+				r.Size -= start - r.Base
+				r.Base = start
+			}
+			if r.End() > end {
+				r.Size = end - r.Base
+			}
+		}
+		targets = append(targets, r)
+	}
+	return targets, nil
+}
+
+// FindPattern returns the addresses of matches of the pattern in the memory selected by opts.
+// opts may be nil to scan all readable memory.
+func (p *Process) FindPattern(pat *Pattern, opts *ScanOptions) ([]uintptr, error) {
+	regions, err := p.scanTargets(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []uintptr
+	p.scanRegions(regions, pat.Len()-1, func(addr uintptr, data []byte) bool {
+		for off := 0; ; {
+			i := pat.index(data[off:])
+			if i == -1 {
+				return true
+			}
+			matches = append(matches, addr+uintptr(off+i))
+			if opts != nil && opts.Limit != 0 && len(matches) >= opts.Limit {
+				return false
+			}
+			off += i + 1
+		}
+	})
+	return matches, nil
+}
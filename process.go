@@ -1,6 +1,7 @@
 package kiwi
 
 import (
+	"encoding/binary"
 	"fmt"
 
 	"golang.org/x/text/encoding/unicode"
@@ -15,6 +16,47 @@ type Process struct {
 
 	// Platform independent process details
 	PID uint64
+
+	// Byte order used to interpret memory, nil for native. See WithByteOrder.
+	byteOrder binary.ByteOrder
+	swap      bool
+
+	// Pointer size override, 0 to detect it. See WithPointerSize.
+	ptrSize int
+
+	// Backend the process's memory is accessed through, nil for direct access to a live process.
+	// See NewProcess.
+	backend Backend
+}
+
+// ProcessInfo describes a running process, as returned by ListProcesses.
+type ProcessInfo struct {
+	PID  int
+	Name string // The executable's file name, e.g. "game.exe".
+}
+
+// read reads into the value pointed to by ptr.
+func (p *Process) read(addr uintptr, ptr interface{}) error {
+	if p.backend != nil {
+		return readFull(p.backend, addr, dataBytes(ptr))
+	}
+	return p.platformRead(addr, ptr)
+}
+
+// write writes the value pointed to by ptr.
+func (p *Process) write(addr uintptr, ptr interface{}) error {
+	if p.backend != nil {
+		return writeFull(p.backend, addr, dataBytes(ptr))
+	}
+	return p.platformWrite(addr, ptr)
+}
+
+// Regions returns the memory regions of the process, sorted by address.
+func (p *Process) Regions() ([]Region, error) {
+	if p.backend != nil {
+		return p.backend.Regions()
+	}
+	return p.platformRegions()
 }
 
 // ReadInt8 reads an int8.
@@ -28,21 +70,21 @@ func (p *Process) ReadInt8(addr uintptr) (int8, error) {
 func (p *Process) ReadInt16(addr uintptr) (int16, error) {
 	var v int16
 	e := p.read(addr, &v)
-	return v, e
+	return int16(p.swap16(uint16(v))), e
 }
 
 // ReadInt32 reads an int32.
 func (p *Process) ReadInt32(addr uintptr) (int32, error) {
 	var v int32
 	e := p.read(addr, &v)
-	return v, e
+	return int32(p.swap32(uint32(v))), e
 }
 
 // ReadInt64 reads an int64
 func (p *Process) ReadInt64(addr uintptr) (int64, error) {
 	var v int64
 	e := p.read(addr, &v)
-	return v, e
+	return int64(p.swap64(uint64(v))), e
 }
 
 // ReadUint8 reads an uint8.
@@ -56,35 +98,35 @@ func (p *Process) ReadUint8(addr uintptr) (uint8, error) {
 func (p *Process) ReadUint16(addr uintptr) (uint16, error) {
 	var v uint16
 	e := p.read(addr, &v)
-	return v, e
+	return p.swap16(v), e
 }
 
 // ReadUint32 reads an uint32.
 func (p *Process) ReadUint32(addr uintptr) (uint32, error) {
 	var v uint32
 	e := p.read(addr, &v)
-	return v, e
+	return p.swap32(v), e
 }
 
 // ReadUint64 reads an uint64.
 func (p *Process) ReadUint64(addr uintptr) (uint64, error) {
 	var v uint64
 	e := p.read(addr, &v)
-	return v, e
+	return p.swap64(v), e
 }
 
 // ReadFloat32 reads a float32.
 func (p *Process) ReadFloat32(addr uintptr) (float32, error) {
 	var v float32
 	e := p.read(addr, &v)
-	return v, e
+	return p.swapFloat32(v), e
 }
 
 // ReadFloat64 reads a float64
 func (p *Process) ReadFloat64(addr uintptr) (float64, error) {
 	var v float64
 	e := p.read(addr, &v)
-	return v, e
+	return p.swapFloat64(v), e
 }
 
 // ReadUint32Ptr reads a uint32 pointer chain with offsets.
@@ -145,7 +187,7 @@ func (p *Process) ReadNullTerminatedUTF8String(addr uintptr) (string, error) {
 			// No null-terminator in the buffer.
 			outputBuffer = append(outputBuffer, v...)
 		} else {
-			outputBuffer = v[:idx]
+			outputBuffer = append(outputBuffer, v[:idx]...)
 			break
 		}
 	}
@@ -163,14 +205,14 @@ func cwstrlen(data []uint16) int {
 }
 
 // ReadNullTerminatedUTF16String reads a null-termimated UTF16 string.
-// Respects BOM, assumes little endianess if no BOM is present.
+// Respects BOM, assumes the process's byte order (see WithByteOrder) if no BOM is present.
 func (p *Process) ReadNullTerminatedUTF16String(addr uintptr) (string, error) {
 	var outputBuffer []uint16
 	readSize := 2048
 	for {
 		// Make a buffer to hold our temporary string data.
 		v := make([]uint16, readSize)
-		err := p.read(addr+uintptr(len(outputBuffer)), &v)
+		err := p.read(addr+uintptr(len(outputBuffer)*2), &v)
 		if err != nil {
 			// Halve readSize if we got an error on read.
 			if readSize > 1 {
@@ -187,7 +229,7 @@ func (p *Process) ReadNullTerminatedUTF16String(addr uintptr) (string, error) {
 			// No null-terminator in the buffer.
 			outputBuffer = append(outputBuffer, v...)
 		} else {
-			outputBuffer = v[:idx]
+			outputBuffer = append(outputBuffer, v[:idx]...)
 			break
 		}
 	}
@@ -199,8 +241,12 @@ func (p *Process) ReadNullTerminatedUTF16String(addr uintptr) (string, error) {
 		byteBuf[(i*2)+1] = byte((outputBuffer[i] >> 8) & 0xFF)
 	}
 
-	// Decode the UTF16 to UTF8
-	decoder := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder()
+	// Decode the UTF16 to UTF8, defaulting to the process's byte order.
+	endianness := unicode.LittleEndian
+	if p.ByteOrder().Uint16([]byte{0x01, 0x02}) == 0x0102 {
+		endianness = unicode.BigEndian
+	}
+	decoder := unicode.UTF16(endianness, unicode.UseBOM).NewDecoder()
 	utf8Bytes, err := decoder.Bytes(byteBuf)
 	if err != nil {
 		return "", err
@@ -216,16 +262,19 @@ func (p *Process) WriteInt8(addr uintptr, v int8) error {
 
 // WriteInt16 writes an int16.
 func (p *Process) WriteInt16(addr uintptr, v int16) error {
+	v = int16(p.swap16(uint16(v)))
 	return p.write(addr, &v)
 }
 
 // WriteInt32 writes an int32.
 func (p *Process) WriteInt32(addr uintptr, v int32) error {
+	v = int32(p.swap32(uint32(v)))
 	return p.write(addr, &v)
 }
 
 // WriteInt64 writes an int64.
 func (p *Process) WriteInt64(addr uintptr, v int64) error {
+	v = int64(p.swap64(uint64(v)))
 	return p.write(addr, &v)
 }
 
@@ -236,26 +285,31 @@ func (p *Process) WriteUint8(addr uintptr, v uint8) error {
 
 // WriteUint16 writes an uint16.
 func (p *Process) WriteUint16(addr uintptr, v uint16) error {
+	v = p.swap16(v)
 	return p.write(addr, &v)
 }
 
 // WriteUint32 writes an uint32.
 func (p *Process) WriteUint32(addr uintptr, v uint32) error {
+	v = p.swap32(v)
 	return p.write(addr, &v)
 }
 
 // WriteUint64 writes an uint64.
 func (p *Process) WriteUint64(addr uintptr, v uint64) error {
+	v = p.swap64(v)
 	return p.write(addr, &v)
 }
 
 // WriteFloat32 writes a float32.
 func (p *Process) WriteFloat32(addr uintptr, v float32) error {
+	v = p.swapFloat32(v)
 	return p.write(addr, &v)
 }
 
 // WriteFloat64 writes a float64.
 func (p *Process) WriteFloat64(addr uintptr, v float64) error {
+	v = p.swapFloat64(v)
 	return p.write(addr, &v)
 }
 
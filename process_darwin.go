@@ -19,6 +19,12 @@ func GetProcessByPID(PID int) (Process, error) {
 	return Process{}, nil
 }
 
+// ListProcesses returns the running processes.
+func ListProcesses() ([]ProcessInfo, error) {
+	panic("OSX is not supported")
+	return nil, nil
+}
+
 // GetProcessByFileName returns the process with the given file name.
 // If multiple processes have the same filename, the first process
 // enumerated by this function is returned.
@@ -28,13 +34,43 @@ func GetProcessByFileName(fileName string) (Process, error) {
 }
 
 // The platform specific read function.
-func (p *Process) read(addr uintptr, ptr interface{}) error {
+func (p *Process) platformRead(addr uintptr, ptr interface{}) error {
 	panic("OSX is not supported")
 	return nil
 }
 
 // The platform specific write function.
-func (p *Process) write(addr uintptr, ptr interface{}) error {
+func (p *Process) platformWrite(addr uintptr, ptr interface{}) error {
+	panic("OSX is not supported")
+	return nil
+}
+
+// The platform specific code write function.
+func (p *Process) platformWriteCode(addr uintptr, data []byte) error {
 	panic("OSX is not supported")
 	return nil
 }
+
+// The platform specific regions function.
+func (p *Process) platformRegions() ([]Region, error) {
+	panic("OSX is not supported")
+	return nil, nil
+}
+
+// The platform specific modules function.
+func (p *Process) platformModules() ([]Module, error) {
+	panic("OSX is not supported")
+	return nil, nil
+}
+
+// The platform specific pointer size function.
+func (p *Process) platformPointerSize() (int, error) {
+	panic("OSX is not supported")
+	return 0, nil
+}
+
+// The platform specific attach function.
+func (p *Process) platformAttach() ([]Thread, func(), error) {
+	panic("OSX is not supported")
+	return nil, nil, nil
+}
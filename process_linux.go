@@ -1,14 +1,19 @@
 package kiwi
 
 import (
+	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
-	_ "path/filepath"
 	"reflect"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"unsafe"
 )
 
@@ -29,6 +34,38 @@ func GetProcessByPID(PID int) (Process, error) {
 	return Process{PID: uint64(PID)}, nil
 }
 
+// ListProcesses returns the running processes.
+func ListProcesses() ([]ProcessInfo, error) {
+	dirNames, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, fmt.Errorf("reading /proc: %w", err)
+	}
+
+	var procs []ProcessInfo
+	for _, d := range dirNames {
+		pid, err := strconv.Atoi(d.Name())
+		if err != nil {
+			continue
+		}
+
+		// The name is between the first "(" and the last ")" of the stat file, as it may contain either.
+		stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			// The process exited.
+			continue
+		}
+		start, end := bytes.IndexByte(stat, '('), bytes.LastIndexByte(stat, ')')
+		if start < 0 || end < start {
+			continue
+		}
+		procs = append(procs, ProcessInfo{PID: pid, Name: string(stat[start+1 : end])})
+	}
+	sort.Slice(procs, func(i, j int) bool {
+		return procs[i].PID < procs[j].PID
+	})
+	return procs, nil
+}
+
 // GetProcessByFileName returns the process with the given file name.
 // If multiple processes have the same filename, the first process
 // enumerated by this function is returned.
@@ -86,7 +123,7 @@ func GetProcessByFileName(fileName string) (Process, error) {
 }
 
 // The platform specific read function.
-func (p *Process) read(addr uintptr, ptr interface{}) error {
+func (p *Process) platformRead(addr uintptr, ptr interface{}) error {
 	// Reflection magic!
 	v := reflect.ValueOf(ptr)
 	dataAddr := getDataAddr(v)
@@ -119,7 +156,7 @@ func (p *Process) read(addr uintptr, ptr interface{}) error {
 }
 
 // The platform specific write function.
-func (p *Process) write(addr uintptr, ptr interface{}) error {
+func (p *Process) platformWrite(addr uintptr, ptr interface{}) error {
 	// Reflection magic!
 	v := reflect.ValueOf(ptr)
 	dataAddr := getDataAddr(v)
@@ -148,3 +185,169 @@ func (p *Process) write(addr uintptr, ptr interface{}) error {
 	}
 	return nil
 }
+
+// The platform specific code write function.
+// Writes through /proc/<pid>/mem ignore page protections, so this is a normal write.
+func (p *Process) platformWriteCode(addr uintptr, data []byte) error {
+	return p.platformWrite(addr, &data)
+}
+
+// The platform specific regions function.
+// Parses the /proc/<pid>/maps file of the process.
+func (p *Process) platformRegions() ([]Region, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/maps", p.PID))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var regions []Region
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Each line is formatted as:
+		// address           perms offset  dev   inode   pathname
+		// 00400000-00452000 r-xp 00000000 08:02 173521  /usr/bin/dbus-daemon
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+
+		bounds := strings.SplitN(fields[0], "-", 2)
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("malformed maps line %q", scanner.Text())
+		}
+		start, err := strconv.ParseUint(bounds[0], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed maps line %q: %w", scanner.Text(), err)
+		}
+		end, err := strconv.ParseUint(bounds[1], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed maps line %q: %w", scanner.Text(), err)
+		}
+		offset, err := strconv.ParseUint(fields[2], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed maps line %q: %w", scanner.Text(), err)
+		}
+
+		var perm Perm
+		if strings.IndexByte(fields[1], 'r') != -1 {
+			perm |= PermRead
+		}
+		if strings.IndexByte(fields[1], 'w') != -1 {
+			perm |= PermWrite
+		}
+		if strings.IndexByte(fields[1], 'x') != -1 {
+			perm |= PermExec
+		}
+
+		regions = append(regions, Region{
+			Base:   uintptr(start),
+			Size:   uintptr(end - start),
+			Perm:   perm,
+			Path:   strings.Join(fields[5:], " "),
+			Offset: offset,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return regions, nil
+}
+
+// The platform specific modules function.
+// Groups the file backed regions of the process by the file they map.
+func (p *Process) platformModules() ([]Module, error) {
+	regions, err := p.platformRegions()
+	if err != nil {
+		return nil, err
+	}
+
+	return modulesFromRegions(regions), nil
+}
+
+// The platform specific pointer size function.
+// Reads the ELF class of the process's executable.
+func (p *Process) platformPointerSize() (int, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/exe", p.PID))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	ident := make([]byte, 5)
+	if _, err := io.ReadFull(f, ident); err != nil {
+		return 0, err
+	}
+	if string(ident[:4]) != "\x7fELF" {
+		return 0, errors.New("executable is not an ELF file")
+	}
+
+	switch ident[4] {
+	case 1: // ELFCLASS32
+		return 4, nil
+	case 2: // ELFCLASS64
+		return 8, nil
+	}
+	return 0, fmt.Errorf("unknown ELF class %d", ident[4])
+}
+
+// ptraceGetRegs is PTRACE_GETREGS, which package syscall doesn't define on every architecture.
+const ptraceGetRegs = 12
+
+// The platform specific attach function.
+// Stops each thread with ptrace and reads its registers.
+func (p *Process) platformAttach() ([]Thread, func(), error) {
+	if runtime.GOARCH != "amd64" {
+		return nil, nil, errors.New("reading registers is only supported on amd64")
+	}
+	tasks, err := ioutil.ReadDir(fmt.Sprintf("/proc/%d/task", p.PID))
+	if err != nil {
+		return nil, nil, err
+	}
+	var tids []int
+	for _, t := range tasks {
+		if tid, err := strconv.Atoi(t.Name()); err == nil {
+			tids = append(tids, tid)
+		}
+	}
+	// The main thread's ID is the PID, put it first.
+	sort.SliceStable(tids, func(i, j int) bool {
+		return uint64(tids[i]) == p.PID && uint64(tids[j]) != p.PID
+	})
+
+	// Every ptrace request must come from the thread which attached.
+	runtime.LockOSThread()
+	var attached []int
+	detach := func() {
+		for _, tid := range attached {
+			syscall.PtraceDetach(tid)
+		}
+		runtime.UnlockOSThread()
+	}
+
+	var threads []Thread
+	for _, tid := range tids {
+		if err := syscall.PtraceAttach(tid); err != nil {
+			if err == syscall.ESRCH {
+				continue // The thread exited.
+			}
+			detach()
+			return nil, nil, fmt.Errorf("attach to thread %d: %w", tid, err)
+		}
+		attached = append(attached, tid)
+
+		var ws syscall.WaitStatus
+		if _, err := syscall.Wait4(tid, &ws, syscall.WALL, nil); err != nil {
+			detach()
+			return nil, nil, fmt.Errorf("wait for thread %d: %w", tid, err)
+		}
+		t := Thread{ID: tid}
+		_, _, errno := syscall.Syscall6(syscall.SYS_PTRACE, ptraceGetRegs, uintptr(tid), 0, uintptr(unsafe.Pointer(&t.Regs)), 0, 0)
+		if errno != 0 {
+			detach()
+			return nil, nil, fmt.Errorf("read registers of thread %d: %w", tid, errno)
+		}
+		threads = append(threads, t)
+	}
+	return threads, detach, nil
+}
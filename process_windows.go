@@ -50,11 +50,8 @@ func getFileNameByPID(pid uint32) (string, error) {
 	return fileName, nil
 }
 
-// GetProcessByFileName returns the process with the given file name.
-// If multiple processes have the same filename, the first process
-// enumerated by this function is returned.
-func GetProcessByFileName(fileName string) (Process, error) {
-	// Read in process ids
+// enumProcessIDs returns the PIDs of every process.
+func enumProcessIDs() ([]uint32, error) {
 	pidCount := 1024
 	var pids []uint32
 	var bytesRead uint32
@@ -66,13 +63,47 @@ func GetProcessByFileName(fileName string) (Process, error) {
 		pids = make([]uint32, pidCount*i)
 		ok := w32.EnumProcesses(pids, uint32(len(pids))*uint32size, &bytesRead)
 		if !ok {
-			return Process{}, fmt.Errorf("EnumProcesses: %w", windows.GetLastError())
+			return nil, fmt.Errorf("EnumProcesses: %w", windows.GetLastError())
+		}
+	}
+
+	// Divide bytesRead by sizeof(uint32) to get how many processes there are.
+	return pids[:bytesRead/uint32size], nil
+}
+
+// ListProcesses returns the running processes which can be queried.
+func ListProcesses() ([]ProcessInfo, error) {
+	pids, err := enumProcessIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	var procs []ProcessInfo
+	for _, pid := range pids {
+		// Skip over the system process with PID 0.
+		if pid == 0 {
+			continue
 		}
+		name, err := getFileNameByPID(pid)
+		if err != nil {
+			continue
+		}
+		procs = append(procs, ProcessInfo{PID: int(pid), Name: name})
 	}
+	return procs, nil
+}
 
-	// Loop over pids,
-	// (Divide bytesRead by sizeof(uint32) to get how many processes there are).
-	for i := uint32(0); i < (bytesRead / uint32size); i++ {
+// GetProcessByFileName returns the process with the given file name.
+// If multiple processes have the same filename, the first process
+// enumerated by this function is returned.
+func GetProcessByFileName(fileName string) (Process, error) {
+	pids, err := enumProcessIDs()
+	if err != nil {
+		return Process{}, err
+	}
+
+	// Loop over pids.
+	for i := range pids {
 		// Skip over the system process with PID 0.
 		if pids[i] == 0 {
 			continue
@@ -99,15 +130,12 @@ func GetProcessByFileName(fileName string) (Process, error) {
 	return Process{}, errors.New("couldn't find process with name " + fileName)
 }
 
-// GetModuleBase takes a module name as an argument. (e.g. "kernel32.dll")
-// Returns the modules base address.
-//
-// (Mostly taken from genkman's gist: https://gist.github.com/henkman/3083408)
-// TODO(Andoryuuta): Figure out possible licencing issues with this, or rewrite.
-func (p *Process) GetModuleBase(moduleName string) (uintptr, error) {
-	snap, ok := w32.CreateToolhelp32Snapshot(w32.TH32CS_SNAPMODULE32|w32.TH32CS_SNAPALL|w32.TH32CS_SNAPMODULE, uint32(p.PID))
+// The platform specific modules function.
+// Enumerates the modules of the process with a toolhelp snapshot.
+func (p *Process) platformModules() ([]Module, error) {
+	snap, ok := w32.CreateToolhelp32Snapshot(w32.TH32CS_SNAPMODULE|w32.TH32CS_SNAPMODULE32, uint32(p.PID))
 	if !ok {
-		return 0, fmt.Errorf("CreateToolhelp32Snapshot: %w", windows.GetLastError())
+		return nil, fmt.Errorf("CreateToolhelp32Snapshot: %w", windows.GetLastError())
 	}
 	defer w32.CloseHandle(snap)
 
@@ -116,28 +144,83 @@ func (p *Process) GetModuleBase(moduleName string) (uintptr, error) {
 
 	// Get first module.
 	if !w32.Module32First(snap, &me32) {
-		return 0, fmt.Errorf("Module32First: %w", windows.GetLastError())
+		return nil, fmt.Errorf("Module32First: %w", windows.GetLastError())
+	}
+
+	// Loop over all of the modules.
+	var modules []Module
+	for ok := true; ok; ok = w32.Module32Next(snap, &me32) {
+		modules = append(modules, Module{
+			Name: syscall.UTF16ToString(me32.SzModule[:]),
+			Path: syscall.UTF16ToString(me32.SzExePath[:]),
+			Base: uintptr(unsafe.Pointer(me32.ModBaseAddr)),
+			Size: uintptr(me32.ModBaseSize),
+		})
+	}
+	return modules, nil
+}
+
+// The platform specific pointer size function.
+func (p *Process) platformPointerSize() (int, error) {
+	wow64, ok := w32.IsWow64Process(p.Handle)
+	if !ok {
+		return 0, fmt.Errorf("IsWow64Process: %w", windows.GetLastError())
+	}
+	if wow64 {
+		return 4, nil
 	}
 
-	// Check first module.
-	if syscall.UTF16ToString(me32.SzModule[:]) == moduleName {
-		return uintptr(unsafe.Pointer(me32.ModBaseAddr)), nil
+	// Not running under WOW64, so the process is native to the OS.
+	// If kiwi is 32-bit, the OS is only 64-bit if kiwi is itself running under WOW64.
+	if unsafe.Sizeof(uintptr(0)) == 4 {
+		self, ok := w32.IsWow64Process(w32.HANDLE(windows.CurrentProcess()))
+		if !ok || !self {
+			return 4, nil
+		}
 	}
+	return 8, nil
+}
 
-	// Loop all modules remaining.
-	for w32.Module32Next(snap, &me32) {
-		// Check this module.
-		if syscall.UTF16ToString(me32.SzModule[:]) == moduleName {
-			return uintptr(unsafe.Pointer(me32.ModBaseAddr)), nil
+// The platform specific code write function.
+// Makes the pages writable for the duration of the write, then flushes the instruction cache.
+// Pages are protected one by one, so each gets its own protection back.
+func (p *Process) platformWriteCode(addr uintptr, data []byte) error {
+	type page struct {
+		base uintptr
+		old  uint32
+	}
+	var pages []page
+	restore := func() error {
+		var err error
+		for _, pg := range pages {
+			if _, ok := w32.VirtualProtectEx(p.Handle, pg.base, pageSize, pg.old); !ok && err == nil {
+				err = fmt.Errorf("VirtualProtectEx 0x%X: %w", pg.base, windows.GetLastError())
+			}
+		}
+		return err
+	}
+
+	end := addr + uintptr(len(data))
+	for base := addr &^ (pageSize - 1); base < end; base += pageSize {
+		old, ok := w32.VirtualProtectEx(p.Handle, base, pageSize, w32.PAGE_EXECUTE_READWRITE)
+		if !ok {
+			err := fmt.Errorf("VirtualProtectEx 0x%X: %w", base, windows.GetLastError())
+			restore()
+			return err
 		}
+		pages = append(pages, page{base, old})
 	}
 
-	// Module couldn't be found.
-	return 0, errors.New("couldn't find module")
+	err := p.platformWrite(addr, &data)
+	if rerr := restore(); err == nil {
+		err = rerr
+	}
+	w32.FlushInstructionCache(p.Handle, addr, uintptr(len(data)))
+	return err
 }
 
 // The platform specific read function.
-func (p *Process) read(addr uintptr, ptr interface{}) error {
+func (p *Process) platformRead(addr uintptr, ptr interface{}) error {
 	v := reflect.ValueOf(ptr)
 	dataAddr := getDataAddr(v)
 	dataSize := getDataSize(v)
@@ -154,7 +237,7 @@ func (p *Process) read(addr uintptr, ptr interface{}) error {
 }
 
 // The platform specific write function.
-func (p *Process) write(addr uintptr, ptr interface{}) error {
+func (p *Process) platformWrite(addr uintptr, ptr interface{}) error {
 	v := reflect.ValueOf(ptr)
 	dataAddr := getDataAddr(v)
 	dataSize := getDataSize(v)
@@ -169,3 +252,54 @@ func (p *Process) write(addr uintptr, ptr interface{}) error {
 	}
 	return nil
 }
+
+// The platform specific regions function.
+// Walks the address space of the process with VirtualQueryEx, returning committed regions.
+func (p *Process) platformRegions() ([]Region, error) {
+	var regions []Region
+	var addr uintptr
+	for {
+		var mbi w32.MEMORY_BASIC_INFORMATION
+		if !w32.VirtualQueryEx(p.Handle, addr, &mbi) {
+			// VirtualQueryEx fails once addr is past the highest user-mode address.
+			break
+		}
+
+		if mbi.State == w32.MEM_COMMIT && mbi.Protect&(w32.PAGE_NOACCESS|w32.PAGE_GUARD) == 0 {
+			regions = append(regions, Region{
+				Base: mbi.BaseAddress,
+				Size: mbi.RegionSize,
+				Perm: permFromProtect(mbi.Protect),
+			})
+		}
+
+		next := mbi.BaseAddress + mbi.RegionSize
+		if next <= addr {
+			break
+		}
+		addr = next
+	}
+	return regions, nil
+}
+
+// permFromProtect converts win32 PAGE_* protection flags to a Perm.
+func permFromProtect(protect uint32) Perm {
+	switch protect & 0xFF {
+	case w32.PAGE_READONLY:
+		return PermRead
+	case w32.PAGE_READWRITE, w32.PAGE_WRITECOPY:
+		return PermRead | PermWrite
+	case w32.PAGE_EXECUTE:
+		return PermExec
+	case w32.PAGE_EXECUTE_READ:
+		return PermRead | PermExec
+	case w32.PAGE_EXECUTE_READWRITE, w32.PAGE_EXECUTE_WRITECOPY:
+		return PermRead | PermWrite | PermExec
+	}
+	return 0
+}
+
+// The platform specific attach function.
+func (p *Process) platformAttach() ([]Thread, func(), error) {
+	return nil, nil, errors.New("reading registers isn't supported on Windows")
+}
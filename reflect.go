@@ -38,3 +38,15 @@ func getDataSize(v reflect.Value) uintptr {
 		panic(fmt.Sprintf("dataSize: Unsupported type: %s", reflect.TypeOf(v).String()))
 	}
 }
+
+// dataBytes returns a []byte aliasing the memory of the value pointed to by ptr.
+func dataBytes(ptr interface{}) []byte {
+	v := reflect.ValueOf(ptr)
+
+	var b []byte
+	sh := (*reflect.SliceHeader)(unsafe.Pointer(&b))
+	sh.Data = getDataAddr(v)
+	sh.Len = int(getDataSize(v))
+	sh.Cap = sh.Len
+	return b
+}
@@ -0,0 +1,49 @@
+package kiwi
+
+// Perm is a set of memory protection flags.
+type Perm uint8
+
+// Memory protection flags.
+const (
+	PermRead Perm = 1 << iota
+	PermWrite
+	PermExec
+)
+
+// String returns the permissions in the "rwx" form used by /proc/<pid>/maps.
+func (p Perm) String() string {
+	s := []byte("---")
+	if p&PermRead != 0 {
+		s[0] = 'r'
+	}
+	if p&PermWrite != 0 {
+		s[1] = 'w'
+	}
+	if p&PermExec != 0 {
+		s[2] = 'x'
+	}
+	return string(s)
+}
+
+// Region is a contiguous range of mapped memory with the same protection.
+type Region struct {
+	Base uintptr
+	Size uintptr
+	Perm Perm
+
+	// Path is the file mapped into the region, if any.
+	Path string
+
+	// Offset is the offset into Path the region is mapped from.
+	Offset uint64
+}
+
+// End returns the address one past the end of the region.
+func (r Region) End() uintptr {
+	return r.Base + r.Size
+}
+
+// Contains reports whether addr is inside the region.
+func (r Region) Contains(addr uintptr) bool {
+	return addr >= r.Base && addr-r.Base < r.Size
+}
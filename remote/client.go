@@ -0,0 +1,377 @@
+package remote
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Andoryuuta/kiwi"
+)
+
+// Options configures a connection to an agent.
+type Options struct {
+	// Token is the agent's token.
+	Token string
+
+	// TLS, if not nil, makes the connection use TLS with the config.
+	TLS *tls.Config
+
+	// Timeout is the timeout for connecting. Zero means no timeout.
+	Timeout time.Duration
+}
+
+// Client is a connection to an agent. It's safe for concurrent use, and concurrent
+// requests are pipelined over the connection.
+type Client struct {
+	conn net.Conn
+
+	wmu sync.Mutex // Guards w.
+	w   *bufio.Writer
+
+	mu      sync.Mutex // Guards the fields below.
+	nextID  uint32
+	pending map[uint32]chan frame
+	err     error // Set once the connection fails.
+}
+
+// Dial connects to the agent at addr.
+func Dial(addr string, opts *Options) (*Client, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	var conn net.Conn
+	var err error
+	if opts.TLS != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, opts.TLS)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := NewClient(conn, opts.Token)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewClient returns a client over an established connection, authenticating with the token.
+func NewClient(conn net.Conn, token string) (*Client, error) {
+	c := &Client{
+		conn:    conn,
+		w:       bufio.NewWriter(conn),
+		pending: make(map[uint32]chan frame),
+	}
+	go c.readLoop()
+
+	var e encoder
+	e.uint32(protocolVersion)
+	e.string(token)
+	if _, err := c.call(opHello, e.b); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// readLoop delivers responses to the calls waiting for them, until the connection fails.
+func (c *Client) readLoop() {
+	r := bufio.NewReader(c.conn)
+	for {
+		f, err := readFrame(r, maxFrame)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[f.id]
+		delete(c.pending, f.id)
+		c.mu.Unlock()
+		if ok {
+			ch <- f
+		}
+	}
+}
+
+// fail fails all pending and future calls with err.
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = fmt.Errorf("connection to agent: %w", err)
+	}
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+}
+
+// call sends a request and waits for its response, returning a decoder over the response body.
+func (c *Client) call(op uint8, body []byte) (*decoder, error) {
+	ch := make(chan frame, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	c.wmu.Lock()
+	err := writeFrame(c.w, frame{id: id, op: op, body: body})
+	c.wmu.Unlock()
+	if err != nil {
+		c.conn.Close()
+		c.fail(err)
+	}
+
+	f, ok := <-ch
+	if !ok {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return nil, c.err
+	}
+	d := &decoder{b: f.body}
+	if f.op != statusOK {
+		if err := d.error(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("agent returned an unknown error")
+	}
+	return d, nil
+}
+
+// Close closes the connection, and with it every process opened through it.
+func (c *Client) Close() error {
+	err := c.conn.Close()
+	c.fail(errors.New("closed"))
+	return err
+}
+
+// ListProcesses returns the processes running on the agent's machine.
+func (c *Client) ListProcesses() ([]kiwi.ProcessInfo, error) {
+	d, err := c.call(opList, nil)
+	if err != nil {
+		return nil, err
+	}
+	procs := decodeProcesses(d)
+	return procs, d.err
+}
+
+// Open opens the process with the given PID on the agent's machine.
+func (c *Client) Open(pid int) (*Target, error) {
+	return c.open(pid, "")
+}
+
+// OpenByName opens the process with the given file name on the agent's machine.
+func (c *Client) OpenByName(name string) (*Target, error) {
+	return c.open(0, name)
+}
+
+func (c *Client) open(pid int, name string) (*Target, error) {
+	var e encoder
+	e.uint32(uint32(pid))
+	e.string(name)
+	d, err := c.call(opOpen, e.b)
+	if err != nil {
+		return nil, err
+	}
+	t := &Target{c: c, handle: d.uint32(), pid: int(d.uint32()), ptrSize: int(d.uint8())}
+	return t, d.err
+}
+
+// Target is a process opened through an agent. It implements kiwi.Backend,
+// along with kiwi.ModuleLister, kiwi.PointerSizer and kiwi.CodeWriter.
+type Target struct {
+	c       *Client
+	handle  uint32
+	pid     int
+	ptrSize int
+}
+
+// Process returns a kiwi.Process which accesses the target.
+func (t *Target) Process() *kiwi.Process {
+	p := kiwi.NewProcess(t)
+	p.PID = uint64(t.pid)
+	return p
+}
+
+// PID returns the PID of the process.
+func (t *Target) PID() int {
+	return t.pid
+}
+
+// request starts a request body with the target's handle.
+func (t *Target) request() *encoder {
+	e := &encoder{}
+	e.uint32(t.handle)
+	return e
+}
+
+// ReadAt reads memory at addr into b. Reads larger than MaxRead are split into several requests.
+func (t *Target) ReadAt(b []byte, addr uintptr) (int, error) {
+	n := 0
+	for n < len(b) {
+		size := len(b) - n
+		if size > MaxRead {
+			size = MaxRead
+		}
+		e := t.request()
+		e.uint64(uint64(addr) + uint64(n))
+		e.uint32(uint32(size))
+		d, err := t.c.call(opRead, e.b)
+		if err != nil {
+			return n, err
+		}
+		data, rerr := d.bytes(), d.error()
+		if d.err != nil {
+			return n, d.err
+		}
+		n += copy(b[n:n+size], data)
+		if rerr != nil {
+			return n, rerr
+		}
+	}
+	return n, nil
+}
+
+// WriteAt writes b to memory at addr.
+func (t *Target) WriteAt(b []byte, addr uintptr) (int, error) {
+	n := 0
+	for n < len(b) {
+		size := len(b) - n
+		if size > MaxRead {
+			size = MaxRead
+		}
+		e := t.request()
+		e.uint64(uint64(addr) + uint64(n))
+		e.bytes(b[n : n+size])
+		d, err := t.c.call(opWrite, e.b)
+		if err != nil {
+			return n, err
+		}
+		written, werr := int(d.uint32()), d.error()
+		if d.err != nil {
+			return n, d.err
+		}
+		n += written
+		if werr != nil {
+			return n, werr
+		}
+	}
+	return n, nil
+}
+
+// WriteCode writes b to memory at addr with kiwi's Process.WriteCode on the agent's machine.
+func (t *Target) WriteCode(b []byte, addr uintptr) error {
+	e := t.request()
+	e.uint64(uint64(addr))
+	e.bytes(b)
+	d, err := t.c.call(opWriteCode, e.b)
+	if err != nil {
+		return err
+	}
+	if err := d.error(); err != nil {
+		return err
+	}
+	return d.err
+}
+
+// Regions returns the memory regions of the process.
+func (t *Target) Regions() ([]kiwi.Region, error) {
+	d, err := t.c.call(opRegions, t.request().b)
+	if err != nil {
+		return nil, err
+	}
+	regions := decodeRegions(d)
+	return regions, d.err
+}
+
+// Modules returns the modules of the process.
+func (t *Target) Modules() ([]kiwi.Module, error) {
+	d, err := t.c.call(opModules, t.request().b)
+	if err != nil {
+		return nil, err
+	}
+	modules := decodeModules(d)
+	return modules, d.err
+}
+
+// PointerSize returns the pointer size of the process.
+func (t *Target) PointerSize() (int, error) {
+	return t.ptrSize, nil
+}
+
+// Close closes the process on the agent. The client stays connected.
+func (t *Target) Close() error {
+	_, err := t.c.call(opClose, t.request().b)
+	return err
+}
+
+// Read is one read of a batch.
+type Read struct {
+	Addr uintptr
+	Buf  []byte
+
+	// N and Err are set by ReadBatch to the number of bytes read and the error reading them, if any.
+	N   int
+	Err error
+}
+
+// ReadBatch makes all of the reads in one round trip, or as few as fit in MaxRead bytes each.
+// It's much faster than reading many small values one by one over a slow network.
+// The returned error is only for the connection failing; errors of each read are in their Err.
+func (t *Target) ReadBatch(reads []Read) error {
+	for start := 0; start < len(reads); {
+		end, total := start, 0
+		for end < len(reads) && (end == start || total+len(reads[end].Buf) <= MaxRead) {
+			total += len(reads[end].Buf)
+			end++
+		}
+		if err := t.readBatch(reads[start:end]); err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+func (t *Target) readBatch(reads []Read) error {
+	// A single read over the limit is split by ReadAt instead.
+	if len(reads) == 1 && len(reads[0].Buf) > MaxRead {
+		reads[0].N, reads[0].Err = t.ReadAt(reads[0].Buf, reads[0].Addr)
+		return nil
+	}
+
+	e := t.request()
+	e.uint32(uint32(len(reads)))
+	for _, r := range reads {
+		e.uint64(uint64(r.Addr))
+		e.uint32(uint32(len(r.Buf)))
+	}
+	d, err := t.c.call(opBatch, e.b)
+	if err != nil {
+		return err
+	}
+	if n := d.count(8); n != len(reads) && d.err == nil {
+		return fmt.Errorf("agent returned %d results for %d reads", n, len(reads))
+	}
+	for i := range reads {
+		data, rerr := d.bytes(), d.error()
+		reads[i].N = copy(reads[i].Buf, data)
+		reads[i].Err = rerr
+	}
+	return d.err
+}
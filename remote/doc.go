@@ -0,0 +1,15 @@
+// Package remote accesses processes on another machine through an agent.
+//
+// The agent, cmd/kiwi-agent or a Server in your own program, runs on the machine with the
+// processes. A Client connects to it over TCP, optionally with TLS, and opens processes as
+// Targets, which are kiwi.Backends, so all of kiwi's API works on them:
+//
+//	c, err := remote.Dial("testrig:7331", &remote.Options{Token: token})
+//	...
+//	t, err := c.OpenByName("game.exe")
+//	...
+//	p := t.Process()
+//	health, err := p.ReadFloat32(addr)
+//
+// Each read is a round trip, so reading many values is best done with Target.ReadBatch.
+package remote
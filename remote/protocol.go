@@ -0,0 +1,284 @@
+package remote
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Andoryuuta/kiwi"
+)
+
+// The protocol is a sequence of frames in both directions. Each frame is:
+//
+//	uint32 length of the rest of the frame
+//	uint32 request ID, echoed in the response
+//	uint8  op in requests, status in responses
+//	body
+//
+// All integers are big-endian. Byte slices and strings are a uint32 length followed by the bytes.
+// The first request of a connection must be opHello with the token, and the server closes
+// the connection if it's wrong. Responses are sent in the order of the requests.
+
+// protocolVersion is sent in opHello, and bumped on incompatible changes.
+const protocolVersion = 1
+
+// maxFrame is the largest frame accepted, to stop a bad peer making us allocate without limit.
+const maxFrame = 64 << 20
+
+// maxHelloFrame is the largest hello accepted. It's read before the client is authenticated,
+// so it's only big enough for the version and token.
+const maxHelloFrame = 4 << 10
+
+// MaxRead is the largest read which can be made in one request, or in total in one batch.
+const MaxRead = 16 << 20
+
+const (
+	opHello     = 1  // version uint32, token string
+	opList      = 2  // → count uint32, [pid uint32, name string]...
+	opOpen      = 3  // pid uint32, name string (used if pid is 0) → handle uint32, pid uint32, pointer size uint8
+	opClose     = 4  // handle uint32
+	opRead      = 5  // handle uint32, addr uint64, size uint32 → data bytes, error string
+	opWrite     = 6  // handle uint32, addr uint64, data bytes → n uint32, error string
+	opRegions   = 7  // handle uint32 → count uint32, [base uint64, size uint64, perm uint8, path string, offset uint64]...
+	opModules   = 8  // handle uint32 → count uint32, [name string, path string, base uint64, size uint64]...
+	opBatch     = 9  // handle uint32, count uint32, [addr uint64, size uint32]... → count uint32, [data bytes, error string]...
+	opWriteCode = 10 // handle uint32, addr uint64, data bytes → error string
+)
+
+const (
+	statusOK    = 0 // The body is the op's result.
+	statusError = 1 // The body is an error string.
+)
+
+// frame is a decoded request or response.
+type frame struct {
+	id   uint32
+	op   uint8 // Or status, for responses.
+	body []byte
+}
+
+// writeFrame writes a frame to w.
+func writeFrame(w *bufio.Writer, f frame) error {
+	var hdr [9]byte
+	binary.BigEndian.PutUint32(hdr[0:], uint32(5+len(f.body)))
+	binary.BigEndian.PutUint32(hdr[4:], f.id)
+	hdr[8] = f.op
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(f.body); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// readFrame reads a frame of at most max bytes from r.
+func readFrame(r io.Reader, max uint32) (frame, error) {
+	var hdr [9]byte
+	if _, err := io.ReadFull(r, hdr[:4]); err != nil {
+		return frame{}, err
+	}
+	size := binary.BigEndian.Uint32(hdr[0:])
+	if size < 5 || size > max {
+		return frame{}, fmt.Errorf("bad frame size %d", size)
+	}
+	if _, err := io.ReadFull(r, hdr[4:]); err != nil {
+		return frame{}, err
+	}
+	f := frame{id: binary.BigEndian.Uint32(hdr[4:]), op: hdr[8], body: make([]byte, size-5)}
+	if _, err := io.ReadFull(r, f.body); err != nil {
+		return frame{}, err
+	}
+	return f, nil
+}
+
+// encoder builds a frame body.
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) uint8(v uint8) {
+	e.b = append(e.b, v)
+}
+
+func (e *encoder) uint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	e.b = append(e.b, b[:]...)
+}
+
+func (e *encoder) uint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	e.b = append(e.b, b[:]...)
+}
+
+func (e *encoder) bytes(v []byte) {
+	e.uint32(uint32(len(v)))
+	e.b = append(e.b, v...)
+}
+
+func (e *encoder) string(v string) {
+	e.uint32(uint32(len(v)))
+	e.b = append(e.b, v...)
+}
+
+// error encodes err as a string, empty for nil.
+func (e *encoder) error(err error) {
+	if err == nil {
+		e.string("")
+		return
+	}
+	e.string(err.Error())
+}
+
+// errShortBody is the error of a decoder which ran out of bytes.
+var errShortBody = errors.New("frame body too short")
+
+// decoder reads a frame body. Once it runs out of bytes, all methods return zero and err is set.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil || n > len(d.b) {
+		d.err = errShortBody
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *decoder) uint8() uint8 {
+	if b := d.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint64() uint64 {
+	if b := d.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) bytes() []byte {
+	// The length is checked before it's converted, as it may not fit in an int.
+	n := d.uint32()
+	if d.err == nil && uint64(n) > uint64(len(d.b)) {
+		d.err = errShortBody
+	}
+	if d.err != nil {
+		return nil
+	}
+	return d.next(int(n))
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+// error decodes an error string, nil if empty.
+func (d *decoder) error() error {
+	if s := d.string(); s != "" {
+		return &Error{Msg: s}
+	}
+	return nil
+}
+
+// count reads a count of items which each take at least min bytes, checking it fits in the body.
+func (d *decoder) count(min int) int {
+	n := d.uint32()
+	if d.err == nil && uint64(n)*uint64(min) > uint64(len(d.b)) {
+		d.err = errShortBody
+	}
+	if d.err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+// Error is an error returned by the agent.
+type Error struct {
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return "agent: " + e.Msg
+}
+
+func encodeRegions(e *encoder, regions []kiwi.Region) {
+	e.uint32(uint32(len(regions)))
+	for _, r := range regions {
+		e.uint64(uint64(r.Base))
+		e.uint64(uint64(r.Size))
+		e.uint8(uint8(r.Perm))
+		e.string(r.Path)
+		e.uint64(r.Offset)
+	}
+}
+
+func decodeRegions(d *decoder) []kiwi.Region {
+	regions := make([]kiwi.Region, d.count(29))
+	for i := range regions {
+		regions[i] = kiwi.Region{
+			Base:   uintptr(d.uint64()),
+			Size:   uintptr(d.uint64()),
+			Perm:   kiwi.Perm(d.uint8()),
+			Path:   d.string(),
+			Offset: d.uint64(),
+		}
+	}
+	return regions
+}
+
+func encodeModules(e *encoder, modules []kiwi.Module) {
+	e.uint32(uint32(len(modules)))
+	for _, m := range modules {
+		e.string(m.Name)
+		e.string(m.Path)
+		e.uint64(uint64(m.Base))
+		e.uint64(uint64(m.Size))
+	}
+}
+
+func decodeModules(d *decoder) []kiwi.Module {
+	modules := make([]kiwi.Module, d.count(24))
+	for i := range modules {
+		modules[i] = kiwi.Module{
+			Name: d.string(),
+			Path: d.string(),
+			Base: uintptr(d.uint64()),
+			Size: uintptr(d.uint64()),
+		}
+	}
+	return modules
+}
+
+func encodeProcesses(e *encoder, procs []kiwi.ProcessInfo) {
+	e.uint32(uint32(len(procs)))
+	for _, p := range procs {
+		e.uint32(uint32(p.PID))
+		e.string(p.Name)
+	}
+}
+
+func decodeProcesses(d *decoder) []kiwi.ProcessInfo {
+	procs := make([]kiwi.ProcessInfo, d.count(8))
+	for i := range procs {
+		procs[i] = kiwi.ProcessInfo{PID: int(d.uint32()), Name: d.string()}
+	}
+	return procs
+}
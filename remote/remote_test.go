@@ -0,0 +1,259 @@
+package remote
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Andoryuuta/kiwi"
+	"github.com/Andoryuuta/kiwi/kiwitest"
+)
+
+const (
+	testToken = "s3cret"
+	imageBase = 0x140000000
+	heapBase  = 0x20000000
+)
+
+// newFake returns a fake game process.
+func newFake() *kiwitest.Fake {
+	f := kiwitest.New()
+	f.SetPID(4242)
+	f.Map(imageBase, 0x2000, kiwi.PermRead|kiwi.PermWrite)
+	f.AddModule("game.exe", imageBase, 0x2000)
+	f.Map(heapBase, 0x1000, kiwi.PermRead|kiwi.PermWrite)
+	f.PutPointer(imageBase+0x1010, heapBase)
+	for i := uintptr(0); i < 16; i++ {
+		f.PutUint32(heapBase+i*4, uint32(i*10))
+	}
+	return f
+}
+
+// serve starts a server for f on loopback.
+func serve(t *testing.T, s *Server, f *kiwitest.Fake, config *tls.Config) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %s\n", err)
+	}
+	if config != nil {
+		l = tls.NewListener(l, config)
+	}
+
+	s.Open = func(pid int, name string) (*kiwi.Process, error) {
+		if pid != 4242 && name != "game.exe" {
+			return nil, errors.New("no such process")
+		}
+		return f.Process(), nil
+	}
+	s.List = func() ([]kiwi.ProcessInfo, error) {
+		return []kiwi.ProcessInfo{{PID: 1, Name: "init"}, {PID: 4242, Name: "game.exe"}}, nil
+	}
+	s.Logf = func(string, ...interface{}) {}
+	go s.Serve(l)
+	return l
+}
+
+func TestRemote(t *testing.T) {
+	f := newFake()
+	l := serve(t, &Server{Token: testToken}, f, nil)
+	defer l.Close()
+	c, err := Dial(l.Addr().String(), &Options{Token: testToken})
+	if err != nil {
+		t.Fatalf("Dial: %s\n", err)
+	}
+	defer c.Close()
+
+	procs, err := c.ListProcesses()
+	if err != nil || len(procs) != 2 || procs[1].PID != 4242 || procs[1].Name != "game.exe" {
+		t.Errorf("Unexpected processes %+v (%v)\n", procs, err)
+	}
+	if _, err := c.Open(1); err == nil {
+		t.Errorf("Expected an error opening a missing process\n")
+	}
+
+	target, err := c.OpenByName("game.exe")
+	if err != nil {
+		t.Fatalf("OpenByName: %s\n", err)
+	}
+	p := target.Process()
+	defer p.Close()
+	if p.PID != 4242 {
+		t.Errorf("Expected PID 4242, got %d\n", p.PID)
+	}
+
+	addr, err := p.Eval("[game.exe+0x1010] + 0x8")
+	if err != nil || addr != heapBase+0x8 {
+		t.Fatalf("Expected 0x%X, got 0x%X (%v)\n", heapBase+0x8, addr, err)
+	}
+	if v, err := p.ReadUint32(addr); err != nil || v != 20 {
+		t.Errorf("Expected 20, got %d (%v)\n", v, err)
+	}
+	if err := p.WriteUint32(addr, 1337); err != nil {
+		t.Fatalf("WriteUint32: %s\n", err)
+	}
+	if v, err := p.ReadUint32(addr); err != nil || v != 1337 {
+		t.Errorf("Expected 1337, got %d (%v)\n", v, err)
+	}
+	if _, err := p.ReadUint32(heapBase + 0x1000); err == nil {
+		t.Errorf("Expected an error reading unmapped memory\n")
+	}
+
+	regions, err := p.Regions()
+	if err != nil || len(regions) != 2 || regions[1].Path != "game.exe" {
+		t.Errorf("Unexpected regions %+v (%v)\n", regions, err)
+	}
+
+	// Batched reads get every value in one round trip, and report errors per read.
+	reads := make([]Read, 17)
+	for i := range reads {
+		reads[i] = Read{Addr: heapBase + uintptr(i)*4, Buf: make([]byte, 4)}
+	}
+	reads[16].Addr = heapBase + 0x1000
+	before := f.Reads()
+	if err := target.ReadBatch(reads); err != nil {
+		t.Fatalf("ReadBatch: %s\n", err)
+	}
+	if reads[3].N != 4 || reads[3].Err != nil || reads[3].Buf[0] != 30 {
+		t.Errorf("Unexpected read %+v\n", reads[3])
+	}
+	if reads[16].N != 0 || reads[16].Err == nil {
+		t.Errorf("Expected the unmapped read to fail, got %+v\n", reads[16])
+	}
+	if n := f.Reads() - before; n != len(reads) {
+		t.Errorf("Expected %d reads, got %d\n", len(reads), n)
+	}
+}
+
+func TestRemoteAuth(t *testing.T) {
+	l := serve(t, &Server{Token: testToken, ReadOnly: true}, newFake(), nil)
+	defer l.Close()
+	addr := l.Addr().String()
+
+	if _, err := Dial(addr, &Options{Token: "wrong"}); err == nil {
+		t.Errorf("Expected an error with the wrong token\n")
+	}
+
+	c, err := Dial(addr, &Options{Token: testToken})
+	if err != nil {
+		t.Fatalf("Dial: %s\n", err)
+	}
+	defer c.Close()
+	target, err := c.Open(4242)
+	if err != nil {
+		t.Fatalf("Open: %s\n", err)
+	}
+	if err := target.Process().WriteUint8(heapBase, 1); err == nil {
+		t.Errorf("Expected an error writing to a read-only agent\n")
+	}
+}
+
+func TestRemoteTLS(t *testing.T) {
+	cert, pool := testCertificate(t)
+	l := serve(t, &Server{Token: testToken}, newFake(), &tls.Config{Certificates: []tls.Certificate{cert}})
+	defer l.Close()
+	addr := l.Addr().String()
+
+	c, err := Dial(addr, &Options{Token: testToken, TLS: &tls.Config{RootCAs: pool, ServerName: "kiwi-agent"}})
+	if err != nil {
+		t.Fatalf("Dial: %s\n", err)
+	}
+	defer c.Close()
+	target, err := c.Open(4242)
+	if err != nil {
+		t.Fatalf("Open: %s\n", err)
+	}
+	if v, err := target.Process().ReadUint32(heapBase + 4); err != nil || v != 10 {
+		t.Errorf("Expected 10, got %d (%v)\n", v, err)
+	}
+}
+
+func TestRemoteHelloLimits(t *testing.T) {
+	defer func(d time.Duration) { helloTimeout = d }(helloTimeout)
+	helloTimeout = 100 * time.Millisecond
+	l := serve(t, &Server{Token: testToken}, newFake(), nil)
+	defer l.Close()
+
+	// The server should close connections with an oversized hello, or which don't send one in time.
+	tests := []struct {
+		name string
+		send []byte
+	}{
+		{"oversized hello", []byte{0, 0x10, 0, 0}},
+		{"no hello", nil},
+	}
+	for _, tst := range tests {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial: %s\n", err)
+		}
+		conn.Write(tst.send)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var b [1]byte
+		if _, err := conn.Read(b[:]); err != io.EOF {
+			t.Errorf("%s: expected the server to close the connection, got %v\n", tst.name, err)
+		}
+		conn.Close()
+	}
+}
+
+// testCertificate returns a self-signed certificate for "kiwi-agent", and a pool trusting it.
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "kiwi-agent"},
+		DNSNames:     []string{"kiwi-agent"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func TestDecoderBounds(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+		read func(d *decoder)
+	}{
+		{"huge bytes", []byte{0xFF, 0xFF, 0xFF, 0xFF, 1, 2}, func(d *decoder) { d.bytes() }},
+		{"short bytes", []byte{0, 0, 0, 3, 1, 2}, func(d *decoder) { d.bytes() }},
+		{"huge count", []byte{0xFF, 0xFF, 0xFF, 0xFF, 1, 2}, func(d *decoder) { d.count(1 << 30) }},
+		{"short count", []byte{0, 0, 0, 2, 1, 2, 3}, func(d *decoder) { d.count(4) }},
+	}
+	for _, tst := range tests {
+		d := &decoder{b: tst.body}
+		tst.read(d)
+		if d.err != errShortBody {
+			t.Errorf("%s: expected errShortBody, got %v\n", tst.name, d.err)
+		}
+	}
+
+	d := &decoder{b: []byte{0, 0, 0, 2, 'o', 'k', 0, 0, 0, 1, 9}}
+	if s, n := d.string(), d.count(1); d.err != nil || s != "ok" || n != 1 {
+		t.Errorf("Expected \"ok\" and 1, got %q and %d (%v)\n", s, n, d.err)
+	}
+}
@@ -0,0 +1,396 @@
+package remote
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/Andoryuuta/kiwi"
+)
+
+// Server serves the processes of this machine to Clients.
+type Server struct {
+	// Token is the token clients must send. If empty, any client is accepted,
+	// which should only be done on a trusted network.
+	Token string
+
+	// ReadOnly makes the server reject writes.
+	ReadOnly bool
+
+	// Open opens a process by PID, or by file name if pid is 0.
+	// If nil, kiwi.GetProcessByPID and kiwi.GetProcessByFileName are used.
+	Open func(pid int, name string) (*kiwi.Process, error)
+
+	// List lists the processes of the machine. If nil, kiwi.ListProcesses is used.
+	List func() ([]kiwi.ProcessInfo, error)
+
+	// Logf logs connections and their errors. If nil, the log package is used.
+	Logf func(format string, args ...interface{})
+
+	// Authorize, if not nil, is called before each operation is done, and the operation
+	// fails with its error if it returns one. Processes are opened before "open" is authorized,
+	// so that its PID is known, and closed again if it isn't allowed.
+	Authorize func(conn net.Conn, op Op) error
+
+	// Audit, if not nil, is called after each operation with its error, if any.
+	Audit func(conn net.Conn, op Op, err error)
+}
+
+// Op describes an operation requested by a client, for Server.Authorize and Server.Audit.
+type Op struct {
+	// Kind is "list", "open", "close", "read", "batch-read", "write", "write-code", "regions" or "modules".
+	Kind string
+
+	PID  int    // The process, for all kinds except "list".
+	Name string // The file name a process was opened by, for "open" without a PID.
+
+	// Addr and Size are the memory accessed by reads and writes.
+	// For "batch-read", Addr is the first read's address and Size is the total size.
+	Addr  uintptr
+	Size  int
+	Count int // The number of reads, for "batch-read".
+}
+
+// Serve accepts connections on l and serves each of them in a goroutine.
+// Wrap l with tls.NewListener to serve over TLS.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := s.ServeConn(conn); err != nil {
+				s.logf("%s: %s", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// session is the state of a connection.
+type session struct {
+	s          *Server
+	conn       net.Conn
+	procs      map[uint32]*kiwi.Process
+	backends   map[uint32]kiwi.Backend
+	nextHandle uint32
+}
+
+// helloTimeout is how long a client has to send its hello after connecting.
+var helloTimeout = 10 * time.Second
+
+// ServeConn serves a single connection until it's closed, and then closes the processes it opened.
+func (s *Server) ServeConn(conn net.Conn) error {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+
+	// Clients which aren't authenticated yet can only send a small hello, and have to send it soon.
+	conn.SetReadDeadline(time.Now().Add(helloTimeout))
+	hello, err := readFrame(r, maxHelloFrame)
+	if err != nil {
+		return err
+	}
+	if err := s.hello(hello); err != nil {
+		var e encoder
+		e.error(err)
+		writeFrame(w, frame{id: hello.id, op: statusError, body: e.b})
+		return err
+	}
+	conn.SetReadDeadline(time.Time{})
+	if err := writeFrame(w, frame{id: hello.id, op: statusOK}); err != nil {
+		return err
+	}
+	s.logf("%s: connected", conn.RemoteAddr())
+
+	ss := &session{
+		s:        s,
+		conn:     conn,
+		procs:    make(map[uint32]*kiwi.Process),
+		backends: make(map[uint32]kiwi.Backend),
+	}
+	defer ss.close()
+
+	for {
+		req, err := readFrame(r, maxFrame)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		resp := frame{id: req.id, op: statusOK}
+		op, body, err := ss.handle(req)
+		if s.Audit != nil && op.Kind != "" {
+			s.Audit(conn, op, err)
+		}
+		if err != nil {
+			var e encoder
+			e.error(err)
+			resp.op, body = statusError, e.b
+		}
+		resp.body = body
+		if err := writeFrame(w, resp); err != nil {
+			return err
+		}
+	}
+}
+
+// hello checks the first request of a connection.
+func (s *Server) hello(f frame) error {
+	if f.op != opHello {
+		return errors.New("expected hello")
+	}
+	d := decoder{b: f.body}
+	version, token := d.uint32(), d.string()
+	if d.err != nil {
+		return d.err
+	}
+	if version != protocolVersion {
+		return fmt.Errorf("unsupported protocol version %d", version)
+	}
+	if s.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+		return errors.New("bad token")
+	}
+	return nil
+}
+
+func (ss *session) close() {
+	for _, p := range ss.procs {
+		p.Close()
+	}
+}
+
+// process decodes a handle and returns its process.
+func (ss *session) process(d *decoder) (uint32, *kiwi.Process, error) {
+	h := d.uint32()
+	if d.err != nil {
+		return 0, nil, d.err
+	}
+	p, ok := ss.procs[h]
+	if !ok {
+		return 0, nil, fmt.Errorf("bad handle %d", h)
+	}
+	return h, p, nil
+}
+
+// handle handles a request, returning the operation and the response body.
+// The operation's Kind is empty if the request couldn't be decoded.
+func (ss *session) handle(req frame) (Op, []byte, error) {
+	d := &decoder{b: req.body}
+	var e encoder
+	var op Op
+
+	switch req.op {
+	case opList:
+		op.Kind = "list"
+		if err := ss.authorize(op); err != nil {
+			return op, nil, err
+		}
+		list := kiwi.ListProcesses
+		if ss.s.List != nil {
+			list = ss.s.List
+		}
+		procs, err := list()
+		if err != nil {
+			return op, nil, err
+		}
+		encodeProcesses(&e, procs)
+
+	case opOpen:
+		pid, name := int(d.uint32()), d.string()
+		if d.err != nil {
+			return op, nil, d.err
+		}
+		op = Op{Kind: "open", PID: pid, Name: name}
+		p, err := ss.s.open(pid, name)
+		if err != nil {
+			return op, nil, err
+		}
+		op.PID = int(p.PID)
+		if err := ss.authorize(op); err != nil {
+			p.Close()
+			return op, nil, err
+		}
+		size, err := p.PointerSize()
+		if err != nil {
+			p.Close()
+			return op, nil, err
+		}
+		ss.nextHandle++
+		ss.procs[ss.nextHandle] = p
+		ss.backends[ss.nextHandle] = p.Backend()
+		e.uint32(ss.nextHandle)
+		e.uint32(uint32(p.PID))
+		e.uint8(uint8(size))
+
+	case opClose:
+		h, p, err := ss.process(d)
+		if err != nil {
+			return op, nil, err
+		}
+		op = Op{Kind: "close", PID: int(p.PID)}
+		delete(ss.procs, h)
+		delete(ss.backends, h)
+		return op, nil, p.Close()
+
+	case opRead:
+		h, p, err := ss.process(d)
+		addr, size := d.uint64(), d.uint32()
+		if err := firstErr(err, d.err); err != nil {
+			return op, nil, err
+		}
+		op = Op{Kind: "read", PID: int(p.PID), Addr: uintptr(addr), Size: int(size)}
+		if size > MaxRead {
+			return op, nil, fmt.Errorf("read of %d bytes is over the limit of %d", size, MaxRead)
+		}
+		if err := ss.authorize(op); err != nil {
+			return op, nil, err
+		}
+		buf := make([]byte, size)
+		n, err := ss.backends[h].ReadAt(buf, uintptr(addr))
+		e.bytes(buf[:n])
+		e.error(err)
+
+	case opBatch:
+		h, p, err := ss.process(d)
+		count := d.count(12)
+		if err := firstErr(err, d.err); err != nil {
+			return op, nil, err
+		}
+		type read struct {
+			addr uintptr
+			size uint32
+		}
+		reads := make([]read, count)
+		total, largest := 0, uint32(0)
+		for i := range reads {
+			reads[i] = read{uintptr(d.uint64()), d.uint32()}
+			total += int(reads[i].size)
+			if reads[i].size > largest {
+				largest = reads[i].size
+			}
+		}
+		op = Op{Kind: "batch-read", PID: int(p.PID), Size: total, Count: count}
+		if count > 0 {
+			op.Addr = reads[0].addr
+		}
+		if total > MaxRead {
+			return op, nil, fmt.Errorf("batch of %d bytes is over the limit of %d", total, MaxRead)
+		}
+		if err := ss.authorize(op); err != nil {
+			return op, nil, err
+		}
+		e.uint32(uint32(count))
+		buf := make([]byte, largest)
+		for _, r := range reads {
+			n, err := ss.backends[h].ReadAt(buf[:r.size], r.addr)
+			e.bytes(buf[:n])
+			e.error(err)
+		}
+
+	case opWrite, opWriteCode:
+		h, p, err := ss.process(d)
+		addr, data := uintptr(d.uint64()), d.bytes()
+		if err := firstErr(err, d.err); err != nil {
+			return op, nil, err
+		}
+		op = Op{Kind: "write", PID: int(p.PID), Addr: addr, Size: len(data)}
+		if req.op == opWriteCode {
+			op.Kind = "write-code"
+		}
+		if ss.s.ReadOnly {
+			return op, nil, errors.New("the agent is read-only")
+		}
+		if err := ss.authorize(op); err != nil {
+			return op, nil, err
+		}
+		if req.op == opWriteCode {
+			e.error(p.WriteCode(addr, data))
+			break
+		}
+		n, err := ss.backends[h].WriteAt(data, addr)
+		e.uint32(uint32(n))
+		e.error(err)
+
+	case opRegions, opModules:
+		_, p, err := ss.process(d)
+		if err != nil {
+			return op, nil, err
+		}
+		op = Op{Kind: "regions", PID: int(p.PID)}
+		if req.op == opModules {
+			op.Kind = "modules"
+		}
+		if err := ss.authorize(op); err != nil {
+			return op, nil, err
+		}
+		if req.op == opModules {
+			modules, err := p.Modules()
+			if err != nil {
+				return op, nil, err
+			}
+			encodeModules(&e, modules)
+			break
+		}
+		regions, err := p.Regions()
+		if err != nil {
+			return op, nil, err
+		}
+		encodeRegions(&e, regions)
+
+	default:
+		return op, nil, fmt.Errorf("unknown op %d", req.op)
+	}
+	return op, e.b, nil
+}
+
+// authorize checks an operation with the server's Authorize hook.
+func (ss *session) authorize(op Op) error {
+	if ss.s.Authorize == nil {
+		return nil
+	}
+	return ss.s.Authorize(ss.conn, op)
+}
+
+// open opens a process for a client.
+func (s *Server) open(pid int, name string) (*kiwi.Process, error) {
+	if s.Open != nil {
+		return s.Open(pid, name)
+	}
+
+	var p kiwi.Process
+	var err error
+	if pid != 0 {
+		p, err = kiwi.GetProcessByPID(pid)
+	} else {
+		p, err = kiwi.GetProcessByFileName(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func firstErr(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package kiwi
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+)
+
+// scanChunkSize is the amount of memory read at once while scanning.
+const scanChunkSize = 1 << 20
+
+// scanRegions calls fn with the contents of each region, read in chunks of up to scanChunkSize bytes.
+//
+// Consecutive chunks of a region overlap by overlap bytes, so that matches spanning a chunk
+// boundary aren't missed. Pages which can't be read are skipped. Scanning stops if fn returns false.
+func (p *Process) scanRegions(regions []Region, overlap int, fn func(addr uintptr, data []byte) bool) {
+	p.scanChunks(regions, overlap, func(addr uintptr, data []byte, final bool) bool {
+		return fn(addr, data)
+	})
+}
+
+// scanChunks is like scanRegions, but also tells fn whether a chunk is the final one of a run of
+// readable memory. Anything in the last overlap bytes of a chunk which isn't final is also
+// at the start of the next chunk.
+func (p *Process) scanChunks(regions []Region, overlap int, fn func(addr uintptr, data []byte, final bool) bool) {
+	buf := make([]byte, scanChunkSize)
+	for _, r := range coalesce(regions) {
+		pos := r.Base
+		for pos < r.End() {
+			n := uintptr(len(buf))
+			if r.End()-pos < n {
+				n = r.End() - pos
+			}
+
+			got, err := p.readPartial(pos, buf[:n])
+			final := err != nil || pos+n >= r.End() || int(n) <= overlap
+			if got > 0 && !fn(pos, buf[:got], final) {
+				return
+			}
+			if err != nil {
+				// Skip over the page that failed.
+				pos = (pos + uintptr(got) + pageSize) &^ (pageSize - 1)
+				continue
+			}
+
+			if final {
+				pos += n
+			} else {
+				pos += n - uintptr(overlap)
+			}
+		}
+	}
+}
+
+// coalesce merges adjacent regions, so that scans can match across region boundaries.
+func coalesce(regions []Region) []Region {
+	var merged []Region
+	for _, r := range regions {
+		if n := len(merged); n > 0 && merged[n-1].End() == r.Base {
+			merged[n-1].Size += r.Size
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// readableRegions returns the regions of the process which can be read.
+func (p *Process) readableRegions() ([]Region, error) {
+	regions, err := p.Regions()
+	if err != nil {
+		return nil, err
+	}
+
+	var readable []Region
+	for _, r := range regions {
+		if r.Perm&PermRead != 0 {
+			readable = append(readable, r)
+		}
+	}
+	return readable, nil
+}
+
+// FindBytes returns the addresses of every occurrence of pattern in the readable memory of the process.
+func (p *Process) FindBytes(pattern []byte) ([]uintptr, error) {
+	if len(pattern) == 0 {
+		return nil, errors.New("empty pattern")
+	}
+
+	regions, err := p.readableRegions()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []uintptr
+	p.scanRegions(regions, len(pattern)-1, func(addr uintptr, data []byte) bool {
+		for off := 0; ; {
+			i := bytes.Index(data[off:], pattern)
+			if i == -1 {
+				break
+			}
+			matches = append(matches, addr+uintptr(off+i))
+			off += i + 1
+		}
+		return true
+	})
+	return matches, nil
+}
+
+// locator finds the region and module containing addresses, for the context of scan results.
+type locator struct {
+	regions []Region
+	modules []Module
+}
+
+func (p *Process) newLocator() (*locator, error) {
+	regions, err := p.Regions()
+	if err != nil {
+		return nil, err
+	}
+	modules, _ := p.Modules()
+	return &locator{regions: regions, modules: modules}, nil
+}
+
+// locate returns the region containing addr, and the name of the module containing it if any.
+func (l *locator) locate(addr uintptr) (Region, string) {
+	r, _ := regionAt(l.regions, addr)
+	for _, m := range l.modules {
+		if m.Contains(addr) {
+			return r, m.Name
+		}
+	}
+	return r, ""
+}
+
+// regionAt returns the region containing addr from regions sorted by address.
+func regionAt(regions []Region, addr uintptr) (Region, bool) {
+	i := sort.Search(len(regions), func(i int) bool {
+		return regions[i].End() > addr
+	})
+	if i < len(regions) && regions[i].Contains(addr) {
+		return regions[i], true
+	}
+	return Region{}, false
+}
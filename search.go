@@ -0,0 +1,265 @@
+package kiwi
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+)
+
+// maxRegexpMatch is the longest regular expression match which is found across a chunk boundary.
+// Longer matches may be cut short.
+const maxRegexpMatch = 4096
+
+// maxPatternKey is the longest run of bytes of a pattern used to find it in a PatternSet.
+const maxPatternKey = 16
+
+// Match is a match found in memory by SearchRegexp or FindPatterns.
+type Match struct {
+	Addr    uintptr
+	Data    []byte // The matched bytes.
+	Pattern int    // Index of the matching pattern in the PatternSet.
+
+	Region Region
+	Module string // Empty if the match isn't inside of a module.
+}
+
+// latin1Text holds memory converted to UTF-8 text, with each byte as a Latin-1 character,
+// so that regular expressions can match any byte value.
+type latin1Text struct {
+	text []byte
+	offs []int32 // Offset in memory of each byte of text, with the end of memory appended.
+}
+
+func (t *latin1Text) convert(data []byte) {
+	t.text, t.offs = t.text[:0], t.offs[:0]
+	for i, c := range data {
+		if c < utf8.RuneSelf {
+			t.text = append(t.text, c)
+			t.offs = append(t.offs, int32(i))
+			continue
+		}
+		t.text = append(t.text, 0xC0|c>>6, 0x80|c&0x3F)
+		t.offs = append(t.offs, int32(i), int32(i))
+	}
+	t.offs = append(t.offs, int32(len(data)))
+}
+
+// SearchRegexp returns the matches of a regular expression over the raw bytes of the memory
+// selected by opts, which may be nil. Matches are returned sorted by address and don't overlap.
+//
+// Each byte of memory is matched as the character with the same value, so \xFF matches the
+// byte 0xFF. Use the s flag, as in (?s), for . to match newlines.
+// Matches longer than 4KB may be cut short where they cross a boundary between reads.
+func (p *Process) SearchRegexp(re *regexp.Regexp, opts *ScanOptions) ([]Match, error) {
+	if opts == nil {
+		opts = &ScanOptions{}
+	}
+	targets, err := p.scanTargets(opts)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := p.newLocator()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []Match
+	var t latin1Text
+	var lastEnd uintptr
+	p.scanChunks(targets, maxRegexpMatch, func(addr uintptr, data []byte, final bool) bool {
+		// Matches starting in the overlap are found again in the next chunk.
+		limit := len(data)
+		if !final {
+			limit -= maxRegexpMatch
+		}
+
+		t.convert(data)
+		for _, m := range re.FindAllIndex(t.text, -1) {
+			start, end := int(t.offs[m[0]]), int(t.offs[m[1]])
+			if start >= limit {
+				break
+			}
+			if addr+uintptr(start) < lastEnd {
+				continue
+			}
+
+			match := Match{Addr: addr + uintptr(start), Data: append([]byte(nil), data[start:end]...)}
+			match.Region, match.Module = loc.locate(match.Addr)
+			matches = append(matches, match)
+			lastEnd = addr + uintptr(end)
+			if opts.Limit != 0 && len(matches) >= opts.Limit {
+				return false
+			}
+		}
+		return true
+	})
+	return matches, nil
+}
+
+// PatternSet is a set of patterns which are searched for together, in a single pass over memory.
+//
+// Each pattern is found by its longest run of fully specified bytes with the Aho-Corasick
+// algorithm, and then the whole pattern is checked.
+type PatternSet struct {
+	patterns []*Pattern
+	keyOff   []int // Offset of the key of each pattern.
+	keyLen   []int
+	maxLen   int
+
+	next [][256]int32 // Transitions between states for each byte.
+	out  [][]int32    // The patterns whose keys end at each state.
+}
+
+// NewPatternSet returns a set of patterns to be searched for with FindPatterns.
+// Each pattern must have at least one fully specified byte.
+func NewPatternSet(patterns ...*Pattern) (*PatternSet, error) {
+	s := &PatternSet{
+		patterns: patterns,
+		keyOff:   make([]int, len(patterns)),
+		keyLen:   make([]int, len(patterns)),
+		next:     make([][256]int32, 1),
+		out:      make([][]int32, 1),
+	}
+
+	// Build a trie of the keys.
+	for i, pat := range patterns {
+		off, n := longestRun(pat.Mask)
+		if n == 0 {
+			return nil, fmt.Errorf("pattern %d (%s) has no fully specified bytes", i, pat)
+		}
+		if n > maxPatternKey {
+			n = maxPatternKey
+		}
+		s.keyOff[i], s.keyLen[i] = off, n
+		if pat.Len() > s.maxLen {
+			s.maxLen = pat.Len()
+		}
+
+		state := int32(0)
+		for _, c := range pat.Bytes[off : off+n] {
+			if s.next[state][c] == 0 {
+				s.next = append(s.next, [256]int32{})
+				s.out = append(s.out, nil)
+				s.next[state][c] = int32(len(s.next) - 1)
+			}
+			state = s.next[state][c]
+		}
+		s.out[state] = append(s.out[state], int32(i))
+	}
+
+	// Add the failure transitions breadth first, so that each state's failure state is complete
+	// before it's used.
+	fail := make([]int32, len(s.next))
+	var queue []int32
+	for c := range s.next[0] {
+		if t := s.next[0][c]; t != 0 {
+			queue = append(queue, t)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		s.out[state] = append(s.out[state], s.out[fail[state]]...)
+		for c := range s.next[state] {
+			t := s.next[state][c]
+			if t == 0 {
+				s.next[state][c] = s.next[fail[state]][c]
+				continue
+			}
+			fail[t] = s.next[fail[state]][c]
+			queue = append(queue, t)
+		}
+	}
+	return s, nil
+}
+
+// longestRun returns the offset and length of the first longest run of fully specified bytes in a mask.
+func longestRun(mask []byte) (off, n int) {
+	for i := 0; i < len(mask); {
+		if mask[i] != 0xFF {
+			i++
+			continue
+		}
+		j := i
+		for j < len(mask) && mask[j] == 0xFF {
+			j++
+		}
+		if j-i > n {
+			off, n = i, j-i
+		}
+		i = j
+	}
+	return off, n
+}
+
+// Len returns the number of patterns in the set.
+func (s *PatternSet) Len() int {
+	return len(s.patterns)
+}
+
+// Pattern returns the i'th pattern of the set.
+func (s *PatternSet) Pattern(i int) *Pattern {
+	return s.patterns[i]
+}
+
+// FindPatterns returns the matches of every pattern in the set in the memory selected by opts,
+// which may be nil. Matches are returned sorted by address, then by pattern.
+func (p *Process) FindPatterns(set *PatternSet, opts *ScanOptions) ([]Match, error) {
+	if opts == nil {
+		opts = &ScanOptions{}
+	}
+	targets, err := p.scanTargets(opts)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := p.newLocator()
+	if err != nil {
+		return nil, err
+	}
+	if set.Len() == 0 {
+		return nil, nil
+	}
+
+	var matches []Match
+	overlap := set.maxLen - 1
+	p.scanChunks(targets, overlap, func(addr uintptr, data []byte, final bool) bool {
+		// Matches starting in the overlap are found again in the next chunk.
+		limit := len(data)
+		if !final {
+			limit -= overlap
+		}
+
+		state := int32(0)
+		for i, c := range data {
+			state = set.next[state][c]
+			for _, pi := range set.out[state] {
+				pat := set.patterns[pi]
+				start := i + 1 - set.keyLen[pi] - set.keyOff[pi]
+				if start < 0 || start >= limit || !pat.Match(data[start:]) {
+					continue
+				}
+
+				match := Match{
+					Addr:    addr + uintptr(start),
+					Data:    append([]byte(nil), data[start:start+pat.Len()]...),
+					Pattern: int(pi),
+				}
+				match.Region, match.Module = loc.locate(match.Addr)
+				matches = append(matches, match)
+				if opts.Limit != 0 && len(matches) >= opts.Limit {
+					return false
+				}
+			}
+		}
+		return true
+	})
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Addr != matches[j].Addr {
+			return matches[i].Addr < matches[j].Addr
+		}
+		return matches[i].Pattern < matches[j].Pattern
+	})
+	return matches, nil
+}
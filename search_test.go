@@ -0,0 +1,102 @@
+package kiwi
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"unsafe"
+)
+
+func TestSearchRegexp(t *testing.T) {
+	p, err := GetProcessByFileName(currentProcessName)
+	if err != nil {
+		t.Fatalf("Error trying to open process \"%s\", Error: %s\n", currentProcessName, err.Error())
+	}
+
+	// One match at the start, and one crossing the boundary between the first two reads.
+	buf := make([]byte, 2*scanChunkSize)
+	first := []byte("kiwi\xFF\x80first")
+	second := []byte("kiwi\xFF\x80second")
+	copy(buf[16:], first)
+	copy(buf[scanChunkSize-8:], second)
+	heapSink = &buf
+	addr := uintptr(unsafe.Pointer(&buf[0]))
+
+	re := regexp.MustCompile(`kiwi\xFF\x80[a-z]+`)
+	matches, err := p.SearchRegexp(re, &ScanOptions{Start: addr, End: addr + uintptr(len(buf))})
+	if err != nil {
+		t.Fatalf("SearchRegexp: %s\n", err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("Expected 2 matches, got %+v\n", matches)
+	}
+	for i, want := range []struct {
+		off  int
+		data []byte
+	}{{16, first}, {scanChunkSize - 8, second}} {
+		m := matches[i]
+		if m.Addr != addr+uintptr(want.off) || !bytes.Equal(m.Data, want.data) {
+			t.Errorf("Match %d: expected %q at 0x%X, got %q at 0x%X\n", i, want.data, addr+uintptr(want.off), m.Data, m.Addr)
+		}
+		if !m.Region.Contains(m.Addr) {
+			t.Errorf("Match %d: region %+v doesn't contain 0x%X\n", i, m.Region, m.Addr)
+		}
+	}
+}
+
+func TestFindPatterns(t *testing.T) {
+	p, err := GetProcessByFileName(currentProcessName)
+	if err != nil {
+		t.Fatalf("Error trying to open process \"%s\", Error: %s\n", currentProcessName, err.Error())
+	}
+
+	set, err := NewPatternSet(
+		MustParsePattern("DE AD BE EF ?? 11 22 33 44"),
+		MustParsePattern("5A 5A"),
+		MustParsePattern("C3 ?? C3"),
+		MustParsePattern("AD BE EF"),
+	)
+	if err != nil {
+		t.Fatalf("NewPatternSet: %s\n", err)
+	}
+
+	// The first pattern crosses the boundary between the first two reads, and the second is in
+	// the overlap between them, so would be found twice if duplicates weren't skipped.
+	buf := make([]byte, 2*scanChunkSize)
+	copy(buf[100:], []byte{0xC3, 0x01, 0xC3})
+	copy(buf[scanChunkSize-7:], []byte{0x5A, 0x5A})
+	copy(buf[scanChunkSize-4:], []byte{0xDE, 0xAD, 0xBE, 0xEF, 0x00, 0x11, 0x22, 0x33, 0x44})
+	copy(buf[len(buf)-2:], []byte{0x5A, 0x5A})
+	heapSink = &buf
+	addr := uintptr(unsafe.Pointer(&buf[0]))
+
+	matches, err := p.FindPatterns(set, &ScanOptions{Start: addr, End: addr + uintptr(len(buf))})
+	if err != nil {
+		t.Fatalf("FindPatterns: %s\n", err)
+	}
+	wants := []struct {
+		off, pattern int
+	}{
+		{100, 2},
+		{scanChunkSize - 7, 1},
+		{scanChunkSize - 4, 0},
+		{scanChunkSize - 3, 3},
+		{len(buf) - 2, 1},
+	}
+	if len(matches) != len(wants) {
+		t.Fatalf("Expected %d matches, got %+v\n", len(wants), matches)
+	}
+	for i, want := range wants {
+		m := matches[i]
+		if m.Addr != addr+uintptr(want.off) || m.Pattern != want.pattern {
+			t.Errorf("Match %d: expected pattern %d at 0x%X, got pattern %d at 0x%X\n", i, want.pattern, addr+uintptr(want.off), m.Pattern, m.Addr)
+		}
+		if !set.Pattern(m.Pattern).Match(m.Data) {
+			t.Errorf("Match %d: data % X doesn't match pattern %s\n", i, m.Data, set.Pattern(m.Pattern))
+		}
+	}
+
+	if _, err := NewPatternSet(MustParsePattern("4? 8?")); err == nil {
+		t.Errorf("Expected an error for a pattern without fully specified bytes\n")
+	}
+}
@@ -0,0 +1,353 @@
+package kiwi
+
+import (
+	"encoding/binary"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// maxFoundStringSize is the size in bytes at which long runs of text are split into separate strings.
+const maxFoundStringSize = 64 << 10
+
+// StringEncoding is the encoding of a string found in memory.
+type StringEncoding int
+
+// String encodings.
+const (
+	EncodingASCII StringEncoding = iota
+	EncodingUTF8
+	EncodingUTF16LE
+	EncodingUTF16BE
+)
+
+func (e StringEncoding) String() string {
+	switch e {
+	case EncodingASCII:
+		return "ascii"
+	case EncodingUTF8:
+		return "utf-8"
+	case EncodingUTF16LE:
+		return "utf-16le"
+	case EncodingUTF16BE:
+		return "utf-16be"
+	}
+	return "unknown"
+}
+
+// FoundString is a string found in memory by FindStrings.
+type FoundString struct {
+	Addr     uintptr
+	Size     int // Size in memory in bytes, without a terminator.
+	Encoding StringEncoding
+	Value    string
+
+	Region Region
+	Module string // Empty if the string isn't inside of a module.
+}
+
+// StringOptions configures FindStrings. The zero value finds strings of all
+// encodings with at least 4 characters in all readable memory.
+type StringOptions struct {
+	ScanOptions
+
+	// MinLength is the minimum length of strings in characters, 4 if zero.
+	MinLength int
+
+	// Encodings limits the encodings searched for. All are searched if nil.
+	// ASCII and UTF-8 are found together, with strings containing only ASCII reported as ASCII.
+	Encodings []StringEncoding
+
+	// NullTerminated only finds strings followed by a null terminator,
+	// which can be read with ReadNullTerminatedUTF8String or ReadNullTerminatedUTF16String.
+	NullTerminated bool
+
+	// Contains and Regexp filter the strings found by their value.
+	Contains string
+	Regexp   *regexp.Regexp
+}
+
+// isTextRune reports whether r is a character allowed in found strings.
+func isTextRune(r rune) bool {
+	return unicode.IsPrint(r) || r == '\t' || r == '\n' || r == '\r'
+}
+
+// isPrintASCII reports whether c is a printable ASCII character.
+func isPrintASCII(c byte) bool {
+	return c >= 0x20 && c < 0x7F
+}
+
+// textRun is a run of text being built up by a scanner.
+type textRun struct {
+	start    uintptr
+	data     []byte
+	chars    int
+	nonASCII bool
+
+	// The number of UTF-16 code units with a low byte of zero, and made of two printable ASCII bytes.
+	lowZero, asciiBytes int
+}
+
+func (r *textRun) add(addr uintptr, b []byte, nonASCII bool) {
+	if len(r.data) == 0 {
+		r.start = addr
+	}
+	r.data = append(r.data, b...)
+	r.chars++
+	r.nonASCII = r.nonASCII || nonASCII
+}
+
+// utf8Scanner finds runs of ASCII and UTF-8 text in a stream of bytes.
+type utf8Scanner struct {
+	run      textRun
+	pend     []byte // An incomplete UTF-8 sequence.
+	pendAddr uintptr
+	emit     func(run *textRun, enc StringEncoding, terminated bool)
+}
+
+func (s *utf8Scanner) feed(addr uintptr, c byte) {
+	if len(s.pend) == 0 {
+		switch {
+		case c < utf8.RuneSelf && isTextRune(rune(c)):
+			s.run.add(addr, []byte{c}, false)
+		case c >= utf8.RuneSelf && utf8.RuneStart(c):
+			s.pend = append(s.pend, c)
+			s.pendAddr = addr
+		default:
+			s.end(c == 0)
+		}
+		if len(s.run.data) >= maxFoundStringSize {
+			s.end(false)
+		}
+		return
+	}
+
+	s.pend = append(s.pend, c)
+	if !utf8.FullRune(s.pend) {
+		return
+	}
+	r, size := utf8.DecodeRune(s.pend)
+	if (r == utf8.RuneError && size == 1) || !isTextRune(r) {
+		// Start again after the first byte of the invalid sequence.
+		rest, restAddr := append([]byte(nil), s.pend[1:]...), s.pendAddr+1
+		s.pend = s.pend[:0]
+		s.end(false)
+		for i, b := range rest {
+			s.feed(restAddr+uintptr(i), b)
+		}
+		return
+	}
+	s.run.add(s.pendAddr, s.pend, true)
+	s.pend = s.pend[:0]
+}
+
+// end ends the current run, which is followed by a null terminator if terminated is set.
+func (s *utf8Scanner) end(terminated bool) {
+	s.pend = s.pend[:0]
+	if s.run.chars > 0 {
+		enc := EncodingASCII
+		if s.run.nonASCII {
+			enc = EncodingUTF8
+		}
+		s.emit(&s.run, enc, terminated)
+	}
+	s.run = textRun{data: s.run.data[:0]}
+}
+
+// isWideTextRune reports whether r is a character allowed in UTF-16 strings.
+// Only common scripts are allowed, as most pairs of bytes decode to some printable character.
+func isWideTextRune(r rune) bool {
+	switch {
+	case r < utf8.RuneSelf:
+		return isTextRune(r)
+	case r >= 0xA0 && r <= 0x17F, // Latin-1 and Latin Extended-A
+		r >= 0x370 && r <= 0x4FF,   // Greek and Cyrillic
+		r >= 0x2000 && r <= 0x206F, // General punctuation
+		r >= 0x3000 && r <= 0x30FF, // CJK punctuation, hiragana and katakana
+		r >= 0x4E00 && r <= 0x9FFF, // CJK ideographs
+		r >= 0xAC00 && r <= 0xD7A3, // Hangul
+		r >= 0xFF00 && r <= 0xFFEF: // Halfwidth and fullwidth forms
+		return unicode.IsPrint(r)
+	}
+	return false
+}
+
+// utf16Scanner finds runs of UTF-16 text at even addresses in a stream of bytes.
+type utf16Scanner struct {
+	order binary.ByteOrder
+	enc   StringEncoding
+	run   textRun
+	unit  [2]byte
+	have  bool // unit holds the first byte of a code unit.
+	emit  func(run *textRun, enc StringEncoding, terminated bool)
+}
+
+func (s *utf16Scanner) feed(addr uintptr, c byte) {
+	if addr%2 == 0 {
+		s.unit[0], s.have = c, true
+		return
+	}
+	if !s.have {
+		return
+	}
+	s.unit[1], s.have = c, false
+
+	u := s.order.Uint16(s.unit[:])
+	if !isWideTextRune(rune(u)) {
+		s.end(u == 0)
+		return
+	}
+	s.run.add(addr-1, s.unit[:], u >= utf8.RuneSelf)
+	if u&0xFF == 0 {
+		s.run.lowZero++
+	}
+	if isPrintASCII(byte(u)) && isPrintASCII(byte(u>>8)) {
+		s.run.asciiBytes++
+	}
+	if len(s.run.data) >= maxFoundStringSize {
+		s.end(false)
+	}
+}
+
+func (s *utf16Scanner) end(terminated bool) {
+	// ASCII text in the other byte order has a low byte of zero for every character,
+	// and ASCII text decodes to characters made of two printable ASCII bytes.
+	// Runs made mostly of either are skipped.
+	if s.run.chars > 0 && s.run.lowZero*2 <= s.run.chars && s.run.asciiBytes*2 <= s.run.chars {
+		s.emit(&s.run, s.enc, terminated)
+	}
+	s.run = textRun{data: s.run.data[:0]}
+}
+
+// reset ends the current run and discards any partial code unit, at a gap in the stream.
+func (s *utf16Scanner) reset() {
+	s.have = false
+	s.end(false)
+}
+
+// FindStrings finds strings in the memory selected by opts, which may be nil.
+// Strings are returned sorted by address.
+func (p *Process) FindStrings(opts *StringOptions) ([]FoundString, error) {
+	if opts == nil {
+		opts = &StringOptions{}
+	}
+	minLength := opts.MinLength
+	if minLength <= 0 {
+		minLength = 4
+	}
+
+	targets, err := p.scanTargets(&opts.ScanOptions)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := p.newLocator()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []FoundString
+	done := false
+	emit := func(run *textRun, enc StringEncoding, terminated bool) {
+		if done || run.chars < minLength || (opts.NullTerminated && !terminated) {
+			return
+		}
+
+		var value string
+		switch enc {
+		case EncodingUTF16LE, EncodingUTF16BE:
+			value = decodeUTF16(run.data, enc == EncodingUTF16BE)
+		default:
+			value = string(run.data)
+		}
+		if opts.Contains != "" && !strings.Contains(value, opts.Contains) {
+			return
+		}
+		if opts.Regexp != nil && !opts.Regexp.MatchString(value) {
+			return
+		}
+
+		s := FoundString{Addr: run.start, Size: len(run.data), Encoding: enc, Value: value}
+		s.Region, s.Module = loc.locate(s.Addr)
+		found = append(found, s)
+		if opts.Limit != 0 && len(found) >= opts.Limit {
+			done = true
+		}
+	}
+
+	// Set up a scanner for each encoding.
+	want := func(enc StringEncoding) bool {
+		if opts.Encodings == nil {
+			return true
+		}
+		for _, e := range opts.Encodings {
+			if e == enc {
+				return true
+			}
+		}
+		return false
+	}
+	var u8 *utf8Scanner
+	if want(EncodingASCII) || want(EncodingUTF8) {
+		u8 = &utf8Scanner{emit: func(run *textRun, enc StringEncoding, terminated bool) {
+			if want(enc) {
+				emit(run, enc, terminated)
+			}
+		}}
+	}
+	var u16 []*utf16Scanner
+	if want(EncodingUTF16LE) {
+		u16 = append(u16, &utf16Scanner{order: binary.LittleEndian, enc: EncodingUTF16LE, emit: emit})
+	}
+	if want(EncodingUTF16BE) {
+		u16 = append(u16, &utf16Scanner{order: binary.BigEndian, enc: EncodingUTF16BE, emit: emit})
+	}
+	endAll := func() {
+		if u8 != nil {
+			u8.end(false)
+		}
+		for _, s := range u16 {
+			s.reset()
+		}
+	}
+
+	var next uintptr
+	p.scanRegions(targets, 0, func(addr uintptr, data []byte) bool {
+		// Strings end at pages which couldn't be read.
+		if addr != next {
+			endAll()
+		}
+		for i, c := range data {
+			a := addr + uintptr(i)
+			if u8 != nil {
+				u8.feed(a, c)
+			}
+			for _, s := range u16 {
+				s.feed(a, c)
+			}
+		}
+		next = addr + uintptr(len(data))
+		return !done
+	})
+	endAll()
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].Addr < found[j].Addr
+	})
+	return found, nil
+}
+
+// decodeUTF16 decodes UTF-16 text in the given byte order.
+func decodeUTF16(b []byte, bigEndian bool) string {
+	var order binary.ByteOrder = binary.LittleEndian
+	if bigEndian {
+		order = binary.BigEndian
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = order.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,117 @@
+package kiwi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+	"unicode/utf16"
+	"unsafe"
+)
+
+// stringScanMarker is found in the test binary's image.
+const stringScanMarker = "kiwi string scan marker"
+
+func TestFindStrings(t *testing.T) {
+	p, err := GetProcessByFileName(currentProcessName)
+	if err != nil {
+		t.Fatalf("Error trying to open process \"%s\", Error: %s\n", currentProcessName, err.Error())
+	}
+
+	tag := fmt.Sprintf("%X", time.Now().UnixNano())
+	ascii := "ascii-" + tag
+	utf8 := "ütf8-ヘルスバー-" + tag
+	wide := "utf16-体力ゲージ-" + tag
+
+	// Build a buffer of strings separated by nulls.
+	var buf []byte
+	type want struct {
+		off   int
+		enc   StringEncoding
+		value string
+	}
+	var wants []want
+	add := func(enc StringEncoding, value string, data []byte) {
+		buf = append(buf, 0, 0)
+		for len(buf)%4 != 0 {
+			buf = append(buf, 0)
+		}
+		wants = append(wants, want{len(buf), enc, value})
+		buf = append(buf, data...)
+	}
+	add(EncodingASCII, ascii, append([]byte(ascii), 0))
+	add(EncodingUTF8, utf8, append([]byte(utf8), 0))
+	for _, enc := range []StringEncoding{EncodingUTF16LE, EncodingUTF16BE} {
+		var order binary.ByteOrder = binary.LittleEndian
+		if enc == EncodingUTF16BE {
+			order = binary.BigEndian
+		}
+		var data []byte
+		for _, u := range append(utf16.Encode([]rune(wide)), 0) {
+			var b [2]byte
+			order.PutUint16(b[:], u)
+			data = append(data, b[:]...)
+		}
+		add(enc, wide, data)
+	}
+	// An unterminated string at the end.
+	add(EncodingASCII, "unterminated", []byte("unterminated"))
+	heapSink = &buf
+	addr := uintptr(unsafe.Pointer(&buf[0]))
+
+	// The bytes of the UTF-16BE string contain "-OSR", which is skipped by the minimum length.
+	found, err := p.FindStrings(&StringOptions{ScanOptions: ScanOptions{Start: addr, End: addr + uintptr(len(buf))}, MinLength: 5})
+	if err != nil {
+		t.Fatalf("FindStrings: %s\n", err)
+	}
+	if len(found) != len(wants) {
+		t.Fatalf("Expected %d strings, got %+v\n", len(wants), found)
+	}
+	for i, w := range wants {
+		f := found[i]
+		if f.Addr != addr+uintptr(w.off) || f.Encoding != w.enc || f.Value != w.value {
+			t.Errorf("String %d got %q (%v) at 0x%X, expected %q (%v) at 0x%X\n", i, f.Value, f.Encoding, f.Addr, w.value, w.enc, addr+uintptr(w.off))
+		}
+		if !f.Region.Contains(f.Addr) {
+			t.Errorf("String %d has region %+v\n", i, f.Region)
+		}
+	}
+
+	// Filters.
+	found, err = p.FindStrings(&StringOptions{
+		ScanOptions:    ScanOptions{Start: addr, End: addr + uintptr(len(buf))},
+		Encodings:      []StringEncoding{EncodingUTF16BE, EncodingASCII},
+		NullTerminated: true,
+		Regexp:         regexp.MustCompile(`^(ascii|utf16)-`),
+	})
+	if err != nil {
+		t.Fatalf("FindStrings: %s\n", err)
+	}
+	if len(found) != 2 || found[0].Value != ascii || found[1].Encoding != EncodingUTF16BE {
+		t.Errorf("Filtered FindStrings got %+v\n", found)
+	}
+
+	// The terminated strings can be read back with the null-terminated readers.
+	s, err := p.ReadNullTerminatedUTF8String(addr + uintptr(wants[1].off))
+	if err != nil || s != utf8 {
+		t.Errorf("ReadNullTerminatedUTF8String got %q, %v\n", s, err)
+	}
+	s, err = p.ReadNullTerminatedUTF16String(addr + uintptr(wants[2].off))
+	if err != nil || s != wide {
+		t.Errorf("ReadNullTerminatedUTF16String got %q, %v\n", s, err)
+	}
+
+	// Strings in the image of a module are attributed to it.
+	// Go packs string literals together, so the marker is part of a longer string.
+	found, err = p.FindStrings(&StringOptions{
+		ScanOptions: ScanOptions{Module: currentProcessName, Limit: 1},
+		Contains:    stringScanMarker,
+	})
+	if err != nil {
+		t.Fatalf("FindStrings: %s\n", err)
+	}
+	if len(found) != 1 || found[0].Module != currentProcessName {
+		t.Errorf("Expected the marker in %s, got %+v\n", currentProcessName, found)
+	}
+}
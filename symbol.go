@@ -0,0 +1,293 @@
+package kiwi
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxForwards is the maximum number of PE export forwards followed when looking up a symbol.
+const maxForwards = 8
+
+// Symbol is an exported symbol of a module.
+type Symbol struct {
+	Name string
+	Addr uintptr
+	Size uintptr // 0 if unknown.
+
+	// Forward is the "MODULE.Symbol" a PE export is forwarded to, in which case Addr is 0.
+	Forward string
+}
+
+// Symbols returns the exported symbols of a module, sorted by address.
+//
+// PE exports are read from the module's image in memory.
+// ELF symbols are read from the module's file on disk.
+func (p *Process) Symbols(moduleName string) ([]Symbol, error) {
+	m, err := p.FindModule(moduleName)
+	if err != nil {
+		return nil, err
+	}
+	return p.moduleSymbols(m)
+}
+
+func (p *Process) moduleSymbols(m Module) ([]Symbol, error) {
+	if sl, ok := p.backend.(SymbolLister); ok {
+		syms, err := sl.Symbols(m)
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(syms, func(i, j int) bool {
+			return syms[i].Addr < syms[j].Addr
+		})
+		return syms, nil
+	}
+
+	magic, err := p.ReadBytes(m.Base, 4)
+	if err != nil {
+		return nil, fmt.Errorf("ReadBytes 0x%X: %w", m.Base, err)
+	}
+
+	var syms []Symbol
+	switch {
+	case bytes.HasPrefix(magic, []byte("MZ")):
+		syms, err = p.peExports(m)
+	case bytes.Equal(magic, []byte(elf.ELFMAG)):
+		syms, err = elfSymbols(m)
+	default:
+		return nil, fmt.Errorf("module %s has an unknown image format", m.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(syms, func(i, j int) bool {
+		return syms[i].Addr < syms[j].Addr
+	})
+	return syms, nil
+}
+
+// LookupSymbol returns the address of an exported symbol of a module, such as ("kernel32.dll", "LoadLibraryA").
+// Forwarded PE exports are followed to the module they're forwarded to.
+func (p *Process) LookupSymbol(moduleName, symbol string) (uintptr, error) {
+	for forwards := 0; forwards < maxForwards; forwards++ {
+		syms, err := p.Symbols(moduleName)
+		if err != nil {
+			return 0, err
+		}
+
+		var found *Symbol
+		for i := range syms {
+			if syms[i].Name == symbol {
+				found = &syms[i]
+				break
+			}
+		}
+		if found == nil {
+			return 0, fmt.Errorf("couldn't find symbol %s in %s", symbol, moduleName)
+		}
+		if found.Forward == "" {
+			return found.Addr, nil
+		}
+
+		// Forwarded exports are given as "MODULE.Symbol".
+		i := strings.LastIndexByte(found.Forward, '.')
+		if i == -1 {
+			return 0, fmt.Errorf("malformed export forward %q", found.Forward)
+		}
+		moduleName, symbol = found.Forward[:i]+".dll", found.Forward[i+1:]
+	}
+	return 0, fmt.Errorf("too many forwards looking up %s!%s", moduleName, symbol)
+}
+
+// SymbolAt returns a symbolic name for addr, such as "libc.so.6!malloc+0x10",
+// or "libc.so.6+0x1234" if it isn't inside of a known symbol. Names which aren't plain
+// identifiers are quoted, so the result can be evaluated as an address expression.
+// Returns false if addr isn't inside of a module, or the module's name contains a quote.
+func (p *Process) SymbolAt(addr uintptr) (string, bool) {
+	return newSymbolizer(p).name(addr)
+}
+
+// symbolizer names addresses, caching modules and symbols between lookups.
+type symbolizer struct {
+	p       *Process
+	modules []Module
+	syms    map[uintptr][]Symbol // By module base.
+}
+
+func newSymbolizer(p *Process) *symbolizer {
+	s := &symbolizer{p: p, syms: make(map[uintptr][]Symbol)}
+	s.modules, _ = p.Modules()
+	return s
+}
+
+func (s *symbolizer) name(addr uintptr) (string, bool) {
+	for _, m := range s.modules {
+		if !m.Contains(addr) {
+			continue
+		}
+
+		syms, ok := s.syms[m.Base]
+		if !ok {
+			syms, _ = s.p.moduleSymbols(m)
+			s.syms[m.Base] = syms
+		}
+
+		// Find the last symbol at or before addr.
+		i := sort.Search(len(syms), func(i int) bool {
+			return syms[i].Addr > addr
+		}) - 1
+		// Names which can't be written in an expression aren't used.
+		mod, ok := exprName(m.Name)
+		if !ok {
+			return "", false
+		}
+		if i >= 0 && (syms[i].Size == 0 || addr-syms[i].Addr < syms[i].Size) && syms[i].Addr != 0 {
+			if sym, ok := exprName(syms[i].Name); ok {
+				if addr == syms[i].Addr {
+					return fmt.Sprintf("%s!%s", mod, sym), true
+				}
+				return fmt.Sprintf("%s!%s+0x%X", mod, sym, addr-syms[i].Addr), true
+			}
+		}
+		return fmt.Sprintf("%s+0x%X", mod, addr-m.Base), true
+	}
+	return "", false
+}
+
+// peExports reads the export directory of the PE image in memory.
+func (p *Process) peExports(m Module) ([]Symbol, error) {
+	le := binary.LittleEndian
+
+	dos, err := p.ReadBytes(m.Base, 0x40)
+	if err != nil {
+		return nil, fmt.Errorf("reading DOS header: %w", err)
+	}
+	ntHeaders := m.Base + uintptr(le.Uint32(dos[0x3C:]))
+
+	// PE signature (4), file header (20) and the start of the optional header.
+	nt, err := p.ReadBytes(ntHeaders, 4+20+0x70+8)
+	if err != nil {
+		return nil, fmt.Errorf("reading NT headers: %w", err)
+	}
+	if string(nt[:4]) != "PE\x00\x00" {
+		return nil, errors.New("invalid PE signature")
+	}
+
+	// The data directories are at a different offset for PE32 and PE32+.
+	opt := nt[24:]
+	var dirs []byte
+	switch le.Uint16(opt) {
+	case 0x10B:
+		dirs = opt[0x60:]
+	case 0x20B:
+		dirs = opt[0x70:]
+	default:
+		return nil, fmt.Errorf("unknown optional header magic 0x%X", le.Uint16(opt))
+	}
+	exportRVA, exportSize := le.Uint32(dirs), le.Uint32(dirs[4:])
+	if exportRVA == 0 {
+		return nil, nil
+	}
+
+	dir, err := p.ReadBytes(m.Base+uintptr(exportRVA), 40)
+	if err != nil {
+		return nil, fmt.Errorf("reading export directory: %w", err)
+	}
+	// The tables are inside of the image, which also bounds their sizes.
+	numFuncs, numNames := le.Uint32(dir[20:]), le.Uint32(dir[24:])
+	if uint64(numFuncs)*4 > uint64(m.Size) || uint64(numNames)*4 > uint64(m.Size) {
+		return nil, fmt.Errorf("export directory has too many entries (%d functions, %d names)", numFuncs, numNames)
+	}
+	funcs, err := p.ReadBytes(m.Base+uintptr(le.Uint32(dir[28:])), int(numFuncs)*4)
+	if err != nil {
+		return nil, fmt.Errorf("reading export functions: %w", err)
+	}
+	names, err := p.ReadBytes(m.Base+uintptr(le.Uint32(dir[32:])), int(numNames)*4)
+	if err != nil {
+		return nil, fmt.Errorf("reading export names: %w", err)
+	}
+	ordinals, err := p.ReadBytes(m.Base+uintptr(le.Uint32(dir[36:])), int(numNames)*2)
+	if err != nil {
+		return nil, fmt.Errorf("reading export ordinals: %w", err)
+	}
+
+	syms := make([]Symbol, 0, numNames)
+	for i := 0; i < int(numNames); i++ {
+		name, err := p.ReadNullTerminatedUTF8String(m.Base + uintptr(le.Uint32(names[i*4:])))
+		if err != nil {
+			continue
+		}
+
+		ordinal := int(le.Uint16(ordinals[i*2:]))
+		if ordinal >= int(numFuncs) {
+			continue
+		}
+		rva := le.Uint32(funcs[ordinal*4:])
+
+		// RVAs inside of the export directory point to a forward string.
+		if rva >= exportRVA && rva < exportRVA+exportSize {
+			forward, err := p.ReadNullTerminatedUTF8String(m.Base + uintptr(rva))
+			if err != nil {
+				continue
+			}
+			syms = append(syms, Symbol{Name: name, Forward: forward})
+			continue
+		}
+		syms = append(syms, Symbol{Name: name, Addr: m.Base + uintptr(rva)})
+	}
+	return syms, nil
+}
+
+// elfSymbols reads the symbols of the ELF file backing the module.
+func elfSymbols(m Module) ([]Symbol, error) {
+	f, err := elf.Open(m.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Prefer the dynamic symbols, which are present even in stripped files.
+	var raw []elf.Symbol
+	if dyn, err := f.DynamicSymbols(); err == nil {
+		raw = append(raw, dyn...)
+	}
+	if static, err := f.Symbols(); err == nil {
+		raw = append(raw, static...)
+	}
+
+	// Executables which aren't position independent use absolute addresses.
+	bias := uintptr(0)
+	if f.Type != elf.ET_EXEC {
+		bias = m.Base - uintptr(elfLoadBias(f))
+	}
+
+	seen := make(map[string]bool)
+	var syms []Symbol
+	for _, s := range raw {
+		if s.Name == "" || s.Section == elf.SHN_UNDEF || s.Value == 0 || seen[s.Name] {
+			continue
+		}
+		if t := elf.ST_TYPE(s.Info); t == elf.STT_SECTION || t == elf.STT_FILE {
+			continue
+		}
+		seen[s.Name] = true
+		syms = append(syms, Symbol{Name: s.Name, Addr: uintptr(s.Value) + bias, Size: uintptr(s.Size)})
+	}
+	return syms, nil
+}
+
+// elfLoadBias returns the page aligned virtual address of the first loadable segment,
+// which is the address the module's base is mapped to.
+func elfLoadBias(f *elf.File) uint64 {
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_LOAD {
+			return prog.Vaddr &^ (pageSize - 1)
+		}
+	}
+	return 0
+}
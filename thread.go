@@ -0,0 +1,52 @@
+package kiwi
+
+import "errors"
+
+// Registers are the general purpose registers of an x86-64 thread,
+// in the order of Linux's user_regs_struct.
+type Registers struct {
+	R15, R14, R13, R12, RBP, RBX, R11, R10 uint64
+	R9, R8, RAX, RCX, RDX, RSI, RDI        uint64
+	OrigRAX                                uint64 // The syscall number, if stopped in a syscall.
+	RIP, CS, EFLAGS, RSP, SS               uint64
+	FSBase, GSBase                         uint64
+	DS, ES, FS, GS                         uint64
+}
+
+// Thread is a thread of a process and its registers.
+type Thread struct {
+	ID   int
+	Regs Registers
+}
+
+// attach stops the process and returns its threads, with the first being the main thread.
+// The process continues when detach is called.
+func (p *Process) attach() (threads []Thread, detach func(), err error) {
+	if p.backend != nil {
+		if tl, ok := p.backend.(ThreadLister); ok {
+			threads, err := tl.Threads()
+			return threads, func() {}, err
+		}
+		return nil, nil, errors.New("threads aren't available for this process")
+	}
+	return p.platformAttach()
+}
+
+// Threads returns the threads of the process and their registers, with the first being the main thread.
+// Live processes are stopped while their registers are read.
+func (p *Process) Threads() ([]Thread, error) {
+	threads, detach, err := p.attach()
+	if err != nil {
+		return nil, err
+	}
+	detach()
+	return threads, nil
+}
+
+// SetRegisters sets the registers of a thread, if the backend supports it.
+func (p *Process) SetRegisters(thread int, regs Registers) error {
+	if rw, ok := p.backend.(RegisterWriter); ok {
+		return rw.SetRegisters(thread, regs)
+	}
+	return errors.New("registers can't be changed for this process")
+}
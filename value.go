@@ -0,0 +1,271 @@
+package kiwi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ValueType is the type of a value in memory.
+type ValueType int
+
+// Value types supported by ReadValue and WriteValue.
+const (
+	TypeInvalid ValueType = iota
+	TypeInt8
+	TypeInt16
+	TypeInt32
+	TypeInt64
+	TypeUint8
+	TypeUint16
+	TypeUint32
+	TypeUint64
+	TypeFloat32
+	TypeFloat64
+	TypeBytes
+)
+
+var valueTypeNames = map[ValueType]string{
+	TypeInt8:    "int8",
+	TypeInt16:   "int16",
+	TypeInt32:   "int32",
+	TypeInt64:   "int64",
+	TypeUint8:   "uint8",
+	TypeUint16:  "uint16",
+	TypeUint32:  "uint32",
+	TypeUint64:  "uint64",
+	TypeFloat32: "float32",
+	TypeFloat64: "float64",
+	TypeBytes:   "bytes",
+}
+
+// String returns the name of the type, as accepted by ParseValueType.
+func (t ValueType) String() string {
+	if name, ok := valueTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("ValueType(%d)", int(t))
+}
+
+// Size returns the size of the type in bytes, or 0 if the type doesn't have a fixed size.
+func (t ValueType) Size() int {
+	switch t {
+	case TypeInt8, TypeUint8:
+		return 1
+	case TypeInt16, TypeUint16:
+		return 2
+	case TypeInt32, TypeUint32, TypeFloat32:
+		return 4
+	case TypeInt64, TypeUint64, TypeFloat64:
+		return 8
+	}
+	return 0
+}
+
+// ParseValueType returns the type with the given name (e.g. "uint32").
+func ParseValueType(name string) (ValueType, error) {
+	for t, n := range valueTypeNames {
+		if strings.EqualFold(n, name) {
+			return t, nil
+		}
+	}
+	return TypeInvalid, fmt.Errorf("unknown value type %q", name)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (t ValueType) MarshalText() ([]byte, error) {
+	if _, ok := valueTypeNames[t]; !ok {
+		return nil, fmt.Errorf("invalid value type %d", int(t))
+	}
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (t *ValueType) UnmarshalText(text []byte) error {
+	v, err := ParseValueType(string(text))
+	if err != nil {
+		return err
+	}
+	*t = v
+	return nil
+}
+
+// ParseValue parses a string as a value of the given type, returning the matching Go type.
+// Integers may be given in any base accepted by strconv.ParseInt (e.g. "0x10"),
+// and bytes as hex separated by optional spaces (e.g. "90 90 90").
+func ParseValue(t ValueType, s string) (interface{}, error) {
+	s = strings.TrimSpace(s)
+	switch t {
+	case TypeInt8, TypeInt16, TypeInt32, TypeInt64:
+		v, err := strconv.ParseInt(s, 0, t.Size()*8)
+		if err != nil {
+			return nil, err
+		}
+		switch t {
+		case TypeInt8:
+			return int8(v), nil
+		case TypeInt16:
+			return int16(v), nil
+		case TypeInt32:
+			return int32(v), nil
+		}
+		return v, nil
+	case TypeUint8, TypeUint16, TypeUint32, TypeUint64:
+		v, err := strconv.ParseUint(s, 0, t.Size()*8)
+		if err != nil {
+			return nil, err
+		}
+		switch t {
+		case TypeUint8:
+			return uint8(v), nil
+		case TypeUint16:
+			return uint16(v), nil
+		case TypeUint32:
+			return uint32(v), nil
+		}
+		return v, nil
+	case TypeFloat32:
+		v, err := strconv.ParseFloat(s, 32)
+		return float32(v), err
+	case TypeFloat64:
+		return strconv.ParseFloat(s, 64)
+	case TypeBytes:
+		return hex.DecodeString(strings.Replace(s, " ", "", -1))
+	}
+	return nil, fmt.Errorf("ParseValue: unsupported value type %v", t)
+}
+
+// FormatValue formats a value of any of the types accepted by WriteValue, in the form accepted by ParseValue.
+func FormatValue(v interface{}) string {
+	if b, ok := v.([]byte); ok {
+		return fmt.Sprintf("% X", b)
+	}
+	return fmt.Sprint(v)
+}
+
+// TypeOf returns the ValueType of a Go value, as accepted by WriteValue.
+func TypeOf(v interface{}) (ValueType, error) {
+	switch v.(type) {
+	case int8:
+		return TypeInt8, nil
+	case int16:
+		return TypeInt16, nil
+	case int32:
+		return TypeInt32, nil
+	case int64:
+		return TypeInt64, nil
+	case uint8:
+		return TypeUint8, nil
+	case uint16:
+		return TypeUint16, nil
+	case uint32:
+		return TypeUint32, nil
+	case uint64:
+		return TypeUint64, nil
+	case float32:
+		return TypeFloat32, nil
+	case float64:
+		return TypeFloat64, nil
+	case []byte:
+		return TypeBytes, nil
+	}
+	return TypeInvalid, fmt.Errorf("unsupported value type %T", v)
+}
+
+// ReadValue reads a value of the given fixed-size type,
+// returning it as the matching Go type (e.g. uint32 for TypeUint32).
+func (p *Process) ReadValue(addr uintptr, t ValueType) (interface{}, error) {
+	switch t {
+	case TypeInt8:
+		return p.ReadInt8(addr)
+	case TypeInt16:
+		return p.ReadInt16(addr)
+	case TypeInt32:
+		return p.ReadInt32(addr)
+	case TypeInt64:
+		return p.ReadInt64(addr)
+	case TypeUint8:
+		return p.ReadUint8(addr)
+	case TypeUint16:
+		return p.ReadUint16(addr)
+	case TypeUint32:
+		return p.ReadUint32(addr)
+	case TypeUint64:
+		return p.ReadUint64(addr)
+	case TypeFloat32:
+		return p.ReadFloat32(addr)
+	case TypeFloat64:
+		return p.ReadFloat64(addr)
+	}
+	return nil, fmt.Errorf("ReadValue: unsupported value type %v", t)
+}
+
+// WriteValue writes a value of any of the Go types returned by ReadValue, or a []byte.
+func (p *Process) WriteValue(addr uintptr, v interface{}) error {
+	switch v := v.(type) {
+	case int8:
+		return p.WriteInt8(addr, v)
+	case int16:
+		return p.WriteInt16(addr, v)
+	case int32:
+		return p.WriteInt32(addr, v)
+	case int64:
+		return p.WriteInt64(addr, v)
+	case uint8:
+		return p.WriteUint8(addr, v)
+	case uint16:
+		return p.WriteUint16(addr, v)
+	case uint32:
+		return p.WriteUint32(addr, v)
+	case uint64:
+		return p.WriteUint64(addr, v)
+	case float32:
+		return p.WriteFloat32(addr, v)
+	case float64:
+		return p.WriteFloat64(addr, v)
+	case []byte:
+		return p.WriteBytes(addr, v)
+	}
+	return fmt.Errorf("WriteValue: unsupported value type %T", v)
+}
+
+// decodeValue decodes a value of the fixed-size type t from b using the process's byte order.
+// b must be at least t.Size() bytes long.
+func (p *Process) decodeValue(b []byte, t ValueType) interface{} {
+	order := p.ByteOrder()
+	switch t {
+	case TypeInt8:
+		return int8(b[0])
+	case TypeInt16:
+		return int16(order.Uint16(b))
+	case TypeInt32:
+		return int32(order.Uint32(b))
+	case TypeInt64:
+		return int64(order.Uint64(b))
+	case TypeUint8:
+		return b[0]
+	case TypeUint16:
+		return order.Uint16(b)
+	case TypeUint32:
+		return order.Uint32(b)
+	case TypeUint64:
+		return order.Uint64(b)
+	case TypeFloat32:
+		return math.Float32frombits(order.Uint32(b))
+	case TypeFloat64:
+		return math.Float64frombits(order.Uint64(b))
+	}
+	return nil
+}
+
+// valuesEqual reports whether two values returned by ReadValue (or a []byte) are equal.
+func valuesEqual(a, b interface{}) bool {
+	if ab, ok := a.([]byte); ok {
+		bb, ok := b.([]byte)
+		return ok && bytes.Equal(ab, bb)
+	}
+	return a == b
+}
@@ -37,3 +37,27 @@ const (
 
 	PROCESS_ALL_ACCESS = STANDARD_RIGHTS_REQUIRED | SYNCHRONIZE | 0xFFFF
 )
+
+const (
+	MEM_COMMIT  = 0x00001000
+	MEM_RESERVE = 0x00002000
+	MEM_FREE    = 0x00010000
+
+	MEM_PRIVATE = 0x00020000
+	MEM_MAPPED  = 0x00040000
+	MEM_IMAGE   = 0x01000000
+)
+
+const (
+	PAGE_NOACCESS          = 0x01
+	PAGE_READONLY          = 0x02
+	PAGE_READWRITE         = 0x04
+	PAGE_WRITECOPY         = 0x08
+	PAGE_EXECUTE           = 0x10
+	PAGE_EXECUTE_READ      = 0x20
+	PAGE_EXECUTE_READWRITE = 0x40
+	PAGE_EXECUTE_WRITECOPY = 0x80
+	PAGE_GUARD             = 0x100
+	PAGE_NOCACHE           = 0x200
+	PAGE_WRITECOMBINE      = 0x400
+)
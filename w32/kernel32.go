@@ -11,12 +11,17 @@ var (
 	// Read / Write mem
 	pReadProcessMemory  = k32.NewProc("ReadProcessMemory")
 	pWriteProcessMemory = k32.NewProc("WriteProcessMemory")
+	pVirtualQueryEx     = k32.NewProc("VirtualQueryEx")
+	pVirtualProtectEx   = k32.NewProc("VirtualProtectEx")
+
+	pFlushInstructionCache = k32.NewProc("FlushInstructionCache")
 
 	// Process enumeration
 	pOpenProcess              = k32.NewProc("OpenProcess")
 	pCreateToolhelp32Snapshot = k32.NewProc("CreateToolhelp32Snapshot")
 	pModule32First            = k32.NewProc("Module32FirstW")
 	pModule32Next             = k32.NewProc("Module32NextW")
+	pIsWow64Process           = k32.NewProc("IsWow64Process")
 
 	// Other
 	pCloseHandle = k32.NewProc("CloseHandle")
@@ -34,6 +39,22 @@ func WriteProcessMemory(hProcess HANDLE, lpBaseAddress, lpBuffer uintptr, nSize
 	return bytesWritten, ret != 0
 }
 
+func VirtualQueryEx(hProcess HANDLE, lpAddress uintptr, lpBuffer *MEMORY_BASIC_INFORMATION) bool {
+	ret, _, _ := pVirtualQueryEx.Call(uintptr(hProcess), lpAddress, uintptr(unsafe.Pointer(lpBuffer)), unsafe.Sizeof(*lpBuffer))
+	return ret != 0
+}
+
+func VirtualProtectEx(hProcess HANDLE, lpAddress, dwSize uintptr, flNewProtect uint32) (uint32, bool) {
+	var oldProtect uint32
+	ret, _, _ := pVirtualProtectEx.Call(uintptr(hProcess), lpAddress, dwSize, uintptr(flNewProtect), uintptr(unsafe.Pointer(&oldProtect)))
+	return oldProtect, ret != 0
+}
+
+func FlushInstructionCache(hProcess HANDLE, lpBaseAddress, dwSize uintptr) bool {
+	ret, _, _ := pFlushInstructionCache.Call(uintptr(hProcess), lpBaseAddress, dwSize)
+	return ret != 0
+}
+
 func OpenProcess(dwDesiredAccess uint32, bInheritHandle bool, processId uint32) (HANDLE, bool) {
 	ret, _, _ := pOpenProcess.Call(uintptr(dwDesiredAccess), uintptr(*(*byte)(unsafe.Pointer(&bInheritHandle))), uintptr(processId))
 	return HANDLE(ret), ret != 0
@@ -45,15 +66,21 @@ func CreateToolhelp32Snapshot(dwFlags uint32, th32ProcessID uint32) (HANDLE, boo
 }
 
 func Module32First(hSnapshot HANDLE, lpme *MODULEENTRY32) bool {
-	ret, _, _ := pModule32First.Call(uintptr(hSnapshot), uintptr(unsafe.Pointer(&lpme)))
+	ret, _, _ := pModule32First.Call(uintptr(hSnapshot), uintptr(unsafe.Pointer(lpme)))
 	return ret == 1
 }
 
 func Module32Next(hSnapshot HANDLE, lpme *MODULEENTRY32) bool {
-	ret, _, _ := pModule32Next.Call(uintptr(hSnapshot), uintptr(unsafe.Pointer(&lpme)))
+	ret, _, _ := pModule32Next.Call(uintptr(hSnapshot), uintptr(unsafe.Pointer(lpme)))
 	return ret == 1
 }
 
+func IsWow64Process(hProcess HANDLE) (bool, bool) {
+	var wow64 int32
+	ret, _, _ := pIsWow64Process.Call(uintptr(hProcess), uintptr(unsafe.Pointer(&wow64)))
+	return wow64 != 0, ret != 0
+}
+
 func CloseHandle(hObject HANDLE) bool {
 	ret, _, _ := pCloseHandle.Call(uintptr(hObject))
 	return ret != 0
@@ -17,3 +17,13 @@ type MODULEENTRY32 struct {
 	SzModule      [MAX_MODULE_NAME32 + 1]uint16
 	SzExePath     [MAX_PATH]uint16
 }
+
+type MEMORY_BASIC_INFORMATION struct {
+	BaseAddress       uintptr
+	AllocationBase    uintptr
+	AllocationProtect uint32
+	RegionSize        uintptr
+	State             uint32
+	Protect           uint32
+	Type              uint32
+}
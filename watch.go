@@ -0,0 +1,132 @@
+package kiwi
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// watchGap is the largest gap between two watched values which are still read together in one read.
+const watchGap = 256
+
+// Change is a change in the value at a watched address.
+type Change struct {
+	Addr uintptr
+	Type ValueType
+	Old  interface{}
+	New  interface{}
+	Time time.Time
+}
+
+// WatchSpec is an address and the type of the value to watch at it.
+type WatchSpec struct {
+	Addr uintptr
+	Type ValueType
+}
+
+// watchSpan is a range of memory read in one go, covering one or more watched values.
+type watchSpan struct {
+	addr  uintptr
+	size  int
+	specs []WatchSpec
+}
+
+// Watch polls the value of type t at addr every interval, sending a Change on the returned channel
+// each time it changes. The channel is closed once ctx is done.
+func (p *Process) Watch(ctx context.Context, addr uintptr, t ValueType, interval time.Duration) (<-chan Change, error) {
+	return p.WatchMany(ctx, []WatchSpec{{Addr: addr, Type: t}}, interval)
+}
+
+// WatchMany polls many values every interval, sending a Change on the returned channel for each
+// value that changes. The channel is closed once ctx is done.
+//
+// Values close together in memory are read together, so each sweep takes as few reads as possible.
+// Values which fail to read keep their last known value until they can be read again.
+func (p *Process) WatchMany(ctx context.Context, specs []WatchSpec, interval time.Duration) (<-chan Change, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("watch interval %v isn't positive", interval)
+	}
+	for _, s := range specs {
+		if s.Type.Size() == 0 {
+			return nil, fmt.Errorf("can't watch 0x%X: unsupported value type %v", s.Addr, s.Type)
+		}
+	}
+	spans := watchSpans(specs)
+
+	ch := make(chan Change)
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// Compare raw bytes rather than values, so NaNs don't always count as changed.
+		type seenValue struct {
+			raw string
+			v   interface{}
+		}
+		last := make(map[WatchSpec]seenValue, len(specs))
+		for {
+			now := time.Now()
+			for _, span := range spans {
+				buf := make([]byte, span.size)
+				n, _ := p.readPartial(span.addr, buf)
+
+				for _, s := range span.specs {
+					off := int(s.Addr - span.addr)
+					if off+s.Type.Size() > n {
+						continue
+					}
+
+					cur := seenValue{raw: string(buf[off : off+s.Type.Size()])}
+					old, seen := last[s]
+					if seen && old.raw == cur.raw {
+						continue
+					}
+					cur.v = p.decodeValue(buf[off:], s.Type)
+					last[s] = cur
+					if !seen {
+						continue
+					}
+
+					select {
+					case ch <- Change{Addr: s.Addr, Type: s.Type, Old: old.v, New: cur.v, Time: now}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// watchSpans groups the specs into spans of nearby memory.
+func watchSpans(specs []WatchSpec) []watchSpan {
+	sorted := append([]WatchSpec(nil), specs...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Addr < sorted[j].Addr
+	})
+
+	var spans []watchSpan
+	for _, s := range sorted {
+		end := s.Addr + uintptr(s.Type.Size())
+		if n := len(spans); n > 0 && s.Addr <= spans[n-1].addr+uintptr(spans[n-1].size)+watchGap {
+			last := &spans[n-1]
+			if size := int(end - last.addr); size > last.size {
+				last.size = size
+			}
+			last.specs = append(last.specs, s)
+			continue
+		}
+		spans = append(spans, watchSpan{addr: s.Addr, size: s.Type.Size(), specs: []WatchSpec{s}})
+	}
+	return spans
+}
@@ -0,0 +1,72 @@
+package kiwi
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestWatch(t *testing.T) {
+	p, err := GetProcessByFileName(currentProcessName)
+	if err != nil {
+		t.Fatalf("Error trying to open process \"%s\", Error: %s\n", currentProcessName, err.Error())
+	}
+
+	var vars [3]uint32
+	specs := []WatchSpec{
+		{Addr: uintptr(unsafe.Pointer(&vars[0])), Type: TypeUint32},
+		{Addr: uintptr(unsafe.Pointer(&vars[2])), Type: TypeUint32},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes, err := p.WatchMany(ctx, specs, time.Millisecond)
+	if err != nil {
+		t.Fatalf("WatchMany: %s\n", err)
+	}
+
+	// Give the watcher a sweep to read the initial values.
+	time.Sleep(20 * time.Millisecond)
+	atomic.StoreUint32(&vars[1], 7) // Not watched.
+	atomic.StoreUint32(&vars[2], 42)
+
+	select {
+	case c := <-changes:
+		if c.Addr != specs[1].Addr || c.Old != uint32(0) || c.New != uint32(42) {
+			t.Fatalf("Unexpected change %+v\n", c)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for change\n")
+	}
+
+	cancel()
+	for range changes {
+	}
+
+	if _, err := p.Watch(context.Background(), 0, TypeBytes, time.Millisecond); err == nil {
+		t.Fatalf("Expected error watching a variable-size type\n")
+	}
+	if _, err := p.Watch(context.Background(), 0, TypeUint32, 0); err == nil {
+		t.Fatalf("Expected error watching with a zero interval\n")
+	}
+}
+
+func TestWatchSpans(t *testing.T) {
+	spans := watchSpans([]WatchSpec{
+		{Addr: 0x2000, Type: TypeUint8},
+		{Addr: 0x1000, Type: TypeUint32},
+		{Addr: 0x1008, Type: TypeFloat64},
+	})
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d\n", len(spans))
+	}
+	if spans[0].addr != 0x1000 || spans[0].size != 0x10 || len(spans[0].specs) != 2 {
+		t.Fatalf("Unexpected first span %+v\n", spans[0])
+	}
+	if spans[1].addr != 0x2000 || spans[1].size != 1 {
+		t.Fatalf("Unexpected second span %+v\n", spans[1])
+	}
+}